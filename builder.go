@@ -17,6 +17,7 @@ package bleve
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/blevesearch/bleve/document"
 	"github.com/blevesearch/bleve/index"
@@ -92,3 +93,52 @@ func newBuilder(path string, mapping mapping.IndexMapping, config map[string]int
 
 	return rv, nil
 }
+
+func mergeBuilds(path string, shardPaths []string, config map[string]interface{}) error {
+	if path == "" {
+		return fmt.Errorf("builder requires path")
+	}
+
+	storePaths := make([]string, 0, len(shardPaths))
+	for _, shardPath := range shardPaths {
+		meta, err := openIndexMeta(shardPath)
+		if err != nil {
+			return fmt.Errorf("error opening shard %s: %v", shardPath, err)
+		}
+		if meta.IndexType != scorch.Name {
+			return fmt.Errorf("shard %s is not a built index", shardPath)
+		}
+		storePaths = append(storePaths, indexStorePath(shardPath))
+	}
+
+	// the mapping is merged from the shards, along with their other
+	// internal values
+	mergeConfig := map[string]interface{}{}
+	for k, v := range config {
+		mergeConfig[k] = v
+	}
+	delete(mergeConfig, "internal")
+
+	// the meta is saved first, so that an existing index isn't merged
+	// into, and removed along with path if it was created here, should
+	// the merge fail
+	_, err := os.Stat(path)
+	created := os.IsNotExist(err)
+	meta := newIndexMeta(scorch.Name, scorch.Name, map[string]interface{}{})
+	err = meta.Save(path)
+	if err != nil {
+		return err
+	}
+
+	mergeConfig["path"] = indexStorePath(path)
+
+	err = scorch.MergeBuilds(mergeConfig, storePaths)
+	if err != nil {
+		if created {
+			_ = os.RemoveAll(path)
+		} else {
+			_ = os.Remove(indexMetaPath(path))
+		}
+	}
+	return err
+}
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -87,3 +89,135 @@ func TestBuilder(t *testing.T) {
 		t.Errorf("expected 10 search hits, got %d", res.Total)
 	}
 }
+
+func TestMergeBuilds(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "bleve-scorch-builder-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = os.RemoveAll(tmpDir)
+		if err != nil {
+			t.Fatalf("error cleaning up test index")
+		}
+	}()
+
+	shardPaths := []string{
+		filepath.Join(tmpDir, "shard0"),
+		filepath.Join(tmpDir, "shard1"),
+	}
+	errs := make([]error, len(shardPaths))
+	var wg sync.WaitGroup
+	for i, shardPath := range shardPaths {
+		wg.Add(1)
+		go func(i int, shardPath string) {
+			defer wg.Done()
+			b, err := NewBuilder(shardPath, NewIndexMapping(), map[string]interface{}{
+				"batchSize": 2,
+				"mergeMax":  2,
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			for j := i; j < 10; j += len(shardPaths) {
+				doc := map[string]interface{}{
+					"name": "hello",
+				}
+				err = b.Index(fmt.Sprintf("%d", j), doc)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+			}
+			errs[i] = b.Close()
+		}(i, shardPath)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(tmpDir, "merged")
+	err = MergeBuilds(path, shardPaths, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Errorf("error closing index: %v", err)
+		}
+	}()
+
+	docCount, err := idx.DocCount()
+	if err != nil {
+		t.Errorf("error checking doc count: %v", err)
+	}
+	if docCount != 10 {
+		t.Errorf("expected doc count to be 10, got %d", docCount)
+	}
+
+	q := NewTermQuery("hello")
+	q.SetField("name")
+	res, err := idx.Search(NewSearchRequest(q))
+	if err != nil {
+		t.Errorf("error searching index: %v", err)
+	}
+	if res.Total != 10 {
+		t.Errorf("expected 10 search hits, got %d", res.Total)
+	}
+}
+
+func TestMergeBuildsError(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "bleve-scorch-builder-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = os.RemoveAll(tmpDir)
+		if err != nil {
+			t.Fatalf("error cleaning up test index")
+		}
+	}()
+
+	// a shard without its build
+	shardPath := filepath.Join(tmpDir, "shard0")
+	meta := newIndexMeta("scorch", "scorch", map[string]interface{}{})
+	err = meta.Save(shardPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tmpDir, "merged")
+	err = MergeBuilds(path, []string{shardPath}, nil)
+	if err == nil {
+		t.Fatalf("expected merging a missing build to fail")
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the failed merge to leave no index, got %v", err)
+	}
+
+	// an existing directory is kept, but not the meta
+	err = os.Mkdir(path, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MergeBuilds(path, []string{shardPath}, nil)
+	if err == nil {
+		t.Fatalf("expected merging a missing build to fail")
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Errorf("expected the existing directory to be kept, got %v", err)
+	}
+	if _, err = os.Stat(indexMetaPath(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the failed merge to leave no meta, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright © 2016 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/blevesearch/bleve"
+	"github.com/spf13/cobra"
+)
+
+var buildWorkers, buildBatchSize, buildMergeMax int
+var buildIDField, buildTempDir string
+
+// buildCmd represents the build command
+var buildCmd = &cobra.Command{
+	Use:   "build [index path] [data paths ...]",
+	Short: "builds a new index offline from newline delimited JSON files",
+	Long: `The build command will build a new index from the documents in one or more newline delimited JSON files.
+Each worker builds a shard of the documents, and the shards are merged into the index when all of them are done.
+Documents are sharded by id, so when several lines have the same id the last of them is indexed.`,
+	Annotations: map[string]string{
+		canMutateBleveIndex: "true",
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// override RootCmd version which opens existing index
+		if len(args) < 2 {
+			return fmt.Errorf("must specify path to index and at least one data path")
+		}
+		if _, err := os.Stat(args[0]); err == nil {
+			return fmt.Errorf("index path %s already exists", args[0])
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mapping, err := buildMapping()
+		if err != nil {
+			return fmt.Errorf("error building mapping: %v", err)
+		}
+		if buildWorkers < 1 {
+			buildWorkers = 1
+		}
+
+		tmpDir, err := ioutil.TempDir(buildTempDir, "bleve-build")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.RemoveAll(tmpDir)
+		}()
+
+		config := map[string]interface{}{
+			"batchSize":       buildBatchSize,
+			"mergeMax":        buildMergeMax,
+			"buildPathPrefix": tmpDir,
+		}
+
+		// documents are sharded by id, so that the same input builds the
+		// same index whatever the number of workers
+		shardPaths := make([]string, buildWorkers)
+		docs := make([]chan buildDoc, buildWorkers)
+		errs := make([]error, buildWorkers)
+		var wg sync.WaitGroup
+		for i := range docs {
+			shardPaths[i] = filepath.Join(tmpDir, "shard"+strconv.Itoa(i))
+			b, err := bleve.NewBuilder(shardPaths[i], mapping, copyConfig(config))
+			if err != nil {
+				return fmt.Errorf("error creating builder: %v", err)
+			}
+			docs[i] = make(chan buildDoc, 100)
+			wg.Add(1)
+			go func(i int, b bleve.Builder) {
+				defer wg.Done()
+				errs[i] = buildShard(b, docs[i])
+			}(i, b)
+		}
+
+		n, err := readBuildLines(args[1:], docs)
+		for _, ch := range docs {
+			close(ch)
+		}
+		wg.Wait()
+		if err != nil {
+			return err
+		}
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("Merging %d docs from %d shards...\n", n, buildWorkers)
+		err = bleve.MergeBuilds(args[0], shardPaths, config)
+		if err != nil {
+			return fmt.Errorf("error merging shards: %v", err)
+		}
+
+		idx, err = bleve.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("error opening built index: %v", err)
+		}
+		// the inheritted Post action will close the index
+		return nil
+	},
+}
+
+type buildDoc struct {
+	id   string
+	line string
+	doc  map[string]interface{}
+}
+
+func copyConfig(config map[string]interface{}) map[string]interface{} {
+	rv := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		rv[k] = v
+	}
+	return rv
+}
+
+// readBuildLines sends the documents of the lines of the files to the
+// workers' channels, returning the number of documents read. Blank lines are
+// skipped. A document is identified by its file and line number, unless it
+// has an id field, and the documents with the same id go to the same worker.
+func readBuildLines(paths []string, docs []chan buildDoc) (int, error) {
+	n := 0
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return n, err
+		}
+		fmt.Printf("Indexing: %s\n", path)
+		r := bufio.NewReader(file)
+		for lineNum := 1; ; lineNum++ {
+			b, err := r.ReadBytes('\n')
+			if len(bytes.TrimSpace(b)) > 0 {
+				doc, parseErr := parseBuildLine(path+":"+strconv.Itoa(lineNum), b)
+				if parseErr != nil {
+					_ = file.Close()
+					return n, parseErr
+				}
+				docs[buildShardFor(doc.id, len(docs))] <- doc
+				n++
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				_ = file.Close()
+				return n, err
+			}
+		}
+		err = file.Close()
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func parseBuildLine(line string, data []byte) (buildDoc, error) {
+	rv := buildDoc{id: line, line: line}
+	err := json.Unmarshal(data, &rv.doc)
+	if err != nil {
+		return rv, fmt.Errorf("error parsing JSON at %s: %v", line, err)
+	}
+	if buildIDField != "" {
+		if v, ok := rv.doc[buildIDField]; ok {
+			switch v := v.(type) {
+			case string:
+				rv.id = v
+			case float64:
+				rv.id = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				return rv, fmt.Errorf("invalid %s at %s: %v", buildIDField, line, v)
+			}
+			if buildIDField == "_id" {
+				// the id is indexed as the _id field already
+				delete(rv.doc, buildIDField)
+			}
+		}
+	}
+	return rv, nil
+}
+
+// buildShardFor returns the shard building the document with the given id.
+func buildShardFor(id string, shards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func buildShard(b bleve.Builder, docs chan buildDoc) error {
+	var err error
+	for doc := range docs {
+		if err != nil {
+			// drain the documents so that the reader isn't blocked
+			continue
+		}
+		err = b.Index(doc.id, doc.doc)
+		if err != nil {
+			err = fmt.Errorf("error indexing %s: %v", doc.line, err)
+		}
+	}
+	closeErr := b.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("error closing builder: %v", closeErr)
+	}
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(buildCmd)
+
+	buildCmd.Flags().StringVarP(&mappingPath, "mapping", "m", "", "Path to a file containing a JSON representation of an index mapping to use.")
+	buildCmd.Flags().IntVarP(&buildWorkers, "workers", "w", runtime.NumCPU(), "Number of workers building shards of the index in parallel.")
+	buildCmd.Flags().IntVarP(&buildBatchSize, "batch", "b", 1000, "Batch size of the segments built.")
+	buildCmd.Flags().IntVar(&buildMergeMax, "merge-max", 10, "Maximum number of segments merged at a time.")
+	buildCmd.Flags().StringVar(&buildIDField, "id-field", "_id", "Field holding a document's id, which is otherwise its file and line number.")
+	buildCmd.Flags().StringVar(&buildTempDir, "tmp", "", "Directory to build the shards in, by default the system's temporary directory.")
+}
@@ -0,0 +1,112 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadBuildLinesSkipsBlankLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bleve-build-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "docs.json")
+	err = ioutil.WriteFile(path, []byte("{\"a\":1}\n\n  \t\n{\"a\":2}\n{\"a\":3}\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := []chan buildDoc{make(chan buildDoc, 10)}
+	n, err := readBuildLines([]string{path}, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 documents, got %d", n)
+	}
+	close(docs[0])
+
+	var ids []string
+	for doc := range docs[0] {
+		ids = append(ids, doc.id)
+	}
+	expected := []string{path + ":1", path + ":4", path + ":5"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected documents %v, got %v", expected, ids)
+	}
+}
+
+func TestReadBuildLinesShardsByID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bleve-build-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "docs.json")
+	err = ioutil.WriteFile(path, []byte(`{"_id":"a","v":1}
+{"_id":"b","v":2}
+{"_id":"a","v":3}
+{"v":4}
+{"_id":"a","v":5}
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 2, 4} {
+		docs := make([]chan buildDoc, workers)
+		for i := range docs {
+			docs[i] = make(chan buildDoc, 10)
+		}
+		n, err := readBuildLines([]string{path}, docs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 5 {
+			t.Errorf("expected 5 documents, got %d", n)
+		}
+
+		shard := buildShardFor("a", workers)
+		for i, ch := range docs {
+			close(ch)
+			var vs []float64
+			for doc := range ch {
+				if doc.id == "a" {
+					if _, ok := doc.doc["_id"]; ok {
+						t.Errorf("expected the _id field to be removed")
+					}
+					vs = append(vs, doc.doc["v"].(float64))
+				}
+			}
+			if i == shard && !reflect.DeepEqual(vs, []float64{1, 3, 5}) {
+				t.Errorf("expected worker %d of %d to get a's lines in order, got %v",
+					i, workers, vs)
+			} else if i != shard && len(vs) > 0 {
+				t.Errorf("expected only worker %d of %d to get a's lines, worker %d got %v",
+					shard, workers, i, vs)
+			}
+		}
+	}
+}
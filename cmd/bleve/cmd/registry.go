@@ -65,6 +65,9 @@ var registryCmd = &cobra.Command{
 
 		types, instances = registry.HighlighterTypesAndInstances()
 		printType("Highlighter", types, instances)
+
+		types, instances = registry.SimilarityTypesAndInstances()
+		printType("Similarity", types, instances)
 	},
 }
 
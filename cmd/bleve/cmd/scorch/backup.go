@@ -0,0 +1,94 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/blevesearch/bleve/index/scorch"
+	"github.com/spf13/cobra"
+)
+
+var backupArchive bool
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup [index path] [backup path]",
+	Short: "backup exports the current snapshot of the index",
+	Long: `The backup command exports the current snapshot of the index to a new directory,
+or with --archive to a tar archive file that the restore command can extract.
+
+The index is opened in shared read-only mode, without locking it, so that an index
+open for writing in another process can be backed up. That process can't know about
+the backup, and may remove segment files before they are linked or copied, in which
+case the backup is retried with its newer snapshot a few times before giving up.
+Setting segmentRemovalGracePeriodMSec in the writer's config avoids this.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("must specify path to scorch index")
+		}
+
+		config := map[string]interface{}{
+			"path":                      args[0],
+			"sharedReadOnly":            true,
+			"sharedRefreshIntervalMSec": -1,
+		}
+		idx, err := scorch.NewScorch(scorch.Name, config, nil)
+		if err != nil {
+			return err
+		}
+
+		err = idx.Open()
+		if err != nil {
+			return fmt.Errorf("error opening: %v", err)
+		}
+
+		index = idx.(*scorch.Scorch)
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("must specify backup path")
+		}
+
+		if !backupArchive {
+			return index.Backup(args[1])
+		}
+
+		f, err := os.OpenFile(args[1], os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		err = index.BackupArchive(f)
+		if err == nil {
+			err = f.Sync()
+		}
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+		if err != nil {
+			_ = os.Remove(args[1])
+		}
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().BoolVar(&backupArchive, "archive", false, "write a tar archive file instead of a directory")
+}
@@ -0,0 +1,136 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/index/scorch"
+	"github.com/blevesearch/bleve/index/scorch/mergeplan"
+	"github.com/spf13/cobra"
+)
+
+var mergePolicyName, mergePolicyOptions string
+var mergeMaxBytesPerSec int64
+
+// mergePolicy returns the policy named by the --policy flag, or nil to
+// use the index's.
+func mergePolicy() (mergeplan.Policy, error) {
+	if mergePolicyName == "" {
+		return nil, nil
+	}
+	var options map[string]interface{}
+	if mergePolicyOptions != "" {
+		err := json.Unmarshal([]byte(mergePolicyOptions), &options)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing policy options: %v", err)
+		}
+	}
+	return mergeplan.NewPolicy(mergePolicyName, options)
+}
+
+// mergePlanCmd represents the mergeplan command
+var mergePlanCmd = &cobra.Command{
+	Use:   "mergeplan [index path]",
+	Short: "mergeplan prints the merge tasks planned for the index",
+	Long:  `The mergeplan command prints the merge tasks a merge policy plans for the index, without running them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := mergePolicy()
+		if err != nil {
+			return err
+		}
+
+		tasks, err := index.PlanMerges(policy)
+		if err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			fmt.Printf("no merge tasks planned\n")
+		}
+		for i, task := range tasks {
+			fmt.Printf("task %d:\n", i)
+			for _, seg := range task.Segments {
+				fmt.Printf("  segment %d %s full size: %d live size: %d\n",
+					seg.ID, seg.File, seg.FullSize, seg.LiveSize)
+			}
+		}
+
+		return nil
+	},
+}
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge [index path]",
+	Short: "merge merges the segments of the index",
+	Long: `The merge command merges the segments of the index, which must not be open elsewhere, as planned by a merge policy, into one segment by default.
+
+There are no commands to pause or resume the merger, as it only runs in the process
+which has the index open, where Scorch's PauseMerger, ResumeMerger and SetMergeBandwidth
+control it. The --max-bytes-per-sec flag limits the bandwidth of this command's merges.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("must specify path to scorch index")
+		}
+
+		config := map[string]interface{}{
+			"path":                      args[0],
+			"scorchMergeMaxBytesPerSec": int(mergeMaxBytesPerSec),
+		}
+		idx, err := scorch.NewScorch(scorch.Name, config, nil)
+		if err != nil {
+			return err
+		}
+
+		err = idx.Open()
+		if err != nil {
+			return fmt.Errorf("error opening: %v", err)
+		}
+
+		index = idx.(*scorch.Scorch)
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := mergePolicy()
+		if err != nil {
+			_ = index.Close()
+			return err
+		}
+
+		if policy == nil {
+			err = index.ForceMerge(context.Background(), nil)
+		} else {
+			err = index.ForceMergeWithPolicy(context.Background(), policy)
+		}
+		err2 := index.Close()
+		if err == nil {
+			err = err2
+		}
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(mergePlanCmd)
+	RootCmd.AddCommand(mergeCmd)
+	for _, c := range []*cobra.Command{mergePlanCmd, mergeCmd} {
+		c.Flags().StringVar(&mergePolicyName, "policy", "", "name of the merge policy, such as tiered or deletes")
+		c.Flags().StringVar(&mergePolicyOptions, "options", "", "JSON options of the merge policy")
+	}
+	mergeCmd.Flags().Int64Var(&mergeMaxBytesPerSec, "max-bytes-per-sec", 0, "limit the rate merged segments are written at")
+}
@@ -0,0 +1,61 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blevesearch/bleve/index/scorch"
+	"github.com/spf13/cobra"
+)
+
+var rewrite scorch.SegmentRewrite
+
+// rewriteProgress prints the bytes written by the rewrite.
+type rewriteProgress struct {
+	bytes uint64
+}
+
+func (p *rewriteProgress) ReportBytesWritten(bytesWritten uint64) {
+	p.bytes += bytesWritten
+	fmt.Printf("rewritten %d bytes\n", p.bytes)
+}
+
+// rewriteCmd represents the rewrite command
+var rewriteCmd = &cobra.Command{
+	Use:               "rewrite [index path]",
+	Short:             "rewrite rewrites the segments of the index, transforming their fields",
+	Long:              `The rewrite command rewrites the segments of the index, which must not be open elsewhere, dropping fields, their stored values, term vectors or doc values, or adding doc values, without reindexing.`,
+	PersistentPreRunE: mergeCmd.PersistentPreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := index.RewriteSegments(context.Background(), &rewrite,
+			&rewriteProgress{})
+		err2 := index.Close()
+		if err == nil {
+			err = err2
+		}
+		return err
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rewriteCmd)
+	rewriteCmd.Flags().StringSliceVar(&rewrite.DropFields, "drop-fields", nil, "fields to drop")
+	rewriteCmd.Flags().StringSliceVar(&rewrite.DropStoredFields, "drop-stored", nil, "fields to drop the stored values of")
+	rewriteCmd.Flags().StringSliceVar(&rewrite.DropTermVectors, "drop-term-vectors", nil, "fields to drop the term vectors of")
+	rewriteCmd.Flags().StringSliceVar(&rewrite.AddDocValues, "add-doc-values", nil, "fields to add doc values to")
+	rewriteCmd.Flags().StringSliceVar(&rewrite.DropDocValues, "drop-doc-values", nil, "fields to drop the doc values of")
+}
@@ -93,11 +93,15 @@ func (b *BooleanField) NumPlainTextBytes() uint64 {
 }
 
 func NewBooleanFieldFromBytes(name string, arrayPositions []uint64, value []byte) *BooleanField {
+	return NewBooleanFieldFromBytesWithIndexingOptions(name, arrayPositions, value, DefaultNumericIndexingOptions)
+}
+
+func NewBooleanFieldFromBytesWithIndexingOptions(name string, arrayPositions []uint64, value []byte, options IndexingOptions) *BooleanField {
 	return &BooleanField{
 		name:              name,
 		arrayPositions:    arrayPositions,
 		value:             value,
-		options:           DefaultNumericIndexingOptions,
+		options:           options,
 		numPlainTextBytes: uint64(len(value)),
 	}
 }
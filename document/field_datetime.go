@@ -121,11 +121,15 @@ func (n *DateTimeField) NumPlainTextBytes() uint64 {
 }
 
 func NewDateTimeFieldFromBytes(name string, arrayPositions []uint64, value []byte) *DateTimeField {
+	return NewDateTimeFieldFromBytesWithIndexingOptions(name, arrayPositions, value, DefaultDateTimeIndexingOptions)
+}
+
+func NewDateTimeFieldFromBytesWithIndexingOptions(name string, arrayPositions []uint64, value []byte, options IndexingOptions) *DateTimeField {
 	return &DateTimeField{
 		name:              name,
 		arrayPositions:    arrayPositions,
 		value:             value,
-		options:           DefaultDateTimeIndexingOptions,
+		options:           options,
 		numPlainTextBytes: uint64(len(value)),
 	}
 }
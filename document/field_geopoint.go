@@ -124,11 +124,15 @@ func (n *GeoPointField) NumPlainTextBytes() uint64 {
 }
 
 func NewGeoPointFieldFromBytes(name string, arrayPositions []uint64, value []byte) *GeoPointField {
+	return NewGeoPointFieldFromBytesWithIndexingOptions(name, arrayPositions, value, DefaultNumericIndexingOptions)
+}
+
+func NewGeoPointFieldFromBytesWithIndexingOptions(name string, arrayPositions []uint64, value []byte, options IndexingOptions) *GeoPointField {
 	return &GeoPointField{
 		name:              name,
 		arrayPositions:    arrayPositions,
 		value:             value,
-		options:           DefaultNumericIndexingOptions,
+		options:           options,
 		numPlainTextBytes: uint64(len(value)),
 	}
 }
@@ -117,11 +117,15 @@ func (n *NumericField) NumPlainTextBytes() uint64 {
 }
 
 func NewNumericFieldFromBytes(name string, arrayPositions []uint64, value []byte) *NumericField {
+	return NewNumericFieldFromBytesWithIndexingOptions(name, arrayPositions, value, DefaultNumericIndexingOptions)
+}
+
+func NewNumericFieldFromBytesWithIndexingOptions(name string, arrayPositions []uint64, value []byte, options IndexingOptions) *NumericField {
 	return &NumericField{
 		name:              name,
 		arrayPositions:    arrayPositions,
 		value:             value,
-		options:           DefaultNumericIndexingOptions,
+		options:           options,
 		numPlainTextBytes: uint64(len(value)),
 	}
 }
@@ -23,6 +23,9 @@ import (
 type DeleteIndexHandler struct {
 	basePath        string
 	IndexNameLookup varLookupFunc
+	// RemoveIndex, if set, is used instead of os.RemoveAll to remove the
+	// index at path, for indexes that keep data outside of their directory
+	RemoveIndex func(path string) error
 }
 
 func NewDeleteIndexHandler(basePath string) *DeleteIndexHandler {
@@ -56,7 +59,11 @@ func (h *DeleteIndexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 	}
 
 	// now delete it
-	err = os.RemoveAll(h.indexPath(indexName))
+	removeIndex := os.RemoveAll
+	if h.RemoveIndex != nil {
+		removeIndex = h.RemoveIndex
+	}
+	err = removeIndex(h.indexPath(indexName))
 	if err != nil {
 		showError(w, req, fmt.Sprintf("error deleting index: %v", err), 500)
 		return
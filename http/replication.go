@@ -0,0 +1,218 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/blevesearch/bleve/index/scorch"
+)
+
+// scorchIndexByName returns the scorch index registered under the name,
+// or reports why there isn't one.
+func scorchIndexByName(w http.ResponseWriter, req *http.Request,
+	indexName string) *scorch.Scorch {
+	index := IndexByName(indexName)
+	if index == nil {
+		showError(w, req, fmt.Sprintf("no such index '%s'", indexName), 404)
+		return nil
+	}
+	internalIndex, _, err := index.Advanced()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error getting index: %v", err), 500)
+		return nil
+	}
+	s, ok := internalIndex.(*scorch.Scorch)
+	if !ok {
+		showError(w, req, fmt.Sprintf("index '%s' is not a scorch index", indexName), 400)
+		return nil
+	}
+	return s
+}
+
+// ReplicationManifestHandler serves the manifest of a scorch index's
+// latest persisted snapshot, for its followers.
+type ReplicationManifestHandler struct {
+	defaultIndexName string
+	IndexNameLookup  varLookupFunc
+}
+
+func NewReplicationManifestHandler(defaultIndexName string) *ReplicationManifestHandler {
+	return &ReplicationManifestHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *ReplicationManifestHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// find the index to operate on
+	var indexName string
+	if h.IndexNameLookup != nil {
+		indexName = h.IndexNameLookup(req)
+	}
+	if indexName == "" {
+		indexName = h.defaultIndexName
+	}
+	s := scorchIndexByName(w, req, indexName)
+	if s == nil {
+		return
+	}
+
+	manifest, err := s.ReplicationManifest()
+	if err != nil {
+		showError(w, req, fmt.Sprintf("error getting manifest: %v", err), 500)
+		return
+	}
+	mustEncode(w, manifest)
+}
+
+// ReplicationSegmentHandler serves the contents of a segment file of a
+// scorch index, for its followers.
+type ReplicationSegmentHandler struct {
+	defaultIndexName  string
+	IndexNameLookup   varLookupFunc
+	SegmentNameLookup varLookupFunc
+}
+
+func NewReplicationSegmentHandler(defaultIndexName string) *ReplicationSegmentHandler {
+	return &ReplicationSegmentHandler{
+		defaultIndexName: defaultIndexName,
+	}
+}
+
+func (h *ReplicationSegmentHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// find the index to operate on
+	var indexName string
+	if h.IndexNameLookup != nil {
+		indexName = h.IndexNameLookup(req)
+	}
+	if indexName == "" {
+		indexName = h.defaultIndexName
+	}
+	s := scorchIndexByName(w, req, indexName)
+	if s == nil {
+		return
+	}
+
+	// find the segment name
+	var segmentName string
+	if h.SegmentNameLookup != nil {
+		segmentName = h.SegmentNameLookup(req)
+	}
+	if segmentName == "" {
+		showError(w, req, "segment name cannot be empty", 400)
+		return
+	}
+
+	sw := &segmentWriter{w: w}
+	err := s.ReadSegmentFile(segmentName, sw)
+	if err != nil {
+		if !sw.started {
+			showError(w, req, fmt.Sprintf("error reading segment '%s': %v", segmentName, err), 404)
+			return
+		}
+		// The response can't be changed anymore, but the follower checks
+		// the size of the segment it read.
+		logger.Printf("error writing segment '%s': %v", segmentName, err)
+	}
+}
+
+// segmentWriter sets the content type of the response when the segment
+// starts to be written, so that errors opening the segment can still be
+// reported.
+type segmentWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	if !s.started {
+		s.w.Header().Set("Content-type", "application/octet-stream")
+		s.started = true
+	}
+	return s.w.Write(p)
+}
+
+// HTTPReplicationSource is a scorch.ReplicationSource that reads from a
+// leader served by a ReplicationManifestHandler and a
+// ReplicationSegmentHandler.
+type HTTPReplicationSource struct {
+	// ManifestURL is the URL of the manifest handler.
+	ManifestURL string
+	// SegmentURLPrefix is the URL of the segment handler, without the
+	// segment name, which is escaped and appended to it.
+	SegmentURLPrefix string
+	// Client is the client used for the requests, http.DefaultClient if
+	// it's nil.
+	Client *http.Client
+}
+
+func NewHTTPReplicationSource(manifestURL, segmentURLPrefix string) *HTTPReplicationSource {
+	return &HTTPReplicationSource{
+		ManifestURL:      manifestURL,
+		SegmentURLPrefix: segmentURLPrefix,
+	}
+}
+
+func (h *HTTPReplicationSource) get(u string) (*http.Response, error) {
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s: %s", u, resp.Status, msg)
+	}
+	return resp, nil
+}
+
+func (h *HTTPReplicationSource) Manifest() (*scorch.ReplicationManifest, error) {
+	resp, err := h.get(h.ManifestURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var rv scorch.ReplicationManifest
+	err = json.NewDecoder(resp.Body).Decode(&rv)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %v", err)
+	}
+	return &rv, nil
+}
+
+func (h *HTTPReplicationSource) ReadSegment(name string, w io.Writer) error {
+	resp, err := h.get(h.SegmentURLPrefix + url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+var _ scorch.ReplicationSource = (*HTTPReplicationSource)(nil)
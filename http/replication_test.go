@@ -0,0 +1,120 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/scorch"
+)
+
+func TestReplicationHandlers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bleve-http-replication")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	leader, err := bleve.NewUsing(dir+"/leader", bleve.NewIndexMapping(),
+		scorch.Name, scorch.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := leader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	RegisterIndexName("leader", leader)
+	defer UnregisterIndexByName("leader")
+
+	for _, id := range []string{"a", "b", "c"} {
+		err = leader.Index(id, map[string]interface{}{"name": id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifestHandler := NewReplicationManifestHandler("leader")
+	segmentHandler := NewReplicationSegmentHandler("leader")
+	segmentHandler.SegmentNameLookup = func(req *http.Request) string {
+		return strings.TrimPrefix(req.URL.Path, "/segment/")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/manifest", manifestHandler)
+	mux.Handle("/segment/", segmentHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	src := NewHTTPReplicationSource(server.URL+"/manifest", server.URL+"/segment/")
+
+	err = src.ReadSegment("missing.zap", ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected error reading a missing segment")
+	}
+
+	replica, err := scorch.NewScorch(scorch.Name, map[string]interface{}{
+		"path":    dir + "/replica",
+		"replica": true,
+	}, index.NewAnalysisQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = replica.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := replica.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	_, err = replica.(*scorch.Scorch).Replicate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := replica.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	count, err := reader.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 documents, got %d", count)
+	}
+}
@@ -307,3 +307,12 @@ type Builder interface {
 func NewBuilder(path string, mapping mapping.IndexMapping, config map[string]interface{}) (Builder, error) {
 	return newBuilder(path, mapping, config)
 }
+
+// MergeBuilds merges the indexes built by Builders at the shard paths into
+// a single index at the specified path, using the specified options, as for
+// NewBuilder. The Builders may have run in parallel, each indexing a shard of
+// the documents with the same mapping. If a document id was indexed in several
+// shards, the document of the last of them is kept.
+func MergeBuilds(path string, shardPaths []string, config map[string]interface{}) error {
+	return mergeBuilds(path, shardPaths, config)
+}
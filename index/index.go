@@ -125,6 +125,29 @@ type IndexReaderContains interface {
 	FieldDictContains(field string) (FieldDictContains, error)
 }
 
+// FieldStats contains the collection statistics of a single field, as
+// needed by length normalizing similarities such as BM25.
+type FieldStats struct {
+	// Docs is the number of documents with at least one term in the field
+	Docs uint64
+	// TotalTerms is the sum of the term frequencies of all the terms in
+	// the field, across all documents
+	TotalTerms uint64
+}
+
+// AvgFieldLength returns the average number of terms in the field, over
+// the documents which have the field, or 0 if there are none.
+func (fs FieldStats) AvgFieldLength() float64 {
+	if fs.Docs == 0 {
+		return 0
+	}
+	return float64(fs.TotalTerms) / float64(fs.Docs)
+}
+
+type IndexReaderFieldStats interface {
+	FieldStats(field string) (FieldStats, error)
+}
+
 // FieldTerms contains the terms used by a document, keyed by field
 type FieldTerms map[string][]string
 
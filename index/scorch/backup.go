@@ -0,0 +1,315 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Backup exports the index's current snapshot to dir, which must be
+// empty or not exist, as an index that can be opened on its own. It
+// holds a reference on the snapshot, and keeps its segment files from
+// being removed, so the index can keep being written to meanwhile.
+//
+// The snapshot's segment files are hard linked into dir where possible,
+// and copied otherwise. Segments that haven't been persisted yet are
+// written to dir, and dir's root.bolt only holds the snapshot.
+//
+// A shared read-only index can't keep the writer from removing segment
+// files, so when one has gone before it could be linked or copied, the
+// index is refreshed and the backup retried with the newer snapshot, up
+// to backupSharedRetries times.
+func (s *Scorch) Backup(dir string) error {
+	err := prepareBackupDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		err = s.backupSnapshot(dir)
+		if !s.shared || !os.IsNotExist(err) || i >= backupSharedRetries {
+			break
+		}
+		err = clearBackupDir(dir)
+		if err != nil {
+			return err
+		}
+		_, err = s.Refresh()
+		if err != nil {
+			return err
+		}
+	}
+	if os.IsNotExist(err) {
+		return fmt.Errorf("error backing up segment: %v", err)
+	}
+	return err
+}
+
+// backupSharedRetries is how many times Backup retries a shared
+// read-only index whose segment files were removed by the writer.
+var backupSharedRetries = 10
+
+// backupSnapshot writes the root to dir, returning the os.PathError of
+// a segment file which no longer exists as is.
+func (s *Scorch) backupSnapshot(dir string) error {
+	snapshot, filenames := s.acquireBackupSnapshot()
+	defer s.releaseBackupSnapshot(snapshot, filenames)
+
+	for _, segmentSnapshot := range snapshot.segment {
+		if seg, ok := segmentSnapshot.segment.(segment.PersistedSegment); ok {
+			err := linkOrCopyFile(seg.Path(),
+				dir+string(os.PathSeparator)+segmentFileName(seg))
+			if os.IsNotExist(err) {
+				return err
+			}
+			if err != nil {
+				return fmt.Errorf("error backing up segment: %v", err)
+			}
+		}
+	}
+
+	rootBolt, err := bolt.Open(dir+string(os.PathSeparator)+rootBoltName, 0600, nil)
+	if err != nil {
+		return err
+	}
+	err = rootBolt.Update(func(tx *bolt.Tx) error {
+		_, _, err := prepareBoltSnapshot(snapshot, tx, NewLocalDirectory(dir), s.segPlugin)
+		return err
+	})
+	if err != nil {
+		_ = rootBolt.Close()
+		return fmt.Errorf("error backing up root.bolt: %v", err)
+	}
+	return rootBolt.Close()
+}
+
+// BackupArchive writes the index's current snapshot to w, as a tar
+// archive of the files Backup would export, which Restore can extract.
+func (s *Scorch) BackupArchive(w io.Writer) error {
+	dir, err := ioutil.TempDir("", "scorch-backup")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	err = s.Backup(dir)
+	if err != nil {
+		return err
+	}
+
+	finfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	for _, finfo := range finfos {
+		err = writeTarFile(tw, dir, finfo)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// acquireBackupSnapshot returns the root with a reference held on it, and
+// the names of its segment files, which are kept from being removed
+// until releaseBackupSnapshot is called.
+func (s *Scorch) acquireBackupSnapshot() (*IndexSnapshot, []string) {
+	s.rootLock.Lock()
+	defer s.rootLock.Unlock()
+	snapshot := s.root
+	snapshot.AddRef()
+	var filenames []string
+	for _, segmentSnapshot := range snapshot.segment {
+		if seg, ok := segmentSnapshot.segment.(segment.PersistedSegment); ok {
+			filename := segmentFileName(seg)
+			s.filesInUse[filename]++
+			filenames = append(filenames, filename)
+		}
+	}
+	return snapshot, filenames
+}
+
+func (s *Scorch) releaseBackupSnapshot(snapshot *IndexSnapshot, filenames []string) {
+	s.unmarkFilesInUse(filenames)
+	_ = snapshot.DecRef()
+}
+
+// prepareBackupDir creates dir, unless it exists and is empty.
+func prepareBackupDir(dir string) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	finfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(finfos) > 0 {
+		return fmt.Errorf("backup directory %s is not empty", dir)
+	}
+	return nil
+}
+
+// clearBackupDir removes what a failed attempt left in dir.
+func clearBackupDir(dir string) error {
+	finfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, finfo := range finfos {
+		err = os.RemoveAll(filepath.Join(dir, finfo.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func linkOrCopyFile(src, dst string) error {
+	if os.Link(src, dst) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	err2 := out.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+func writeTarFile(tw *tar.Writer, dir string, finfo os.FileInfo) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    finfo.Name(),
+		Mode:    0600,
+		Size:    finfo.Size(),
+		ModTime: finfo.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(dir + string(os.PathSeparator) + finfo.Name())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Restore extracts an archive written by BackupArchive into a new index
+// at path, which must be empty or not exist. The files are extracted
+// next to path first, and moved into place once they all are.
+func Restore(r io.Reader, path string) (err error) {
+	if len(path) == 0 {
+		return fmt.Errorf("Restore: index path is empty")
+	}
+	finfos, err := ioutil.ReadDir(path)
+	if err == nil && len(finfos) > 0 {
+		return fmt.Errorf("Restore: index path %s is not empty", path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	path = filepath.Clean(path)
+	tmpDir, err := ioutil.TempDir(filepath.Dir(path), filepath.Base(path)+".restore")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(tmpDir)
+		}
+	}()
+
+	var foundRootBolt bool
+	tr := tar.NewReader(r)
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Restore: error reading archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg ||
+			(hdr.Name != rootBoltName && filepath.Ext(hdr.Name) != ".zap") ||
+			hdr.Name != filepath.Base(hdr.Name) {
+			return fmt.Errorf("Restore: unexpected file in archive: %s", hdr.Name)
+		}
+		foundRootBolt = foundRootBolt || hdr.Name == rootBoltName
+		err = extractTarFile(tr, tmpDir+string(os.PathSeparator)+hdr.Name, hdr.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+	if !foundRootBolt {
+		return fmt.Errorf("Restore: archive has no %s", rootBoltName)
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(tmpDir, path)
+}
+
+func extractTarFile(r io.Reader, path string, modTime time.Time) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Chtimes(path, modTime, modTime)
+	}
+	return err
+}
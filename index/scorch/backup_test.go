@@ -0,0 +1,279 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/index"
+)
+
+func openTestIndex(t *testing.T, cfg map[string]interface{}) index.Index {
+	idx, err := NewScorch(Name, cfg, index.NewAnalysisQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestBackup(t *testing.T) {
+	cfg := CreateConfig("TestBackup")
+	cfg["unsafe_batch"] = true
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	backupCfg := CreateConfig("TestBackup-backup")
+	err = InitTest(backupCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(backupCfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	updateDocs(t, idx, "a", "b")
+	updateDocs(t, idx, "c")
+
+	err = idx.(*Scorch).Backup(backupCfg["path"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.(*Scorch).filesInUse) != 0 {
+		t.Errorf("expected no files in use after backup, got %v", idx.(*Scorch).filesInUse)
+	}
+
+	// Changes after the backup aren't in it.
+	updateDocs(t, idx, "d", "e")
+
+	err = idx.(*Scorch).Backup(backupCfg["path"].(string))
+	if err == nil {
+		t.Errorf("expected backup to a non-empty directory to fail")
+	}
+
+	backup := openTestIndex(t, backupCfg)
+	checkDocCount(t, backup, 3)
+	err = backup.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDocCount(t, idx, 5)
+}
+
+func TestBackupSharedSegmentsRemoved(t *testing.T) {
+	cfg := CreateConfig("TestBackupSharedSegmentsRemoved")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	backupCfg := CreateConfig("TestBackupSharedSegmentsRemoved-backup")
+	err = InitTest(backupCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(backupCfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	writer := openTestIndex(t, cfg)
+	defer func() {
+		err := writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	updateDocs(t, writer, "a", "b")
+	updateDocs(t, writer, "c")
+
+	reader := openTestIndex(t, map[string]interface{}{
+		"path":                      cfg["path"],
+		"sharedReadOnly":            true,
+		"sharedRefreshIntervalMSec": -1,
+	})
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// The writer removes the segment files of the reader's snapshot, the
+	// new doc makes sure there's a merge even if the writer's background
+	// merges already left a single segment.
+	before := zapFileNames(t, cfg["path"].(string))
+	updateDocs(t, writer, "d")
+	err = writer.(*Scorch).ForceMerge(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		removed := true
+		for name := range zapFileNames(t, cfg["path"].(string)) {
+			if _, ok := before[name]; ok {
+				removed = false
+			}
+		}
+		if removed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the merged segment files to be removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+		writer.(*Scorch).removeOldData()
+	}
+
+	err = reader.(*Scorch).Backup(backupCfg["path"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backup is of the refreshed snapshot.
+	backup := openTestIndex(t, backupCfg)
+	checkDocCount(t, backup, 4)
+	err = backup.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupArchiveRestore(t *testing.T) {
+	cfg := CreateConfig("TestBackupArchiveRestore")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	restoreCfg := CreateConfig("TestBackupArchiveRestore-restore")
+	err = InitTest(restoreCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(restoreCfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	updateDocs(t, idx, "a", "b", "c")
+	updateDocs(t, idx, "d")
+
+	var buf bytes.Buffer
+	err = idx.(*Scorch).BackupArchive(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Restore(bytes.NewReader(buf.Bytes()), restoreCfg["path"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Restore(bytes.NewReader(buf.Bytes()), restoreCfg["path"].(string))
+	if err == nil {
+		t.Errorf("expected restore to a non-empty directory to fail")
+	}
+
+	restored := openTestIndex(t, restoreCfg)
+	checkDocCount(t, restored, 4)
+	err = restored.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreUnexpectedFile(t *testing.T) {
+	cfg := CreateConfig("TestRestoreUnexpectedFile")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	for _, name := range []string{"../root.bolt", "other.txt"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte("x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Restore(&buf, cfg["path"].(string))
+		if err == nil {
+			t.Errorf("expected restore of %s to fail", name)
+		}
+		if _, err := os.Stat(cfg["path"].(string)); !os.IsNotExist(err) {
+			t.Errorf("expected no index after failed restore of %s", name)
+		}
+	}
+}
@@ -24,7 +24,6 @@ import (
 	"github.com/blevesearch/bleve/document"
 	"github.com/blevesearch/bleve/index"
 	"github.com/blevesearch/bleve/index/scorch/segment"
-	bolt "go.etcd.io/bbolt"
 )
 
 const DefaultBuilderBatchSize = 1000
@@ -33,7 +32,7 @@ const DefaultBuilderMergeMax = 10
 type Builder struct {
 	m         sync.Mutex
 	segCount  uint64
-	path      string
+	dir       Directory
 	buildPath string
 	segPaths  []string
 	batchSize int
@@ -49,6 +48,11 @@ func NewBuilder(config map[string]interface{}) (*Builder, error) {
 		return nil, fmt.Errorf("must specify path")
 	}
 
+	dir, err := openDirectory(config, path)
+	if err != nil {
+		return nil, err
+	}
+
 	buildPathPrefix, _ := config["buildPathPrefix"].(string)
 	buildPath, err := ioutil.TempDir(buildPathPrefix, "scorch-offline-build")
 	if err != nil {
@@ -56,7 +60,7 @@ func NewBuilder(config map[string]interface{}) (*Builder, error) {
 	}
 
 	rv := &Builder{
-		path:      path,
+		dir:       dir,
 		buildPath: buildPath,
 		mergeMax:  DefaultBuilderMergeMax,
 		batchSize: DefaultBuilderBatchSize,
@@ -116,7 +120,8 @@ func (o *Builder) parseConfig(config map[string]interface{}) (err error) {
 }
 
 // Index will place the document into the index.
-// It is invalid to index the same document multiple times.
+// It is invalid to index the same document multiple times, unless the
+// build is then merged by MergeBuilds, which keeps only the last of them.
 func (o *Builder) Index(doc *document.Document) error {
 	o.m.Lock()
 	defer o.m.Unlock()
@@ -169,18 +174,37 @@ func (o *Builder) executeBatchLOCKED(batch *index.Batch) (err error) {
 }
 
 func (o *Builder) doMerge() error {
-	// as long as we have more than 1 segment, keep merging
+	// as long as we have more than 1 segment, keep merging, in passes
+	// which keep the segments in order so that the documents are too
 	for len(o.segPaths) > 1 {
+		var err error
+		o.segPaths, err = o.doMergePass(o.segPaths)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// doMergePass merges each run of <mergeMax> segments into one new one,
+// returning the paths of the resulting segments in order.
+func (o *Builder) doMergePass(segPaths []string) ([]string, error) {
+	var rv []string
+	for len(segPaths) > 0 {
 		// merge the next <mergeMax> number of segments into one new one
 		// or, if there are fewer than <mergeMax> remaining, merge them all
 		mergeCount := o.mergeMax
-		if mergeCount > len(o.segPaths) {
-			mergeCount = len(o.segPaths)
+		if mergeCount > len(segPaths) {
+			mergeCount = len(segPaths)
 		}
 
-		mergePaths := o.segPaths[0:mergeCount]
-		o.segPaths = o.segPaths[mergeCount:]
+		mergePaths := segPaths[0:mergeCount]
+		segPaths = segPaths[mergeCount:]
+		if mergeCount == 1 {
+			rv = append(rv, mergePaths[0])
+			continue
+		}
 
 		// open each of the segments to be merged
 		mergeSegs := make([]segment.Segment, 0, mergeCount)
@@ -203,7 +227,7 @@ func (o *Builder) doMerge() error {
 			seg, err := o.segPlugin.Open(mergePath)
 			if err != nil {
 				_ = closeOpenedSegs()
-				return fmt.Errorf("error opening segment (%s) for merge: %v", mergePath, err)
+				return nil, fmt.Errorf("error opening segment (%s) for merge: %v", mergePath, err)
 			}
 			mergeSegs = append(mergeSegs, seg)
 		}
@@ -214,27 +238,27 @@ func (o *Builder) doMerge() error {
 		_, _, err := o.segPlugin.Merge(mergeSegs, drops, mergedSegPath, nil, nil)
 		if err != nil {
 			_ = closeOpenedSegs()
-			return fmt.Errorf("error merging segments (%v): %v", mergePaths, err)
+			return nil, fmt.Errorf("error merging segments (%v): %v", mergePaths, err)
 		}
 		o.segCount++
-		o.segPaths = append(o.segPaths, mergedSegPath)
+		rv = append(rv, mergedSegPath)
 
 		// close segments opened for merge
 		err = closeOpenedSegs()
 		if err != nil {
-			return fmt.Errorf("error closing opened segments: %v", err)
+			return nil, fmt.Errorf("error closing opened segments: %v", err)
 		}
 
 		// remove merged segments
 		for _, mergePath := range mergePaths {
 			err = os.RemoveAll(mergePath)
 			if err != nil {
-				return fmt.Errorf("error removing segment %s after merge: %v", mergePath, err)
+				return nil, fmt.Errorf("error removing segment %s after merge: %v", mergePath, err)
 			}
 		}
 	}
 
-	return nil
+	return rv, nil
 }
 
 func (o *Builder) Close() error {
@@ -247,14 +271,28 @@ func (o *Builder) Close() error {
 		return fmt.Errorf("error flushing batch before close: %v", err)
 	}
 
+	return o.finishLOCKED()
+}
+
+// finishLOCKED merges the built segments into one, and writes the index
+// with it to the builder's path.
+func (o *Builder) finishLOCKED() error {
+	// an index without documents still needs a segment
+	if len(o.segPaths) == 0 {
+		err := o.executeBatchLOCKED(o.batch)
+		if err != nil {
+			return fmt.Errorf("error building empty segment: %v", err)
+		}
+	}
+
 	// perform all the merging
-	err = o.doMerge()
+	err := o.doMerge()
 	if err != nil {
 		return fmt.Errorf("error while merging: %v", err)
 	}
 
 	// ensure the store path exists
-	err = os.MkdirAll(o.path, 0700)
+	err = o.dir.Setup(false)
 	if err != nil {
 		return err
 	}
@@ -262,8 +300,10 @@ func (o *Builder) Close() error {
 	// move final segment into place
 	// segment id 2 is chosen to match the behavior of a scorch
 	// index which indexes a single batch of data
-	finalSegPath := o.path + string(os.PathSeparator) + zapFileName(2)
-	err = os.Rename(o.segPaths[0], finalSegPath)
+	finalSegName := zapFileName(2)
+	err = o.dir.Create(finalSegName, func(path string) error {
+		return os.Rename(o.segPaths[0], path)
+	})
 	if err != nil {
 		return fmt.Errorf("error moving final segment into place: %v", err)
 	}
@@ -275,7 +315,7 @@ func (o *Builder) Close() error {
 	}
 
 	// prepare wrapping
-	seg, err := o.segPlugin.Open(finalSegPath)
+	seg, err := o.dir.Open(finalSegName, o.segPlugin.Open)
 	if err != nil {
 		return fmt.Errorf("error opening final segment")
 	}
@@ -292,8 +332,7 @@ func (o *Builder) Close() error {
 	}
 
 	// create the root bolt
-	rootBoltPath := o.path + string(os.PathSeparator) + "root.bolt"
-	rootBolt, err := bolt.Open(rootBoltPath, 0600, nil)
+	rootBolt, err := o.dir.OpenMeta(false)
 	if err != nil {
 		return err
 	}
@@ -305,7 +344,7 @@ func (o *Builder) Close() error {
 	}
 
 	// fill the root bolt with this fake index snapshot
-	_, _, err = prepareBoltSnapshot(is, tx, o.path, o.segPlugin)
+	_, _, err = prepareBoltSnapshot(is, tx, o.dir, o.segPlugin)
 	if err != nil {
 		_ = tx.Rollback()
 		_ = rootBolt.Close()
@@ -0,0 +1,262 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	bolt "go.etcd.io/bbolt"
+)
+
+// MergeBuilds writes a single index at the config's path, from the
+// indexes that Builders wrote at the paths, as if all their documents
+// had been given to one Builder, which the config is otherwise the
+// config of. The documents are numbered in the order of the paths, and
+// of a document id in several of the indexes only the last is kept.
+// The internal values of the indexes must agree with each other and
+// with the config's.
+//
+// The indexes at the paths are only read, so several Builders, in
+// separate goroutines or processes, can each build a shard of the
+// documents to be merged once all of them are closed.
+func MergeBuilds(config map[string]interface{}, paths []string) (err error) {
+	o, err := NewBuilder(config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(o.buildPath)
+		}
+	}()
+
+	internal := make(map[string][]byte, len(o.internal))
+	for k, v := range o.internal {
+		internal[k] = v
+	}
+	o.internal = internal
+
+	var segs []segment.Segment
+	var drops []*roaring.Bitmap
+	defer func() {
+		for _, seg := range segs {
+			_ = seg.Close()
+		}
+	}()
+	for _, path := range paths {
+		manifest, dir, err := readBuild(config, path)
+		if err != nil {
+			return fmt.Errorf("error reading build %s: %v", path, err)
+		}
+		if manifest.SegmentType != o.segPlugin.Type() ||
+			manifest.SegmentVersion != o.segPlugin.Version() {
+			return fmt.Errorf("build %s has segments of type %s version %d, expected %s version %d",
+				path, manifest.SegmentType, manifest.SegmentVersion,
+				o.segPlugin.Type(), o.segPlugin.Version())
+		}
+		for _, v := range manifest.Internal {
+			if prev, ok := o.internal[string(v.Key)]; ok && !bytes.Equal(prev, v.Val) {
+				return fmt.Errorf("build %s has conflicting internal value for key %q",
+					path, v.Key)
+			}
+			o.internal[string(v.Key)] = v.Val
+		}
+		for _, ms := range manifest.Segments {
+			seg, err := dir.Open(ms.File, o.segPlugin.Open)
+			if err != nil {
+				return fmt.Errorf("error opening segment %s of build %s: %v",
+					ms.File, path, err)
+			}
+			segs = append(segs, seg)
+			var drop *roaring.Bitmap
+			if len(ms.Deleted) > 0 {
+				drop = roaring.NewBitmap()
+				_, err = drop.ReadFrom(bytes.NewReader(ms.Deleted))
+				if err != nil {
+					return fmt.Errorf("error reading deleted bitmap of segment %s of build %s: %v",
+						ms.File, path, err)
+				}
+			}
+			drops = append(drops, drop)
+		}
+	}
+
+	err = dropDuplicateIDs(segs, drops)
+	if err != nil {
+		return fmt.Errorf("error finding duplicate ids: %v", err)
+	}
+
+	// merge the segments of the builds into the build path, <mergeMax>
+	// at a time, after which they're merged into one like those built
+	for len(segs) > 0 {
+		mergeCount := o.mergeMax
+		if mergeCount > len(segs) {
+			mergeCount = len(segs)
+		}
+		mergedSegPath := o.buildPath + string(os.PathSeparator) + zapFileName(o.segCount)
+		_, _, err = o.segPlugin.Merge(segs[:mergeCount], drops[:mergeCount],
+			mergedSegPath, nil, nil)
+		if err != nil {
+			return fmt.Errorf("error merging segments of builds: %v", err)
+		}
+		o.segCount++
+		o.segPaths = append(o.segPaths, mergedSegPath)
+
+		merged := segs[:mergeCount]
+		segs, drops = segs[mergeCount:], drops[mergeCount:]
+		for _, seg := range merged {
+			clErr := seg.Close()
+			if clErr != nil && err == nil {
+				err = clErr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error closing merged segments: %v", err)
+		}
+	}
+
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.finishLOCKED()
+}
+
+// readBuild reads the manifest of the snapshot of the index that a
+// Builder wrote at the path.
+func readBuild(config map[string]interface{}, path string) (
+	*ReplicationManifest, Directory, error) {
+	dir, err := openDirectory(config, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = dir.Setup(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	rootBolt, err := dir.OpenMeta(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rootBolt.Close() }()
+
+	var rv *ReplicationManifest
+	err = rootBolt.View(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(boltSnapshotsBucket)
+		if snapshots == nil {
+			return nil
+		}
+		k, _ := snapshots.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		rv, err = readReplicationManifestBucket(snapshots.Bucket(k))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if rv == nil {
+		return nil, nil, fmt.Errorf("no snapshot found")
+	}
+	return rv, dir, nil
+}
+
+// dropDuplicateIDs adds to the drops of the segments the documents whose
+// _id is also that of a later live document, walking the segments' _id
+// dictionaries together in order.
+func dropDuplicateIDs(segs []segment.Segment, drops []*roaring.Bitmap) error {
+	dicts := make([]segment.TermDictionary, len(segs))
+	itrs := make([]segment.DictionaryIterator, len(segs))
+	heads := make([]*index.DictEntry, len(segs))
+	for i, seg := range segs {
+		dict, err := seg.Dictionary("_id")
+		if err != nil {
+			return err
+		}
+		dicts[i] = dict
+		itrs[i] = dict.Iterator()
+		heads[i], err = itrs[i].Next()
+		if err != nil {
+			return err
+		}
+	}
+
+	type segDoc struct {
+		seg int
+		num uint64
+	}
+	var docs []segDoc
+	var postings segment.PostingsList
+	var postingsItr segment.PostingsIterator
+	for {
+		var term string
+		var count uint64
+		found := false
+		for _, head := range heads {
+			if head == nil {
+				continue
+			}
+			if !found || head.Term < term {
+				term, count, found = head.Term, head.Count, true
+			} else if head.Term == term {
+				count += head.Count
+			}
+		}
+		if !found {
+			return nil
+		}
+
+		docs = docs[:0]
+		for i, head := range heads {
+			if head == nil || head.Term != term {
+				continue
+			}
+			if count > 1 {
+				var err error
+				postings, err = dicts[i].PostingsList([]byte(term), drops[i], postings)
+				if err != nil {
+					return err
+				}
+				postingsItr = postings.Iterator(false, false, false, postingsItr)
+				for {
+					p, err := postingsItr.Next()
+					if err != nil {
+						return err
+					}
+					if p == nil {
+						break
+					}
+					docs = append(docs, segDoc{seg: i, num: p.Number()})
+				}
+			}
+			var err error
+			heads[i], err = itrs[i].Next()
+			if err != nil {
+				return err
+			}
+		}
+
+		for j := 0; j+1 < len(docs); j++ {
+			if drops[docs[j].seg] == nil {
+				drops[docs[j].seg] = roaring.NewBitmap()
+			}
+			drops[docs[j].seg].Add(uint32(docs[j].num))
+		}
+	}
+}
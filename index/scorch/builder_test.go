@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/blevesearch/bleve/document"
@@ -158,3 +160,188 @@ func TestBuilderFlushFinalBatch(t *testing.T) {
 
 	checkIndex(t, tmpDir, []byte("hello"), "name", 9)
 }
+
+func TestMergeBuilds(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "scorch-builder-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = os.RemoveAll(tmpDir)
+		if err != nil {
+			t.Fatalf("error cleaning up test index: %v", err)
+		}
+	}()
+
+	// the last shard is left empty
+	shards := 4
+	paths := make([]string, shards)
+	errs := make([]error, shards)
+	var wg sync.WaitGroup
+	for i := 0; i < shards; i++ {
+		paths[i] = tmpDir + string(os.PathSeparator) + "shard" + strconv.Itoa(i)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b, err := NewBuilder(map[string]interface{}{
+				"path":      paths[i],
+				"batchSize": 2,
+				"mergeMax":  2,
+				"internal":  map[string][]byte{"k": []byte("v")},
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			for j := i; j < 10 && i < shards-1; j += shards - 1 {
+				doc := document.NewDocument(strconv.Itoa(j))
+				doc.AddField(document.NewTextField("name", nil, []byte("hello")))
+				errs[i] = b.Index(doc)
+				if errs[i] != nil {
+					return
+				}
+			}
+			if i == shards-2 {
+				// a later shard replaces doc 0
+				doc := document.NewDocument("0")
+				doc.AddField(document.NewTextField("name", nil, []byte("world")))
+				errs[i] = b.Index(doc)
+				if errs[i] != nil {
+					return
+				}
+			}
+			errs[i] = b.Close()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := map[string]interface{}{
+		"path":     tmpDir + string(os.PathSeparator) + "merged",
+		"mergeMax": 2,
+	}
+	err = MergeBuilds(cfg, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	checkDocCount(t, idx, 10)
+	checkTermHits(t, idx, "hello", "name", 9)
+	checkTermHits(t, idx, "world", "name", 1)
+
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	v, err := reader.GetInternal([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "v" {
+		t.Errorf("expected internal value v, got %q", v)
+	}
+	for j := 0; j < 10; j++ {
+		doc, err := reader.Document(strconv.Itoa(j))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc == nil {
+			t.Errorf("expected doc %d", j)
+		}
+	}
+
+	// builds with conflicting internal values can't be merged
+	conflicting := tmpDir + string(os.PathSeparator) + "conflicting"
+	b, err := NewBuilder(map[string]interface{}{
+		"path":     conflicting,
+		"internal": map[string][]byte{"k": []byte("other")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MergeBuilds(map[string]interface{}{
+		"path": tmpDir + string(os.PathSeparator) + "conflicted",
+	}, []string{paths[0], conflicting})
+	if err == nil {
+		t.Errorf("expected error merging builds with conflicting internal values")
+	}
+}
+
+func TestMergeBuildsKeepsLastDuplicate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "scorch-builder-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = os.RemoveAll(tmpDir)
+		if err != nil {
+			t.Fatalf("error cleaning up test index: %v", err)
+		}
+	}()
+
+	// each version of the doc is built in its own segment, more of them
+	// than are merged at a time
+	path := tmpDir + string(os.PathSeparator) + "shard"
+	b, err := NewBuilder(map[string]interface{}{
+		"path":      path,
+		"batchSize": 1,
+		"mergeMax":  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		doc := document.NewDocument("0")
+		doc.AddField(document.NewTextField("name", nil, []byte("hello"+strconv.Itoa(i))))
+		err = b.Index(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = b.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := map[string]interface{}{
+		"path": tmpDir + string(os.PathSeparator) + "merged",
+	}
+	err = MergeBuilds(cfg, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	checkDocCount(t, idx, 1)
+	for i := 0; i < 4; i++ {
+		checkTermHits(t, idx, "hello"+strconv.Itoa(i), "name", 0)
+	}
+	checkTermHits(t, idx, "hello4", "name", 1)
+}
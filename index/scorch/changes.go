@@ -0,0 +1,338 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ChangeOp is the kind of mutation recorded by a Change.
+type ChangeOp uint8
+
+const (
+	// ChangeOpUpdate records that a document was indexed, either for the
+	// first time or replacing a previous version.
+	ChangeOpUpdate ChangeOp = 'u'
+	// ChangeOpDelete records that a document was deleted. It's recorded
+	// even if there was no document with the ID.
+	ChangeOpDelete ChangeOp = 'd'
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeOpUpdate:
+		return "update"
+	case ChangeOpDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("ChangeOp(%d)", uint8(op))
+}
+
+// Change is a mutation of a document, made in the persisted snapshot
+// with the epoch, since the previous persisted snapshot.
+type Change struct {
+	Epoch uint64
+	DocID string
+	Op    ChangeOp
+}
+
+// ErrChangesUnavailable is returned when the changes since an epoch
+// aren't retained, because the snapshots before the epoch's next one
+// were removed, or because the change feed was enabled after it.
+var ErrChangesUnavailable = fmt.Errorf("changes since epoch are unavailable")
+
+// The change feed is recorded, when the "changeFeed" config is true, in
+// its own bucket of root.bolt, so that indexes that have one can still
+// be opened by versions that don't know about it. The bucket holds, for
+// each persisted snapshot epoch, the changes made since the previous
+// one, and the epoch from which the changes are complete.
+var boltChangesBucket = []byte{'c'}
+var boltChangesFromKey = []byte{'f'}
+
+// pendingChange is a change that hasn't been persisted yet, with the
+// epoch of the snapshot that introduced it.
+type pendingChange struct {
+	epoch uint64
+	docID string
+	op    ChangeOp
+}
+
+// setupChangeFeed creates the change feed's bucket, complete from the
+// current root, if the change feed is enabled, and otherwise removes it,
+// since the changes made without it would be missing from it.
+func (s *Scorch) setupChangeFeed() error {
+	return s.rootBolt.Update(func(tx *bolt.Tx) error {
+		if !s.changeFeed {
+			err := tx.DeleteBucket(boltChangesBucket)
+			if err == bolt.ErrBucketNotFound {
+				err = nil
+			}
+			return err
+		}
+		if tx.Bucket(boltChangesBucket) != nil {
+			return nil
+		}
+		changes, err := tx.CreateBucket(boltChangesBucket)
+		if err != nil {
+			return err
+		}
+		return changes.Put(boltChangesFromKey,
+			segment.EncodeUvarintAscending(nil, s.root.epoch))
+	})
+}
+
+// recordChanges queues the changes made by an introduction, with the
+// epoch of the snapshot it introduced. s.rootLock must be held.
+func (s *Scorch) recordChanges(epoch uint64, ids []string, ops []ChangeOp) {
+	for i, id := range ids {
+		s.pendingChanges = append(s.pendingChanges, pendingChange{
+			epoch: epoch,
+			docID: id,
+			op:    ops[i],
+		})
+	}
+}
+
+// prepareBoltChanges writes the pending changes introduced up to the
+// snapshot to the change feed's bucket, under the snapshot's epoch, and
+// returns how many it wrote, which should be dropped from the pending
+// changes once tx is committed.
+func (s *Scorch) prepareBoltChanges(snapshot *IndexSnapshot, tx *bolt.Tx) (int, error) {
+	if !s.changeFeed {
+		return 0, nil
+	}
+	changes, err := tx.CreateBucketIfNotExists(boltChangesBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	s.rootLock.RLock()
+	var n int
+	var buf []byte
+	for _, c := range s.pendingChanges {
+		if c.epoch > snapshot.epoch {
+			break
+		}
+		buf = append(buf, byte(c.op))
+		buf = appendUvarint(buf, uint64(len(c.docID)))
+		buf = append(buf, c.docID...)
+		n++
+	}
+	s.rootLock.RUnlock()
+
+	if n == 0 {
+		return 0, nil
+	}
+	return n, changes.Put(segment.EncodeUvarintAscending(nil, snapshot.epoch), buf)
+}
+
+// changesPersisted drops the first n pending changes, which were
+// persisted, and wakes up the change subscriptions.
+func (s *Scorch) changesPersisted(n int) {
+	if !s.changeFeed {
+		return
+	}
+	s.rootLock.Lock()
+	s.pendingChanges = append(s.pendingChanges[:0], s.pendingChanges[n:]...)
+	close(s.changesCh)
+	s.changesCh = make(notificationChan)
+	s.rootLock.Unlock()
+}
+
+// removeBoltChanges removes the changes persisted with the epochs, whose
+// snapshots were removed, so that the changes are only complete from
+// the newest of them.
+func removeBoltChanges(tx *bolt.Tx, epochs []uint64) error {
+	changes := tx.Bucket(boltChangesBucket)
+	if changes == nil {
+		return nil
+	}
+	_, from, err := segment.DecodeUvarintAscending(changes.Get(boltChangesFromKey))
+	if err != nil {
+		return err
+	}
+	for _, epoch := range epochs {
+		err = changes.Delete(segment.EncodeUvarintAscending(nil, epoch))
+		if err != nil {
+			return err
+		}
+		if epoch > from {
+			from = epoch
+		}
+	}
+	return changes.Put(boltChangesFromKey, segment.EncodeUvarintAscending(nil, from))
+}
+
+// rollbackBoltChanges removes the changes persisted after the epoch.
+func rollbackBoltChanges(tx *bolt.Tx, epoch uint64) error {
+	changes := tx.Bucket(boltChangesBucket)
+	if changes == nil {
+		return nil
+	}
+	var epochs [][]byte
+	c := changes.Cursor()
+	for k, _ := c.Seek(segment.EncodeUvarintAscending(nil, epoch+1)); k != nil; k, _ = c.Next() {
+		epochs = append(epochs, append([]byte(nil), k...))
+	}
+	for _, k := range epochs {
+		err := changes.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func decodeChanges(epoch uint64, buf []byte, rv []Change) ([]Change, error) {
+	for len(buf) > 0 {
+		op := ChangeOp(buf[0])
+		l, n := binary.Uvarint(buf[1:])
+		if n <= 0 || uint64(len(buf)-1-n) < l {
+			return nil, fmt.Errorf("corrupt changes for epoch %d", epoch)
+		}
+		buf = buf[1+n:]
+		rv = append(rv, Change{Epoch: epoch, DocID: string(buf[:l]), Op: op})
+		buf = buf[l:]
+	}
+	return rv, nil
+}
+
+// Changes returns the changes made in the persisted snapshots after
+// sinceEpoch, in the order they were made, and the epoch of the newest
+// persisted snapshot, which the changes that follow can be read from.
+// sinceEpoch can be the epoch of any retained snapshot, or an epoch
+// returned by Changes, as long as the snapshot after it is retained.
+//
+// Indexes only record their changes when their "changeFeed" config is
+// true, and ErrChangesUnavailable is returned for other indexes.
+func (s *Scorch) Changes(sinceEpoch uint64) ([]Change, uint64, error) {
+	if s.rootBolt == nil {
+		return nil, 0, ErrChangesUnavailable
+	}
+	var rv []Change
+	var epoch uint64
+	err := s.rootBolt.View(func(tx *bolt.Tx) error {
+		changes := tx.Bucket(boltChangesBucket)
+		if changes == nil {
+			return ErrChangesUnavailable
+		}
+		_, from, err := segment.DecodeUvarintAscending(changes.Get(boltChangesFromKey))
+		if err != nil {
+			return err
+		}
+		if sinceEpoch < from {
+			return ErrChangesUnavailable
+		}
+		epoch = sinceEpoch
+
+		c := changes.Cursor()
+		for k, v := c.Seek(segment.EncodeUvarintAscending(nil, sinceEpoch+1)); k != nil; k, v = c.Next() {
+			_, changesEpoch, err := segment.DecodeUvarintAscending(k)
+			if err != nil {
+				return err
+			}
+			rv, err = decodeChanges(changesEpoch, v, rv)
+			if err != nil {
+				return err
+			}
+		}
+
+		if snapshots := tx.Bucket(boltSnapshotsBucket); snapshots != nil {
+			k, _ := snapshots.Cursor().Last()
+			if k != nil {
+				_, lastEpoch, err := segment.DecodeUvarintAscending(k)
+				if err != nil {
+					return err
+				}
+				if lastEpoch > epoch {
+					epoch = lastEpoch
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return rv, epoch, nil
+}
+
+// ChangeSubscription reads the changes of an index as they're persisted.
+type ChangeSubscription struct {
+	s       *Scorch
+	epoch   uint64
+	closeCh chan struct{}
+}
+
+// SubscribeChanges returns a subscription to the changes made in the
+// persisted snapshots after sinceEpoch, which can be any epoch Changes
+// accepts. A subscription can be resumed by subscribing again from the
+// epoch it reached.
+func (s *Scorch) SubscribeChanges(sinceEpoch uint64) *ChangeSubscription {
+	return &ChangeSubscription{
+		s:       s,
+		epoch:   sinceEpoch,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Epoch returns the epoch the subscription has read the changes up to.
+func (c *ChangeSubscription) Epoch() uint64 {
+	return c.epoch
+}
+
+// Next returns the next changes, blocking until some are persisted, the
+// subscription is closed, or the index is closed, in which cases it
+// returns ErrClosed.
+func (c *ChangeSubscription) Next() ([]Change, error) {
+	for {
+		c.s.rootLock.RLock()
+		changesCh := c.s.changesCh
+		closeCh := c.s.closeCh
+		c.s.rootLock.RUnlock()
+
+		changes, epoch, err := c.s.Changes(c.epoch)
+		if err != nil {
+			return nil, err
+		}
+		c.epoch = epoch
+		if len(changes) > 0 {
+			return changes, nil
+		}
+
+		select {
+		case <-changesCh:
+		case <-closeCh:
+			return nil, ErrClosed
+		case <-c.closeCh:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// Close stops the subscription, making Next return.
+func (c *ChangeSubscription) Close() {
+	close(c.closeCh)
+}
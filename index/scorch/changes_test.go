@@ -0,0 +1,241 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/index"
+)
+
+func changeStrings(changes []Change) []string {
+	rv := make([]string, 0, len(changes))
+	for _, c := range changes {
+		rv = append(rv, c.DocID+" "+c.Op.String())
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+func checkChanges(t *testing.T, changes []Change, expected ...string) {
+	actual := changeStrings(changes)
+	sort.Strings(expected)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected changes %v, got %v", expected, actual)
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected changes %v, got %v", expected, actual)
+		}
+	}
+}
+
+func deleteDocs(t *testing.T, idx index.Index, ids ...string) {
+	batch := index.NewBatch()
+	for _, id := range ids {
+		batch.Delete(id)
+	}
+	err := idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangeFeed(t *testing.T) {
+	cfg := CreateConfig("TestChangeFeed")
+	cfg["changeFeed"] = true
+	cfg["numSnapshotsToKeep"] = 100
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	s := idx.(*Scorch)
+
+	changes, epoch, err := s.Changes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes)
+
+	updateDocs(t, idx, "a", "b")
+	deleteDocs(t, idx, "a")
+
+	changes, epoch, err = s.Changes(epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes, "a update", "b update", "a delete")
+	var last uint64
+	for _, c := range changes {
+		if c.Epoch < last || c.Epoch > epoch {
+			t.Errorf("unexpected epoch %d in changes up to %d", c.Epoch, epoch)
+		}
+		last = c.Epoch
+	}
+	if changes[len(changes)-1].DocID != "a" || changes[len(changes)-1].Op != ChangeOpDelete {
+		t.Errorf("expected the delete to be the last change, got %v", changes)
+	}
+
+	// A subscription resumes from the epoch reached.
+	sub := s.SubscribeChanges(epoch)
+	go func() {
+		batch := index.NewBatch()
+		batch.Delete("c")
+		_ = idx.Batch(batch)
+	}()
+	changes, err = sub.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes, "c delete")
+	if sub.Epoch() <= epoch {
+		t.Errorf("expected subscription epoch after %d, got %d", epoch, sub.Epoch())
+	}
+	epoch = sub.Epoch()
+
+	done := make(chan error)
+	go func() {
+		_, err := sub.Next()
+		done <- err
+	}()
+	sub.Close()
+	select {
+	case err = <-done:
+		if err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected Next to return after Close")
+	}
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The changes survive reopening the index, and merges.
+	idx = openTestIndex(t, cfg)
+	s = idx.(*Scorch)
+	changes, _, err = s.Changes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes, "a update", "b update", "a delete", "c delete")
+	changes, _, err = s.Changes(epoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes)
+
+	err = s.ForceMerge(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, _, err = s.Changes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkChanges(t, changes, "a update", "b update", "a delete", "c delete")
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Disabling the change feed removes the changes.
+	delete(cfg, "changeFeed")
+	idx = openTestIndex(t, cfg)
+	_, _, err = idx.(*Scorch).Changes(0)
+	if err != ErrChangesUnavailable {
+		t.Errorf("expected ErrChangesUnavailable, got %v", err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangeFeedRemovedSnapshots(t *testing.T) {
+	cfg := CreateConfig("TestChangeFeedRemovedSnapshots")
+	cfg["changeFeed"] = true
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	s := idx.(*Scorch)
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		updateDocs(t, idx, id)
+	}
+	// The snapshots become eligible for removal asynchronously.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s.removeOldData()
+		_, _, err = s.Changes(0)
+		if err == ErrChangesUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected ErrChangesUnavailable, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The persister may remove the oldest snapshot meanwhile too.
+	var epochs []uint64
+	var epoch uint64
+	for {
+		epochs, err = s.RootBoltSnapshotEpochs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldest := epochs[len(epochs)-1]
+		_, epoch, err = s.Changes(oldest)
+		if err == nil {
+			break
+		}
+		if err != ErrChangesUnavailable || time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+	if epoch != epochs[0] {
+		t.Errorf("expected changes up to epoch %d, got %d", epochs[0], epoch)
+	}
+}
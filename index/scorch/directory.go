@@ -0,0 +1,358 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Directory is where a scorch index persists its segment files, and
+// the bolt database that holds its snapshots, root.bolt.
+//
+// Segment plugins write and memory map their files through local paths,
+// so a Directory hands out a local path for each file it creates or
+// opens, whose base name must be the name of the file.
+type Directory interface {
+	// Setup prepares the directory to be used, creating it unless
+	// readOnly is true.
+	Setup(readOnly bool) error
+
+	// OpenMeta opens the bolt database that holds the index's snapshots.
+	OpenMeta(readOnly bool) (*bolt.DB, error)
+
+	// Create creates the file with the name, by calling write with the
+	// local path it should be written to.
+	Create(name string, write func(path string) error) error
+
+	// Open opens the segment file with the name, by calling open with
+	// the local path it can be read from.
+	Open(name string, open func(path string) (segment.Segment, error)) (
+		segment.Segment, error)
+
+	// List returns the files in the directory, including root.bolt.
+	List() ([]os.FileInfo, error)
+
+	// Remove removes the file with the name.
+	Remove(name string) error
+}
+
+// RegistryDirectories should be treated as read-only after process
+// init()'ialization. An index uses the directory constructor named by
+// its "directoryName" config, which is passed the index's path, and
+// otherwise a LocalDirectory at its path.
+var RegistryDirectories = map[string]func(path string) (Directory, error){}
+
+const rootBoltName = "root.bolt"
+
+func openDirectory(config map[string]interface{}, path string) (Directory, error) {
+	name, ok := config["directoryName"].(string)
+	if !ok {
+		return NewLocalDirectory(path), nil
+	}
+	ctr := RegistryDirectories[name]
+	if ctr == nil {
+		return nil, fmt.Errorf("no directory constructor named %s", name)
+	}
+	return ctr(path)
+}
+
+// segmentFileName returns the name of a segment file opened from a
+// Directory.
+func segmentFileName(seg segment.PersistedSegment) string {
+	return filepath.Base(seg.Path())
+}
+
+// LocalDirectory is a Directory on the local filesystem.
+type LocalDirectory struct {
+	path string
+}
+
+func NewLocalDirectory(path string) *LocalDirectory {
+	return &LocalDirectory{path: path}
+}
+
+func (d *LocalDirectory) filePath(name string) string {
+	return d.path + string(os.PathSeparator) + name
+}
+
+func (d *LocalDirectory) Setup(readOnly bool) error {
+	if readOnly {
+		return nil
+	}
+	return os.MkdirAll(d.path, 0700)
+}
+
+func (d *LocalDirectory) OpenMeta(readOnly bool) (*bolt.DB, error) {
+	var rootBoltOpt *bolt.Options
+	if readOnly {
+		rootBoltOpt = &bolt.Options{
+			ReadOnly: true,
+		}
+	}
+	return bolt.Open(d.filePath(rootBoltName), 0600, rootBoltOpt)
+}
+
+func (d *LocalDirectory) Create(name string, write func(path string) error) error {
+	return write(d.filePath(name))
+}
+
+func (d *LocalDirectory) Open(name string,
+	open func(path string) (segment.Segment, error)) (segment.Segment, error) {
+	return open(d.filePath(name))
+}
+
+func (d *LocalDirectory) List() ([]os.FileInfo, error) {
+	finfos, err := ioutil.ReadDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+	rv := finfos[:0]
+	for _, finfo := range finfos {
+		if !finfo.IsDir() {
+			rv = append(rv, finfo)
+		}
+	}
+	return rv, nil
+}
+
+func (d *LocalDirectory) Remove(name string) error {
+	return os.Remove(d.filePath(name))
+}
+
+// TempDirectory is a Directory for tests, whose files live in a private
+// temporary directory while the index using it is open. Clone copies it
+// as it would be found after a crash, so that recovery can be tested
+// without touching the index's own path.
+//
+// It does touch the disk: segment plugins and bolt memory map their
+// files, so they can only be opened from local paths. The contents of
+// the segment files are also kept in memory, and Close removes the
+// temporary directory, keeping root.bolt in memory as well, so that the
+// directory can be reopened or cloned after the index is closed.
+type TempDirectory struct {
+	m       sync.Mutex
+	files   map[string]*memoryFile
+	staging string
+	// meta is the contents of root.bolt while it isn't staged.
+	meta []byte
+	// db is the last bolt database opened by OpenMeta.
+	db *bolt.DB
+}
+
+type memoryFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+	staged  bool
+}
+
+func (f *memoryFile) Name() string       { return f.name }
+func (f *memoryFile) Size() int64        { return int64(len(f.data)) }
+func (f *memoryFile) Mode() os.FileMode  { return 0600 }
+func (f *memoryFile) ModTime() time.Time { return f.modTime }
+func (f *memoryFile) IsDir() bool        { return false }
+func (f *memoryFile) Sys() interface{}   { return nil }
+
+func NewTempDirectory() *TempDirectory {
+	return &TempDirectory{files: map[string]*memoryFile{}}
+}
+
+// stagingPath returns the staging path of the file with the name,
+// creating the staging directory if needed. d.m must be held.
+func (d *TempDirectory) stagingPath(name string) (string, error) {
+	if d.staging == "" {
+		staging, err := ioutil.TempDir("", "scorch-temp-directory")
+		if err != nil {
+			return "", err
+		}
+		d.staging = staging
+	}
+	return d.staging + string(os.PathSeparator) + name, nil
+}
+
+func (d *TempDirectory) Setup(readOnly bool) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	_, err := d.stagingPath(rootBoltName)
+	return err
+}
+
+func (d *TempDirectory) OpenMeta(readOnly bool) (*bolt.DB, error) {
+	d.m.Lock()
+	path, err := d.stagingPath(rootBoltName)
+	if err == nil && d.meta != nil {
+		err = ioutil.WriteFile(path, d.meta, 0600)
+		d.meta = nil
+	}
+	d.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var rootBoltOpt *bolt.Options
+	if readOnly {
+		rootBoltOpt = &bolt.Options{
+			ReadOnly: true,
+		}
+	}
+	db, err := bolt.Open(path, 0600, rootBoltOpt)
+	if err != nil {
+		return nil, err
+	}
+	d.m.Lock()
+	d.db = db
+	d.m.Unlock()
+	return db, nil
+}
+
+func (d *TempDirectory) Create(name string, write func(path string) error) error {
+	d.m.Lock()
+	path, err := d.stagingPath(name)
+	d.m.Unlock()
+	if err != nil {
+		return err
+	}
+	err = write(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	d.m.Lock()
+	d.files[name] = &memoryFile{name: name, data: data, modTime: time.Now(), staged: true}
+	d.m.Unlock()
+	return nil
+}
+
+func (d *TempDirectory) Open(name string,
+	open func(path string) (segment.Segment, error)) (segment.Segment, error) {
+	d.m.Lock()
+	f := d.files[name]
+	if f == nil {
+		d.m.Unlock()
+		return nil, fmt.Errorf("open %s: %v", name, os.ErrNotExist)
+	}
+	path, err := d.stagingPath(name)
+	if err == nil && !f.staged {
+		err = ioutil.WriteFile(path, f.data, 0600)
+		f.staged = err == nil
+	}
+	d.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return open(path)
+}
+
+func (d *TempDirectory) List() ([]os.FileInfo, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	rv := make([]os.FileInfo, 0, len(d.files)+1)
+	for _, f := range d.files {
+		rv = append(rv, f)
+	}
+	if d.staging != "" {
+		if finfo, err := os.Stat(d.staging + string(os.PathSeparator) + rootBoltName); err == nil {
+			rv = append(rv, finfo)
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Name() < rv[j].Name() })
+	return rv, nil
+}
+
+func (d *TempDirectory) Remove(name string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	f := d.files[name]
+	if f == nil {
+		return fmt.Errorf("remove %s: %v", name, os.ErrNotExist)
+	}
+	delete(d.files, name)
+	if f.staged {
+		return os.Remove(d.staging + string(os.PathSeparator) + name)
+	}
+	return nil
+}
+
+// Clone returns a copy of the directory with the files it has now, and
+// the snapshots committed to root.bolt, even while the index using the
+// directory is persisting another one.
+func (d *TempDirectory) Clone() (*TempDirectory, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	rv := NewTempDirectory()
+	// Segment files are created before the snapshots that refer to them
+	// are committed, so holding d.m while root.bolt is copied keeps the
+	// copy's segment files from being missing.
+	for name, f := range d.files {
+		rv.files[name] = &memoryFile{name: name, data: f.data, modTime: f.modTime}
+	}
+	rv.meta = d.meta
+	if d.staging == "" || rv.meta != nil {
+		return rv, nil
+	}
+	if d.db != nil {
+		var buf bytes.Buffer
+		err := d.db.View(func(tx *bolt.Tx) error {
+			_, err := tx.WriteTo(&buf)
+			return err
+		})
+		if err != bolt.ErrDatabaseNotOpen {
+			rv.meta = buf.Bytes()
+			return rv, err
+		}
+	}
+	meta, err := ioutil.ReadFile(d.staging + string(os.PathSeparator) + rootBoltName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	rv.meta = meta
+	return rv, nil
+}
+
+// Close removes the staged files, keeping the contents of root.bolt in
+// memory. The index using the directory must be closed first.
+func (d *TempDirectory) Close() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.staging == "" {
+		return nil
+	}
+	meta, err := ioutil.ReadFile(d.staging + string(os.PathSeparator) + rootBoltName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if meta != nil {
+		d.meta = meta
+	}
+	err = os.RemoveAll(d.staging)
+	d.staging = ""
+	d.db = nil
+	for _, f := range d.files {
+		f.staged = false
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index"
+)
+
+// openTempIndex opens an index in the temp directory, registered
+// under the name.
+func openTempIndex(t *testing.T, name string, dir *TempDirectory) index.Index {
+	RegistryDirectories[name] = func(path string) (Directory, error) {
+		return dir, nil
+	}
+	idx, err := NewScorch(Name, map[string]interface{}{
+		"path":          name,
+		"directoryName": name,
+	}, index.NewAnalysisQueue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func updateDocs(t *testing.T, idx index.Index, ids ...string) {
+	batch := index.NewBatch()
+	for _, id := range ids {
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextField("name", []uint64{}, []byte("test"+id)))
+		batch.Update(doc)
+	}
+	err := idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkDocCount(t *testing.T, idx index.Index, expected uint64) {
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	count, err := reader.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != expected {
+		t.Errorf("expected %d documents, got %d", expected, count)
+	}
+}
+
+func TestTempDirectory(t *testing.T) {
+	dir := NewTempDirectory()
+	defer func() {
+		err := dir.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	idx := openTempIndex(t, "TestTempDirectory", dir)
+	for i := 0; i < 5; i++ {
+		updateDocs(t, idx, fmt.Sprintf("%d", i))
+	}
+	checkDocCount(t, idx, 5)
+
+	finfos, err := dir.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(finfos) < 2 || finfos[len(finfos)-1].Name() != rootBoltName {
+		t.Errorf("expected segment files and root.bolt, got %d files", len(finfos))
+	}
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("TestTempDirectory"); !os.IsNotExist(err) {
+		t.Errorf("expected the index's path not to be used, got %v", err)
+	}
+
+	// The files are staged again when the index is reopened.
+	idx = openTempIndex(t, "TestTempDirectory", dir)
+	checkDocCount(t, idx, 5)
+	updateDocs(t, idx, "5")
+	checkDocCount(t, idx, 6)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTempDirectoryCrash(t *testing.T) {
+	dir := NewTempDirectory()
+	defer func() {
+		_ = dir.Close()
+	}()
+
+	idx := openTempIndex(t, "TestTempDirectoryCrash", dir)
+	updateDocs(t, idx, "1", "2")
+	updateDocs(t, idx, "3")
+
+	// Batch returns once the batch is persisted, so a crash now keeps it,
+	// whatever the persister and merger are doing.
+	crashed, err := dir.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = crashed.Close()
+	}()
+
+	updateDocs(t, idx, "4")
+	checkDocCount(t, idx, 4)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := openTempIndex(t, "TestTempDirectoryCrashRecovered", crashed)
+	checkDocCount(t, recovered, 3)
+	updateDocs(t, recovered, "5")
+	checkDocCount(t, recovered, 4)
+	err = recovered.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTempDirectoryMissingSegment(t *testing.T) {
+	dir := NewTempDirectory()
+	defer func() {
+		_ = dir.Close()
+	}()
+
+	idx := openTempIndex(t, "TestTempDirectoryMissingSegment", dir)
+	updateDocs(t, idx, "1")
+	err := idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	finfos, err := dir.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finfo := range finfos {
+		if finfo.Name() != rootBoltName {
+			err = dir.Remove(finfo.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The snapshot that refers to the lost segment can't be loaded, so
+	// the index is opened empty.
+	idx = openTempIndex(t, "TestTempDirectoryMissingSegment", dir)
+	checkDocCount(t, idx, 0)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -187,3 +187,86 @@ func TestIndexFieldDict(t *testing.T) {
 		t.Errorf("expected %#v, got %#v", expectedTerms, terms)
 	}
 }
+
+func TestIndexFieldStats(t *testing.T) {
+	cfg := CreateConfig("TestIndexFieldStats")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewScorch(Name, cfg, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	defer func() {
+		cerr := idx.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	// each update introduces its own segment
+	doc := document.NewDocument("1")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("test one two"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	doc = document.NewDocument("2")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("test test"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	doc = document.NewDocument("3")
+	doc.AddField(document.NewTextFieldWithAnalyzer("desc", []uint64{}, []byte("eat more rice"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+
+	checkFieldStats := func(field string, expected index.FieldStats) {
+		indexReader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			err := indexReader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+		actual, err := indexReader.(index.IndexReaderFieldStats).FieldStats(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Errorf("expected %s stats %+v, got %+v", field, expected, actual)
+		}
+	}
+
+	checkFieldStats("name", index.FieldStats{Docs: 2, TotalTerms: 5})
+	checkFieldStats("desc", index.FieldStats{Docs: 1, TotalTerms: 3})
+	checkFieldStats("missing", index.FieldStats{})
+
+	// the stats of the earlier segments come from their cache
+	doc = document.NewDocument("4")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("four"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	checkFieldStats("name", index.FieldStats{Docs: 3, TotalTerms: 6})
+}
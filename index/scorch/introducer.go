@@ -17,6 +17,7 @@ package scorch
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/RoaringBitmap/roaring"
 	"github.com/blevesearch/bleve/index"
@@ -28,7 +29,10 @@ type segmentIntroduction struct {
 	data      segment.Segment
 	obsoletes map[uint64]*roaring.Bitmap
 	ids       []string
+	ops       []ChangeOp // The changes made to ids, if the change feed is enabled.
 	internal  map[string][]byte
+	expiries  *segmentExpiries // The expiry times of data's documents, if any.
+	logged    bool             // Whether the batch is in the write-ahead log.
 
 	applied           chan error
 	persisted         chan error
@@ -70,14 +74,19 @@ OUTER:
 		case persist := <-s.persists:
 			s.introducePersist(persist)
 
+		case now := <-s.expirations:
+			s.introduceExpiries(now)
+
 		}
 
-		var epochCurr uint64
+		var epochCurr, expiredCurr uint64
 		s.rootLock.RLock()
 		if s.root != nil {
 			epochCurr = s.root.epoch
+			expiredCurr = s.root.expiredCount()
 		}
 		s.rootLock.RUnlock()
+		atomic.StoreUint64(&s.stats.CurExpiredItems, expiredCurr)
 		var epochWatchersNext []*epochWatcher
 		for _, w := range epochWatchers {
 			if w.epoch < epochCurr {
@@ -104,6 +113,7 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 	defer func() { _ = root.DecRef() }()
 
 	nsegs := len(root.segment)
+	now := time.Now().UnixNano()
 
 	// prepare new index snapshot
 	newSnapshot := &IndexSnapshot{
@@ -136,6 +146,8 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 			id:         root.segment[i].id,
 			segment:    root.segment[i].segment,
 			cachedDocs: root.segment[i].cachedDocs,
+			fieldStats: root.segment[i].fieldStats,
+			expiries:   root.segment[i].expiries,
 			creator:    root.segment[i].creator,
 		}
 
@@ -148,6 +160,7 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 		if newss.deleted.IsEmpty() {
 			newss.deleted = nil
 		}
+		expireSegment(newss, root.segment[i], now)
 
 		// check for live size before copying
 		if newss.LiveSize() > 0 {
@@ -175,8 +188,11 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 			id:         next.id,
 			segment:    next.data, // take ownership of next.data's ref-count
 			cachedDocs: &cachedDocs{cache: nil},
+			fieldStats: &segmentFieldStats{},
+			expiries:   next.expiries,
 			creator:    "introduceSegment",
 		}
+		expireSegment(newSegmentSnapshot, nil, now)
 		newSnapshot.segment = append(newSnapshot.segment, newSegmentSnapshot)
 		newSnapshot.offsets = append(newSnapshot.offsets, running)
 
@@ -209,6 +225,12 @@ func (s *Scorch) introduceSegment(next *segmentIntroduction) error {
 	// swap in new index snapshot
 	newSnapshot.epoch = s.nextSnapshotEpoch
 	s.nextSnapshotEpoch++
+	if next.ops != nil {
+		s.recordChanges(newSnapshot.epoch, next.ids, next.ops)
+	}
+	if next.logged {
+		s.walIntroduced(next.id, newSnapshot.epoch)
+	}
 	rootPrev := s.root
 	s.root = newSnapshot
 	atomic.StoreUint64(&s.stats.CurRootEpoch, s.root.epoch)
@@ -237,6 +259,7 @@ func (s *Scorch) introducePersist(persist *persistIntroduction) {
 
 	defer func() { _ = root.DecRef() }()
 
+	now := time.Now().UnixNano()
 	newIndexSnapshot := &IndexSnapshot{
 		parent:   s,
 		epoch:    nextSnapshotEpoch,
@@ -256,8 +279,11 @@ func (s *Scorch) introducePersist(persist *persistIntroduction) {
 				segment:    replacement,
 				deleted:    segmentSnapshot.deleted,
 				cachedDocs: segmentSnapshot.cachedDocs,
+				fieldStats: segmentSnapshot.fieldStats,
+				expiries:   segmentSnapshot.expiries,
 				creator:    "introducePersist",
 			}
+			expireSegment(newSegmentSnapshot, segmentSnapshot, now)
 			newIndexSnapshot.segment[i] = newSegmentSnapshot
 			delete(persist.persisted, segmentSnapshot.id)
 
@@ -313,6 +339,7 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 
 	defer func() { _ = root.DecRef() }()
 
+	now := time.Now().UnixNano()
 	newSnapshot := &IndexSnapshot{
 		parent:   s,
 		internal: root.internal,
@@ -330,9 +357,10 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 			if segSnapAtMerge != nil && root.segment[i].deleted != nil {
 				// assume all these deletes are new
 				deletedSince := root.segment[i].deleted
-				// if we already knew about some of them, remove
-				if segSnapAtMerge.deleted != nil {
-					deletedSince = roaring.AndNot(root.segment[i].deleted, segSnapAtMerge.deleted)
+				// if we already knew about some of them, or they had
+				// expired and were dropped, remove
+				if hidden := segSnapAtMerge.hiddenDocs(); hidden != nil {
+					deletedSince = roaring.AndNot(root.segment[i].deleted, hidden)
 				}
 				deletedSinceItr := deletedSince.Iterator()
 				for deletedSinceItr.HasNext() {
@@ -348,13 +376,17 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 			delete(nextMerge.old, segmentID)
 		} else if root.segment[i].LiveSize() > 0 {
 			// this segment is staying
-			newSnapshot.segment = append(newSnapshot.segment, &SegmentSnapshot{
+			newss := &SegmentSnapshot{
 				id:         root.segment[i].id,
 				segment:    root.segment[i].segment,
 				deleted:    root.segment[i].deleted,
 				cachedDocs: root.segment[i].cachedDocs,
+				fieldStats: root.segment[i].fieldStats,
+				expiries:   root.segment[i].expiries,
 				creator:    root.segment[i].creator,
-			})
+			}
+			expireSegment(newss, root.segment[i], now)
+			newSnapshot.segment = append(newSnapshot.segment, newss)
 			root.segment[i].segment.AddRef()
 			newSnapshot.offsets = append(newSnapshot.offsets, running)
 			running += root.segment[i].segment.Count()
@@ -389,13 +421,17 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 	if nextMerge.new != nil &&
 		nextMerge.new.Count() > newSegmentDeleted.GetCardinality() {
 		// put new segment at end
-		newSnapshot.segment = append(newSnapshot.segment, &SegmentSnapshot{
+		newss := &SegmentSnapshot{
 			id:         nextMerge.id,
 			segment:    nextMerge.new, // take ownership for nextMerge.new's ref-count
 			deleted:    newSegmentDeleted,
 			cachedDocs: &cachedDocs{cache: nil},
+			fieldStats: &segmentFieldStats{},
+			expiries:   nextMerge.expiries,
 			creator:    "introduceMerge",
-		})
+		}
+		expireSegment(newss, nil, now)
+		newSnapshot.segment = append(newSnapshot.segment, newss)
 		newSnapshot.offsets = append(newSnapshot.offsets, running)
 		atomic.AddUint64(&s.stats.TotIntroducedSegmentsMerge, 1)
 
@@ -419,12 +455,17 @@ func (s *Scorch) introduceMerge(nextMerge *segmentMerge) {
 
 	newSnapshot.updateSize()
 	s.rootLock.Lock()
+	if nextMerge.persisted != nil {
+		s.rootPersisted = append(s.rootPersisted, nextMerge.persisted)
+	}
 	// swap in new index snapshot
 	newSnapshot.epoch = s.nextSnapshotEpoch
 	s.nextSnapshotEpoch++
 	rootPrev := s.root
 	s.root = newSnapshot
 	atomic.StoreUint64(&s.stats.CurRootEpoch, s.root.epoch)
+	// stored before notifying the requester too, which may read it
+	atomic.StoreUint64(&s.stats.CurExpiredItems, s.root.expiredCount())
 	// release lock
 	s.rootLock.Unlock()
 
@@ -18,8 +18,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"strings"
 	"sync/atomic"
 	"time"
 
@@ -31,15 +29,6 @@ import (
 func (s *Scorch) mergerLoop() {
 	var lastEpochMergePlanned uint64
 	var ctrlMsg *mergerCtrl
-	mergePlannerOptions, err := s.parseMergePlannerOptions()
-	if err != nil {
-		s.fireAsyncError(fmt.Errorf("mergePlannerOption json parsing err: %v", err))
-		s.asyncTasks.Done()
-		return
-	}
-	ctrlMsgDflt := &mergerCtrl{ctx: context.Background(),
-		options: mergePlannerOptions,
-		doneCh:  nil}
 
 OUTER:
 	for {
@@ -50,6 +39,20 @@ OUTER:
 			break OUTER
 
 		default:
+			if resumeCh := s.mergerPausedCh(); resumeCh != nil {
+				if ctrlMsg != nil && ctrlMsg.doneCh != nil {
+					ctrlMsg.paused = true
+					close(ctrlMsg.doneCh)
+				}
+				ctrlMsg = nil
+				select {
+				case <-s.closeCh:
+					break OUTER
+				case <-resumeCh:
+				}
+				continue OUTER
+			}
+
 			// check to see if there is a new snapshot to persist
 			s.rootLock.Lock()
 			ourSnapshot := s.root
@@ -59,14 +62,21 @@ OUTER:
 			s.rootLock.Unlock()
 
 			if ctrlMsg == nil && ourSnapshot.epoch != lastEpochMergePlanned {
-				ctrlMsg = ctrlMsgDflt
+				ctrlMsg = &mergerCtrl{ctx: context.Background(),
+					policy: s.MergePolicy(),
+					doneCh: nil}
 			}
 			if ctrlMsg != nil {
 				startTime := time.Now()
 
 				// lets get started
-				err := s.planMergeAtSnapshot(ctrlMsg.ctx, ctrlMsg.options,
+				err := s.planMergeAtSnapshot(ctrlMsg.ctx, ctrlMsg.policy,
 					ourSnapshot)
+				if err == errMergerPausing {
+					// plan again once the merger is resumed
+					_ = ourSnapshot.DecRef()
+					continue OUTER
+				}
 				if err != nil {
 					atomic.StoreUint64(&s.iStats.mergeEpoch, 0)
 					if err == segment.ErrClosed {
@@ -135,15 +145,36 @@ OUTER:
 }
 
 type mergerCtrl struct {
-	ctx     context.Context
-	options *mergeplan.MergePlanOptions
-	doneCh  chan struct{}
+	ctx    context.Context
+	policy mergeplan.Policy
+	doneCh chan struct{}
+	paused bool // Set before doneCh is closed, if the merger was paused.
 }
 
 // ForceMerge helps users trigger a merge operation on
 // an online scorch index.
 func (s *Scorch) ForceMerge(ctx context.Context,
 	mo *mergeplan.MergePlanOptions) error {
+	if mo != nil {
+		err := mergeplan.ValidateMergePlannerOptions(mo)
+		if err != nil {
+			return err
+		}
+	} else {
+		// assume the default single segment merge policy
+		mo = &mergeplan.SingleSegmentMergePlanOptions
+	}
+	return s.ForceMergeWithPolicy(ctx, &mergeplan.TieredPolicy{Options: *mo})
+}
+
+// ForceMergeWithPolicy is like ForceMerge, but merges the segments with
+// the policy.
+func (s *Scorch) ForceMergeWithPolicy(ctx context.Context,
+	policy mergeplan.Policy) error {
+	if s.MergerPaused() {
+		return ErrMergerPaused
+	}
+
 	// check whether force merge is already under processing
 	s.rootLock.Lock()
 	if s.stats.TotFileMergeForceOpsStarted >
@@ -155,16 +186,7 @@ func (s *Scorch) ForceMerge(ctx context.Context,
 	s.stats.TotFileMergeForceOpsStarted++
 	s.rootLock.Unlock()
 
-	if mo != nil {
-		err := mergeplan.ValidateMergePlannerOptions(mo)
-		if err != nil {
-			return err
-		}
-	} else {
-		// assume the default single segment merge policy
-		mo = &mergeplan.SingleSegmentMergePlanOptions
-	}
-	msg := &mergerCtrl{options: mo,
+	msg := &mergerCtrl{policy: policy,
 		doneCh: make(chan struct{}),
 		ctx:    ctx,
 	}
@@ -180,6 +202,9 @@ func (s *Scorch) ForceMerge(ctx context.Context,
 	select {
 	case <-msg.doneCh:
 		atomic.AddUint64(&s.stats.TotFileMergeForceOpsCompleted, 1)
+		if msg.paused {
+			return ErrMergerPaused
+		}
 	case <-s.closeCh:
 	}
 
@@ -240,7 +265,7 @@ func (w *closeChWrapper) listen() {
 }
 
 func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
-	options *mergeplan.MergePlanOptions, ourSnapshot *IndexSnapshot) error {
+	policy mergeplan.Policy, ourSnapshot *IndexSnapshot) error {
 	// build list of persisted segments in this snapshot
 	var onlyPersistedSnapshots []mergeplan.Segment
 	for _, segmentSnapshot := range ourSnapshot.segment {
@@ -252,7 +277,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 	atomic.AddUint64(&s.stats.TotFileMergePlan, 1)
 
 	// give this list to the planner
-	resultMergePlan, err := mergeplan.Plan(onlyPersistedSnapshots, options)
+	resultMergePlan, err := policy.Plan(onlyPersistedSnapshots)
 	if err != nil {
 		atomic.AddUint64(&s.stats.TotFileMergePlanErr, 1)
 		return fmt.Errorf("merge planning err: %v", err)
@@ -274,7 +299,16 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 
 	go cw.listen()
 
+	throttle := &mergeThrottle{s: s, closeCh: cw.closeCh}
+
 	for _, task := range resultMergePlan.Tasks {
+		if s.MergerPaused() {
+			for _, f := range filenames {
+				s.unmarkIneligibleForRemoval(f)
+			}
+			return errMergerPausing
+		}
+
 		if len(task.Segments) == 0 {
 			atomic.AddUint64(&s.stats.TotFileMergePlanTasksSegmentsEmpty, 1)
 			continue
@@ -286,6 +320,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 		newSegmentID := atomic.AddUint64(&s.nextSegmentID, 1)
 		segmentsToMerge := make([]segment.Segment, 0, len(task.Segments))
 		docsToDrop := make([]*roaring.Bitmap, 0, len(task.Segments))
+		var expiredToDrop uint64
 
 		for _, planSegment := range task.Segments {
 			if segSnapshot, ok := planSegment.(*SegmentSnapshot); ok {
@@ -296,31 +331,36 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 						oldMap[segSnapshot.id] = nil
 					} else {
 						segmentsToMerge = append(segmentsToMerge, segSnapshot.segment)
-						docsToDrop = append(docsToDrop, segSnapshot.deleted)
+						docsToDrop = append(docsToDrop, segSnapshot.hiddenDocs())
+						if segSnapshot.expired != nil {
+							expiredToDrop += segSnapshot.expired.GetCardinality()
+						}
 					}
 					// track the files getting merged for unsetting the
 					// removal ineligibility. This helps to unflip files
 					// even with fast merger, slow persister work flows.
-					path := persistedSeg.Path()
-					filenames = append(filenames,
-						strings.TrimPrefix(path, s.path+string(os.PathSeparator)))
+					filenames = append(filenames, segmentFileName(persistedSeg))
 				}
 			}
 		}
 
 		var oldNewDocNums map[uint64][]uint64
 		var seg segment.Segment
+		var expiries *segmentExpiries
 		var filename string
 		if len(segmentsToMerge) > 0 {
 			filename = zapFileName(newSegmentID)
 			s.markIneligibleForRemoval(filename)
-			path := s.path + string(os.PathSeparator) + filename
 
 			fileMergeZapStartTime := time.Now()
 
 			atomic.AddUint64(&s.stats.TotFileMergeZapBeg, 1)
-			newDocNums, _, err := s.segPlugin.Merge(segmentsToMerge, docsToDrop, path,
-				cw.closeCh, s)
+			var newDocNums [][]uint64
+			err := s.dir.Create(filename, func(path string) (err error) {
+				newDocNums, _, err = s.segPlugin.Merge(segmentsToMerge, docsToDrop, path,
+					cw.closeCh, throttle)
+				return err
+			})
 			atomic.AddUint64(&s.stats.TotFileMergeZapEnd, 1)
 
 			fileMergeZapTime := uint64(time.Since(fileMergeZapStartTime))
@@ -338,18 +378,26 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 				return fmt.Errorf("merging failed: %v", err)
 			}
 
-			seg, err = s.segPlugin.Open(path)
+			seg, err = s.dir.Open(filename, s.segPlugin.Open)
 			if err != nil {
 				s.unmarkIneligibleForRemoval(filename)
 				atomic.AddUint64(&s.stats.TotFileMergePlanTasksErr, 1)
 				return err
 			}
+			expiries, err = s.loadExpiries(seg)
+			if err != nil {
+				_ = seg.Close()
+				s.unmarkIneligibleForRemoval(filename)
+				atomic.AddUint64(&s.stats.TotFileMergePlanTasksErr, 1)
+				return err
+			}
 			oldNewDocNums = make(map[uint64][]uint64)
 			for i, segNewDocNums := range newDocNums {
 				oldNewDocNums[task.Segments[i].Id()] = segNewDocNums
 			}
 
 			atomic.AddUint64(&s.stats.TotFileMergeSegments, uint64(len(segmentsToMerge)))
+			atomic.AddUint64(&s.stats.TotExpiredItemsPurged, expiredToDrop)
 		}
 
 		sm := &segmentMerge{
@@ -357,6 +405,7 @@ func (s *Scorch) planMergeAtSnapshot(ctx context.Context,
 			old:           oldMap,
 			oldNewDocNums: oldNewDocNums,
 			new:           seg,
+			expiries:      expiries,
 			notifyCh:      make(chan *mergeTaskIntroStatus),
 		}
 
@@ -415,7 +464,9 @@ type segmentMerge struct {
 	old           map[uint64]*SegmentSnapshot
 	oldNewDocNums map[uint64][]uint64
 	new           segment.Segment
+	expiries      *segmentExpiries // The expiry times of new's documents, if any.
 	notifyCh      chan *mergeTaskIntroStatus
+	persisted     chan error // Closed once the introduction is persisted, if not nil.
 }
 
 // perform a merging of the given SegmentBase instances into a new,
@@ -432,10 +483,13 @@ func (s *Scorch) mergeSegmentBases(snapshot *IndexSnapshot,
 
 	newSegmentID := atomic.AddUint64(&s.nextSegmentID, 1)
 	filename := zapFileName(newSegmentID)
-	path := s.path + string(os.PathSeparator) + filename
 
-	newDocNums, _, err :=
-		s.segPlugin.Merge(sbs, sbsDrops, path, s.closeCh, s)
+	var newDocNums [][]uint64
+	err := s.dir.Create(filename, func(path string) (err error) {
+		newDocNums, _, err =
+			s.segPlugin.Merge(sbs, sbsDrops, path, s.closeCh, s)
+		return err
+	})
 
 	atomic.AddUint64(&s.stats.TotMemMergeZapEnd, 1)
 
@@ -450,12 +504,19 @@ func (s *Scorch) mergeSegmentBases(snapshot *IndexSnapshot,
 		return nil, 0, err
 	}
 
-	seg, err := s.segPlugin.Open(path)
+	seg, err := s.dir.Open(filename, s.segPlugin.Open)
 	if err != nil {
 		atomic.AddUint64(&s.stats.TotMemMergeErr, 1)
 		return nil, 0, err
 	}
 
+	expiries, err := s.loadExpiries(seg)
+	if err != nil {
+		_ = seg.Close()
+		atomic.AddUint64(&s.stats.TotMemMergeErr, 1)
+		return nil, 0, err
+	}
+
 	// update persisted stats
 	atomic.AddUint64(&s.stats.TotPersistedItems, seg.Count())
 	atomic.AddUint64(&s.stats.TotPersistedSegments, 1)
@@ -465,6 +526,7 @@ func (s *Scorch) mergeSegmentBases(snapshot *IndexSnapshot,
 		old:           make(map[uint64]*SegmentSnapshot),
 		oldNewDocNums: make(map[uint64][]uint64),
 		new:           seg,
+		expiries:      expiries,
 		notifyCh:      make(chan *mergeTaskIntroStatus),
 	}
 
@@ -472,6 +534,9 @@ func (s *Scorch) mergeSegmentBases(snapshot *IndexSnapshot,
 		ss := snapshot.segment[idx]
 		sm.old[ss.id] = ss
 		sm.oldNewDocNums[ss.id] = newDocNums[i]
+		if ss.expired != nil {
+			atomic.AddUint64(&s.stats.TotExpiredItemsPurged, ss.expired.GetCardinality())
+		}
 	}
 
 	select { // send to introducer
@@ -0,0 +1,224 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/blevesearch/bleve/index/scorch/mergeplan"
+	"github.com/blevesearch/bleve/index/scorch/segment"
+)
+
+// ErrMergerPaused is returned by ForceMerge when the merger is paused,
+// before or while it's merging.
+var ErrMergerPaused = fmt.Errorf("scorch: merger paused")
+
+// errMergerPausing stops the merger between merge tasks, when it's paused.
+var errMergerPausing = fmt.Errorf("scorch: merger pausing")
+
+// parseMergePolicy returns the merge policy named by the
+// "scorchMergePolicy" config, configured by "scorchMergePolicyOptions",
+// and otherwise the tiered policy configured by "scorchMergePlanOptions".
+func (s *Scorch) parseMergePolicy() (mergeplan.Policy, error) {
+	name, ok := s.config["scorchMergePolicy"].(string)
+	if !ok {
+		options, err := s.parseMergePlannerOptions()
+		if err != nil {
+			return nil, fmt.Errorf("mergePlannerOption json parsing err: %v", err)
+		}
+		return &mergeplan.TieredPolicy{Options: *options}, nil
+	}
+	var options map[string]interface{}
+	if v, ok := s.config["scorchMergePolicyOptions"]; ok {
+		options, ok = v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("scorchMergePolicyOptions must be an object, got %T", v)
+		}
+	}
+	return mergeplan.NewPolicy(name, options)
+}
+
+// MergePolicy returns the policy the merger plans merges with.
+func (s *Scorch) MergePolicy() mergeplan.Policy {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+	return s.mergePolicy
+}
+
+// SetMergePolicy replaces the policy the merger plans merges with, from
+// its next round, after the index changes.
+func (s *Scorch) SetMergePolicy(policy mergeplan.Policy) {
+	s.rootLock.Lock()
+	s.mergePolicy = policy
+	s.rootLock.Unlock()
+}
+
+// PauseMerger stops the merger from merging segments until ResumeMerger
+// is called. A merge task that's in progress is finished first.
+func (s *Scorch) PauseMerger() {
+	s.rootLock.Lock()
+	if s.mergerResumeCh == nil {
+		s.mergerResumeCh = make(chan struct{})
+		close(s.mergerPauseCh)
+	}
+	s.rootLock.Unlock()
+}
+
+// ResumeMerger lets a paused merger merge segments again.
+func (s *Scorch) ResumeMerger() {
+	s.rootLock.Lock()
+	if s.mergerResumeCh != nil {
+		close(s.mergerResumeCh)
+		s.mergerResumeCh = nil
+		s.mergerPauseCh = make(chan struct{})
+	}
+	s.rootLock.Unlock()
+}
+
+// MergerPaused returns whether the merger is paused.
+func (s *Scorch) MergerPaused() bool {
+	return s.mergerPausedCh() != nil
+}
+
+// mergerPausedCh returns a channel closed when the merger is resumed, or
+// nil if it isn't paused.
+func (s *Scorch) mergerPausedCh() chan struct{} {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+	return s.mergerResumeCh
+}
+
+// mergerPausingCh returns a channel closed once the merger is paused.
+func (s *Scorch) mergerPausingCh() chan struct{} {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+	return s.mergerPauseCh
+}
+
+// SetMergeBandwidth limits the rate at which the merger writes merged
+// segments, in bytes per second, or lifts the limit if it's 0. It can
+// be set initially with the "scorchMergeMaxBytesPerSec" config.
+func (s *Scorch) SetMergeBandwidth(bytesPerSec int64) {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	atomic.StoreInt64(&s.mergeBytesPerSec, bytesPerSec)
+}
+
+// MergeBandwidth returns the merger's limit set by SetMergeBandwidth.
+func (s *Scorch) MergeBandwidth() int64 {
+	return atomic.LoadInt64(&s.mergeBytesPerSec)
+}
+
+// mergeThrottle reports the bytes written by the merges of the merger,
+// and sleeps to keep their rate under its limit.
+type mergeThrottle struct {
+	s       *Scorch
+	closeCh chan struct{}
+
+	limit int64 // The limit start and bytes were counted from.
+	start time.Time
+	bytes uint64
+}
+
+func (t *mergeThrottle) ReportBytesWritten(bytesWritten uint64) {
+	t.s.ReportBytesWritten(bytesWritten)
+
+	limit := atomic.LoadInt64(&t.s.mergeBytesPerSec)
+	if limit <= 0 {
+		t.limit = 0
+		return
+	}
+	if limit != t.limit {
+		t.limit, t.start, t.bytes = limit, time.Now(), 0
+	}
+	t.bytes += bytesWritten
+	wait := time.Duration(float64(t.bytes)/float64(limit)*float64(time.Second)) -
+		time.Since(t.start)
+	if wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	startWait := time.Now()
+	select {
+	case <-timer.C:
+	case <-t.closeCh:
+	}
+	atomic.AddUint64(&t.s.stats.TotFileMergeThrottleTime, uint64(time.Since(startWait)))
+}
+
+// PlannedMergeTask is a merge task planned by a merge policy, see
+// PlanMerges.
+type PlannedMergeTask struct {
+	Segments []PlannedMergeSegment `json:"segments"`
+}
+
+// PlannedMergeSegment is a segment of a PlannedMergeTask. Its sizes are
+// the sizes seen by the merge policy.
+type PlannedMergeSegment struct {
+	ID       uint64 `json:"id"`
+	File     string `json:"file"`
+	FullSize int64  `json:"full_size"`
+	LiveSize int64  `json:"live_size"`
+}
+
+// PlanMerges returns the merge tasks the policy plans for the persisted
+// segments of the current root, without running them. If policy is nil,
+// the index's merge policy is used.
+func (s *Scorch) PlanMerges(policy mergeplan.Policy) ([]PlannedMergeTask, error) {
+	if policy == nil {
+		policy = s.MergePolicy()
+	}
+
+	s.rootLock.RLock()
+	snapshot := s.root
+	snapshot.AddRef()
+	s.rootLock.RUnlock()
+	defer func() { _ = snapshot.DecRef() }()
+
+	var segments []mergeplan.Segment
+	for _, segmentSnapshot := range snapshot.segment {
+		if _, ok := segmentSnapshot.segment.(segment.PersistedSegment); ok {
+			segments = append(segments, segmentSnapshot)
+		}
+	}
+
+	plan, err := policy.Plan(segments)
+	if err != nil || plan == nil {
+		return nil, err
+	}
+	rv := make([]PlannedMergeTask, 0, len(plan.Tasks))
+	for _, task := range plan.Tasks {
+		var t PlannedMergeTask
+		for _, planSegment := range task.Segments {
+			ps := PlannedMergeSegment{
+				ID:       planSegment.Id(),
+				FullSize: planSegment.FullSize(),
+				LiveSize: planSegment.LiveSize(),
+			}
+			if segSnapshot, ok := planSegment.(*SegmentSnapshot); ok {
+				if seg, ok := segSnapshot.segment.(segment.PersistedSegment); ok {
+					ps.File = segmentFileName(seg)
+				}
+			}
+			t.Segments = append(t.Segments, ps)
+		}
+		rv = append(rv, t)
+	}
+	return rv, nil
+}
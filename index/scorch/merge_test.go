@@ -15,12 +15,15 @@
 package scorch
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/blevesearch/bleve/document"
 	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/scorch/mergeplan"
 )
 
 func TestObsoleteSegmentMergeIntroduction(t *testing.T) {
@@ -152,3 +155,282 @@ func TestObsoleteSegmentMergeIntroduction(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type noMergePolicy struct {
+	plans int64
+}
+
+func (p *noMergePolicy) Plan(segments []mergeplan.Segment) (*mergeplan.MergePlan, error) {
+	atomic.AddInt64(&p.plans, 1)
+	return nil, nil
+}
+
+func numPersistedSegments(t *testing.T, s *Scorch) int {
+	snapshot := s.currentSnapshot()
+	defer func() {
+		err := snapshot.DecRef()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	return len(snapshot.segment)
+}
+
+func TestMergePolicyRegistry(t *testing.T) {
+	cfg := CreateConfig("TestMergePolicyRegistry")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	policy := &noMergePolicy{}
+	mergeplan.RegistryPolicies["test-none"] = func(options map[string]interface{}) (mergeplan.Policy, error) {
+		return policy, nil
+	}
+	defer delete(mergeplan.RegistryPolicies, "test-none")
+	cfg["scorchMergePolicy"] = "test-none"
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	s := idx.(*Scorch)
+	if s.MergePolicy() != policy {
+		t.Fatalf("expected the registered policy, got %v", s.MergePolicy())
+	}
+
+	updateDocs(t, idx, "a", "b")
+	updateDocs(t, idx, "c", "d")
+	updateDocs(t, idx, "e", "f")
+	updateDocs(t, idx, "g", "h")
+	deleteDocs(t, idx, "a", "c")
+	if n := numPersistedSegments(t, s); n != 4 {
+		t.Errorf("expected 4 segments with the policy, got %d", n)
+	}
+
+	tasks, err := s.PlanMerges(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 0 || atomic.LoadInt64(&policy.plans) == 0 {
+		t.Errorf("expected no tasks from the policy, got %v", tasks)
+	}
+
+	deletes, err := mergeplan.NewPolicy(mergeplan.DeletesPolicyName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err = s.PlanMerges(deletes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || len(tasks[0].Segments) != 2 {
+		t.Fatalf("expected a task merging the 2 deleted segments, got %v", tasks)
+	}
+	for _, seg := range tasks[0].Segments {
+		if seg.LiveSize != 1 || seg.FullSize != 2 || seg.File == "" {
+			t.Errorf("unexpected planned segment %+v", seg)
+		}
+	}
+	// Planning doesn't merge.
+	if n := numPersistedSegments(t, s); n != 4 {
+		t.Errorf("expected 4 segments after planning, got %d", n)
+	}
+
+	err = s.ForceMergeWithPolicy(context.Background(), deletes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := numPersistedSegments(t, s); n != 3 {
+		t.Errorf("expected 3 segments after merging, got %d", n)
+	}
+	checkDocCount(t, idx, 6)
+}
+
+func TestPauseMerger(t *testing.T) {
+	cfg := CreateConfig("TestPauseMerger")
+	cfg["scorchMergePolicy"] = mergeplan.TieredPolicyName
+	cfg["scorchMergePolicyOptions"] = map[string]interface{}{
+		"maxSegmentsPerTier":   1,
+		"segmentsPerMergeTask": 2,
+		"floorSegmentSize":     1,
+	}
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	s := idx.(*Scorch)
+
+	s.PauseMerger()
+	if !s.MergerPaused() {
+		t.Fatal("expected the merger to be paused")
+	}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		updateDocs(t, idx, id)
+	}
+	if n := numPersistedSegments(t, s); n != 4 {
+		t.Errorf("expected 4 segments while paused, got %d", n)
+	}
+	err = s.ForceMerge(context.Background(), nil)
+	if err != ErrMergerPaused {
+		t.Errorf("expected ErrMergerPaused, got %v", err)
+	}
+	tasks, err := s.PlanMerges(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) == 0 {
+		t.Errorf("expected planned tasks while paused")
+	}
+
+	s.ResumeMerger()
+	s.SetMergeBandwidth(1 << 20)
+	err = s.ForceMerge(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := numPersistedSegments(t, s); n != 1 {
+		t.Errorf("expected 1 segment after resuming, got %d", n)
+	}
+	if atomic.LoadUint64(&s.stats.TotFileMergeThrottleTime) == 0 {
+		t.Errorf("expected merges to be throttled")
+	}
+	checkDocCount(t, idx, 4)
+}
+
+func TestPauseMergerPersists(t *testing.T) {
+	cfg := CreateConfig("TestPauseMergerPersists")
+	cfg["scorchPersisterOptions"] = map[string]interface{}{
+		"PersisterNapUnderNumFiles": 2,
+	}
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	s := idx.(*Scorch)
+
+	// The persister doesn't wait for a paused merger to catch up.
+	s.PauseMerger()
+	errCh := make(chan error, 1)
+	go func() {
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			batch := index.NewBatch()
+			batch.Update(document.NewDocument(id))
+			err := idx.Batch(batch)
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- nil
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected batches to be persisted while the merger is paused")
+	}
+	if n := numPersistedSegments(t, s); n != 5 {
+		t.Errorf("expected 5 segments while paused, got %d", n)
+	}
+	s.ResumeMerger()
+	checkDocCount(t, idx, 5)
+}
+
+// blockingMergePolicy plans merging all the segments, once release is
+// closed.
+type blockingMergePolicy struct {
+	planning chan struct{}
+	release  chan struct{}
+}
+
+func (p *blockingMergePolicy) Plan(segments []mergeplan.Segment) (*mergeplan.MergePlan, error) {
+	close(p.planning)
+	<-p.release
+	return &mergeplan.MergePlan{Tasks: []*mergeplan.MergeTask{{Segments: segments}}}, nil
+}
+
+func TestPauseMergerDuringForceMerge(t *testing.T) {
+	cfg := CreateConfig("TestPauseMergerDuringForceMerge")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	s := idx.(*Scorch)
+	s.SetMergePolicy(&noMergePolicy{})
+	updateDocs(t, idx, "a")
+	updateDocs(t, idx, "b")
+
+	policy := &blockingMergePolicy{
+		planning: make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ForceMergeWithPolicy(context.Background(), policy)
+	}()
+	<-policy.planning
+	s.PauseMerger()
+	close(policy.release)
+	err = <-errCh
+	if err != ErrMergerPaused {
+		t.Errorf("expected ErrMergerPaused, got %v", err)
+	}
+	if n := numPersistedSegments(t, s); n != 2 {
+		t.Errorf("expected 2 segments, got %d", n)
+	}
+	s.ResumeMerger()
+}
@@ -589,3 +589,73 @@ func emit(descrip string, cycle int, step int, segments []Segment, plan *MergePl
 	fmt.Printf("%s %d.%d ---------- %s\n", descrip, cycle, step, suffix)
 	fmt.Printf("%s\n", ToBarChart(descrip, 100, segments, plan))
 }
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy(TieredPolicyName, map[string]interface{}{
+		"maxSegmentsPerTier": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiered := p.(*TieredPolicy)
+	if tiered.Options.MaxSegmentsPerTier != 1 ||
+		tiered.Options.SegmentsPerMergeTask != DefaultMergePlanOptions.SegmentsPerMergeTask {
+		t.Errorf("unexpected options %+v", tiered.Options)
+	}
+
+	_, err = NewPolicy(TieredPolicyName, map[string]interface{}{
+		"maxSegmentSize": int64(MaxSegmentSizeLimit) + 1,
+	})
+	if err != ErrMaxSegmentSizeTooLarge {
+		t.Errorf("expected ErrMaxSegmentSizeTooLarge, got %v", err)
+	}
+
+	_, err = NewPolicy("unknown", nil)
+	if err == nil {
+		t.Errorf("expected error for an unknown policy")
+	}
+}
+
+func TestDeletesPolicy(t *testing.T) {
+	p, err := NewPolicy(DeletesPolicyName, map[string]interface{}{
+		"minDeletedRatio":      0.5,
+		"segmentsPerMergeTask": 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segs := []Segment{
+		&segment{MyId: 1, MyFullSize: 100, MyLiveSize: 100},
+		&segment{MyId: 2, MyFullSize: 100, MyLiveSize: 10},
+		&segment{MyId: 3, MyFullSize: 100, MyLiveSize: 50},
+		&segment{MyId: 4, MyFullSize: 100, MyLiveSize: 0},
+		&segment{MyId: 5, MyFullSize: 100, MyLiveSize: 60},
+	}
+	plan, err := p.Plan(segs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &MergePlan{Tasks: []*MergeTask{
+		{Segments: []Segment{segs[3], segs[1]}},
+		{Segments: []Segment{segs[2]}},
+	}}
+	if !reflect.DeepEqual(plan, expect) {
+		t.Errorf("expected plan %v, got %v", expect, plan)
+	}
+
+	plan, err = p.Plan(segs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan != nil {
+		t.Errorf("expected no plan, got %v", plan)
+	}
+
+	_, err = NewPolicy(DeletesPolicyName, map[string]interface{}{
+		"minDeletedRatio": 2,
+	})
+	if err == nil {
+		t.Errorf("expected error for a ratio over 1")
+	}
+}
@@ -0,0 +1,163 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mergeplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// A Policy decides which segments should be merged together. Its Plan
+// has the same contract as the Plan() API.
+type Policy interface {
+	Plan(segments []Segment) (*MergePlan, error)
+}
+
+// A PolicyConstructor returns a Policy configured by the options, which
+// are usually parsed from JSON.
+type PolicyConstructor func(options map[string]interface{}) (Policy, error)
+
+// RegistryPolicies should be treated as read-only after process
+// init()'ialization. It holds the "tiered" and "deletes" policies, and
+// custom policies can be registered alongside them.
+var RegistryPolicies = map[string]PolicyConstructor{
+	TieredPolicyName:  NewTieredPolicy,
+	DeletesPolicyName: NewDeletesPolicy,
+}
+
+// NewPolicy returns the policy registered under the name, configured by
+// the options.
+func NewPolicy(name string, options map[string]interface{}) (Policy, error) {
+	ctr, ok := RegistryPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("no merge policy named %s", name)
+	}
+	return ctr(options)
+}
+
+// parseOptions sets the fields of rv from the options.
+func parseOptions(options map[string]interface{}, rv interface{}) error {
+	if options == nil {
+		return nil
+	}
+	b, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, rv)
+}
+
+const TieredPolicyName = "tiered"
+
+// TieredPolicy is the Policy of the Plan() API.
+type TieredPolicy struct {
+	Options MergePlanOptions
+}
+
+// NewTieredPolicy returns a TieredPolicy with the MergePlanOptions set
+// by the options, starting from the DefaultMergePlanOptions.
+func NewTieredPolicy(options map[string]interface{}) (Policy, error) {
+	rv := &TieredPolicy{Options: DefaultMergePlanOptions}
+	err := parseOptions(options, &rv.Options)
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateMergePlannerOptions(&rv.Options)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func (p *TieredPolicy) Plan(segments []Segment) (*MergePlan, error) {
+	return plan(segments, &p.Options)
+}
+
+const DeletesPolicyName = "deletes"
+
+// DeletesPolicy merges the segments with a ratio of deleted documents of
+// at least MinDeletedRatio, which drops the deleted documents, and
+// leaves the other segments alone. A segment can be merged on its own.
+type DeletesPolicy struct {
+	// MinDeletedRatio is the ratio of deleted documents of the segments
+	// that are merged, 0.2 by default.
+	MinDeletedRatio float64
+
+	// SegmentsPerMergeTask is the most segments merged together, 10 by
+	// default.
+	SegmentsPerMergeTask int
+
+	// MaxSegmentSize is the largest live size of a merged segment, 1<<30
+	// by default.
+	MaxSegmentSize int64
+}
+
+// NewDeletesPolicy returns a DeletesPolicy configured by the options.
+func NewDeletesPolicy(options map[string]interface{}) (Policy, error) {
+	rv := &DeletesPolicy{
+		MinDeletedRatio:      0.2,
+		SegmentsPerMergeTask: 10,
+		MaxSegmentSize:       1 << 30,
+	}
+	err := parseOptions(options, rv)
+	if err != nil {
+		return nil, err
+	}
+	if rv.MinDeletedRatio <= 0 || rv.MinDeletedRatio > 1 {
+		return nil, fmt.Errorf("MinDeletedRatio must be in (0, 1], got %v", rv.MinDeletedRatio)
+	}
+	if rv.SegmentsPerMergeTask < 1 {
+		return nil, fmt.Errorf("SegmentsPerMergeTask must be at least 1, got %d", rv.SegmentsPerMergeTask)
+	}
+	if rv.MaxSegmentSize > MaxSegmentSizeLimit {
+		return nil, ErrMaxSegmentSizeTooLarge
+	}
+	return rv, nil
+}
+
+func (p *DeletesPolicy) Plan(segments []Segment) (*MergePlan, error) {
+	var eligibles []Segment
+	for _, segment := range segments {
+		if segment.FullSize() <= 0 {
+			continue
+		}
+		deleted := segment.FullSize() - segment.LiveSize()
+		if float64(deleted)/float64(segment.FullSize()) >= p.MinDeletedRatio {
+			eligibles = append(eligibles, segment)
+		}
+	}
+	if len(eligibles) == 0 {
+		return nil, nil
+	}
+
+	// The smallest segments are merged together first.
+	sort.Sort(sort.Reverse(byLiveSizeDescending(eligibles)))
+
+	rv := &MergePlan{}
+	var task *MergeTask
+	var taskLiveSize int64
+	for _, segment := range eligibles {
+		if task == nil || len(task.Segments) >= p.SegmentsPerMergeTask ||
+			taskLiveSize+segment.LiveSize() > p.MaxSegmentSize {
+			task = &MergeTask{}
+			taskLiveSize = 0
+			rv.Tasks = append(rv.Tasks, task)
+		}
+		task.Segments = append(task.Segments, segment)
+		taskLiveSize += segment.LiveSize()
+	}
+	return rv, nil
+}
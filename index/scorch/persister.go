@@ -19,10 +19,8 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -283,6 +281,8 @@ func (s *Scorch) pausePersisterForMergerCatchUp(lastPersistedEpoch uint64,
 	// Persister pause until the merger catches up to reduce the segment
 	// file count under the threshold.
 	// But if there is memory pressure, then skip this sleep maneuvers.
+	// A paused merger won't catch up, so don't wait for it then.
+	pausedCh := s.mergerPausingCh()
 OUTER:
 	for po.PersisterNapUnderNumFiles > 0 &&
 		numFilesOnDisk >= uint64(po.PersisterNapUnderNumFiles) &&
@@ -292,6 +292,8 @@ OUTER:
 		select {
 		case <-s.closeCh:
 			break OUTER
+		case <-pausedCh:
+			break OUTER
 		case ew := <-s.persisterNotifier:
 			persistWatchers = append(persistWatchers, ew)
 			lastMergedEpoch = ew.epoch
@@ -364,7 +366,7 @@ func (s *Scorch) persistSnapshotMaybeMerge(snapshot *IndexSnapshot) (
 	for i, segmentSnapshot := range snapshot.segment {
 		if _, ok := segmentSnapshot.segment.(segment.PersistedSegment); !ok {
 			sbs = append(sbs, segmentSnapshot.segment)
-			sbsDrops = append(sbsDrops, segmentSnapshot.deleted)
+			sbsDrops = append(sbsDrops, segmentSnapshot.hiddenDocs())
 			sbsIndexes = append(sbsIndexes, i)
 		}
 	}
@@ -428,7 +430,7 @@ func (s *Scorch) persistSnapshotMaybeMerge(snapshot *IndexSnapshot) (
 	return true, nil
 }
 
-func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
+func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, dir Directory,
 	segPlugin segment.Plugin) ([]string, map[uint64]string, error) {
 	snapshotsBucket, err := tx.CreateBucketIfNotExists(boltSnapshotsBucket)
 	if err != nil {
@@ -470,7 +472,7 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 	}
 
 	var filenames []string
-	newSegmentPaths := make(map[uint64]string)
+	newSegmentNames := make(map[uint64]string)
 
 	// first ensure that each segment in this snapshot has been persisted
 	for _, segmentSnapshot := range snapshot.segment {
@@ -481,8 +483,7 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 		}
 		switch seg := segmentSnapshot.segment.(type) {
 		case segment.PersistedSegment:
-			segPath := seg.Path()
-			filename := strings.TrimPrefix(segPath, path+string(os.PathSeparator))
+			filename := segmentFileName(seg)
 			err = snapshotSegmentBucket.Put(boltPathKey, []byte(filename))
 			if err != nil {
 				return nil, nil, err
@@ -491,12 +492,11 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 		case segment.UnpersistedSegment:
 			// need to persist this to disk
 			filename := zapFileName(segmentSnapshot.id)
-			path := path + string(os.PathSeparator) + filename
-			err = seg.Persist(path)
+			err = dir.Create(filename, seg.Persist)
 			if err != nil {
 				return nil, nil, fmt.Errorf("error persisting segment: %v", err)
 			}
-			newSegmentPaths[segmentSnapshot.id] = path
+			newSegmentNames[segmentSnapshot.id] = filename
 			err = snapshotSegmentBucket.Put(boltPathKey, []byte(filename))
 			if err != nil {
 				return nil, nil, err
@@ -519,7 +519,7 @@ func prepareBoltSnapshot(snapshot *IndexSnapshot, tx *bolt.Tx, path string,
 		}
 	}
 
-	return filenames, newSegmentPaths, nil
+	return filenames, newSegmentNames, nil
 }
 
 func (s *Scorch) persistSnapshotDirect(snapshot *IndexSnapshot) (err error) {
@@ -535,7 +535,17 @@ func (s *Scorch) persistSnapshotDirect(snapshot *IndexSnapshot) (err error) {
 		}
 	}()
 
-	filenames, newSegmentPaths, err := prepareBoltSnapshot(snapshot, tx, s.path, s.segPlugin)
+	filenames, newSegmentNames, err := prepareBoltSnapshot(snapshot, tx, s.dir, s.segPlugin)
+	if err != nil {
+		return err
+	}
+
+	numChanges, err := s.prepareBoltChanges(snapshot, tx)
+	if err != nil {
+		return err
+	}
+
+	walTruncated, err := s.prepareBoltWAL(snapshot, tx)
 	if err != nil {
 		return err
 	}
@@ -547,7 +557,7 @@ func (s *Scorch) persistSnapshotDirect(snapshot *IndexSnapshot) (err error) {
 	// other cases like updates to internal values only, and/or when
 	// there are only deletions, are already covered and persisted by
 	// the newly populated boltdb snapshotBucket above
-	if len(newSegmentPaths) > 0 {
+	if len(newSegmentNames) > 0 {
 		// now try to open all the new snapshots
 		newSegments := make(map[uint64]segment.Segment)
 		defer func() {
@@ -559,10 +569,10 @@ func (s *Scorch) persistSnapshotDirect(snapshot *IndexSnapshot) (err error) {
 				}
 			}
 		}()
-		for segmentID, path := range newSegmentPaths {
-			newSegments[segmentID], err = s.segPlugin.Open(path)
+		for segmentID, filename := range newSegmentNames {
+			newSegments[segmentID], err = s.dir.Open(filename, s.segPlugin.Open)
 			if err != nil {
-				return fmt.Errorf("error opening new segment at %s, %v", path, err)
+				return fmt.Errorf("error opening new segment %s, %v", filename, err)
 			}
 		}
 
@@ -602,6 +612,9 @@ func (s *Scorch) persistSnapshotDirect(snapshot *IndexSnapshot) (err error) {
 	}
 	s.rootLock.Unlock()
 
+	s.changesPersisted(numChanges)
+	s.walTruncated(walTruncated)
+
 	return nil
 }
 
@@ -762,8 +775,7 @@ func (s *Scorch) loadSegment(segmentBucket *bolt.Bucket) (*SegmentSnapshot, erro
 	if pathBytes == nil {
 		return nil, fmt.Errorf("segment path missing")
 	}
-	segmentPath := s.path + string(os.PathSeparator) + string(pathBytes)
-	segment, err := s.segPlugin.Open(segmentPath)
+	segment, err := s.dir.Open(string(pathBytes), s.segPlugin.Open)
 	if err != nil {
 		return nil, fmt.Errorf("error opening bolt segment: %v", err)
 	}
@@ -771,6 +783,7 @@ func (s *Scorch) loadSegment(segmentBucket *bolt.Bucket) (*SegmentSnapshot, erro
 	rv := &SegmentSnapshot{
 		segment:    segment,
 		cachedDocs: &cachedDocs{cache: nil},
+		fieldStats: &segmentFieldStats{},
 	}
 	deletedBytes := segmentBucket.Get(boltDeletedKey)
 	if deletedBytes != nil {
@@ -786,6 +799,13 @@ func (s *Scorch) loadSegment(segmentBucket *bolt.Bucket) (*SegmentSnapshot, erro
 		}
 	}
 
+	rv.expiries, err = s.loadExpiries(segment)
+	if err != nil {
+		_ = segment.Close()
+		return nil, fmt.Errorf("error reading expiries: %v", err)
+	}
+	expireSegment(rv, nil, time.Now().UnixNano())
+
 	return rv, nil
 }
 
@@ -874,12 +894,15 @@ func (s *Scorch) removeOldBoltSnapshots() (numRemoved int, err error) {
 			numRemoved++
 		}
 	}
+	if err == nil {
+		err = removeBoltChanges(tx, epochsToRemove)
+	}
 
 	return numRemoved, err
 }
 
 func (s *Scorch) maxSegmentIDOnDisk() (uint64, error) {
-	currFileInfos, err := ioutil.ReadDir(s.path)
+	currFileInfos, err := s.dir.List()
 	if err != nil {
 		return 0, err
 	}
@@ -908,18 +931,34 @@ func (s *Scorch) removeOldZapFiles() error {
 		return err
 	}
 
-	currFileInfos, err := ioutil.ReadDir(s.path)
+	currFileInfos, err := s.dir.List()
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
 	s.rootLock.RLock()
+	s.unreferencedLock.Lock()
 
 	for _, finfo := range currFileInfos {
 		fname := finfo.Name()
 		if filepath.Ext(fname) == ".zap" {
-			if _, exists := liveFileNames[fname]; !exists && !s.ineligibleForRemoval[fname] {
-				err := os.Remove(s.path + string(os.PathSeparator) + fname)
+			if _, exists := liveFileNames[fname]; !exists && !s.ineligibleForRemoval[fname] &&
+				s.filesInUse[fname] == 0 {
+				// keep the file for the grace period, for the readers
+				// of shared indexes that may be opening it
+				if s.removalGracePeriod > 0 {
+					since, ok := s.unreferencedSince[fname]
+					if !ok {
+						s.unreferencedSince[fname] = now
+					}
+					if !ok || now.Sub(since) < s.removalGracePeriod {
+						atomic.AddUint64(&s.stats.TotFileRemovalDeferred, 1)
+						continue
+					}
+				}
+				delete(s.unreferencedSince, fname)
+				err := s.dir.Remove(fname)
 				if err != nil {
 					log.Printf("got err removing file: %s, err: %v", fname, err)
 				}
@@ -927,6 +966,7 @@ func (s *Scorch) removeOldZapFiles() error {
 		}
 	}
 
+	s.unreferencedLock.Unlock()
 	s.rootLock.RUnlock()
 
 	return nil
@@ -0,0 +1,554 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ReplicationManifest describes a persisted snapshot of a leader index,
+// which a follower applies after copying the segment files it lacks.
+type ReplicationManifest struct {
+	Epoch          uint64                `json:"epoch"`
+	SegmentType    string                `json:"segment_type"`
+	SegmentVersion uint32                `json:"segment_version"`
+	Internal       []ReplicationInternal `json:"internal,omitempty"`
+	Segments       []ReplicationSegment  `json:"segments"`
+}
+
+// ReplicationInternal is an internal value of a snapshot.
+type ReplicationInternal struct {
+	Key []byte `json:"key"`
+	Val []byte `json:"val"`
+}
+
+// ReplicationSegment is a segment of a snapshot, with the segment file's
+// name and size, and the snapshot's deleted bitmap of the segment, in
+// roaring's format.
+type ReplicationSegment struct {
+	ID      uint64 `json:"id"`
+	File    string `json:"file"`
+	Size    int64  `json:"size"`
+	Deleted []byte `json:"deleted,omitempty"`
+}
+
+// ReplicationSource is how a follower reads from its leader.
+type ReplicationSource interface {
+	// Manifest returns the manifest of the leader's latest persisted
+	// snapshot.
+	Manifest() (*ReplicationManifest, error)
+
+	// ReadSegment writes the contents of the leader's segment file with
+	// the name to w.
+	ReadSegment(name string, w io.Writer) error
+}
+
+// ErrReplica is returned when a replica index is written to.
+var ErrReplica = fmt.Errorf("scorch: replica indexes are only updated by replication")
+
+func validSegmentFileName(name string) bool {
+	return name == filepath.Base(name) && filepath.Ext(name) == ".zap"
+}
+
+// ReplicationLeaseDuration is how long the segment files of a manifest
+// are kept from being removed, for followers to copy them.
+var ReplicationLeaseDuration = time.Minute
+
+// ReplicationManifest returns the manifest of the index's latest
+// persisted snapshot, for its followers. Its segment files are kept for
+// ReplicationLeaseDuration, even if the snapshot is removed meanwhile.
+func (s *Scorch) ReplicationManifest() (*ReplicationManifest, error) {
+	if s.rootBolt == nil {
+		return nil, fmt.Errorf("scorch: index isn't persisted")
+	}
+	// The files may be removed between reading the snapshot and marking
+	// them in use, in which case a newer snapshot has to be read.
+	for i := 0; ; i++ {
+		manifest, err := s.readReplicationManifest()
+		if err != nil {
+			return nil, err
+		}
+		filenames := make([]string, 0, len(manifest.Segments))
+		for _, seg := range manifest.Segments {
+			filenames = append(filenames, seg.File)
+		}
+		s.markFilesInUse(filenames)
+
+		err = s.setReplicationSegmentSizes(manifest)
+		if err == nil {
+			time.AfterFunc(ReplicationLeaseDuration, func() {
+				s.unmarkFilesInUse(filenames)
+			})
+			return manifest, nil
+		}
+		s.unmarkFilesInUse(filenames)
+		if i == 10 {
+			return nil, err
+		}
+	}
+}
+
+func (s *Scorch) setReplicationSegmentSizes(manifest *ReplicationManifest) error {
+	finfos, err := s.dir.List()
+	if err != nil {
+		return err
+	}
+	sizes := make(map[string]int64, len(finfos))
+	for _, finfo := range finfos {
+		sizes[finfo.Name()] = finfo.Size()
+	}
+	for i, seg := range manifest.Segments {
+		size, ok := sizes[seg.File]
+		if !ok {
+			return fmt.Errorf("segment file %s missing", seg.File)
+		}
+		manifest.Segments[i].Size = size
+	}
+	return nil
+}
+
+func (s *Scorch) readReplicationManifest() (*ReplicationManifest, error) {
+	var rv *ReplicationManifest
+	err := s.rootBolt.View(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(boltSnapshotsBucket)
+		if snapshots == nil {
+			return nil
+		}
+		k, _ := snapshots.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		_, epoch, err := segment.DecodeUvarintAscending(k)
+		if err != nil {
+			return err
+		}
+		rv, err = readReplicationManifestBucket(snapshots.Bucket(k))
+		if err != nil {
+			return err
+		}
+		rv.Epoch = epoch
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rv == nil {
+		return nil, fmt.Errorf("scorch: index has no persisted snapshot")
+	}
+	return rv, nil
+}
+
+func readReplicationManifestBucket(snapshot *bolt.Bucket) (*ReplicationManifest, error) {
+	rv := &ReplicationManifest{}
+	c := snapshot.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		b := snapshot.Bucket(k)
+		if b == nil {
+			return nil, fmt.Errorf("snapshot key, but bucket missing % x", k)
+		}
+		if k[0] == boltMetaDataKey[0] {
+			rv.SegmentType = string(b.Get(boltMetaDataSegmentTypeKey))
+			rv.SegmentVersion = binary.BigEndian.Uint32(b.Get(boltMetaDataSegmentVersionKey))
+		} else if k[0] == boltInternalKey[0] {
+			err := b.ForEach(func(key []byte, val []byte) error {
+				rv.Internal = append(rv.Internal, ReplicationInternal{
+					Key: append([]byte(nil), key...),
+					Val: append([]byte(nil), val...),
+				})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			_, id, err := segment.DecodeUvarintAscending(k)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode segment id: %v", err)
+			}
+			rv.Segments = append(rv.Segments, ReplicationSegment{
+				ID:      id,
+				File:    string(b.Get(boltPathKey)),
+				Deleted: append([]byte(nil), b.Get(boltDeletedKey)...),
+			})
+		}
+	}
+	return rv, nil
+}
+
+// ReadSegmentFile writes the contents of the index's segment file with
+// the name to w, for its followers. Segment files are immutable, but
+// they're removed once they're no longer in a retained snapshot, nor in
+// a manifest returned within ReplicationLeaseDuration.
+func (s *Scorch) ReadSegmentFile(name string, w io.Writer) error {
+	if s.dir == nil {
+		return fmt.Errorf("scorch: index isn't persisted")
+	}
+	if !validSegmentFileName(name) {
+		return fmt.Errorf("scorch: invalid segment file name %q", name)
+	}
+	_, err := s.dir.Open(name, func(path string) (segment.Segment, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(w, f)
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+		return nil, err
+	})
+	return err
+}
+
+type memoryReplicationSource struct {
+	leader *Scorch
+}
+
+// NewMemoryReplicationSource returns a ReplicationSource that reads from
+// a leader in the same process. The manifests are copied as they would
+// be by a remote transport, so it's mostly useful for tests.
+func NewMemoryReplicationSource(leader *Scorch) ReplicationSource {
+	return &memoryReplicationSource{leader: leader}
+}
+
+func (m *memoryReplicationSource) Manifest() (*ReplicationManifest, error) {
+	manifest, err := m.leader.ReplicationManifest()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var rv ReplicationManifest
+	err = json.Unmarshal(buf, &rv)
+	if err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
+
+func (m *memoryReplicationSource) ReadSegment(name string, w io.Writer) error {
+	return m.leader.ReadSegmentFile(name, w)
+}
+
+// Replicate advances a replica index, opened with the "replica" config
+// set to true, to its leader's latest persisted snapshot. The segment
+// files it lacks are copied first, and then the snapshot is committed
+// to its root.bolt and swapped in as its root at once. It returns the
+// epoch of the root, which is the leader's epoch it was copied from.
+//
+// Manifests with an epoch older than the root's are ignored, and files
+// removed by the leader before they're copied fail the replication, so
+// it should be retried.
+func (s *Scorch) Replicate(src ReplicationSource) (uint64, error) {
+	if !s.replica {
+		return 0, fmt.Errorf("scorch: only replica indexes can be replicated to")
+	}
+	s.replicateLock.Lock()
+	defer s.replicateLock.Unlock()
+
+	manifest, err := src.Manifest()
+	if err != nil {
+		return 0, err
+	}
+
+	// The snapshots and files of previous roots are removed once they're
+	// no longer used, so that's retried every time.
+	defer s.removeOldData()
+
+	s.rootLock.RLock()
+	rootEpoch := s.root.epoch
+	s.rootLock.RUnlock()
+	if manifest.Epoch <= rootEpoch {
+		return rootEpoch, nil
+	}
+
+	err = s.copySegmentFiles(src, manifest)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.rootBolt.Update(func(tx *bolt.Tx) error {
+		return prepareReplicationSnapshot(manifest, tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.introduceReplicationSnapshot(manifest)
+	if err != nil {
+		return 0, err
+	}
+
+	return manifest.Epoch, nil
+}
+
+// copySegmentFiles copies the manifest's segment files that the replica
+// lacks.
+func (s *Scorch) copySegmentFiles(src ReplicationSource, manifest *ReplicationManifest) error {
+	finfos, err := s.dir.List()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]int64, len(finfos))
+	for _, finfo := range finfos {
+		existing[finfo.Name()] = finfo.Size()
+	}
+
+	for _, seg := range manifest.Segments {
+		if !validSegmentFileName(seg.File) {
+			return fmt.Errorf("scorch: invalid segment file name %q", seg.File)
+		}
+		if size, ok := existing[seg.File]; ok && size == seg.Size {
+			continue
+		}
+		err = s.dir.Create(seg.File, func(path string) error {
+			return copySegmentFile(src, seg, path)
+		})
+		if err != nil {
+			return fmt.Errorf("error copying segment %s: %v", seg.File, err)
+		}
+	}
+	return nil
+}
+
+func copySegmentFile(src ReplicationSource, seg ReplicationSegment, path string) (err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	err = src.ReadSegment(seg.File, f)
+	if err != nil {
+		return err
+	}
+	finfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if finfo.Size() != seg.Size {
+		return fmt.Errorf("expected %d bytes, got %d", seg.Size, finfo.Size())
+	}
+	return f.Sync()
+}
+
+// prepareReplicationSnapshot writes the manifest's snapshot to root.bolt,
+// the way prepareBoltSnapshot does.
+func prepareReplicationSnapshot(manifest *ReplicationManifest, tx *bolt.Tx) error {
+	snapshotsBucket, err := tx.CreateBucketIfNotExists(boltSnapshotsBucket)
+	if err != nil {
+		return err
+	}
+	// The snapshot may have been committed before, by a replication that
+	// failed to swap it in.
+	snapshotKey := segment.EncodeUvarintAscending(nil, manifest.Epoch)
+	err = snapshotsBucket.DeleteBucket(snapshotKey)
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	snapshotBucket, err := snapshotsBucket.CreateBucket(snapshotKey)
+	if err != nil {
+		return err
+	}
+
+	metaBucket, err := snapshotBucket.CreateBucket(boltMetaDataKey)
+	if err != nil {
+		return err
+	}
+	err = metaBucket.Put(boltMetaDataSegmentTypeKey, []byte(manifest.SegmentType))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, binary.MaxVarintLen32)
+	binary.BigEndian.PutUint32(buf, manifest.SegmentVersion)
+	err = metaBucket.Put(boltMetaDataSegmentVersionKey, buf)
+	if err != nil {
+		return err
+	}
+
+	internalBucket, err := snapshotBucket.CreateBucket(boltInternalKey)
+	if err != nil {
+		return err
+	}
+	for _, internal := range manifest.Internal {
+		err = internalBucket.Put(internal.Key, internal.Val)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, seg := range manifest.Segments {
+		segmentBucket, err := snapshotBucket.CreateBucket(
+			segment.EncodeUvarintAscending(nil, seg.ID))
+		if err != nil {
+			return err
+		}
+		err = segmentBucket.Put(boltPathKey, []byte(seg.File))
+		if err != nil {
+			return err
+		}
+		if len(seg.Deleted) > 0 {
+			err = segmentBucket.Put(boltDeletedKey, seg.Deleted)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// introduceReplicationSnapshot swaps in the manifest's snapshot as the
+// root, reusing the segments the root already has open.
+func (s *Scorch) introduceReplicationSnapshot(manifest *ReplicationManifest) (err error) {
+	err = s.loadSegmentPlugin(manifest.SegmentType, manifest.SegmentVersion)
+	if err != nil {
+		return err
+	}
+
+	s.rootLock.RLock()
+	root := s.root
+	root.AddRef()
+	s.rootLock.RUnlock()
+	defer func() { _ = root.DecRef() }()
+
+	opened := make(map[string]*SegmentSnapshot, len(root.segment))
+	for _, segmentSnapshot := range root.segment {
+		if seg, ok := segmentSnapshot.segment.(segment.PersistedSegment); ok {
+			opened[segmentFileName(seg)] = segmentSnapshot
+		}
+	}
+
+	newSnapshot := &IndexSnapshot{
+		parent:   s,
+		epoch:    manifest.Epoch,
+		segment:  make([]*SegmentSnapshot, 0, len(manifest.Segments)),
+		offsets:  make([]uint64, 0, len(manifest.Segments)),
+		internal: make(map[string][]byte, len(manifest.Internal)),
+		refs:     1,
+		creator:  "introduceReplicationSnapshot",
+	}
+	defer func() {
+		if err != nil {
+			_ = newSnapshot.DecRef()
+		}
+	}()
+
+	now := time.Now().UnixNano()
+	var running uint64
+	for _, seg := range manifest.Segments {
+		newss := &SegmentSnapshot{
+			id:      seg.ID,
+			creator: "introduceReplicationSnapshot",
+		}
+		if prev, ok := opened[seg.File]; ok {
+			prev.segment.AddRef()
+			newss.segment = prev.segment
+			newss.cachedDocs = prev.cachedDocs
+			newss.fieldStats = prev.fieldStats
+			newss.expiries = prev.expiries
+		} else {
+			newss.segment, err = s.dir.Open(seg.File, s.segPlugin.Open)
+			if err != nil {
+				return fmt.Errorf("error opening segment %s: %v", seg.File, err)
+			}
+			newss.cachedDocs = &cachedDocs{cache: nil}
+			newss.fieldStats = &segmentFieldStats{}
+			newss.expiries, err = s.loadExpiries(newss.segment)
+			if err != nil {
+				_ = newss.segment.Close()
+				return fmt.Errorf("error reading expiries of segment %s: %v", seg.File, err)
+			}
+		}
+		newSnapshot.segment = append(newSnapshot.segment, newss)
+		newSnapshot.offsets = append(newSnapshot.offsets, running)
+		running += newss.segment.Count()
+
+		if len(seg.Deleted) > 0 {
+			deleted := roaring.NewBitmap()
+			_, err = deleted.ReadFrom(bytes.NewReader(seg.Deleted))
+			if err != nil {
+				return fmt.Errorf("error reading deleted bytes: %v", err)
+			}
+			if !deleted.IsEmpty() {
+				newss.deleted = deleted
+			}
+		}
+		expireSegment(newss, nil, now)
+	}
+	for _, internal := range manifest.Internal {
+		newSnapshot.internal[string(internal.Key)] = internal.Val
+	}
+	newSnapshot.updateSize()
+
+	s.rootLock.Lock()
+	rootPrev := s.root
+	s.root = newSnapshot
+	s.nextSnapshotEpoch = manifest.Epoch + 1
+	atomic.StoreUint64(&s.stats.CurRootEpoch, manifest.Epoch)
+	atomic.StoreUint64(&s.stats.TotFileSegmentsAtRoot, uint64(len(newSnapshot.segment)))
+	atomic.StoreUint64(&s.stats.CurExpiredItems, newSnapshot.expiredCount())
+	s.rootLock.Unlock()
+
+	if rootPrev != nil {
+		_ = rootPrev.DecRef()
+	}
+	return nil
+}
+
+// Follow replicates the replica index from src every interval, until
+// the index is closed. Errors are reported to the index's async error
+// callback, and the replication is retried at the next interval.
+func (s *Scorch) Follow(src ReplicationSource, interval time.Duration) {
+	s.asyncTasks.Add(1)
+	go func() {
+		defer s.asyncTasks.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			_, err := s.Replicate(src)
+			if err != nil {
+				s.fireAsyncError(fmt.Errorf("replication error: %v", err))
+			}
+			select {
+			case <-s.closeCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
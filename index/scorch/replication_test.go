@@ -0,0 +1,194 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func zapFileNames(t *testing.T, path string) map[string]struct{} {
+	names, err := filepath.Glob(filepath.Join(path, "*.zap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		rv[filepath.Base(name)] = struct{}{}
+	}
+	return rv
+}
+
+func TestReplication(t *testing.T) {
+	cfg := CreateConfig("TestReplication")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	replicaCfg := CreateConfig("TestReplication-replica")
+	replicaCfg["replica"] = true
+	err = InitTest(replicaCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(replicaCfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	leader := openTestIndex(t, cfg)
+	defer func() {
+		err := leader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	replica := openTestIndex(t, replicaCfg)
+	defer func() {
+		err := replica.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	src := NewMemoryReplicationSource(leader.(*Scorch))
+	r := replica.(*Scorch)
+
+	updateDocs(t, leader, "a", "b", "c")
+	err = leader.SetInternal([]byte("k"), []byte("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	epoch, err := r.Replicate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDocCount(t, replica, 3)
+	reader, err := replica.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := reader.GetInternal([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "v" {
+		t.Errorf("expected internal value v, got %q", val)
+	}
+
+	// Deletions only change the deleted bitmaps. The reader opened before
+	// keeps seeing its snapshot.
+	deleteDocs(t, leader, "a")
+	epoch2, err := r.Replicate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch2 <= epoch {
+		t.Errorf("expected epoch after %d, got %d", epoch, epoch2)
+	}
+	checkDocCount(t, replica, 2)
+	count, err := reader.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected the old reader to see 3 documents, got %d", count)
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replicating the same snapshot again does nothing.
+	epoch3, err := r.Replicate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch3 != epoch2 {
+		t.Errorf("expected epoch %d, got %d", epoch2, epoch3)
+	}
+
+	err = replica.Batch(nil)
+	if err != ErrReplica {
+		t.Errorf("expected ErrReplica, got %v", err)
+	}
+
+	// After merges, the replica ends up with the leader's files.
+	updateDocs(t, leader, "d")
+	updateDocs(t, leader, "e")
+	err = leader.(*Scorch).ForceMerge(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Replicate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDocCount(t, replica, 4)
+
+	// The persister may still be merging the leader's segments, so the
+	// manifest is read again while waiting.
+	var manifest *ReplicationManifest
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		manifest, err = src.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]struct{}{}
+		for _, seg := range manifest.Segments {
+			expected[seg.File] = struct{}{}
+		}
+		actual := zapFileNames(t, replicaCfg["path"].(string))
+		match := len(actual) == len(expected)
+		for name := range expected {
+			if _, ok := actual[name]; !ok {
+				match = false
+			}
+		}
+		if match {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected replica files %v, got %v", expected, actual)
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, err = r.Replicate(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The replica reopens at the epoch it replicated.
+	err = replica.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica = openTestIndex(t, replicaCfg)
+	checkDocCount(t, replica, 4)
+	if replica.(*Scorch).root.epoch != manifest.Epoch {
+		t.Errorf("expected replica epoch %d, got %d", manifest.Epoch, replica.(*Scorch).root.epoch)
+	}
+}
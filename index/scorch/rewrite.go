@@ -0,0 +1,680 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/scorch/segment"
+)
+
+// SegmentRewrite describes how RewriteSegments transforms the fields of
+// the segments of an index, so that mapping changes apply to the
+// documents already indexed without reindexing them. Fields are named
+// as in the segments, composite fields like _all included.
+type SegmentRewrite struct {
+	// DropFields are removed entirely: their terms, stored values and
+	// doc values. Their terms are removed from composite fields too,
+	// where those have term vectors to tell them apart.
+	DropFields []string `json:"drop_fields,omitempty"`
+
+	// DropStoredFields keep their terms, but lose their stored values.
+	DropStoredFields []string `json:"drop_stored_fields,omitempty"`
+
+	// DropTermVectors keep their terms, but lose their locations.
+	DropTermVectors []string `json:"drop_term_vectors,omitempty"`
+
+	// AddDocValues get doc values, built from their terms.
+	AddDocValues []string `json:"add_doc_values,omitempty"`
+
+	// DropDocValues lose their doc values.
+	DropDocValues []string `json:"drop_doc_values,omitempty"`
+}
+
+type fieldSet map[string]struct{}
+
+func newFieldSet(fields []string) fieldSet {
+	rv := make(fieldSet, len(fields))
+	for _, field := range fields {
+		rv[field] = struct{}{}
+	}
+	return rv
+}
+
+func (fs fieldSet) has(field string) bool {
+	_, ok := fs[field]
+	return ok
+}
+
+// segmentRewriter rewrites segments with a validated SegmentRewrite.
+type segmentRewriter struct {
+	dropFields      fieldSet
+	dropStored      fieldSet
+	dropTermVectors fieldSet
+	addDocValues    fieldSet
+	dropDocValues   fieldSet
+}
+
+func newSegmentRewriter(rewrite *SegmentRewrite) (*segmentRewriter, error) {
+	rv := &segmentRewriter{
+		dropFields:      newFieldSet(rewrite.DropFields),
+		dropStored:      newFieldSet(rewrite.DropStoredFields),
+		dropTermVectors: newFieldSet(rewrite.DropTermVectors),
+		addDocValues:    newFieldSet(rewrite.AddDocValues),
+		dropDocValues:   newFieldSet(rewrite.DropDocValues),
+	}
+	if rv.dropFields.has("_id") || rv.dropStored.has("_id") {
+		return nil, fmt.Errorf("scorch: the _id field can't be dropped")
+	}
+	for field := range rv.addDocValues {
+		if rv.dropDocValues.has(field) || rv.dropFields.has(field) {
+			return nil, fmt.Errorf("scorch: doc values of field %s both added and dropped", field)
+		}
+	}
+	return rv, nil
+}
+
+// RewriteChunkSize is the number of live documents of a segment that
+// RewriteSegments uninverts in memory at once. The documents of a larger
+// segment of a persisted index are rewritten into temporary segments of
+// up to that many documents, which are then merged.
+var RewriteChunkSize = 10000
+
+// RewriteSegments rewrites every segment of the index, applying the
+// rewrite to its documents, and introduces the rewritten segments
+// through the merge path, each in a new snapshot. The merger is paused
+// meanwhile, and RewriteSegments returns once the rewritten segments
+// are persisted. The bytes written are reported to reporter, if it isn't
+// nil, as they are by merges. Documents indexed meanwhile may not be
+// rewritten.
+func (s *Scorch) RewriteSegments(ctx context.Context, rewrite *SegmentRewrite,
+	reporter segment.StatsReporter) error {
+	if s.replica {
+		return ErrReplica
+	}
+	if s.readOnly {
+		return fmt.Errorf("scorch: can't rewrite the segments of a read-only index")
+	}
+	rw, err := newSegmentRewriter(rewrite)
+	if err != nil {
+		return err
+	}
+
+	s.rewriteLock.Lock()
+	defer s.rewriteLock.Unlock()
+
+	paused := s.MergerPaused()
+	if !paused {
+		s.PauseMerger()
+	}
+	persisted, err := s.rewriteSegments(ctx, rw, reporter)
+	if !paused {
+		s.ResumeMerger()
+	}
+	if err != nil || persisted == nil {
+		return err
+	}
+
+	select {
+	case <-s.closeCh:
+		return ErrClosed
+	case err = <-persisted:
+		return err
+	}
+}
+
+// rewriteSegments rewrites the segments of the root with rw, and returns
+// a channel closed once the last of them is persisted, or nil if none
+// was or the index isn't persisted.
+func (s *Scorch) rewriteSegments(ctx context.Context, rw *segmentRewriter,
+	reporter segment.StatsReporter) (chan error, error) {
+	// A segment merged away by a merge that was in progress, or by the
+	// persister, is skipped, and the segments that replaced it are
+	// rewritten in another round.
+	var persisted chan error
+	rewritten := map[uint64]struct{}{}
+	for {
+		s.rootLock.RLock()
+		snapshot := s.root
+		snapshot.AddRef()
+		s.rootLock.RUnlock()
+
+		var err error
+		var obsoleted bool
+		for _, ss := range snapshot.segment {
+			if _, ok := rewritten[ss.id]; ok || ss.LiveSize() == 0 {
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			var segPersisted chan error
+			if s.dir != nil {
+				segPersisted = make(chan error, 1)
+			}
+			var newSegmentID uint64
+			newSegmentID, err = s.rewriteSegment(ctx, rw, ss, reporter, segPersisted)
+			if err != nil {
+				atomic.AddUint64(&s.stats.TotRewriteSegmentsErr, 1)
+				break
+			}
+			persisted = segPersisted
+			if newSegmentID == 0 {
+				obsoleted = true
+				continue
+			}
+			rewritten[newSegmentID] = struct{}{}
+		}
+		_ = snapshot.DecRef()
+		if err != nil {
+			return nil, err
+		}
+		if !obsoleted {
+			return persisted, nil
+		}
+	}
+}
+
+// rewriteSegment introduces the segment of ss rewritten by rw in place
+// of ss, and returns its id, or 0 if ss was obsoleted meanwhile. The
+// persisted channel, if not nil, is closed once the snapshot introducing
+// it is persisted.
+func (s *Scorch) rewriteSegment(ctx context.Context, rw *segmentRewriter,
+	ss *SegmentSnapshot, reporter segment.StatsReporter,
+	persisted chan error) (uint64, error) {
+	newSegmentID := atomic.AddUint64(&s.nextSegmentID, 1)
+	var filename string
+	if s.dir != nil {
+		filename = zapFileName(newSegmentID)
+		s.markIneligibleForRemoval(filename)
+	}
+	seg, newDocNums, err := s.rewrittenSegment(ctx, rw, ss, filename,
+		&rewriteReporter{s: s, reporter: reporter})
+	if err != nil {
+		if filename != "" {
+			s.unmarkIneligibleForRemoval(filename)
+		}
+		return 0, err
+	}
+
+	expiries, err := s.loadExpiries(seg)
+	if err != nil {
+		_ = seg.Close()
+		if filename != "" {
+			s.unmarkIneligibleForRemoval(filename)
+		}
+		return 0, err
+	}
+
+	sm := &segmentMerge{
+		id:            newSegmentID,
+		old:           map[uint64]*SegmentSnapshot{ss.id: ss},
+		oldNewDocNums: map[uint64][]uint64{ss.id: newDocNums},
+		new:           seg,
+		expiries:      expiries,
+		notifyCh:      make(chan *mergeTaskIntroStatus),
+		persisted:     persisted,
+	}
+	select {
+	case <-s.closeCh:
+		_ = seg.Close()
+		return 0, segment.ErrClosed
+	case s.merges <- sm:
+	}
+
+	introStatus := <-sm.notifyCh
+	if introStatus != nil && introStatus.indexSnapshot != nil {
+		_ = introStatus.indexSnapshot.DecRef()
+		if introStatus.skipped {
+			if filename != "" {
+				s.unmarkIneligibleForRemoval(filename)
+			}
+			_ = seg.Close()
+			atomic.AddUint64(&s.stats.TotRewriteSegmentsObsoleted, 1)
+			return 0, nil
+		}
+	}
+	atomic.AddUint64(&s.stats.TotRewriteSegments, 1)
+	if ss.expired != nil {
+		atomic.AddUint64(&s.stats.TotExpiredItemsPurged, ss.expired.GetCardinality())
+	}
+	return newSegmentID, nil
+}
+
+// rewriteReporter reports the bytes written by a rewrite to the index,
+// and to the reporter passed to RewriteSegments, if any.
+type rewriteReporter struct {
+	s        *Scorch
+	reporter segment.StatsReporter
+}
+
+func (r *rewriteReporter) ReportBytesWritten(bytesWritten uint64) {
+	r.s.ReportBytesWritten(bytesWritten)
+	if r.reporter != nil {
+		r.reporter.ReportBytesWritten(bytesWritten)
+	}
+}
+
+// rewrittenSegment returns the segment of ss rewritten by rw, persisted
+// to the file with the name unless it's empty, and the new numbers of
+// all the documents of ss, the hidden ones mapped to math.MaxUint64.
+func (s *Scorch) rewrittenSegment(ctx context.Context, rw *segmentRewriter,
+	ss *SegmentSnapshot, filename string, reporter *rewriteReporter) (
+	segment.Segment, []uint64, error) {
+	chunks := rewriteChunks(ss)
+	if filename == "" || len(chunks) == 1 {
+		results, newDocNums, err := rw.invert(ctx, ss, 0, ss.segment.Count())
+		if err != nil {
+			return nil, nil, err
+		}
+		seg, err := s.newRewrittenSegment(results, filename, reporter)
+		return seg, newDocNums, err
+	}
+
+	// Each chunk is written to a temporary segment file, so that only
+	// one is uninverted in memory at a time, and they're merged.
+	var chunkSegs []segment.Segment
+	var chunkFiles []string
+	defer func() {
+		for _, seg := range chunkSegs {
+			_ = seg.Close()
+		}
+		for _, name := range chunkFiles {
+			_ = s.dir.Remove(name)
+			s.unmarkIneligibleForRemoval(name)
+		}
+	}()
+	chunkDocNums := make([][]uint64, len(chunks))
+	for i, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		results, newDocNums, err := rw.invert(ctx, ss, chunk[0], chunk[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		chunkDocNums[i] = newDocNums
+		name := zapFileName(atomic.AddUint64(&s.nextSegmentID, 1))
+		s.markIneligibleForRemoval(name)
+		chunkFiles = append(chunkFiles, name)
+		seg, err := s.newRewrittenSegment(results, name, reporter)
+		if err != nil {
+			return nil, nil, err
+		}
+		chunkSegs = append(chunkSegs, seg)
+	}
+
+	cw := newCloseChWrapper(s.closeCh, ctx)
+	defer cw.close()
+	go cw.listen()
+
+	var mergedDocNums [][]uint64
+	err := s.dir.Create(filename, func(path string) (err error) {
+		mergedDocNums, _, err = s.segPlugin.Merge(chunkSegs,
+			make([]*roaring.Bitmap, len(chunkSegs)), path, cw.closeCh, reporter)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	seg, err := s.dir.Open(filename, s.segPlugin.Open)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newDocNums := make([]uint64, 0, ss.segment.Count())
+	for i, docNums := range chunkDocNums {
+		for _, docNum := range docNums {
+			if docNum != math.MaxUint64 {
+				docNum = mergedDocNums[i][docNum]
+			}
+			newDocNums = append(newDocNums, docNum)
+		}
+	}
+	return seg, newDocNums, nil
+}
+
+// rewriteChunks splits the documents of the segment of ss into ranges
+// of document numbers with up to RewriteChunkSize live documents each.
+func rewriteChunks(ss *SegmentSnapshot) [][2]uint64 {
+	count := ss.segment.Count()
+	hidden := ss.hiddenDocs()
+	var rv [][2]uint64
+	var start, live uint64
+	for docNum := uint64(0); docNum < count; docNum++ {
+		if hidden != nil && hidden.Contains(uint32(docNum)) {
+			continue
+		}
+		if live == uint64(RewriteChunkSize) {
+			rv = append(rv, [2]uint64{start, docNum})
+			start, live = docNum, 0
+		}
+		live++
+	}
+	return append(rv, [2]uint64{start, count})
+}
+
+// newRewrittenSegment returns a segment of the analysis results,
+// persisted to the file with the name unless it's empty.
+func (s *Scorch) newRewrittenSegment(results []*index.AnalysisResult,
+	filename string, reporter *rewriteReporter) (segment.Segment, error) {
+	seg, size, err := s.segPlugin.New(results)
+	if err != nil {
+		return nil, err
+	}
+	if filename != "" {
+		unpersisted, ok := seg.(segment.UnpersistedSegment)
+		if !ok {
+			_ = seg.Close()
+			return nil, fmt.Errorf("scorch: segment of type %T can't be persisted", seg)
+		}
+		err = s.dir.Create(filename, unpersisted.Persist)
+		_ = seg.Close()
+		if err != nil {
+			return nil, err
+		}
+		seg, err = s.dir.Open(filename, s.segPlugin.Open)
+		if err != nil {
+			return nil, err
+		}
+	}
+	reporter.ReportBytesWritten(size)
+	return seg, nil
+}
+
+// rewrittenDoc accumulates a live document of a segment being
+// rewritten, uninverted from the segment.
+type rewrittenDoc struct {
+	id      string
+	indexed map[string]*rewrittenField
+	fields  []string // The indexed fields, in the order they were met.
+	stored  []document.Field
+}
+
+// rewrittenField accumulates the terms of an indexed field of a
+// rewrittenDoc.
+type rewrittenField struct {
+	length    int
+	locations bool
+	tfs       analysis.TokenFrequencies
+}
+
+// normUint64 is implemented by the postings of segments that keep the
+// length of fields.
+type normUint64 interface {
+	NormUint64() uint64
+}
+
+// invert returns the analysis results of the live documents of the
+// segment of ss numbered from start up to end, transformed by rw, and
+// the new numbers of those documents, counted from start, the hidden
+// ones mapped to math.MaxUint64.
+func (rw *segmentRewriter) invert(ctx context.Context, ss *SegmentSnapshot,
+	start, end uint64) ([]*index.AnalysisResult, []uint64, error) {
+	seg := ss.segment
+	hidden := ss.hiddenDocs()
+
+	newDocNums := make([]uint64, end-start)
+	var docs []*rewrittenDoc
+	for docNum := start; docNum < end; docNum++ {
+		if hidden != nil && hidden.Contains(uint32(docNum)) {
+			newDocNums[docNum-start] = math.MaxUint64
+			continue
+		}
+		newDocNums[docNum-start] = uint64(len(docs))
+		docs = append(docs, &rewrittenDoc{indexed: map[string]*rewrittenField{}})
+	}
+
+	// The postings of the documents out of the range are skipped too.
+	except := hidden
+	if start > 0 || end < seg.Count() {
+		except = roaring.New()
+		except.AddRange(0, start)
+		except.AddRange(end, seg.Count())
+		if hidden != nil {
+			except.Or(hidden)
+		}
+	}
+
+	docValues := fieldSet{}
+	if dvs, ok := seg.(segment.DocumentFieldTermVisitable); ok {
+		fields, err := dvs.VisitableDocValueFields()
+		if err != nil {
+			return nil, nil, err
+		}
+		docValues = newFieldSet(fields)
+	}
+
+	for _, field := range seg.Fields() {
+		if rw.dropFields.has(field) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		err := rw.invertField(seg, field, except, start, newDocNums, docs)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for docNum, newDocNum := range newDocNums {
+		if newDocNum == math.MaxUint64 {
+			continue
+		}
+		doc := docs[newDocNum]
+		err := seg.VisitDocument(start+uint64(docNum), func(field string, typ byte,
+			value []byte, pos []uint64) bool {
+			if field == "_id" {
+				doc.id = string(value)
+			} else if rw.dropFields.has(field) || rw.dropStored.has(field) {
+				return true
+			}
+			value = append([]byte(nil), value...)
+			if len(pos) > 0 {
+				pos = append([]uint64(nil), pos...)
+			} else {
+				pos = nil
+			}
+			if f := storedField(field, typ, value, pos); f != nil {
+				doc.stored = append(doc.stored, f)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	results := make([]*index.AnalysisResult, len(docs))
+	for i, doc := range docs {
+		d := document.NewDocument(doc.id)
+		rv := &index.AnalysisResult{
+			Document: d,
+			Analyzed: make([]analysis.TokenFrequencies, 0, len(doc.fields)+len(doc.stored)),
+			Length:   make([]int, 0, len(doc.fields)+len(doc.stored)),
+		}
+		// The indexed fields come first, so that the terms of stored
+		// fields with the same names are merged into theirs.
+		for _, field := range doc.fields {
+			f := doc.indexed[field]
+			options := document.IndexField
+			if f.locations {
+				options |= document.IncludeTermVectors
+			}
+			if rw.addDocValues.has(field) ||
+				(docValues.has(field) && !rw.dropDocValues.has(field)) {
+				options |= document.DocValues
+			}
+			d.AddField(document.NewTextFieldCustom(field, nil, nil, options, nil))
+			rv.Analyzed = append(rv.Analyzed, f.tfs)
+			if f.length < 0 {
+				f.length = 0
+			}
+			rv.Length = append(rv.Length, f.length)
+		}
+		for _, f := range doc.stored {
+			d.AddField(f)
+			rv.Analyzed = append(rv.Analyzed, nil)
+			rv.Length = append(rv.Length, 0)
+		}
+		results[i] = rv
+		docs[i] = nil
+	}
+	return results, newDocNums, nil
+}
+
+// invertField adds the terms of the field to the docs, but those of the
+// documents in except.
+func (rw *segmentRewriter) invertField(seg segment.Segment, field string,
+	except *roaring.Bitmap, start uint64, newDocNums []uint64,
+	docs []*rewrittenDoc) error {
+	dict, err := seg.Dictionary(field)
+	if err != nil {
+		return err
+	}
+	includeLocations := !rw.dropTermVectors.has(field)
+
+	var postings segment.PostingsList
+	var postingsItr segment.PostingsIterator
+	itr := dict.Iterator()
+	for {
+		entry, err := itr.Next()
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		term := []byte(entry.Term)
+
+		postings, err = dict.PostingsList(term, except, postings)
+		if err != nil {
+			return err
+		}
+		postingsItr = postings.Iterator(true, true, includeLocations, postingsItr)
+		for {
+			p, err := postingsItr.Next()
+			if err != nil {
+				return err
+			}
+			if p == nil {
+				break
+			}
+			doc := docs[newDocNums[p.Number()-start]]
+			f := doc.indexed[field]
+			if f == nil {
+				f = &rewrittenField{
+					length: fieldLength(p),
+					tfs:    analysis.TokenFrequencies{},
+				}
+				doc.indexed[field] = f
+				doc.fields = append(doc.fields, field)
+			}
+			rw.addTerm(f, field, term, p)
+		}
+	}
+}
+
+// addTerm adds the term of the posting to f, without the locations of
+// dropped fields in composite fields.
+func (rw *segmentRewriter) addTerm(f *rewrittenField, field string,
+	term []byte, p segment.Posting) {
+	freq := int(p.Frequency())
+	locs := p.Locations()
+	tokens := make(analysis.TokenStream, 0, freq)
+	locFields := make([]string, 0, len(locs))
+	locArrayPositions := make([][]uint64, 0, len(locs))
+	for _, loc := range locs {
+		if loc.Field() != field && rw.dropFields.has(loc.Field()) {
+			freq--
+			f.length--
+			continue
+		}
+		tokens = append(tokens, &analysis.Token{
+			Term:     term,
+			Start:    int(loc.Start()),
+			End:      int(loc.End()),
+			Position: int(loc.Pos()),
+		})
+		locFields = append(locFields, loc.Field())
+		var arrayPositions []uint64
+		if len(loc.ArrayPositions()) > 0 {
+			arrayPositions = append(arrayPositions, loc.ArrayPositions()...)
+		}
+		locArrayPositions = append(locArrayPositions, arrayPositions)
+	}
+	if freq <= 0 {
+		return
+	}
+	includeLocations := len(tokens) > 0
+	for len(tokens) < freq {
+		tokens = append(tokens, &analysis.Token{Term: term})
+	}
+
+	tf := analysis.TokenFrequency(tokens, nil, includeLocations)[string(term)]
+	for i, loc := range tf.Locations {
+		loc.Field = locFields[i]
+		loc.ArrayPositions = locArrayPositions[i]
+	}
+	if includeLocations {
+		f.locations = true
+	}
+	f.tfs[string(term)] = tf
+}
+
+// fieldLength returns the length of the field of the posting, from its
+// norm.
+func fieldLength(p segment.Posting) int {
+	if n, ok := p.(normUint64); ok {
+		return int(n.NormUint64())
+	}
+	norm := p.Norm()
+	if norm <= 0 || math.IsInf(norm, 0) {
+		return 0
+	}
+	return int(math.Round(1 / (norm * norm)))
+}
+
+// storedField returns a stored-only field for a value visited by
+// Segment.VisitDocument.
+func storedField(name string, typ byte, value []byte,
+	arrayPositions []uint64) document.Field {
+	switch typ {
+	case 't':
+		return document.NewTextFieldWithIndexingOptions(name, arrayPositions,
+			value, document.StoreField)
+	case 'n':
+		return document.NewNumericFieldFromBytesWithIndexingOptions(name,
+			arrayPositions, value, document.StoreField)
+	case 'd':
+		return document.NewDateTimeFieldFromBytesWithIndexingOptions(name,
+			arrayPositions, value, document.StoreField)
+	case 'b':
+		return document.NewBooleanFieldFromBytesWithIndexingOptions(name,
+			arrayPositions, value, document.StoreField)
+	case 'g':
+		return document.NewGeoPointFieldFromBytesWithIndexingOptions(name,
+			arrayPositions, value, document.StoreField)
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index"
+)
+
+type countingReporter struct {
+	bytes uint64
+}
+
+func (r *countingReporter) ReportBytesWritten(bytesWritten uint64) {
+	r.bytes += bytesWritten
+}
+
+func termFieldDoc(t *testing.T, idx index.Index, term, field string) *index.TermFieldDoc {
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tfr, err := reader.TermFieldReader([]byte(term), field, true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := tfr.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tfd, err := tfr.Next(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tfd
+}
+
+func TestRewriteSegments(t *testing.T) {
+	cfg := CreateConfig("TestRewriteSegments")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	s := idx.(*Scorch)
+
+	for _, id := range []string{"a", "b", "c"} {
+		batch := index.NewBatch()
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextFieldWithIndexingOptions("name", []uint64{0},
+			[]byte("name"+id), document.IndexField|document.StoreField|document.IncludeTermVectors))
+		doc.AddField(document.NewTextFieldWithIndexingOptions("secret", nil,
+			[]byte("secret"+id), document.IndexField|document.StoreField|document.IncludeTermVectors))
+		doc.AddField(document.NewNumericField("age", nil, 42))
+		doc.AddField(document.NewCompositeFieldWithIndexingOptions("_all", true, nil, nil,
+			document.IndexField|document.IncludeTermVectors))
+		batch.Update(doc)
+		err = idx.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleteDocs(t, idx, "b")
+
+	before := termFieldDoc(t, idx, "namea", "name")
+	if before == nil || len(before.Vectors) != 1 {
+		t.Fatalf("expected a hit with a term vector, got %v", before)
+	}
+
+	reporter := &countingReporter{}
+	err = s.RewriteSegments(context.Background(), &SegmentRewrite{
+		DropFields:       []string{"secret"},
+		DropStoredFields: []string{"name"},
+		AddDocValues:     []string{"name"},
+		DropDocValues:    []string{"age"},
+	}, reporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reporter.bytes == 0 {
+		t.Errorf("expected the bytes written to be reported")
+	}
+	if atomic.LoadUint64(&s.stats.TotRewriteSegments) == 0 {
+		t.Errorf("expected segments to be rewritten")
+	}
+	if s.MergerPaused() {
+		t.Errorf("expected the merger to be resumed")
+	}
+
+	check := func() {
+		checkDocCount(t, idx, 2)
+		checkTermHits(t, idx, "secreta", "secret", 0)
+		checkTermHits(t, idx, "secreta", "_all", 0)
+		checkTermHits(t, idx, "namea", "_all", 1)
+		checkTermHits(t, idx, "nameb", "name", 0)
+
+		after := termFieldDoc(t, idx, "namea", "name")
+		if after == nil {
+			t.Fatalf("expected a hit")
+		}
+		if after.Freq != before.Freq || after.Norm != before.Norm ||
+			!reflect.DeepEqual(after.Vectors, before.Vectors) {
+			t.Errorf("expected hit %+v, got %+v", before, after)
+		}
+
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			err := reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+		fields, err := reader.Fields()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range fields {
+			if field == "secret" {
+				t.Errorf("expected the secret field to be dropped")
+			}
+		}
+		doc, err := reader.Document("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(doc.Fields) != 1 || doc.Fields[0].Name() != "age" {
+			t.Fatalf("expected only the age field stored, got %v", doc.Fields)
+		}
+		age, err := doc.Fields[0].(*document.NumericField).Number()
+		if err != nil || age != 42 {
+			t.Errorf("expected age 42, got %v, %v", age, err)
+		}
+
+		for _, ss := range reader.(*IndexSnapshot).segment {
+			dvFields, err := ss.segment.(interface {
+				VisitableDocValueFields() ([]string, error)
+			}).VisitableDocValueFields()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range dvFields {
+				if field == "age" {
+					t.Errorf("expected the doc values of age to be dropped")
+				}
+			}
+			if len(dvFields) != 1 || dvFields[0] != "name" {
+				t.Errorf("expected doc values for name, got %v", dvFields)
+			}
+		}
+	}
+	check()
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rewritten segments are persisted.
+	idx = openTestIndex(t, cfg)
+	check()
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewriteSegmentsChunked(t *testing.T) {
+	cfg := CreateConfig("TestRewriteSegmentsChunked")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	defer func(size int) {
+		RewriteChunkSize = size
+	}(RewriteChunkSize)
+	RewriteChunkSize = 2
+
+	idx := openTestIndex(t, cfg)
+	s := idx.(*Scorch)
+
+	ids := []string{"a", "b", "c", "d", "e", "f", "g"}
+	batch := index.NewBatch()
+	for _, id := range ids {
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextFieldWithIndexingOptions("name", nil,
+			[]byte("name"+id), document.IndexField|document.StoreField|document.IncludeTermVectors))
+		doc.AddField(document.NewTextFieldWithIndexingOptions("secret", nil,
+			[]byte("secret"+id), document.IndexField|document.StoreField))
+		batch.Update(doc)
+	}
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteDocs(t, idx, "b", "e")
+
+	err = s.RewriteSegments(context.Background(), &SegmentRewrite{
+		DropFields: []string{"secret"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		checkDocCount(t, idx, 5)
+		for _, id := range ids {
+			hits := 1
+			if id == "b" || id == "e" {
+				hits = 0
+			}
+			checkTermHits(t, idx, "name"+id, "name", hits)
+			checkTermHits(t, idx, "secret"+id, "secret", 0)
+		}
+		tfd := termFieldDoc(t, idx, "namef", "name")
+		if tfd == nil || len(tfd.Vectors) != 1 {
+			t.Fatalf("expected a hit with a term vector, got %v", tfd)
+		}
+
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			err := reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+		for _, id := range []string{"a", "d", "g"} {
+			doc, err := reader.Document(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.Fields) != 1 || string(doc.Fields[0].Value()) != "name"+id {
+				t.Errorf("expected only the name field stored, got %v", doc.Fields)
+			}
+		}
+	}
+	check()
+
+	// The temporary segments of the chunks are removed, along with the
+	// rewritten segment once the persister lets go of it.
+	deadline := time.Now().Add(10 * time.Second)
+	s.removeOldData()
+	for len(zapFileNames(t, cfg["path"].(string))) != numPersistedSegments(t, s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d segment files, got %d", numPersistedSegments(t, s),
+				len(zapFileNames(t, cfg["path"].(string))))
+		}
+		time.Sleep(10 * time.Millisecond)
+		s.removeOldData()
+	}
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx = openTestIndex(t, cfg)
+	check()
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewriteSegmentsInvalid(t *testing.T) {
+	cfg := CreateConfig("TestRewriteSegmentsInvalid")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	s := idx.(*Scorch)
+
+	for _, rewrite := range []*SegmentRewrite{
+		{DropFields: []string{"_id"}},
+		{DropStoredFields: []string{"_id"}},
+		{AddDocValues: []string{"name"}, DropDocValues: []string{"name"}},
+	} {
+		err = s.RewriteSegments(context.Background(), rewrite, nil)
+		if err == nil {
+			t.Errorf("expected an error rewriting with %+v", rewrite)
+		}
+	}
+}
@@ -190,6 +190,11 @@ func Rollback(path string, to *RollbackPoint) error {
 		}
 	}()
 
+	err = rollbackBoltChanges(tx, to.epoch)
+	if err != nil {
+		return err
+	}
+
 	snapshots := tx.Bucket(boltSnapshotsBucket)
 	if snapshots == nil {
 		return nil
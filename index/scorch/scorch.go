@@ -17,8 +17,6 @@ package scorch
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -27,6 +25,7 @@ import (
 	"github.com/blevesearch/bleve/analysis"
 	"github.com/blevesearch/bleve/document"
 	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/scorch/mergeplan"
 	"github.com/blevesearch/bleve/index/scorch/segment"
 	"github.com/blevesearch/bleve/index/store"
 	"github.com/blevesearch/bleve/registry"
@@ -44,6 +43,8 @@ type Scorch struct {
 	stats         Stats
 	iStats        internalStats
 
+	mergeBytesPerSec int64 // Accessed atomically.
+
 	readOnly      bool
 	version       uint8
 	config        map[string]interface{}
@@ -51,20 +52,46 @@ type Scorch struct {
 	path          string
 
 	unsafeBatch bool
+	changeFeed  bool
+	wal         bool
+	replica     bool // Only updated by replication, see Replicate.
+	shared      bool // Read without locking root.bolt, see parseShared.
+
+	sharedRefreshInterval time.Duration
+	sharedTxID            uint64 // The root.bolt transaction read, protected by refreshLock.
+	removalGracePeriod    time.Duration
+
+	ttlFields        []string // The fields holding expiry times, see parseTTL.
+	ttlCheckInterval time.Duration
+
+	dir Directory // nil if the index isn't persisted
+
+	replicateLock sync.Mutex // Serializes Replicate calls.
+	walLock       sync.Mutex // Serializes logging batches and introducing them.
+	rewriteLock   sync.Mutex // Serializes RewriteSegments calls.
+	refreshLock   sync.Mutex // Serializes Refresh calls.
 
 	rootLock             sync.RWMutex
 	root                 *IndexSnapshot // holds 1 ref-count on the root
 	rootPersisted        []chan error   // closed when root is persisted
 	persistedCallbacks   []index.BatchCallback
 	nextSnapshotEpoch    uint64
-	eligibleForRemoval   []uint64        // Index snapshot epochs that are safe to GC.
-	ineligibleForRemoval map[string]bool // Filenames that should not be GC'ed yet.
+	eligibleForRemoval   []uint64             // Index snapshot epochs that are safe to GC.
+	ineligibleForRemoval map[string]bool      // Filenames that should not be GC'ed yet.
+	filesInUse           map[string]int       // Filenames being read, with their counts.
+	unreferencedLock     sync.Mutex           // Protects unreferencedSince.
+	unreferencedSince    map[string]time.Time // When unreferenced files were found, see removalGracePeriod.
+
+	pendingChanges []pendingChange  // Changes introduced, but not yet persisted.
+	walEntries     []walEntry       // Batches in the write-ahead log.
+	changesCh      notificationChan // Closed when changes are persisted.
 
 	numSnapshotsToKeep int
 	closeCh            chan struct{}
 	introductions      chan *segmentIntroduction
 	persists           chan *persistIntroduction
 	merges             chan *segmentMerge
+	expirations        chan int64
 	introducerNotifier chan *epochWatcher
 	persisterNotifier  chan *epochWatcher
 	rootBolt           *bolt.DB
@@ -74,6 +101,9 @@ type Scorch struct {
 	onAsyncError func(err error)
 
 	forceMergeRequestCh chan *mergerCtrl
+	mergePolicy         mergeplan.Policy // Protected by rootLock.
+	mergerResumeCh      chan struct{}    // Protected by rootLock, nil unless the merger is paused.
+	mergerPauseCh       chan struct{}    // Protected by rootLock, closed while the merger is paused.
 
 	segPlugin segment.Plugin
 }
@@ -99,7 +129,11 @@ func NewScorch(storeName string,
 		nextSnapshotEpoch:    1,
 		closeCh:              make(chan struct{}),
 		ineligibleForRemoval: map[string]bool{},
+		filesInUse:           map[string]int{},
+		unreferencedSince:    map[string]time.Time{},
+		changesCh:            make(notificationChan),
 		forceMergeRequestCh:  make(chan *mergerCtrl, 1),
+		mergerPauseCh:        make(chan struct{}),
 		segPlugin:            defaultSegmentPlugin,
 	}
 
@@ -124,6 +158,20 @@ func NewScorch(storeName string,
 	if ok {
 		rv.unsafeBatch = ub
 	}
+	cf, ok := config["changeFeed"].(bool)
+	if ok {
+		rv.changeFeed = cf
+	}
+	wal, ok := config["writeAheadLog"].(bool)
+	if ok {
+		rv.wal = wal
+	}
+	replica, ok := config["replica"].(bool)
+	if ok && replica {
+		// Replicas aren't written to, but their root.bolt is.
+		rv.replica = true
+		rv.readOnly = true
+	}
 	ecbName, ok := config["eventCallbackName"].(string)
 	if ok {
 		rv.onEvent = RegistryEventCallbacks[ecbName]
@@ -132,6 +180,25 @@ func NewScorch(storeName string,
 	if ok {
 		rv.onAsyncError = RegistryAsyncErrorCallbacks[aecbName]
 	}
+	err = rv.parseTTL()
+	if err != nil {
+		return nil, err
+	}
+	err = rv.parseShared()
+	if err != nil {
+		return nil, err
+	}
+	rv.mergePolicy, err = rv.parseMergePolicy()
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := config["scorchMergeMaxBytesPerSec"]; ok {
+		t, err := parseToInteger(v)
+		if err != nil {
+			return nil, fmt.Errorf("scorchMergeMaxBytesPerSec parse err: %v", err)
+		}
+		rv.SetMergeBandwidth(int64(t))
+	}
 	return rv, nil
 }
 
@@ -182,6 +249,18 @@ func (s *Scorch) Open() error {
 	s.asyncTasks.Add(1)
 	go s.introducerLoop()
 
+	// Replicas and shared indexes hide the documents expired by the time
+	// they replicate or refresh.
+	if !s.replica && !s.shared && len(s.ttlFields) > 0 {
+		s.asyncTasks.Add(1)
+		go s.expirerLoop()
+	}
+
+	if s.shared && s.sharedRefreshInterval > 0 {
+		s.asyncTasks.Add(1)
+		go s.refresherLoop()
+	}
+
 	if !s.readOnly && s.path != "" {
 		s.asyncTasks.Add(1)
 		go s.persisterLoop()
@@ -199,49 +278,81 @@ func (s *Scorch) openBolt() error {
 		return fmt.Errorf("must specify path")
 	}
 	if s.path == "" {
+		if s.replica {
+			return fmt.Errorf("replicas must specify path")
+		}
 		s.unsafeBatch = true
 	}
-
-	var rootBoltOpt *bolt.Options
-	if s.readOnly {
-		rootBoltOpt = &bolt.Options{
-			ReadOnly: true,
-		}
-	} else {
-		if s.path != "" {
-			err := os.MkdirAll(s.path, 0700)
-			if err != nil {
-				return err
-			}
-		}
+	if s.path == "" || s.readOnly {
+		s.changeFeed = false
+	}
+	if s.path == "" || s.readOnly || !s.unsafeBatch {
+		s.wal = false
 	}
 
-	rootBoltPath := s.path + string(os.PathSeparator) + "root.bolt"
 	var err error
 	if s.path != "" {
-		s.rootBolt, err = bolt.Open(rootBoltPath, 0600, rootBoltOpt)
+		s.dir, err = openDirectory(s.config, s.path)
 		if err != nil {
 			return err
 		}
-
-		// now see if there is any existing state to load
-		err = s.loadFromBolt()
+		metaReadOnly := s.readOnly && !s.replica
+		err = s.dir.Setup(metaReadOnly)
 		if err != nil {
-			_ = s.Close()
 			return err
 		}
+		if s.shared {
+			if _, ok := s.dir.(*LocalDirectory); !ok {
+				return fmt.Errorf("shared read-only indexes must be in a local directory")
+			}
+			_, err = s.Refresh()
+			if err != nil {
+				_ = s.root.DecRef()
+				return err
+			}
+		} else {
+			s.rootBolt, err = s.dir.OpenMeta(metaReadOnly)
+			if err != nil {
+				return err
+			}
+
+			// now see if there is any existing state to load
+			err = s.loadFromBolt()
+			if err != nil {
+				_ = s.Close()
+				return err
+			}
+		}
+
+		if !s.readOnly {
+			err = s.setupChangeFeed()
+			if err != nil {
+				_ = s.Close()
+				return err
+			}
+		}
 	}
 
 	atomic.StoreUint64(&s.stats.TotFileSegmentsAtRoot, uint64(len(s.root.segment)))
+	atomic.StoreUint64(&s.stats.CurExpiredItems, s.root.expiredCount())
 
 	s.introductions = make(chan *segmentIntroduction)
 	s.persists = make(chan *persistIntroduction)
 	s.merges = make(chan *segmentMerge)
+	s.expirations = make(chan int64)
 	s.introducerNotifier = make(chan *epochWatcher, 1)
 	s.persisterNotifier = make(chan *epochWatcher, 1)
 	s.closeCh = make(chan struct{})
 	s.forceMergeRequestCh = make(chan *mergerCtrl, 1)
 
+	if s.wal {
+		err = s.replayWAL()
+		if err != nil {
+			_ = s.Close()
+			return err
+		}
+	}
+
 	if !s.readOnly && s.path != "" {
 		err := s.removeOldZapFiles() // Before persister or merger create any new files.
 		if err != nil {
@@ -277,8 +388,10 @@ func (s *Scorch) Close() (err error) {
 	// wait for them to close
 	s.asyncTasks.Wait()
 	// now close the root bolt
-	if s.rootBolt != nil {
-		err = s.rootBolt.Close()
+	if s.rootBolt != nil || s.shared {
+		if s.rootBolt != nil {
+			err = s.rootBolt.Close()
+		}
 		s.rootLock.Lock()
 		if s.root != nil {
 			err2 := s.root.DecRef()
@@ -307,6 +420,13 @@ func (s *Scorch) Delete(id string) error {
 
 // Batch applices a batch of changes to the index atomically
 func (s *Scorch) Batch(batch *index.Batch) (err error) {
+	if s.replica {
+		return ErrReplica
+	}
+	if s.shared {
+		return ErrShared
+	}
+
 	start := time.Now()
 
 	defer func() {
@@ -319,16 +439,28 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 	var numDeletes uint64
 	var numPlainTextBytes uint64
 	var ids []string
+	var ops []ChangeOp
 	for docID, doc := range batch.IndexOps {
+		op := ChangeOpUpdate
 		if doc != nil {
+			if s.ttlPerDoc() {
+				err = applyDocTTL(doc, start)
+				if err != nil {
+					return err
+				}
+			}
 			// insert _id field
 			doc.AddField(document.NewTextFieldCustom("_id", nil, []byte(doc.ID), document.IndexField|document.StoreField, nil))
 			numUpdates++
 			numPlainTextBytes += doc.NumPlainTextBytes()
 		} else {
 			numDeletes++
+			op = ChangeOpDelete
 		}
 		ids = append(ids, docID)
+		if s.changeFeed {
+			ops = append(ops, op)
+		}
 	}
 
 	// FIXME could sort ids list concurrent with analysis?
@@ -379,7 +511,7 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 		atomic.AddUint64(&s.stats.TotBatchesEmpty, 1)
 	}
 
-	err = s.prepareSegment(newSegment, ids, batch.InternalOps, batch.PersistedCallback())
+	err = s.prepareSegment(newSegment, ids, ops, batch.InternalOps, batch.PersistedCallback())
 	if err != nil {
 		if newSegment != nil {
 			_ = newSegment.Close()
@@ -398,16 +530,31 @@ func (s *Scorch) Batch(batch *index.Batch) (err error) {
 	return err
 }
 
-func (s *Scorch) prepareSegment(newSegment segment.Segment, ids []string,
+func (s *Scorch) prepareSegment(newSegment segment.Segment, ids []string, ops []ChangeOp,
 	internalOps map[string][]byte, persistedCallback index.BatchCallback) error {
+	if s.wal {
+		s.walLock.Lock()
+		defer s.walLock.Unlock()
+	}
+
+	var expiries *segmentExpiries
+	if newSegment != nil {
+		var err error
+		expiries, err = s.loadExpiries(newSegment)
+		if err != nil {
+			return err
+		}
+	}
 
 	// new introduction
 	introduction := &segmentIntroduction{
 		id:                atomic.AddUint64(&s.nextSegmentID, 1),
 		data:              newSegment,
 		ids:               ids,
+		ops:               ops,
 		obsoletes:         make(map[uint64]*roaring.Bitmap),
 		internal:          internalOps,
+		expiries:          expiries,
 		applied:           make(chan error),
 		persistedCallback: persistedCallback,
 	}
@@ -416,6 +563,13 @@ func (s *Scorch) prepareSegment(newSegment segment.Segment, ids []string,
 		introduction.persisted = make(chan error, 1)
 	}
 
+	if s.wal {
+		err := s.writeAheadLog(introduction)
+		if err != nil {
+			return err
+		}
+	}
+
 	// optimistically prepare obsoletes outside of rootLock
 	s.rootLock.RLock()
 	root := s.root
@@ -487,28 +641,25 @@ func (s *Scorch) Stats() json.Marshaler {
 	return &s.stats
 }
 
-func (s *Scorch) diskFileStats(rootSegmentPaths map[string]struct{}) (uint64,
+func (s *Scorch) diskFileStats(rootSegmentNames map[string]struct{}) (uint64,
 	uint64, uint64) {
 	var numFilesOnDisk, numBytesUsedDisk, numBytesOnDiskByRoot uint64
-	if s.path != "" {
-		finfos, err := ioutil.ReadDir(s.path)
+	if s.dir != nil {
+		finfos, err := s.dir.List()
 		if err == nil {
 			for _, finfo := range finfos {
-				if !finfo.IsDir() {
-					numBytesUsedDisk += uint64(finfo.Size())
-					numFilesOnDisk++
-					if rootSegmentPaths != nil {
-						fname := s.path + string(os.PathSeparator) + finfo.Name()
-						if _, fileAtRoot := rootSegmentPaths[fname]; fileAtRoot {
-							numBytesOnDiskByRoot += uint64(finfo.Size())
-						}
+				numBytesUsedDisk += uint64(finfo.Size())
+				numFilesOnDisk++
+				if rootSegmentNames != nil {
+					if _, fileAtRoot := rootSegmentNames[finfo.Name()]; fileAtRoot {
+						numBytesOnDiskByRoot += uint64(finfo.Size())
 					}
 				}
 			}
 		}
 	}
-	// if no root files path given, then consider all disk files.
-	if rootSegmentPaths == nil {
+	// if no root files names given, then consider all disk files.
+	if rootSegmentNames == nil {
 		return numFilesOnDisk, numBytesUsedDisk, numBytesUsedDisk
 	}
 
@@ -523,13 +674,13 @@ func (s *Scorch) StatsMap() map[string]interface{} {
 		_ = indexSnapshot.Close()
 	}()
 
-	rootSegPaths := indexSnapshot.diskSegmentsPaths()
+	rootSegNames := indexSnapshot.diskSegmentsNames()
 
 	s.rootLock.RLock()
 	m["CurFilesIneligibleForRemoval"] = uint64(len(s.ineligibleForRemoval))
 	s.rootLock.RUnlock()
 
-	numFilesOnDisk, numBytesUsedDisk, numBytesOnDiskByRoot := s.diskFileStats(rootSegPaths)
+	numFilesOnDisk, numBytesUsedDisk, numBytesOnDiskByRoot := s.diskFileStats(rootSegNames)
 
 	m["CurOnDiskBytes"] = numBytesUsedDisk
 	m["CurOnDiskFiles"] = numFilesOnDisk
@@ -659,6 +810,25 @@ func (s *Scorch) unmarkIneligibleForRemoval(filename string) {
 	s.rootLock.Unlock()
 }
 
+func (s *Scorch) markFilesInUse(filenames []string) {
+	s.rootLock.Lock()
+	for _, filename := range filenames {
+		s.filesInUse[filename]++
+	}
+	s.rootLock.Unlock()
+}
+
+func (s *Scorch) unmarkFilesInUse(filenames []string) {
+	s.rootLock.Lock()
+	for _, filename := range filenames {
+		s.filesInUse[filename]--
+		if s.filesInUse[filename] <= 0 {
+			delete(s.filesInUse, filename)
+		}
+	}
+	s.rootLock.Unlock()
+}
+
 func init() {
 	registry.RegisterIndexType(Name, NewScorch)
 }
@@ -0,0 +1,327 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultSharedRefreshInterval is how often a shared read-only index is
+// refreshed, unless its "sharedRefreshIntervalMSec" config says
+// otherwise.
+var DefaultSharedRefreshInterval = time.Second
+
+// ErrNotShared is returned when an index that isn't opened shared is
+// refreshed.
+var ErrNotShared = fmt.Errorf("scorch: index isn't a shared read-only index")
+
+// ErrShared is returned when a shared read-only index is written to.
+var ErrShared = fmt.Errorf("scorch: shared read-only indexes are only updated by refreshing")
+
+// parseShared reads the configs of indexes shared between processes.
+//
+// With the "sharedReadOnly" config, an index is opened read-only without
+// locking its root.bolt, so that it can be read while another process
+// writes it. It reads the latest persisted snapshot from a consistent
+// copy of root.bolt instead, and is refreshed to newer ones every
+// "sharedRefreshIntervalMSec", or only by Refresh if that's negative.
+//
+// A snapshot's segment files may be removed by the writer between the
+// copy and the reader opening them, in which case a newer snapshot is
+// read. The writer's "segmentRemovalGracePeriodMSec" config keeps the
+// files it no longer needs for a while, to let readers open them.
+func (s *Scorch) parseShared() error {
+	if shared, ok := s.config["sharedReadOnly"].(bool); ok && shared {
+		s.shared = true
+		s.readOnly = true
+	}
+	s.sharedRefreshInterval = DefaultSharedRefreshInterval
+	if v, ok := s.config["sharedRefreshIntervalMSec"]; ok {
+		t, err := parseToInteger(v)
+		if err != nil {
+			return fmt.Errorf("sharedRefreshIntervalMSec parse err: %v", err)
+		}
+		if t != 0 {
+			s.sharedRefreshInterval = time.Duration(t) * time.Millisecond
+		}
+	}
+	if v, ok := s.config["segmentRemovalGracePeriodMSec"]; ok {
+		t, err := parseToInteger(v)
+		if err != nil {
+			return fmt.Errorf("segmentRemovalGracePeriodMSec parse err: %v", err)
+		}
+		s.removalGracePeriod = time.Duration(t) * time.Millisecond
+	}
+	return nil
+}
+
+// Refresh swaps in the latest snapshot persisted by the writer of a
+// shared read-only index, if it's newer than the index's root, and
+// returns the epoch of the root.
+func (s *Scorch) Refresh() (uint64, error) {
+	if !s.shared {
+		return 0, ErrNotShared
+	}
+	s.refreshLock.Lock()
+	defer s.refreshLock.Unlock()
+
+	atomic.AddUint64(&s.stats.TotSharedRefresh, 1)
+	epoch, err := s.refreshShared()
+	if err != nil {
+		atomic.AddUint64(&s.stats.TotSharedRefreshErr, 1)
+	}
+	return epoch, err
+}
+
+func (s *Scorch) rootEpoch() uint64 {
+	s.rootLock.RLock()
+	defer s.rootLock.RUnlock()
+	return s.root.epoch
+}
+
+func (s *Scorch) refreshShared() (uint64, error) {
+	path := filepath.Join(s.path, rootBoltName)
+	for i := 0; ; i++ {
+		manifest, txID, err := readSharedManifest(path, s.sharedTxID)
+		if err != nil {
+			return 0, err
+		}
+		if manifest == nil || manifest.Epoch == s.rootEpoch() {
+			s.sharedTxID = txID
+			return s.rootEpoch(), nil
+		}
+
+		err = s.setReplicationSegmentSizes(manifest)
+		if err == nil {
+			err = s.introduceReplicationSnapshot(manifest)
+		}
+		if err == nil {
+			s.sharedTxID = txID
+			return manifest.Epoch, nil
+		}
+		if i == 10 {
+			return 0, err
+		}
+	}
+}
+
+// refresherLoop refreshes a shared read-only index every
+// sharedRefreshInterval, until it's closed.
+func (s *Scorch) refresherLoop() {
+	defer s.asyncTasks.Done()
+
+	ticker := time.NewTicker(s.sharedRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+		}
+		_, err := s.Refresh()
+		if err != nil {
+			s.fireAsyncError(fmt.Errorf("shared refresh error: %v", err))
+		}
+	}
+}
+
+// readSharedManifest reads the manifest of the latest snapshot of the
+// root.bolt at path, from a copy of it, and returns it with the id of
+// the transaction copied. The manifest is nil if there's no snapshot,
+// or if the latest transaction is still lastTxID, and then root.bolt
+// isn't copied.
+func readSharedManifest(path string, lastTxID uint64) (
+	*ReplicationManifest, uint64, error) {
+	data, txID, err := readSharedMeta(path, lastTxID)
+	if err != nil || data == nil {
+		return nil, txID, err
+	}
+
+	f, err := ioutil.TempFile("", "scorch-shared-root")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	db, err := bolt.Open(f.Name(), 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = db.Close() }()
+
+	var rv *ReplicationManifest
+	err = db.View(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(boltSnapshotsBucket)
+		if snapshots == nil {
+			return nil
+		}
+		k, _ := snapshots.Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		_, epoch, err := segment.DecodeUvarintAscending(k)
+		if err != nil {
+			return err
+		}
+		rv, err = readReplicationManifestBucket(snapshots.Bucket(k))
+		if err != nil {
+			return err
+		}
+		rv.Epoch = epoch
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return rv, txID, nil
+}
+
+// readSharedMeta reads the contents of the root.bolt at path, as of its
+// latest committed transaction, and returns them with the id of that
+// transaction. Only the meta pages are read, and the contents are nil,
+// if that transaction is still lastTxID.
+//
+// Bolt writes the pages of a transaction to pages free as of the last
+// one, before its meta page, and the meta pages are at the start of the
+// file, so the contents are consistent unless another transaction was
+// committed while they were read, in which case they're read again.
+func readSharedMeta(path string, lastTxID uint64) ([]byte, uint64, error) {
+	for i := 0; ; i++ {
+		head, err := readFileHead(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		txIDBefore, err := boltTxID(head)
+		if err != nil {
+			return nil, 0, err
+		}
+		if txIDBefore == lastTxID {
+			return nil, lastTxID, nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		txID, err := boltTxID(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		head, err = readFileHead(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		txIDAfter, err := boltTxID(head)
+		if err != nil {
+			return nil, 0, err
+		}
+		if txID == txIDAfter {
+			return data, txID, nil
+		}
+		if i == 10 {
+			return nil, 0, fmt.Errorf("scorch: %s changed while read", path)
+		}
+	}
+}
+
+// boltMaxPageSize bounds the page size of a bolt database, so that both
+// its meta pages are in the first 2*boltMaxPageSize bytes.
+const boltMaxPageSize = 64 * 1024
+
+func readFileHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	head := make([]byte, 2*boltMaxPageSize)
+	n, err := io.ReadFull(f, head)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// The layout of the meta pages of a bolt database, as of bbolt v1.3,
+// which are written in the byte order of the host, assumed to be little
+// endian. A database of another version isn't valid.
+const (
+	boltMagic          = 0xED0CDAED
+	boltVersion        = 2
+	boltPageHeaderSize = 16
+	boltMetaChecksum   = 56 // The offset of the checksum in a meta page.
+	boltMetaSize       = 64
+)
+
+// boltMeta returns the page size and transaction id of the meta page at
+// the start of data, if it's valid.
+func boltMeta(data []byte) (uint32, uint64, bool) {
+	if len(data) < boltPageHeaderSize+boltMetaSize {
+		return 0, 0, false
+	}
+	m := data[boltPageHeaderSize : boltPageHeaderSize+boltMetaSize]
+	if binary.LittleEndian.Uint32(m) != boltMagic ||
+		binary.LittleEndian.Uint32(m[4:]) != boltVersion {
+		return 0, 0, false
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(m[:boltMetaChecksum])
+	if h.Sum64() != binary.LittleEndian.Uint64(m[boltMetaChecksum:]) {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(m[8:]), binary.LittleEndian.Uint64(m[48:]), true
+}
+
+// boltTxID returns the id of the latest transaction committed to the
+// bolt database starting with data.
+func boltTxID(data []byte) (uint64, error) {
+	pageSize, txID, ok := boltMeta(data)
+	if !ok {
+		pageSize = uint32(os.Getpagesize())
+	}
+	if uint64(pageSize) < uint64(len(data)) {
+		if _, txID1, ok1 := boltMeta(data[pageSize:]); ok1 {
+			if !ok || txID1 > txID {
+				txID = txID1
+			}
+			ok = true
+		}
+	}
+	if !ok {
+		return 0, fmt.Errorf("scorch: invalid bolt database")
+	}
+	return txID, nil
+}
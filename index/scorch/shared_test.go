@@ -0,0 +1,259 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/index"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSharedReadOnly(t *testing.T) {
+	cfg := CreateConfig("TestSharedReadOnly")
+	cfg["segmentRemovalGracePeriodMSec"] = 3600000
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	writer := openTestIndex(t, cfg)
+	defer func() {
+		err := writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	updateDocs(t, writer, "a", "b")
+
+	// The reader opens the index while the writer holds its lock.
+	readerCfg := map[string]interface{}{
+		"path":                      cfg["path"],
+		"sharedReadOnly":            true,
+		"sharedRefreshIntervalMSec": -1,
+	}
+	reader := openTestIndex(t, readerCfg)
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	s := reader.(*Scorch)
+	checkDocCount(t, reader, 2)
+
+	updateDocs(t, writer, "c")
+	deleteDocs(t, writer, "a")
+	checkDocCount(t, reader, 2)
+	epoch, err := s.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch == 0 {
+		t.Errorf("expected a refreshed epoch")
+	}
+	checkDocCount(t, reader, 2)
+	checkTermHits(t, reader, "testc", "name", 1)
+	checkTermHits(t, reader, "testa", "name", 0)
+
+	// Refreshing without changes keeps the root, once the writer has
+	// persisted any background merges.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		epoch2, err := s.Refresh()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if epoch2 == epoch {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected epoch %d, got %d", epoch, epoch2)
+		}
+		epoch = epoch2
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The files merged away are kept for the grace period.
+	before := zapFileNames(t, cfg["path"].(string))
+	err = writer.(*Scorch).ForceMerge(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The snapshots merged away are removed asynchronously.
+	deadline = time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&writer.(*Scorch).stats.TotFileRemovalDeferred) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected file removals to be deferred")
+		}
+		time.Sleep(10 * time.Millisecond)
+		writer.(*Scorch).removeOldData()
+	}
+	for name := range before {
+		if _, ok := zapFileNames(t, cfg["path"].(string))[name]; !ok {
+			t.Errorf("expected %s to be kept for the grace period", name)
+		}
+	}
+
+	updateDocs(t, writer, "d")
+	_, err = s.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDocCount(t, reader, 3)
+
+	err = reader.(*Scorch).Batch(index.NewBatch())
+	if err != ErrShared {
+		t.Errorf("expected ErrShared, got %v", err)
+	}
+	_, err = writer.(*Scorch).Refresh()
+	if err != ErrNotShared {
+		t.Errorf("expected ErrNotShared, got %v", err)
+	}
+}
+
+// TestBoltTxID pins the layout of the meta pages read by boltMeta to
+// the bbolt version in use, with several page sizes.
+func TestBoltTxID(t *testing.T) {
+	cfg := CreateConfig("TestBoltTxID")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	err = os.MkdirAll(cfg["path"].(string), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pageSize := range []int{0, 4096, 16384, boltMaxPageSize} {
+		path := filepath.Join(cfg["path"].(string), fmt.Sprintf("%d.bolt", pageSize))
+		db, err := bolt.Open(path, 0600, &bolt.Options{PageSize: pageSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			err = db.Update(func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucketIfNotExists([]byte("b"))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx, err := db.Begin(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := uint64(tx.ID())
+			err = tx.Rollback()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			head, err := readFileHead(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metaPageSize, _, ok := boltMeta(head)
+			if !ok || int(metaPageSize) != db.Info().PageSize {
+				t.Errorf("expected page size %d, got %d, %t", db.Info().PageSize, metaPageSize, ok)
+			}
+
+			data, txID, err := readSharedMeta(path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txID != expected || len(data) == 0 {
+				t.Errorf("expected transaction %d, got %d", expected, txID)
+			}
+
+			// The contents aren't read again while unchanged.
+			data, txID, err = readSharedMeta(path, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txID != expected || data != nil {
+				t.Errorf("expected transaction %d unread, got %d, %d bytes", expected, txID, len(data))
+			}
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSharedReadOnlyRefreshInterval(t *testing.T) {
+	cfg := CreateConfig("TestSharedReadOnlyRefreshInterval")
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	writer := openTestIndex(t, cfg)
+	defer func() {
+		err := writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	reader := openTestIndex(t, map[string]interface{}{
+		"path":                      cfg["path"],
+		"sharedReadOnly":            true,
+		"sharedRefreshIntervalMSec": 10,
+	})
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	checkDocCount(t, reader, 0)
+
+	updateDocs(t, writer, "a")
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&reader.(*Scorch).stats.CurRootEpoch) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the reader to be refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkDocCount(t, reader, 1)
+}
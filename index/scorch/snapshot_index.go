@@ -349,6 +349,21 @@ func (i *IndexSnapshot) DocCount() (uint64, error) {
 	return rv, nil
 }
 
+// FieldStats sums the statistics of the field over the segments of the
+// snapshot.
+func (i *IndexSnapshot) FieldStats(field string) (index.FieldStats, error) {
+	var rv index.FieldStats
+	for _, segment := range i.segment {
+		stats, err := segment.FieldStats(field)
+		if err != nil {
+			return index.FieldStats{}, err
+		}
+		rv.Docs += stats.Docs
+		rv.TotalTerms += stats.TotalTerms
+	}
+	return rv, nil
+}
+
 func (i *IndexSnapshot) Document(id string) (rv *document.Document, err error) {
 	// FIXME could be done more efficiently directly, but reusing for simplicity
 	tfr, err := i.TermFieldReader([]byte(id), "_id", false, false, false)
@@ -489,7 +504,7 @@ func (i *IndexSnapshot) TermFieldReader(term []byte, field string, includeFreq,
 	}
 
 	for i, segment := range i.segment {
-		pl, err := rv.dicts[i].PostingsList(term, segment.deleted, rv.postings[i])
+		pl, err := rv.dicts[i].PostingsList(term, segment.hiddenDocs(), rv.postings[i])
 		if err != nil {
 			return nil, err
 		}
@@ -708,11 +723,11 @@ func (i *IndexSnapshot) DumpFields() chan interface{} {
 	return rv
 }
 
-func (i *IndexSnapshot) diskSegmentsPaths() map[string]struct{} {
+func (i *IndexSnapshot) diskSegmentsNames() map[string]struct{} {
 	rv := make(map[string]struct{}, len(i.segment))
 	for _, segmentSnapshot := range i.segment {
 		if seg, ok := segmentSnapshot.segment.(segment.PersistedSegment); ok {
-			rv[seg.Path()] = struct{}{}
+			rv[segmentFileName(seg)] = struct{}{}
 		}
 	}
 	return rv
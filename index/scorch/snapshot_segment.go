@@ -36,6 +36,16 @@ type SegmentSnapshot struct {
 	creator string
 
 	cachedDocs *cachedDocs
+	fieldStats *segmentFieldStats
+
+	// expiries are the expiry times of the segment's documents, if any
+	// expire, and expired are the documents that have expired by the
+	// time the snapshot was introduced, except the deleted ones. The
+	// first expiredN expiries were applied, see expireSegment.
+	expiries *segmentExpiries
+	expired  *roaring.Bitmap
+	expiredN int
+	hidden   *roaring.Bitmap // The deleted and expired documents, if any expired.
 }
 
 func (s *SegmentSnapshot) Segment() segment.Segment {
@@ -46,6 +56,14 @@ func (s *SegmentSnapshot) Deleted() *roaring.Bitmap {
 	return s.deleted
 }
 
+// hiddenDocs returns the documents that are deleted or have expired.
+func (s *SegmentSnapshot) hiddenDocs() *roaring.Bitmap {
+	if s.expired != nil {
+		return s.hidden
+	}
+	return s.deleted
+}
+
 func (s *SegmentSnapshot) Id() uint64 {
 	return s.id
 }
@@ -75,6 +93,9 @@ func (s *SegmentSnapshot) Count() uint64 {
 	if s.deleted != nil {
 		rv -= s.deleted.GetCardinality()
 	}
+	if s.expired != nil {
+		rv -= s.expired.GetCardinality()
+	}
 	return rv
 }
 
@@ -83,8 +104,8 @@ func (s *SegmentSnapshot) DocNumbers(docIDs []string) (*roaring.Bitmap, error) {
 	if err != nil {
 		return nil, err
 	}
-	if s.deleted != nil {
-		rv.AndNot(s.deleted)
+	if hidden := s.hiddenDocs(); hidden != nil {
+		rv.AndNot(hidden)
 	}
 	return rv, nil
 }
@@ -93,8 +114,8 @@ func (s *SegmentSnapshot) DocNumbers(docIDs []string) (*roaring.Bitmap, error) {
 func (s *SegmentSnapshot) DocNumbersLive() *roaring.Bitmap {
 	rv := roaring.NewBitmap()
 	rv.AddRange(0, s.segment.Count())
-	if s.deleted != nil {
-		rv.AndNot(s.deleted)
+	if hidden := s.hiddenDocs(); hidden != nil {
+		rv.AndNot(hidden)
 	}
 	return rv
 }
@@ -108,6 +129,9 @@ func (s *SegmentSnapshot) Size() (rv int) {
 	if s.deleted != nil {
 		rv += int(s.deleted.GetSizeInBytes())
 	}
+	if s.expired != nil {
+		rv += int(s.expired.GetSizeInBytes())
+	}
 	rv += s.cachedDocs.Size()
 	return
 }
@@ -277,3 +301,81 @@ func (c *cachedDocs) visitDoc(localDocNum uint64,
 
 	c.m.Unlock()
 }
+
+// FieldStats returns the statistics of a field over all the documents of
+// the segment. Like the dictionary counts, they include the documents
+// which were deleted since the segment was built.
+func (s *SegmentSnapshot) FieldStats(field string) (index.FieldStats, error) {
+	if s.fieldStats == nil {
+		return computeFieldStats(s.segment, field)
+	}
+	return s.fieldStats.fieldStats(s.segment, field)
+}
+
+// segmentFieldStats caches the field statistics of a segment. As they do
+// not depend on the deletions, it is shared by all the snapshots of the
+// segment, in the same way as the cachedDocs.
+type segmentFieldStats struct {
+	m     sync.Mutex
+	cache map[string]index.FieldStats // Keyed by field
+}
+
+func (c *segmentFieldStats) fieldStats(seg segment.Segment,
+	field string) (index.FieldStats, error) {
+	c.m.Lock()
+	rv, exists := c.cache[field]
+	c.m.Unlock()
+	if exists {
+		return rv, nil
+	}
+
+	rv, err := computeFieldStats(seg, field)
+	if err != nil {
+		return rv, err
+	}
+
+	c.m.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]index.FieldStats)
+	}
+	c.cache[field] = rv
+	c.m.Unlock()
+	return rv, nil
+}
+
+func computeFieldStats(seg segment.Segment, field string) (index.FieldStats, error) {
+	var rv index.FieldStats
+	dict, err := seg.Dictionary(field)
+	if err != nil {
+		return rv, err
+	}
+
+	docs := roaring.NewBitmap()
+	var postings segment.PostingsList
+	var postingsItr segment.PostingsIterator
+	dictItr := dict.Iterator()
+	next, err := dictItr.Next()
+	for err == nil && next != nil {
+		postings, err = dict.PostingsList([]byte(next.Term), nil, postings)
+		if err != nil {
+			return rv, err
+		}
+		postingsItr = postings.Iterator(true, false, false, postingsItr)
+		var posting segment.Posting
+		posting, err = postingsItr.Next()
+		for err == nil && posting != nil {
+			rv.TotalTerms += posting.Frequency()
+			docs.Add(uint32(posting.Number()))
+			posting, err = postingsItr.Next()
+		}
+		if err != nil {
+			return rv, err
+		}
+		next, err = dictItr.Next()
+	}
+	if err != nil {
+		return rv, err
+	}
+	rv.Docs = docs.GetCardinality()
+	return rv, nil
+}
@@ -59,6 +59,8 @@ type Stats struct {
 	TotIntroduceMergeEnd   uint64
 	TotIntroduceRevertBeg  uint64
 	TotIntroduceRevertEnd  uint64
+	TotIntroduceExpiryBeg  uint64
+	TotIntroduceExpiryEnd  uint64
 
 	TotIntroducedItems         uint64
 	TotIntroducedSegmentsBatch uint64
@@ -103,6 +105,7 @@ type Stats struct {
 	TotFileMergeSegments      uint64
 	TotFileSegmentsAtRoot     uint64
 	TotFileMergeWrittenBytes  uint64
+	TotFileMergeThrottleTime  uint64
 
 	TotFileMergeZapBeg              uint64
 	TotFileMergeZapEnd              uint64
@@ -128,6 +131,21 @@ type Stats struct {
 	MaxMemMergeZapTime      uint64
 	TotMemMergeSegments     uint64
 	TotMemorySegmentsAtRoot uint64
+
+	CurExpiredItems       uint64
+	TotExpiredItemsPurged uint64
+
+	TotWALRecords          uint64
+	TotWALRecordsTruncated uint64
+	TotWALRecordsReplayed  uint64
+
+	TotRewriteSegments          uint64
+	TotRewriteSegmentsErr       uint64
+	TotRewriteSegmentsObsoleted uint64
+
+	TotSharedRefresh       uint64
+	TotSharedRefreshErr    uint64
+	TotFileRemovalDeferred uint64
 }
 
 // atomically populates the returned map
@@ -0,0 +1,347 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	"github.com/blevesearch/bleve/numeric"
+)
+
+// TTLFieldName is the name of the field that holds a document's time to
+// live, when the "ttl" config is true. The field is either a duration,
+// a string like "72h" or a number of seconds, which is replaced by the
+// time the document expires when it's indexed, or a datetime field,
+// which is that time.
+const TTLFieldName = "_ttl"
+
+// DefaultTTLCheckInterval is how often an index checks for documents
+// that have expired, unless its "ttlCheckIntervalMSec" config says
+// otherwise.
+var DefaultTTLCheckInterval = time.Second
+
+// parseTTL reads the TTL configs. Documents expire at the times indexed
+// in the _ttl field, when the "ttl" config is true, and in the datetime
+// field named by the "ttlField" config. A document with several expiry
+// times expires at the first.
+//
+// Expired documents are hidden by a bitmap kept next to the deleted one
+// by each SegmentSnapshot, which isn't persisted, but found again from
+// the expiry times whenever the segment is opened. The expirer hides
+// documents as they expire, and merges drop them from the segments.
+func (s *Scorch) parseTTL() error {
+	if ttl, ok := s.config["ttl"].(bool); ok && ttl {
+		s.ttlFields = append(s.ttlFields, TTLFieldName)
+	}
+	if field, ok := s.config["ttlField"].(string); ok && field != "" &&
+		field != TTLFieldName {
+		s.ttlFields = append(s.ttlFields, field)
+	}
+	s.ttlCheckInterval = DefaultTTLCheckInterval
+	if v, ok := s.config["ttlCheckIntervalMSec"]; ok {
+		t, err := parseToInteger(v)
+		if err != nil {
+			return fmt.Errorf("ttlCheckIntervalMSec parse err: %v", err)
+		}
+		if t > 0 {
+			s.ttlCheckInterval = time.Duration(t) * time.Millisecond
+		}
+	}
+	return nil
+}
+
+func (s *Scorch) ttlPerDoc() bool {
+	return len(s.ttlFields) > 0 && s.ttlFields[0] == TTLFieldName
+}
+
+// applyDocTTL replaces the doc's _ttl durations by the times they end,
+// counting from now.
+func applyDocTTL(doc *document.Document, now time.Time) error {
+	for i, field := range doc.Fields {
+		if field.Name() != TTLFieldName {
+			continue
+		}
+		var ttl time.Duration
+		switch field := field.(type) {
+		case *document.DateTimeField:
+			continue
+		case *document.NumericField:
+			secs, err := field.Number()
+			if err != nil {
+				return fmt.Errorf("doc %s: invalid %s: %v", doc.ID, TTLFieldName, err)
+			}
+			ttl = time.Duration(secs * float64(time.Second))
+		case *document.TextField:
+			var err error
+			ttl, err = time.ParseDuration(string(field.Value()))
+			if err != nil {
+				return fmt.Errorf("doc %s: invalid %s: %v", doc.ID, TTLFieldName, err)
+			}
+		default:
+			return fmt.Errorf("doc %s: %s must be a duration or a datetime, got %T",
+				doc.ID, TTLFieldName, field)
+		}
+		expiry, err := document.NewDateTimeFieldWithIndexingOptions(TTLFieldName,
+			field.ArrayPositions(), now.Add(ttl), document.IndexField|document.StoreField)
+		if err != nil {
+			return fmt.Errorf("doc %s: invalid %s: %v", doc.ID, TTLFieldName, err)
+		}
+		doc.Fields[i] = expiry
+	}
+	return nil
+}
+
+type segmentExpiry struct {
+	at  int64 // Unix time in nanoseconds.
+	num uint32
+}
+
+// segmentExpiries are the expiry times of the documents in a segment, in
+// order, shared by the SegmentSnapshots of the segment, and of segments
+// with the same documents.
+type segmentExpiries struct {
+	expiries []segmentExpiry
+
+	m  sync.Mutex
+	n  int             // The number of expiries in bm.
+	bm *roaring.Bitmap // The documents of the first n expiries, not modified.
+}
+
+// loadExpiries reads the expiry times of the documents in the segment
+// from its ttl fields, returning nil if none of them expire.
+func (s *Scorch) loadExpiries(seg segment.Segment) (*segmentExpiries, error) {
+	var expiries []segmentExpiry
+	shiftZero := string([]byte{numeric.ShiftStartInt64})
+	for _, field := range s.ttlFields {
+		dict, err := seg.Dictionary(field)
+		if err != nil {
+			return nil, err
+		}
+		var postings segment.PostingsList
+		var postingsItr segment.PostingsIterator
+		itr := dict.PrefixIterator(shiftZero)
+		for {
+			next, err := itr.Next()
+			if err != nil {
+				return nil, err
+			}
+			if next == nil {
+				break
+			}
+			at, err := numeric.PrefixCoded(next.Term).Int64()
+			if err != nil {
+				return nil, err
+			}
+			postings, err = dict.PostingsList([]byte(next.Term), nil, postings)
+			if err != nil {
+				return nil, err
+			}
+			postingsItr = postings.Iterator(false, false, false, postingsItr)
+			for {
+				p, err := postingsItr.Next()
+				if err != nil {
+					return nil, err
+				}
+				if p == nil {
+					break
+				}
+				expiries = append(expiries, segmentExpiry{at: at, num: uint32(p.Number())})
+			}
+		}
+	}
+	if len(expiries) == 0 {
+		return nil, nil
+	}
+	sort.Slice(expiries, func(i, j int) bool {
+		return expiries[i].at < expiries[j].at
+	})
+	return &segmentExpiries{expiries: expiries}, nil
+}
+
+// expiredAt returns the number of expiries up to now, and a bitmap of
+// their documents, which mustn't be modified.
+func (e *segmentExpiries) expiredAt(now int64) (int, *roaring.Bitmap) {
+	n := sort.Search(len(e.expiries), func(i int) bool {
+		return e.expiries[i].at > now
+	})
+	if n == 0 {
+		return 0, nil
+	}
+	e.m.Lock()
+	defer e.m.Unlock()
+	if n != e.n {
+		bm := roaring.NewBitmap()
+		for _, expiry := range e.expiries[:n] {
+			bm.Add(expiry.num)
+		}
+		e.n, e.bm = n, bm
+	}
+	return e.n, e.bm
+}
+
+// expireSegment hides the documents of ss that have expired by now,
+// reusing the bitmaps of prev, a snapshot of the same segment, if they're
+// unchanged.
+func expireSegment(ss, prev *SegmentSnapshot, now int64) {
+	if ss.expiries == nil {
+		return
+	}
+	n, bm := ss.expiries.expiredAt(now)
+	if prev != nil && prev.expiries == ss.expiries &&
+		prev.expiredN == n && prev.deleted == ss.deleted {
+		ss.expiredN, ss.expired, ss.hidden = prev.expiredN, prev.expired, prev.hidden
+		return
+	}
+	ss.expiredN, ss.expired, ss.hidden = n, nil, nil
+	if bm == nil {
+		return
+	}
+	expired := bm
+	if ss.deleted != nil {
+		expired = roaring.AndNot(bm, ss.deleted)
+		if expired.IsEmpty() {
+			return
+		}
+	}
+	ss.expired = expired
+	if ss.deleted != nil {
+		ss.hidden = roaring.Or(ss.deleted, expired)
+	} else {
+		ss.hidden = expired
+	}
+}
+
+// expiredCount returns the number of expired documents in the snapshot,
+// which are still to be dropped by merges.
+func (i *IndexSnapshot) expiredCount() (rv uint64) {
+	for _, segment := range i.segment {
+		if segment.expired != nil {
+			rv += segment.expired.GetCardinality()
+		}
+	}
+	return rv
+}
+
+func (s *Scorch) expiriesDue(now int64) bool {
+	s.rootLock.RLock()
+	root := s.root
+	root.AddRef()
+	s.rootLock.RUnlock()
+	defer func() { _ = root.DecRef() }()
+
+	for _, segment := range root.segment {
+		if segment.expiries != nil {
+			if n, _ := segment.expiries.expiredAt(now); n > segment.expiredN {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Scorch) expirerLoop() {
+	defer s.asyncTasks.Done()
+
+	ticker := time.NewTicker(s.ttlCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now().UnixNano()
+		if !s.expiriesDue(now) {
+			continue
+		}
+		select {
+		case <-s.closeCh:
+			return
+		case s.expirations <- now:
+		}
+	}
+}
+
+// introduceExpiries introduces a snapshot hiding the documents that have
+// expired by now.
+func (s *Scorch) introduceExpiries(now int64) {
+	atomic.AddUint64(&s.stats.TotIntroduceExpiryBeg, 1)
+	defer atomic.AddUint64(&s.stats.TotIntroduceExpiryEnd, 1)
+
+	s.rootLock.RLock()
+	root := s.root
+	root.AddRef()
+	s.rootLock.RUnlock()
+
+	defer func() { _ = root.DecRef() }()
+
+	newSnapshot := &IndexSnapshot{
+		parent:   s,
+		segment:  make([]*SegmentSnapshot, 0, len(root.segment)),
+		offsets:  make([]uint64, 0, len(root.segment)),
+		internal: root.internal,
+		refs:     1,
+		creator:  "introduceExpiries",
+	}
+
+	var running, fileSegments, memSegments uint64
+	for _, segmentSnapshot := range root.segment {
+		newss := &SegmentSnapshot{
+			id:         segmentSnapshot.id,
+			segment:    segmentSnapshot.segment,
+			deleted:    segmentSnapshot.deleted,
+			cachedDocs: segmentSnapshot.cachedDocs,
+			fieldStats: segmentSnapshot.fieldStats,
+			expiries:   segmentSnapshot.expiries,
+			creator:    segmentSnapshot.creator,
+		}
+		expireSegment(newss, segmentSnapshot, now)
+		if newss.LiveSize() == 0 {
+			continue
+		}
+		newSnapshot.segment = append(newSnapshot.segment, newss)
+		newss.segment.AddRef()
+		newSnapshot.offsets = append(newSnapshot.offsets, running)
+		running += newss.segment.Count()
+		if isMemorySegment(newss) {
+			memSegments++
+		} else {
+			fileSegments++
+		}
+	}
+
+	atomic.StoreUint64(&s.stats.TotMemorySegmentsAtRoot, memSegments)
+	atomic.StoreUint64(&s.stats.TotFileSegmentsAtRoot, fileSegments)
+
+	newSnapshot.updateSize()
+	s.rootLock.Lock()
+	newSnapshot.epoch = s.nextSnapshotEpoch
+	s.nextSnapshotEpoch++
+	rootPrev := s.root
+	s.root = newSnapshot
+	atomic.StoreUint64(&s.stats.CurRootEpoch, s.root.epoch)
+	s.rootLock.Unlock()
+
+	if rootPrev != nil {
+		_ = rootPrev.DecRef()
+	}
+}
@@ -0,0 +1,238 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index"
+)
+
+func checkTermHits(t *testing.T, idx index.Index, term, field string, expected int) {
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tfr, err := reader.TermFieldReader([]byte(term), field, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits int
+	for {
+		tfd, err := tfr.Next(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tfd == nil {
+			break
+		}
+		hits++
+	}
+	err = tfr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits != expected {
+		t.Errorf("expected %d hits for %s:%s, got %d", expected, field, term, hits)
+	}
+}
+
+func TestTTLPerDoc(t *testing.T) {
+	cfg := CreateConfig("TestTTLPerDoc")
+	cfg["ttl"] = true
+	cfg["ttlCheckIntervalMSec"] = 10
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	batch := index.NewBatch()
+	doc := document.NewDocument("a")
+	doc.AddField(document.NewTextField("name", nil, []byte("test")))
+	doc.AddField(document.NewTextField(TTLFieldName, nil, []byte("50ms")))
+	batch.Update(doc)
+	doc = document.NewDocument("b")
+	doc.AddField(document.NewTextField("name", nil, []byte("test")))
+	batch.Update(doc)
+	doc = document.NewDocument("c")
+	doc.AddField(document.NewTextField("name", nil, []byte("test")))
+	doc.AddField(document.NewNumericField(TTLFieldName, nil, 3600))
+	batch.Update(doc)
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDocCount(t, idx, 3)
+
+	s := idx.(*Scorch)
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&s.stats.CurExpiredItems) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected doc a to expire")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkDocCount(t, idx, 2)
+	checkTermHits(t, idx, "test", "name", 2)
+
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err = reader.Document("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc != nil {
+		t.Errorf("expected expired doc a to be hidden")
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Merges drop the expired doc.
+	updateDocs(t, idx, "d")
+	err = s.ForceMerge(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadUint64(&s.stats.TotExpiredItemsPurged) != 1 {
+		t.Errorf("expected 1 expired doc purged, got %d", s.stats.TotExpiredItemsPurged)
+	}
+	if atomic.LoadUint64(&s.stats.CurExpiredItems) != 0 {
+		t.Errorf("expected no expired docs pending purge, got %d", s.stats.CurExpiredItems)
+	}
+	checkDocCount(t, idx, 3)
+	checkTermHits(t, idx, "test", "name", 2)
+}
+
+func TestTTLField(t *testing.T) {
+	cfg := CreateConfig("TestTTLField")
+	cfg["ttlField"] = "expires"
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+
+	batch := index.NewBatch()
+	for id, expires := range map[string]time.Time{
+		"a": time.Now().Add(-time.Hour),
+		"b": time.Now().Add(time.Hour),
+	} {
+		doc := document.NewDocument(id)
+		doc.AddField(document.NewTextField("name", nil, []byte("test")))
+		field, err := document.NewDateTimeField("expires", nil, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.AddField(field)
+		batch.Update(doc)
+	}
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDocCount(t, idx, 1)
+	checkTermHits(t, idx, "test", "name", 1)
+
+	// A _ttl field isn't special unless the ttl config is true.
+	batch = index.NewBatch()
+	doc := document.NewDocument("c")
+	doc.AddField(document.NewTextField(TTLFieldName, nil, []byte("not a duration")))
+	batch.Update(doc)
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The expired doc is still hidden when the index is opened again.
+	idx = openTestIndex(t, cfg)
+	checkDocCount(t, idx, 2)
+	checkTermHits(t, idx, "test", "name", 1)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTTLInvalid(t *testing.T) {
+	cfg := CreateConfig("TestTTLInvalid")
+	cfg["ttl"] = true
+	err := InitTest(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := DestroyTest(cfg)
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx := openTestIndex(t, cfg)
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	batch := index.NewBatch()
+	doc := document.NewDocument("a")
+	doc.AddField(document.NewTextField(TTLFieldName, nil, []byte("not a duration")))
+	batch.Update(doc)
+	err = idx.Batch(batch)
+	if err == nil {
+		t.Errorf("expected an invalid %s to fail the batch", TTLFieldName)
+	}
+}
@@ -0,0 +1,390 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/blevesearch/bleve/index/scorch/segment"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The write-ahead log makes unsafe batches durable before Batch returns,
+// when the "writeAheadLog" config is true, so that they survive a crash
+// even though the persister hasn't written them to zap files yet. It's
+// unused by indexes whose batches are safe, which wait for the
+// persister anyway.
+//
+// Each batch's segment is written to its own .wal file, by the segment
+// plugin, which syncs it, and the rest of the batch to a record in its
+// own bucket of root.bolt, keyed by the batch's segment id. Batches are
+// logged and introduced in the order of their ids, which is the order
+// they're replayed in on Open. Once a persisted snapshot covers the
+// epoch a batch introduced, its record is deleted by the same
+// transaction, and then its .wal file.
+var boltWALBucket = []byte{'w'}
+
+const (
+	walFlagSegment byte = 1 << iota // The batch has a .wal file.
+	walFlagOps                      // The batch's change ops are logged.
+)
+
+// walEntry is a batch in the write-ahead log, with the epoch of the
+// snapshot that introduced it, or 0 if it's not introduced yet.
+type walEntry struct {
+	id      uint64
+	epoch   uint64
+	segment bool
+}
+
+func walFileName(id uint64) string {
+	return fmt.Sprintf("%012x.wal", id)
+}
+
+func encodeWALRecord(next *segmentIntroduction) []byte {
+	var flags byte
+	if next.data != nil {
+		flags |= walFlagSegment
+	}
+	if next.ops != nil {
+		flags |= walFlagOps
+	}
+	buf := []byte{flags}
+	buf = appendUvarint(buf, uint64(len(next.ids)))
+	for i, id := range next.ids {
+		if next.ops != nil {
+			buf = append(buf, byte(next.ops[i]))
+		}
+		buf = appendUvarint(buf, uint64(len(id)))
+		buf = append(buf, id...)
+	}
+	buf = appendUvarint(buf, uint64(len(next.internal)))
+	for key, val := range next.internal {
+		buf = appendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+		if val == nil {
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		buf = appendUvarint(buf, uint64(len(val)))
+		buf = append(buf, val...)
+	}
+	return buf
+}
+
+// decodeWALRecord decodes a record into an introduction, without its
+// segment, and returns whether the batch has a .wal file.
+func decodeWALRecord(id uint64, buf []byte) (*segmentIntroduction, bool, error) {
+	d := &walDecoder{buf: buf}
+	flags := d.byte()
+	rv := &segmentIntroduction{
+		id:        id,
+		obsoletes: make(map[uint64]*roaring.Bitmap),
+	}
+	n := d.uvarint()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		if flags&walFlagOps != 0 {
+			rv.ops = append(rv.ops, ChangeOp(d.byte()))
+		}
+		rv.ids = append(rv.ids, string(d.bytes()))
+	}
+	n = d.uvarint()
+	if n > 0 {
+		rv.internal = make(map[string][]byte, n)
+	}
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		key := string(d.bytes())
+		var val []byte
+		if d.byte() != 0 {
+			val = append([]byte{}, d.bytes()...)
+		}
+		rv.internal[key] = val
+	}
+	if d.err == nil && len(d.buf) > 0 {
+		d.err = fmt.Errorf("trailing bytes")
+	}
+	if d.err != nil {
+		return nil, false, fmt.Errorf("corrupt write-ahead log record %d: %v", id, d.err)
+	}
+	return rv, flags&walFlagSegment != 0, nil
+}
+
+type walDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *walDecoder) byte() byte {
+	if d.err != nil || len(d.buf) < 1 {
+		d.err = fmt.Errorf("truncated")
+		return 0
+	}
+	rv := d.buf[0]
+	d.buf = d.buf[1:]
+	return rv
+}
+
+func (d *walDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	rv, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("truncated")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return rv
+}
+
+func (d *walDecoder) bytes() []byte {
+	l := d.uvarint()
+	if d.err != nil || uint64(len(d.buf)) < l {
+		d.err = fmt.Errorf("truncated")
+		return nil
+	}
+	rv := d.buf[:l]
+	d.buf = d.buf[l:]
+	return rv
+}
+
+// writeAheadLog logs the batch of the introduction, before it's
+// introduced. s.walLock must be held until it's introduced.
+func (s *Scorch) writeAheadLog(next *segmentIntroduction) error {
+	entry := walEntry{id: next.id, segment: next.data != nil}
+	if entry.segment {
+		seg, ok := next.data.(segment.UnpersistedSegment)
+		if !ok {
+			return fmt.Errorf("segment of type %T can't be logged", next.data)
+		}
+		err := s.dir.Create(walFileName(next.id), seg.Persist)
+		if err != nil {
+			s.removeWALFile(next.id)
+			return err
+		}
+	}
+	err := s.rootBolt.Update(func(tx *bolt.Tx) error {
+		wal, err := tx.CreateBucketIfNotExists(boltWALBucket)
+		if err != nil {
+			return err
+		}
+		return wal.Put(segment.EncodeUvarintAscending(nil, next.id), encodeWALRecord(next))
+	})
+	if err != nil {
+		if entry.segment {
+			s.removeWALFile(next.id)
+		}
+		return err
+	}
+	s.rootLock.Lock()
+	s.walEntries = append(s.walEntries, entry)
+	s.rootLock.Unlock()
+	next.logged = true
+	atomic.AddUint64(&s.stats.TotWALRecords, 1)
+	return nil
+}
+
+// walIntroduced records the epoch of the snapshot that introduced a
+// logged batch. s.rootLock must be held.
+func (s *Scorch) walIntroduced(id, epoch uint64) {
+	for i := len(s.walEntries) - 1; i >= 0; i-- {
+		if s.walEntries[i].id == id {
+			s.walEntries[i].epoch = epoch
+			return
+		}
+	}
+}
+
+// prepareBoltWAL deletes the records of the logged batches introduced up
+// to the snapshot, and returns them, so that their .wal files can be
+// removed once tx is committed.
+func (s *Scorch) prepareBoltWAL(snapshot *IndexSnapshot, tx *bolt.Tx) ([]walEntry, error) {
+	var rv []walEntry
+	s.rootLock.RLock()
+	for _, entry := range s.walEntries {
+		if entry.epoch != 0 && entry.epoch <= snapshot.epoch {
+			rv = append(rv, entry)
+		}
+	}
+	s.rootLock.RUnlock()
+	if len(rv) == 0 {
+		return nil, nil
+	}
+	wal := tx.Bucket(boltWALBucket)
+	if wal == nil {
+		return nil, fmt.Errorf("write-ahead log bucket missing")
+	}
+	for _, entry := range rv {
+		err := wal.Delete(segment.EncodeUvarintAscending(nil, entry.id))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+// walTruncated removes the truncated batches, and their .wal files.
+func (s *Scorch) walTruncated(truncated []walEntry) {
+	if len(truncated) == 0 {
+		return
+	}
+	ids := make(map[uint64]struct{}, len(truncated))
+	for _, entry := range truncated {
+		ids[entry.id] = struct{}{}
+	}
+	s.rootLock.Lock()
+	walEntries := s.walEntries[:0]
+	for _, entry := range s.walEntries {
+		if _, ok := ids[entry.id]; !ok {
+			walEntries = append(walEntries, entry)
+		}
+	}
+	s.walEntries = walEntries
+	s.rootLock.Unlock()
+	for _, entry := range truncated {
+		if entry.segment {
+			s.removeWALFile(entry.id)
+		}
+	}
+	atomic.AddUint64(&s.stats.TotWALRecordsTruncated, uint64(len(truncated)))
+}
+
+func (s *Scorch) removeWALFile(id uint64) {
+	err := s.dir.Remove(walFileName(id))
+	if err != nil {
+		log.Printf("got err removing file: %s, err: %v", walFileName(id), err)
+	}
+}
+
+// replayWAL introduces the logged batches that weren't persisted before
+// the index was closed, writing their segments to zap files, which
+// become eligible for removal once they're persisted.
+func (s *Scorch) replayWAL() error {
+	var intros []*segmentIntroduction
+	var segments []bool
+	err := s.rootBolt.View(func(tx *bolt.Tx) error {
+		wal := tx.Bucket(boltWALBucket)
+		if wal == nil {
+			return nil
+		}
+		return wal.ForEach(func(k, v []byte) error {
+			_, id, err := segment.DecodeUvarintAscending(k)
+			if err != nil {
+				return err
+			}
+			intro, hasSegment, err := decodeWALRecord(id, v)
+			if err != nil {
+				return err
+			}
+			intros = append(intros, intro)
+			segments = append(segments, hasSegment)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	logged := make(map[string]struct{}, len(intros))
+	for i, intro := range intros {
+		if segments[i] {
+			logged[walFileName(intro.id)] = struct{}{}
+		}
+	}
+	finfos, err := s.dir.List()
+	if err != nil {
+		return err
+	}
+	for _, finfo := range finfos {
+		fname := finfo.Name()
+		if _, ok := logged[fname]; !ok && filepath.Ext(fname) == ".wal" {
+			err = s.dir.Remove(fname)
+			if err != nil {
+				log.Printf("got err removing file: %s, err: %v", fname, err)
+			}
+		}
+	}
+
+	for i, intro := range intros {
+		if segments[i] {
+			intro.data, err = s.replayWALSegment(intro.id)
+			if err != nil {
+				return err
+			}
+			intro.expiries, err = s.loadExpiries(intro.data)
+			if err != nil {
+				_ = intro.data.Close()
+				return err
+			}
+		}
+		if !s.changeFeed {
+			intro.ops = nil
+		} else if intro.ops == nil {
+			intro.ops = make([]ChangeOp, len(intro.ids))
+			for j := range intro.ops {
+				intro.ops[j] = ChangeOpUpdate
+			}
+		}
+		intro.applied = make(chan error, 1)
+		intro.logged = true
+
+		s.rootLock.Lock()
+		s.walEntries = append(s.walEntries, walEntry{id: intro.id, segment: segments[i]})
+		s.rootLock.Unlock()
+
+		err = s.introduceSegment(intro)
+		if err != nil {
+			return err
+		}
+		if intro.id > s.nextSegmentID {
+			s.nextSegmentID = intro.id
+		}
+		atomic.AddUint64(&s.stats.TotWALRecordsReplayed, 1)
+	}
+	return nil
+}
+
+// replayWALSegment writes the segment of a logged batch to the zap file
+// the persister would have written, and opens it.
+func (s *Scorch) replayWALSegment(id uint64) (segment.Segment, error) {
+	walSeg, err := s.dir.Open(walFileName(id), s.segPlugin.Open)
+	if err != nil {
+		return nil, fmt.Errorf("error opening write-ahead log segment: %v", err)
+	}
+	filename := zapFileName(id)
+	s.markIneligibleForRemoval(filename)
+	err = s.dir.Create(filename, func(path string) error {
+		_, _, err := s.segPlugin.Merge([]segment.Segment{walSeg},
+			[]*roaring.Bitmap{nil}, path, s.closeCh, s)
+		return err
+	})
+	_ = walSeg.Close()
+	if err != nil {
+		s.unmarkIneligibleForRemoval(filename)
+		return nil, err
+	}
+	seg, err := s.dir.Open(filename, s.segPlugin.Open)
+	if err != nil {
+		s.unmarkIneligibleForRemoval(filename)
+		return nil, err
+	}
+	return seg, nil
+}
@@ -0,0 +1,183 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorch
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/index"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openWALIndex opens an index with a write-ahead log in the temp
+// directory, registered under the name, whose persister naps for a
+// minute if nap is true.
+func openWALIndex(t *testing.T, name string, dir *TempDirectory, nap bool) index.Index {
+	RegistryDirectories[name] = func(path string) (Directory, error) {
+		return dir, nil
+	}
+	cfg := map[string]interface{}{
+		"path":          name,
+		"directoryName": name,
+		"unsafe_batch":  true,
+		"writeAheadLog": true,
+	}
+	if nap {
+		cfg["scorchPersisterOptions"] = map[string]interface{}{
+			"PersisterNapTimeMSec": 60000,
+		}
+	}
+	return openTestIndex(t, cfg)
+}
+
+func walFileNames(t *testing.T, dir Directory) []string {
+	finfos, err := dir.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rv []string
+	for _, finfo := range finfos {
+		if filepath.Ext(finfo.Name()) == ".wal" {
+			rv = append(rv, finfo.Name())
+		}
+	}
+	return rv
+}
+
+func waitForWALTruncated(t *testing.T, s *Scorch) {
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&s.stats.TotWALRecordsTruncated) <
+		atomic.LoadUint64(&s.stats.TotWALRecords)+atomic.LoadUint64(&s.stats.TotWALRecordsReplayed) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the write-ahead log to be truncated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	dir := NewTempDirectory()
+	idx := openWALIndex(t, "TestWALReplay", dir, true)
+	updateDocs(t, idx, "a", "b")
+	updateDocs(t, idx, "c")
+	deleteDocs(t, idx, "a")
+	err := idx.SetInternal([]byte("k"), []byte("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadUint64(&idx.(*Scorch).stats.TotWALRecords); n != 4 {
+		t.Errorf("expected 4 records in the write-ahead log, got %d", n)
+	}
+
+	// The persister is napping, so only the log has the batches.
+	crash, err := dir.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := openWALIndex(t, "TestWALReplay-crash", crash, false)
+	s := recovered.(*Scorch)
+	if n := atomic.LoadUint64(&s.stats.TotWALRecordsReplayed); n != 4 {
+		t.Errorf("expected 4 records replayed, got %d", n)
+	}
+	checkDocCount(t, recovered, 2)
+	reader, err := recovered.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := reader.GetInternal([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "v" {
+		t.Errorf("expected internal value v, got %q", val)
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the replayed batches are persisted, the log is truncated.
+	waitForWALTruncated(t, s)
+	if names := walFileNames(t, crash); len(names) != 0 {
+		t.Errorf("expected no .wal files, got %v", names)
+	}
+	err = recovered.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openWALIndex(t, "TestWALReplay-crash", crash, false)
+	if n := atomic.LoadUint64(&reopened.(*Scorch).stats.TotWALRecordsReplayed); n != 0 {
+		t.Errorf("expected no records replayed, got %d", n)
+	}
+	checkDocCount(t, reopened, 2)
+	err = reopened.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = crash.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWALTruncate(t *testing.T) {
+	dir := NewTempDirectory()
+	idx := openWALIndex(t, "TestWALTruncate", dir, false)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		updateDocs(t, idx, id)
+	}
+	s := idx.(*Scorch)
+	waitForWALTruncated(t, s)
+	if names := walFileNames(t, dir); len(names) != 0 {
+		t.Errorf("expected no .wal files, got %v", names)
+	}
+	err := s.rootBolt.View(func(tx *bolt.Tx) error {
+		if wal := tx.Bucket(boltWALBucket); wal != nil && wal.Stats().KeyN != 0 {
+			t.Errorf("expected no write-ahead log records, got %d", wal.Stats().KeyN)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openWALIndex(t, "TestWALTruncate", dir, false)
+	checkDocCount(t, reopened, 4)
+	err = reopened.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
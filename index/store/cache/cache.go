@@ -0,0 +1,309 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// entryOverhead is a rough count of the bytes used by an entry besides its
+// keys and values, so that caching many small values is bounded too.
+const entryOverhead = 64
+
+// row is a key and value read by an iterator.
+type row struct {
+	key, val []byte
+}
+
+// page is a run of consecutive rows of an iterator's range, read from lo, the
+// position the iterator was seeked to.
+type page struct {
+	// rng is the range of the iterator that read the page.
+	rng keyRange
+	lo  []byte
+	// rows are the rows of the range from lo. If done is true they're all the
+	// rows of the range from lo, otherwise more may follow the last one.
+	rows []row
+	done bool
+}
+
+// covers returns whether writing any of the sorted keys could change the
+// page. Since lo is in the range, or after all of it, the keys at or after
+// lo that are in the range come before those that aren't, so only the first
+// key at or after lo has to be checked.
+func (p *page) covers(sortedKeys [][]byte) bool {
+	i := sort.Search(len(sortedKeys), func(i int) bool {
+		return bytes.Compare(sortedKeys[i], p.lo) >= 0
+	})
+	if i == len(sortedKeys) || !p.rng.contains(sortedKeys[i]) {
+		return false
+	}
+	return p.done || bytes.Compare(sortedKeys[i], p.rows[len(p.rows)-1].key) <= 0
+}
+
+// keyRange is the range of keys visited by an iterator, either the keys with
+// a prefix, or the keys from start, inclusive, to end, exclusive.
+type keyRange struct {
+	prefix     []byte
+	isPrefix   bool
+	start, end []byte
+}
+
+func (r keyRange) contains(key []byte) bool {
+	if r.isPrefix {
+		return bytes.HasPrefix(key, r.prefix)
+	}
+	return bytes.Compare(key, r.start) >= 0 && (r.end == nil || bytes.Compare(key, r.end) < 0)
+}
+
+// first returns the first key that could be in the range.
+func (r keyRange) first() []byte {
+	if r.isPrefix {
+		return r.prefix
+	}
+	if r.start == nil {
+		return []byte{}
+	}
+	return r.start
+}
+
+// pageKey returns the cache key of the page of the range read from seek.
+func (r keyRange) pageKey(seek []byte) string {
+	var buf bytes.Buffer
+	if r.isPrefix {
+		buf.WriteByte('p')
+		writeLengthPrefixed(&buf, r.prefix)
+	} else {
+		buf.WriteByte('r')
+		writeLengthPrefixed(&buf, r.start)
+		if r.end == nil {
+			buf.WriteByte(0)
+		} else {
+			buf.WriteByte(1)
+			writeLengthPrefixed(&buf, r.end)
+		}
+	}
+	buf.Write(seek)
+	return buf.String()
+}
+
+func writeLengthPrefixed(buf *bytes.Buffer, b []byte) {
+	var n [4]byte
+	n[0], n[1], n[2], n[3] = byte(len(b)>>24), byte(len(b)>>16), byte(len(b)>>8), byte(len(b))
+	buf.Write(n[:])
+	buf.Write(b)
+}
+
+// getKey returns the cache key of the value of key.
+func getKey(key []byte) string {
+	return "g" + string(key)
+}
+
+type entry struct {
+	key string
+	// epoch is the epoch of the cache when the entry was added.
+	epoch   uint64
+	expires time.Time
+	size    int
+	// Either val and found are the result of a Get, or p is a page.
+	val   []byte
+	found bool
+	p     *page
+}
+
+// cache is a size bounded LRU cache of the values and iterator pages read
+// from a store.
+//
+// Its epoch is incremented before and after every write is executed. An entry
+// is only added if no write started since the reader that read it was opened,
+// and it's only returned to readers opened after it was added, so a reader
+// never sees rows from a newer or older snapshot than the one it was opened on.
+type cache struct {
+	maxBytes int
+	ttl      time.Duration
+	now      func() time.Time
+
+	m       sync.Mutex // Protects the fields that follow.
+	epoch   uint64
+	writing int
+	bytes   int
+	lru     *list.List // Most recently used first.
+	entries map[string]*list.Element
+	pages   map[*list.Element]struct{}
+
+	hits, misses, pageHits, pageMisses, evictions, invalidations uint64
+}
+
+func newCache(maxBytes int, ttl time.Duration) *cache {
+	return &cache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		pages:    map[*list.Element]struct{}{},
+	}
+}
+
+// currentEpoch returns the epoch a reader opened now reads at.
+func (c *cache) currentEpoch() uint64 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.epoch
+}
+
+// lookup returns the entry cached for key, if it can be read by a reader at
+// epoch.
+func (c *cache) lookup(key string, epoch uint64) *entry {
+	el := c.entries[key]
+	if el == nil {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if c.ttl > 0 && c.now().After(e.expires) {
+		c.remove(el)
+		return nil
+	}
+	if e.epoch > epoch {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e
+}
+
+func (c *cache) get(key []byte, epoch uint64) (val []byte, found, ok bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	e := c.lookup(getKey(key), epoch)
+	if e == nil {
+		c.misses++
+		return nil, false, false
+	}
+	c.hits++
+	return e.val, e.found, true
+}
+
+func (c *cache) getPage(r keyRange, seek []byte, epoch uint64) *page {
+	c.m.Lock()
+	defer c.m.Unlock()
+	e := c.lookup(r.pageKey(seek), epoch)
+	if e == nil {
+		c.pageMisses++
+		return nil
+	}
+	c.pageHits++
+	return e.p
+}
+
+// add adds an entry read by a reader at epoch, unless a write has started
+// since.
+func (c *cache) add(e *entry, epoch uint64) {
+	if e.size > c.maxBytes {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.writing > 0 || c.epoch != epoch {
+		return
+	}
+	if el := c.entries[e.key]; el != nil {
+		c.remove(el)
+	}
+	e.epoch = epoch
+	if c.ttl > 0 {
+		e.expires = c.now().Add(c.ttl)
+	}
+	el := c.lru.PushFront(e)
+	c.entries[e.key] = el
+	if e.p != nil {
+		c.pages[el] = struct{}{}
+	}
+	c.bytes += e.size
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *cache) addValue(key, val []byte, epoch uint64) {
+	e := &entry{key: getKey(key), found: val != nil}
+	if val != nil {
+		e.val = append([]byte(nil), val...)
+	}
+	e.size = len(e.key) + len(e.val) + entryOverhead
+	c.add(e, epoch)
+}
+
+func (c *cache) addPage(p *page, seek []byte, epoch uint64) {
+	e := &entry{key: p.rng.pageKey(seek), p: p}
+	e.size = len(e.key) + len(p.lo) + entryOverhead
+	for _, r := range p.rows {
+		e.size += len(r.key) + len(r.val) + entryOverhead
+	}
+	c.add(e, epoch)
+}
+
+func (c *cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	delete(c.pages, el)
+	c.bytes -= e.size
+}
+
+// invalidate removes the entries that writing keys could change.
+func (c *cache) invalidate(keys [][]byte) {
+	for _, key := range keys {
+		if el := c.entries[getKey(key)]; el != nil {
+			c.remove(el)
+			c.invalidations++
+		}
+	}
+	if len(c.pages) == 0 {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	for el := range c.pages {
+		if el.Value.(*entry).p.covers(keys) {
+			c.remove(el)
+			c.invalidations++
+		}
+	}
+}
+
+// startWrite invalidates the entries that writing keys could change, and
+// stops entries from being added until finishWrite is called.
+func (c *cache) startWrite(keys [][]byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.epoch++
+	c.writing++
+	c.invalidate(keys)
+}
+
+// finishWrite lets entries be added again, by readers opened after the write.
+// Readers opened before or during it may read from older snapshots.
+func (c *cache) finishWrite() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.epoch++
+	c.writing--
+}
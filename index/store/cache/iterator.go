@@ -0,0 +1,151 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+
+	"github.com/blevesearch/bleve/index/store"
+)
+
+// Iterator reads its range a page at a time, from the cache if it can. The
+// wrapped store's iterator is only opened when a page is missing, and is
+// kept open to read the pages that follow it.
+type Iterator struct {
+	r   *Reader
+	rng keyRange
+
+	p   *page
+	pos int
+
+	// o is the wrapped store's iterator, or nil if it hasn't been needed.
+	// If oValid is true, it's positioned at the first key at or after oAt.
+	o      store.KVIterator
+	oAt    []byte
+	oValid bool
+
+	err error
+}
+
+func newIterator(r *Reader, rng keyRange) *Iterator {
+	rv := &Iterator{r: r, rng: rng}
+	rv.load(rng.first())
+	return rv
+}
+
+// load makes the page read from seek the current one.
+func (i *Iterator) load(seek []byte) {
+	i.pos = 0
+	if i.p = i.r.s.c.getPage(i.rng, seek, i.r.epoch); i.p != nil {
+		return
+	}
+	p := &page{rng: i.rng, lo: append([]byte(nil), seek...)}
+	i.p = p
+	if i.o == nil {
+		if i.rng.isPrefix {
+			i.o = i.r.o.PrefixIterator(i.rng.prefix)
+		} else {
+			i.o = i.r.o.RangeIterator(i.rng.start, i.rng.end)
+		}
+		i.oAt, i.oValid = i.rng.first(), true
+	}
+	if !i.oValid || !bytes.Equal(i.oAt, seek) {
+		i.o.Seek(seek)
+	}
+	for len(p.rows) < i.r.s.iteratorPageSize {
+		key, val, valid := i.o.Current()
+		if !valid {
+			break
+		}
+		p.rows = append(p.rows, row{
+			key: append([]byte(nil), key...),
+			val: append([]byte(nil), val...),
+		})
+		i.o.Next()
+	}
+	p.done = !i.o.Valid()
+	if len(p.rows) > 0 {
+		i.oAt, i.oValid = successor(p.rows[len(p.rows)-1].key), true
+	} else {
+		i.oValid = false
+	}
+	if i.err = store.IteratorErr(i.o); i.err != nil {
+		// The page is incomplete, so it's not cached, and the iteration
+		// ends with it.
+		p.done = true
+		return
+	}
+	i.r.s.c.addPage(p, seek, i.r.epoch)
+}
+
+// successor returns the first key after key.
+func successor(key []byte) []byte {
+	rv := make([]byte, len(key)+1)
+	copy(rv, key)
+	return rv
+}
+
+func (i *Iterator) Seek(k []byte) {
+	if i.err != nil {
+		return
+	}
+	if first := i.rng.first(); bytes.Compare(k, first) < 0 {
+		k = first
+	}
+	i.load(k)
+}
+
+func (i *Iterator) Next() {
+	if !i.Valid() {
+		return
+	}
+	i.pos++
+	for i.pos >= len(i.p.rows) && !i.p.done && i.err == nil {
+		i.load(successor(i.p.rows[len(i.p.rows)-1].key))
+	}
+}
+
+func (i *Iterator) Current() ([]byte, []byte, bool) {
+	if !i.Valid() {
+		return nil, nil, false
+	}
+	r := i.p.rows[i.pos]
+	return r.key, r.val, true
+}
+
+func (i *Iterator) Key() []byte {
+	key, _, _ := i.Current()
+	return key
+}
+
+func (i *Iterator) Value() []byte {
+	_, val, _ := i.Current()
+	return val
+}
+
+func (i *Iterator) Valid() bool {
+	return i.pos < len(i.p.rows)
+}
+
+func (i *Iterator) Err() error {
+	return i.err
+}
+
+func (i *Iterator) Close() error {
+	if i.o == nil {
+		return nil
+	}
+	return i.o.Close()
+}
@@ -0,0 +1,93 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import "github.com/blevesearch/bleve/index/store"
+
+type Reader struct {
+	s *Store
+	o store.KVReader
+	// epoch is the epoch of the cache when the reader was opened.
+	epoch uint64
+}
+
+func (r *Reader) Get(key []byte) ([]byte, error) {
+	if val, found, ok := r.s.c.get(key, r.epoch); ok {
+		if !found {
+			return nil, nil
+		}
+		return append([]byte(nil), val...), nil
+	}
+	val, err := r.o.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	r.s.c.addValue(key, val, r.epoch)
+	return val, nil
+}
+
+func (r *Reader) MultiGet(keys [][]byte) ([][]byte, error) {
+	vals := make([][]byte, len(keys))
+	var missing []int
+	var missingKeys [][]byte
+	for i, key := range keys {
+		val, found, ok := r.s.c.get(key, r.epoch)
+		if !ok {
+			missing = append(missing, i)
+			missingKeys = append(missingKeys, key)
+			continue
+		}
+		if found {
+			vals[i] = append([]byte(nil), val...)
+		}
+	}
+	if len(missing) == 0 {
+		return vals, nil
+	}
+	missingVals, err := r.o.MultiGet(missingKeys)
+	if err != nil {
+		return nil, err
+	}
+	for n, i := range missing {
+		vals[i] = missingVals[n]
+		r.s.c.addValue(keys[i], vals[i], r.epoch)
+	}
+	return vals, nil
+}
+
+func (r *Reader) PrefixIterator(prefix []byte) store.KVIterator {
+	if !r.s.cacheIterators {
+		return r.o.PrefixIterator(prefix)
+	}
+	return newIterator(r, keyRange{
+		prefix:   append([]byte(nil), prefix...),
+		isPrefix: true,
+	})
+}
+
+func (r *Reader) RangeIterator(start, end []byte) store.KVIterator {
+	if !r.s.cacheIterators {
+		return r.o.RangeIterator(start, end)
+	}
+	rng := keyRange{start: append([]byte(nil), start...)}
+	if end != nil {
+		rng.end = append([]byte(nil), end...)
+	}
+	return newIterator(r, rng)
+}
+
+func (r *Reader) Close() error {
+	return r.o.Close()
+}
@@ -0,0 +1,54 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+
+	"github.com/blevesearch/bleve/index/store"
+)
+
+type stats struct {
+	s *Store
+}
+
+func (s *stats) statsMap() map[string]interface{} {
+	ms := map[string]interface{}{}
+
+	c := s.s.c
+	c.m.Lock()
+	ms["cache"] = map[string]interface{}{
+		"hits":          c.hits,
+		"misses":        c.misses,
+		"page_hits":     c.pageHits,
+		"page_misses":   c.pageMisses,
+		"evictions":     c.evictions,
+		"invalidations": c.invalidations,
+		"entries":       len(c.entries),
+		"bytes":         c.bytes,
+	}
+	c.m.Unlock()
+
+	if o, ok := s.s.o.(store.KVStoreStats); ok {
+		ms["kv"] = o.StatsMap()
+	}
+
+	return ms
+}
+
+func (s *stats) MarshalJSON() ([]byte, error) {
+	m := s.statsMap()
+	return json.Marshal(m)
+}
@@ -0,0 +1,191 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache provides a bleve.store.KVStore implementation that
+// wraps another, real KVStore implementation, and caches the values and
+// iterator pages read from it in a size bounded LRU cache.
+//
+// It's meant for stores with slow reads, like remote ones. Writes made
+// through the cache store invalidate the entries they could change, but
+// writes made by other processes are only seen once the entries expire,
+// after cacheTTL.
+//
+// The wrapped store is named by config["cache_kvStoreName_actual"], or if
+// that's missing by config["kvStoreName_actual"], so the cache store can be
+// stacked on the metrics store:
+//
+//	{
+//		"cache_kvStoreName_actual": "metrics",
+//		"kvStoreName_actual": "dynamodb",
+//		...
+//	}
+//
+// The rest of the config is passed to the wrapped store, and these options
+// configure the cache:
+//
+//	cacheMaxBytes          the size of the cache, 64MB by default
+//	cacheTTL               how long entries are kept, as a duration string,
+//	                       by default until they're evicted or invalidated
+//	cacheIterators         whether to cache iterator pages, true by default
+//	cacheIteratorPageSize  the number of rows in a page, 100 by default
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/registry"
+)
+
+const Name = "cache"
+
+const (
+	defaultMaxBytes         = 64 << 20
+	defaultIteratorPageSize = 100
+)
+
+type Store struct {
+	o store.KVStore
+	c *cache
+
+	cacheIterators   bool
+	iteratorPageSize int
+
+	s *stats
+}
+
+func New(mo store.MergeOperator, config map[string]interface{}) (store.KVStore, error) {
+
+	name, ok := config["cache_kvStoreName_actual"].(string)
+	if !ok {
+		name, ok = config["kvStoreName_actual"].(string)
+	}
+	if !ok || name == "" {
+		return nil, fmt.Errorf("cache: missing kvStoreName_actual,"+
+			" config: %#v", config)
+	}
+
+	if name == Name {
+		return nil, fmt.Errorf("cache: circular kvStoreName_actual")
+	}
+
+	maxBytes, err := configInt(config, "cacheMaxBytes", defaultMaxBytes, 0)
+	if err != nil {
+		return nil, err
+	}
+	pageSize, err := configInt(config, "cacheIteratorPageSize", defaultIteratorPageSize, 1)
+	if err != nil {
+		return nil, err
+	}
+	cacheIterators := true
+	if v, ok := config["cacheIterators"]; ok {
+		if cacheIterators, ok = v.(bool); !ok {
+			return nil, fmt.Errorf("cache: config[cacheIterators] must be a bool, got %T", v)
+		}
+	}
+	var ttl time.Duration
+	if v, ok := config["cacheTTL"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("cache: config[cacheTTL] must be a duration string, got %T", v)
+		}
+		if ttl, err = time.ParseDuration(s); err != nil || ttl < 0 {
+			return nil, fmt.Errorf("cache: config[cacheTTL] must be a non-negative duration, got %q", s)
+		}
+	}
+
+	ctr := registry.KVStoreConstructorByName(name)
+	if ctr == nil {
+		return nil, fmt.Errorf("cache: no kv store constructor,"+
+			" kvStoreName_actual: %s", name)
+	}
+
+	kvs, err := ctr(mo, config)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &Store{
+		o:                kvs,
+		c:                newCache(maxBytes, ttl),
+		cacheIterators:   cacheIterators,
+		iteratorPageSize: pageSize,
+	}
+
+	rv.s = &stats{s: rv}
+
+	return rv, nil
+}
+
+// configInt returns the number config[key], which can be an int or, when
+// parsed from JSON, a float64, or def if it's missing.
+func configInt(config map[string]interface{}, key string, def, min int) (int, error) {
+	v, ok := config[key]
+	if !ok {
+		return def, nil
+	}
+	var rv int
+	switch v := v.(type) {
+	case int:
+		rv = v
+	case float64:
+		rv = int(v)
+		if float64(rv) != v {
+			return 0, fmt.Errorf("cache: config[%s] must be an integer, got %v", key, v)
+		}
+	default:
+		return 0, fmt.Errorf("cache: config[%s] must be a number, got %T", key, v)
+	}
+	if rv < min {
+		return 0, fmt.Errorf("cache: config[%s] must be at least %d, got %d", key, min, rv)
+	}
+	return rv, nil
+}
+
+func init() {
+	registry.RegisterKVStore(Name, New)
+}
+
+func (s *Store) Close() error {
+	return s.o.Close()
+}
+
+func (s *Store) Reader() (store.KVReader, error) {
+	// The epoch is read before the reader is opened, so that if a write
+	// finishes in between, the reader, which may see it, can't add entries.
+	epoch := s.c.currentEpoch()
+	o, err := s.o.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{s: s, o: o, epoch: epoch}, nil
+}
+
+func (s *Store) Writer() (store.KVWriter, error) {
+	o, err := s.o.Writer()
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{s: s, o: o}, nil
+}
+
+func (s *Store) Stats() json.Marshaler {
+	return s.s
+}
+
+func (s *Store) StatsMap() map[string]interface{} {
+	return s.s.statsMap()
+}
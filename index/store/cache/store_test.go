@@ -0,0 +1,322 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/index/store/gtreap"
+	_ "github.com/blevesearch/bleve/index/store/metrics"
+	"github.com/blevesearch/bleve/index/store/test"
+)
+
+func openConfig(t *testing.T, mo store.MergeOperator, config map[string]interface{}) *Store {
+	config["kvStoreName_actual"] = gtreap.Name
+	config["path"] = ""
+	rv, err := New(mo, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv.(*Store)
+}
+
+func open(t *testing.T, mo store.MergeOperator) store.KVStore {
+	// Small pages make the iterator tests read several of them.
+	return openConfig(t, mo, map[string]interface{}{"cacheIteratorPageSize": 2})
+}
+
+func cleanup(t *testing.T, s store.KVStore) {
+	err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheKVCrud(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestKVCrud(t, s)
+}
+
+func TestCacheReaderIsolation(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestReaderIsolation(t, s)
+}
+
+func TestCacheReaderOwnsGetBytes(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestReaderOwnsGetBytes(t, s)
+}
+
+func TestCacheWriterOwnsBytes(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestWriterOwnsBytes(t, s)
+}
+
+func TestCachePrefixIterator(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestPrefixIterator(t, s)
+}
+
+func TestCachePrefixIteratorSeek(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestPrefixIteratorSeek(t, s)
+}
+
+func TestCacheRangeIterator(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestRangeIterator(t, s)
+}
+
+func TestCacheRangeIteratorSeek(t *testing.T) {
+	s := open(t, nil)
+	defer cleanup(t, s)
+	test.CommonTestRangeIteratorSeek(t, s)
+}
+
+func TestCacheMerge(t *testing.T) {
+	s := open(t, &test.TestMergeCounter{})
+	defer cleanup(t, s)
+	test.CommonTestMerge(t, s)
+}
+
+// set writes key=val through the store's writer, or the wrapped store's
+// writer if bypass is true.
+func set(t *testing.T, s *Store, bypass bool, kvs ...string) {
+	var kvstore store.KVStore = s
+	if bypass {
+		kvstore = s.o
+	}
+	writer, err := kvstore.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := writer.NewBatch()
+	for i := 0; i < len(kvs); i += 2 {
+		if kvs[i+1] == "" {
+			batch.Delete([]byte(kvs[i]))
+		} else {
+			batch.Set([]byte(kvs[i]), []byte(kvs[i+1]))
+		}
+	}
+	if err := writer.ExecuteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, s *Store, key string) string {
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	val, err := reader.Get([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(val)
+}
+
+func scan(t *testing.T, s *Store, prefix string) []string {
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	it := reader.PrefixIterator([]byte(prefix))
+	defer it.Close()
+	var rv []string
+	for key, val, valid := it.Current(); valid; key, val, valid = it.Current() {
+		rv = append(rv, string(key)+"="+string(val))
+		it.Next()
+	}
+	return rv
+}
+
+func checkStats(t *testing.T, s *Store, name string, expected uint64) {
+	if got := s.StatsMap()["cache"].(map[string]interface{})[name].(uint64); got != expected {
+		t.Errorf("expected %d %s, got %d", expected, name, got)
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	s := openConfig(t, nil, map[string]interface{}{})
+	defer cleanup(t, s)
+
+	set(t, s, false, "a", "1")
+	for i := 0; i < 2; i++ {
+		if val := get(t, s, "a"); val != "1" {
+			t.Errorf("expected a=1, got %q", val)
+		}
+		if val := get(t, s, "b"); val != "" {
+			t.Errorf("expected b to be missing, got %q", val)
+		}
+	}
+	checkStats(t, s, "misses", 2)
+	checkStats(t, s, "hits", 2)
+
+	// Writes through the cache store invalidate the values they change.
+	set(t, s, false, "a", "2", "b", "3")
+	if val := get(t, s, "a"); val != "2" {
+		t.Errorf("expected a=2, got %q", val)
+	}
+	if val := get(t, s, "b"); val != "3" {
+		t.Errorf("expected b=3, got %q", val)
+	}
+
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	vals, err := reader.MultiGet([][]byte{[]byte("a"), []byte("c"), []byte("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, [][]byte{[]byte("2"), nil, []byte("3")}) {
+		t.Errorf("expected 2, nil, 3, got %q", vals)
+	}
+	checkStats(t, s, "misses", 5)
+	checkStats(t, s, "hits", 4)
+}
+
+func TestCacheIteratorPages(t *testing.T) {
+	s := openConfig(t, nil, map[string]interface{}{"cacheIteratorPageSize": 2})
+	defer cleanup(t, s)
+
+	set(t, s, false, "a1", "1", "a2", "2", "a3", "3", "a4", "4", "a5", "5", "b1", "1")
+	expected := []string{"a1=1", "a2=2", "a3=3", "a4=4", "a5=5"}
+	for i := 0; i < 2; i++ {
+		if rows := scan(t, s, "a"); !reflect.DeepEqual(rows, expected) {
+			t.Errorf("expected %v, got %v", expected, rows)
+		}
+	}
+	checkStats(t, s, "page_misses", 3)
+	checkStats(t, s, "page_hits", 3)
+
+	// Writing a key outside of the range doesn't invalidate its pages, and
+	// writing one in the range only invalidates the page it's in.
+	set(t, s, false, "b2", "2", "a31", "31")
+	checkStats(t, s, "invalidations", 1)
+	expected = []string{"a1=1", "a2=2", "a3=3", "a31=31", "a4=4", "a5=5"}
+	if rows := scan(t, s, "a"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %v, got %v", expected, rows)
+	}
+
+	// Deleting the last key of the range invalidates the last page.
+	set(t, s, false, "a5", "")
+	expected = expected[:5]
+	if rows := scan(t, s, "a"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %v, got %v", expected, rows)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	s := openConfig(t, nil, map[string]interface{}{"cacheTTL": "1m"})
+	defer cleanup(t, s)
+	now := time.Now()
+	s.c.now = func() time.Time { return now }
+
+	set(t, s, false, "a", "1", "b", "1")
+	if val := get(t, s, "a"); val != "1" {
+		t.Errorf("expected a=1, got %q", val)
+	}
+	if rows := scan(t, s, ""); !reflect.DeepEqual(rows, []string{"a=1", "b=1"}) {
+		t.Errorf("expected a=1, b=1, got %v", rows)
+	}
+
+	// Writes that don't go through the cache store, like those of other
+	// processes, are only seen once the entries expire.
+	set(t, s, true, "a", "2", "c", "3")
+	if val := get(t, s, "a"); val != "1" {
+		t.Errorf("expected the cached a=1, got %q", val)
+	}
+	if rows := scan(t, s, ""); !reflect.DeepEqual(rows, []string{"a=1", "b=1"}) {
+		t.Errorf("expected the cached a=1, b=1, got %v", rows)
+	}
+	now = now.Add(2 * time.Minute)
+	if val := get(t, s, "a"); val != "2" {
+		t.Errorf("expected a=2, got %q", val)
+	}
+	if rows := scan(t, s, ""); !reflect.DeepEqual(rows, []string{"a=2", "b=1", "c=3"}) {
+		t.Errorf("expected a=2, b=1, c=3, got %v", rows)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	// Room for 3 values, each with a 2 byte cache key and a 1 byte value.
+	maxBytes := 3 * (entryOverhead + 3)
+	s := openConfig(t, nil, map[string]interface{}{"cacheMaxBytes": maxBytes})
+	defer cleanup(t, s)
+
+	set(t, s, false, "a", "1", "b", "2", "c", "3", "d", "4")
+	for _, key := range []string{"a", "b", "c", "a", "d"} {
+		get(t, s, key)
+	}
+	checkStats(t, s, "evictions", 1)
+	// b was the least recently used value.
+	get(t, s, "a")
+	get(t, s, "b")
+	checkStats(t, s, "hits", 2)
+	checkStats(t, s, "misses", 5)
+	if bytes := s.StatsMap()["cache"].(map[string]interface{})["bytes"].(int); bytes > maxBytes {
+		t.Errorf("expected the cache to use at most %d bytes, got %d", maxBytes, bytes)
+	}
+}
+
+func TestCacheStacked(t *testing.T) {
+	s, err := New(nil, map[string]interface{}{
+		"cache_kvStoreName_actual": "metrics",
+		"kvStoreName_actual":       gtreap.Name,
+		"path":                     "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(t, s)
+	test.CommonTestKVCrud(t, s)
+	if _, ok := s.(store.KVStoreStats).StatsMap()["kv"].(map[string]interface{})["metrics"]; !ok {
+		t.Error("expected the stats of the metrics store")
+	}
+}
+
+func TestCacheInvalidConfig(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{},
+		{"kvStoreName_actual": Name},
+		{"kvStoreName_actual": "missing"},
+		{"kvStoreName_actual": gtreap.Name, "cacheMaxBytes": "1MB"},
+		{"kvStoreName_actual": gtreap.Name, "cacheIteratorPageSize": 0.0},
+		{"kvStoreName_actual": gtreap.Name, "cacheTTL": 60.0},
+		{"kvStoreName_actual": gtreap.Name, "cacheTTL": "-1s"},
+		{"kvStoreName_actual": gtreap.Name, "cacheIterators": "yes"},
+	} {
+		if _, err := New(nil, config); err == nil {
+			t.Errorf("expected config %v to be rejected", config)
+		}
+	}
+}
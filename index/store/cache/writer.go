@@ -0,0 +1,54 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/index/store"
+)
+
+type Writer struct {
+	s *Store
+	o store.KVWriter
+}
+
+func (w *Writer) Close() error {
+	return w.o.Close()
+}
+
+func (w *Writer) NewBatch() store.KVBatch {
+	return &Batch{o: w.o.NewBatch()}
+}
+
+func (w *Writer) NewBatchEx(options store.KVBatchOptions) ([]byte, store.KVBatch, error) {
+	buf, b, err := w.o.NewBatchEx(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf, &Batch{o: b}, nil
+}
+
+// ExecuteBatch invalidates the cache entries of the keys in the batch, and
+// stops entries from being added while it's executed.
+func (w *Writer) ExecuteBatch(b store.KVBatch) error {
+	batch, ok := b.(*Batch)
+	if !ok {
+		return fmt.Errorf("wrong type of batch")
+	}
+	w.s.c.startWrite(batch.keys)
+	defer w.s.c.finishWrite()
+	return w.o.ExecuteBatch(batch.o)
+}
@@ -0,0 +1,303 @@
+package dynamodb
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// MaxTransactItems is the maximum number of actions DynamoDB accepts in a
+	// TransactWriteItems call.
+	MaxTransactItems = 100
+	// MaxTransactBytes is the maximum total size of a TransactWriteItems call.
+	MaxTransactBytes = 4 * 1024 * 1024
+	// MaxBatchWriteItems is the maximum number of requests DynamoDB accepts in a
+	// BatchWriteItem call.
+	MaxBatchWriteItems = 25
+	// MaxBatchWriteBytes is the maximum total size of a BatchWriteItem call.
+	MaxBatchWriteBytes = 16 * 1024 * 1024
+)
+
+// batchOptions control how the Writer splits a batch into DynamoDB calls.
+type batchOptions struct {
+	// maxTransactItems and maxTransactBytes limit the size of each transaction.
+	maxTransactItems int
+	maxTransactBytes int
+	// batchWriteItem writes sets and deletes with BatchWriteItem instead of
+	// TransactWriteItems. Merges always use transactions.
+	batchWriteItem bool
+	// writeConcurrency is the number of chunks of a batch written at the same time.
+	writeConcurrency int
+	// readConcurrency is the number of BatchGetItem calls a MultiGet makes at the same time.
+	readConcurrency int
+	// maxRetries is the number of times unprocessed items or keys, or transactions cancelled
+	// by conflicts or throttling, are retried, with exponential backoff between
+	// retryDelay and maxRetryDelay.
+	maxRetries    int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+}
+
+func newBatchOptions(config map[string]interface{}) (rv batchOptions, err error) {
+	if rv.maxTransactItems, err = configIntRange(config, "maxTransactItems", MaxTransactItems, 1, MaxTransactItems); err != nil {
+		return
+	}
+	if rv.maxTransactBytes, err = configIntRange(config, "maxTransactBytes", MaxTransactBytes, 1, MaxTransactBytes); err != nil {
+		return
+	}
+	if rv.batchWriteItem, err = configBool(config, "batchWriteItem", false); err != nil {
+		return
+	}
+	if rv.writeConcurrency, err = configIntRange(config, "writeConcurrency", 4, 1, 1024); err != nil {
+		return
+	}
+	if rv.readConcurrency, err = configIntRange(config, "readConcurrency", 4, 1, 1024); err != nil {
+		return
+	}
+	if rv.maxRetries, err = configIntRange(config, "maxBatchRetries", 10, 0, 1000); err != nil {
+		return
+	}
+	if rv.retryDelay, err = configDuration(config, "batchRetryDelay", 50*time.Millisecond); err != nil {
+		return
+	}
+	if rv.maxRetryDelay, err = configDuration(config, "maxBatchRetryDelay", 5*time.Second); err != nil {
+		return
+	}
+	if rv.retryDelay <= 0 || rv.maxRetryDelay < rv.retryDelay {
+		err = fmt.Errorf("dynamodb store, config[batchRetryDelay] must be positive and no more than config[maxBatchRetryDelay], got %v and %v", rv.retryDelay, rv.maxRetryDelay)
+	}
+	return
+}
+
+// backoff returns the time to wait before the given retry, which grows
+// exponentially up to maxRetryDelay, with jitter so that concurrent writers
+// don't retry in lockstep.
+func (o batchOptions) backoff(retry int) time.Duration {
+	d := o.maxRetryDelay
+	if retry < 32 && o.retryDelay<<uint(retry) < o.maxRetryDelay {
+		d = o.retryDelay << uint(retry)
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// attributeValueSize approximates the size DynamoDB counts towards request limits.
+func attributeValueSize(v *dynamodb.AttributeValue) int {
+	switch {
+	case v == nil:
+		return 0
+	case v.S != nil:
+		return len(*v.S)
+	case v.N != nil:
+		return len(*v.N)/2 + 2
+	}
+	return len(v.B)
+}
+
+func itemSize(item map[string]*dynamodb.AttributeValue) (size int) {
+	for k, v := range item {
+		size += len(k) + attributeValueSize(v)
+	}
+	return
+}
+
+func transactWriteItemSize(item *dynamodb.TransactWriteItem) int {
+	switch {
+	case item.Put != nil:
+		return itemSize(item.Put.Item)
+	case item.Update != nil:
+		return itemSize(item.Update.Key) + itemSize(item.Update.ExpressionAttributeValues)
+	case item.Delete != nil:
+		return itemSize(item.Delete.Key)
+	}
+	return 0
+}
+
+// chunkTransactItems splits the items into transactions that fit within the limits.
+func (o batchOptions) chunkTransactItems(items []*dynamodb.TransactWriteItem) (chunks [][]*dynamodb.TransactWriteItem) {
+	var chunk []*dynamodb.TransactWriteItem
+	var size int
+	for _, item := range items {
+		itemSize := transactWriteItemSize(item)
+		if len(chunk) > 0 && (len(chunk) >= o.maxTransactItems || size+itemSize > o.maxTransactBytes) {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, item)
+		size += itemSize
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return
+}
+
+// chunkWriteRequests splits the requests into BatchWriteItem calls that fit within the limits.
+func chunkWriteRequests(requests []*dynamodb.WriteRequest) (chunks [][]*dynamodb.WriteRequest) {
+	var chunk []*dynamodb.WriteRequest
+	var size int
+	for _, r := range requests {
+		var requestSize int
+		if r.PutRequest != nil {
+			requestSize = itemSize(r.PutRequest.Item)
+		}
+		if len(chunk) > 0 && (len(chunk) >= MaxBatchWriteItems || size+requestSize > MaxBatchWriteBytes) {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, r)
+		size += requestSize
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return
+}
+
+// writeItems writes the items of a batch. If they fit within a single transaction,
+// they're written atomically, otherwise they're split into several calls. The
+// merges are the items that are conditional puts of merged values.
+func (bs *Store) writeItems(items []*dynamodb.TransactWriteItem, merges map[*dynamodb.TransactWriteItem]*mergeOp) error {
+	var transactItems []*dynamodb.TransactWriteItem
+	var writeRequests []*dynamodb.WriteRequest
+	for _, item := range items {
+		switch {
+		case bs.bo.batchWriteItem && item.Put != nil && merges[item] == nil:
+			writeRequests = append(writeRequests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item.Put.Item}})
+		case bs.bo.batchWriteItem && item.Delete != nil:
+			writeRequests = append(writeRequests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: item.Delete.Key}})
+		default:
+			transactItems = append(transactItems, item)
+		}
+	}
+
+	var tasks []func() error
+	for _, chunk := range bs.bo.chunkTransactItems(transactItems) {
+		chunk := chunk
+		tasks = append(tasks, func() error { return bs.transactWrite(chunk, merges) })
+	}
+	for _, chunk := range chunkWriteRequests(writeRequests) {
+		chunk := chunk
+		tasks = append(tasks, func() error { return bs.batchWrite(chunk) })
+	}
+	return runTasks(tasks, bs.bo.writeConcurrency)
+}
+
+// runTasks runs the tasks with the given concurrency, and returns the first error.
+// Once a task has failed, the tasks that haven't started yet are skipped.
+func runTasks(tasks []func() error, concurrency int) error {
+	if len(tasks) == 1 || concurrency == 1 {
+		for _, task := range tasks {
+			if err := task(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var m sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, task := range tasks {
+		sem <- struct{}{}
+		m.Lock()
+		failed := firstErr != nil
+		m.Unlock()
+		if failed {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(task func() error) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := task(); err != nil {
+				m.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				m.Unlock()
+			}
+		}(task)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// retryableCancellation returns true if a transaction was cancelled only because
+// of conflicts with other transactions or writes, or throttling, rather than because
+// a condition failed or a request was invalid. It also returns the merges whose
+// items were changed by another writer after they were read, which have to be read
+// again before the transaction is retried.
+func retryableCancellation(err error, items []*dynamodb.TransactWriteItem, merges map[*dynamodb.TransactWriteItem]*mergeOp) (conflicts []*mergeOp, retryable bool) {
+	tce, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		return nil, false
+	}
+	for i, reason := range tce.CancellationReasons {
+		switch aws.StringValue(reason.Code) {
+		case "None", "":
+		case "TransactionConflict", "ThrottlingError", "ProvisionedThroughputExceeded":
+			retryable = true
+		case "ConditionalCheckFailed":
+			if i >= len(items) || merges[items[i]] == nil {
+				return nil, false
+			}
+			conflicts = append(conflicts, merges[items[i]])
+			retryable = true
+		default:
+			return nil, false
+		}
+	}
+	return conflicts, retryable
+}
+
+func (bs *Store) transactWrite(items []*dynamodb.TransactWriteItem, merges map[*dynamodb.TransactWriteItem]*mergeOp) (err error) {
+	for retry := 0; ; retry++ {
+		_, err = bs.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+		if err == nil || retry >= bs.bo.maxRetries {
+			return
+		}
+		conflicts, retryable := retryableCancellation(err, items, merges)
+		if !retryable {
+			return
+		}
+		if len(conflicts) > 0 {
+			if err = bs.readMerges(conflicts); err != nil {
+				return
+			}
+		}
+		bs.s.retry()
+		time.Sleep(bs.bo.backoff(retry))
+	}
+}
+
+func (bs *Store) batchWrite(requests []*dynamodb.WriteRequest) error {
+	for retry := 0; ; retry++ {
+		bwo, err := bs.db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{
+				bs.tableName: requests,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		requests = bwo.UnprocessedItems[bs.tableName]
+		if len(requests) == 0 {
+			return nil
+		}
+		if retry >= bs.bo.maxRetries {
+			return fmt.Errorf("dynamodb store, %d items were still unprocessed after %d retries", len(requests), retry)
+		}
+		bs.s.retry()
+		time.Sleep(bs.bo.backoff(retry))
+	}
+}
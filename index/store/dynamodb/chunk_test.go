@@ -0,0 +1,218 @@
+package dynamodb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve/index/store"
+)
+
+// countCalls records the number of calls made to each operation of the fake.
+type countCalls struct {
+	m     sync.Mutex
+	calls map[string]int
+}
+
+func (c *countCalls) fault(operation string, input interface{}) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+	c.calls[operation]++
+	return nil
+}
+
+func (c *countCalls) count(operation string) int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.calls[operation]
+}
+
+func writeLargeBatch(t *testing.T, s store.KVStore, n int) {
+	writer, err := s.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	batch := writer.NewBatch()
+	for i := 0; i < n; i++ {
+		batch.Set([]byte(fmt.Sprintf("k%04d", i)), []byte(fmt.Sprintf("v%d", i)))
+		if i%10 == 0 {
+			counter := make([]byte, 8)
+			binary.LittleEndian.PutUint64(counter, uint64(i))
+			batch.Merge([]byte(fmt.Sprintf("m%04d", i)), counter)
+		}
+	}
+	err = writer.ExecuteBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkLargeBatch(t *testing.T, s store.KVStore, n int) {
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	it := reader.PrefixIterator([]byte("k"))
+	var count int
+	for ; it.Valid(); it.Next() {
+		key, val, _ := it.Current()
+		if expected := fmt.Sprintf("k%04d", count); string(key) != expected {
+			t.Fatalf("expected key %s, got %s", expected, key)
+		}
+		if expected := fmt.Sprintf("v%d", count); string(val) != expected {
+			t.Fatalf("expected value %s, got %s", expected, val)
+		}
+		count++
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Errorf("expected %d items, got %d", n, count)
+	}
+	last := (n - 1) / 10 * 10
+	val, err := reader.Get([]byte(fmt.Sprintf("m%04d", last)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(val) != 8 || binary.LittleEndian.Uint64(val) != uint64(last) {
+		t.Errorf("expected merged value %d, got %v", last, val)
+	}
+}
+
+func TestDynamoDBLargeBatchTransactions(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{"writeConcurrency": 3.0})
+	var calls countCalls
+	db.Fault = calls.fault
+	writeLargeBatch(t, s, 1000)
+	checkLargeBatch(t, s, 1000)
+	if expected := 11; calls.count("TransactWriteItems") != expected {
+		t.Errorf("expected %d transactions, got %d", expected, calls.count("TransactWriteItems"))
+	}
+}
+
+func TestDynamoDBLargeBatchTransactionSize(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{"maxTransactItems": 10, "maxTransactBytes": 1024})
+	var calls countCalls
+	db.Fault = calls.fault
+	writer, err := s.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := writer.NewBatch()
+	for i := 0; i < 4; i++ {
+		batch.Set([]byte(fmt.Sprintf("k%d", i)), []byte(strings.Repeat("v", 500)))
+	}
+	err = writer.ExecuteBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 4; calls.count("TransactWriteItems") != expected {
+		t.Errorf("expected %d transactions, got %d", expected, calls.count("TransactWriteItems"))
+	}
+}
+
+func TestDynamoDBLargeBatchBatchWriteItem(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{
+		"batchWriteItem":  true,
+		"batchRetryDelay": "1ms",
+	})
+	var calls countCalls
+	db.Fault = calls.fault
+	// Only process some of each BatchWriteItem call, so that the writer has to retry.
+	db.BatchWriteItemLimit = 10
+	writeLargeBatch(t, s, 1000)
+	checkLargeBatch(t, s, 1000)
+	if calls.count("BatchWriteItem") <= 1000/MaxBatchWriteItems {
+		t.Errorf("expected unprocessed items to be retried, got %d calls", calls.count("BatchWriteItem"))
+	}
+	// The merges have to use transactions.
+	if expected := 1; calls.count("TransactWriteItems") != expected {
+		t.Errorf("expected %d transactions, got %d", expected, calls.count("TransactWriteItems"))
+	}
+}
+
+func TestDynamoDBBatchWriteItemRetriesExhausted(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{
+		"batchWriteItem":     true,
+		"maxBatchRetries":    2,
+		"batchRetryDelay":    "1ms",
+		"maxBatchRetryDelay": "2ms",
+	})
+	db.BatchWriteItemLimit = 1
+	writer, err := s.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := writer.NewBatch()
+	for i := 0; i < 5; i++ {
+		batch.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v"))
+	}
+	err = writer.ExecuteBatch(batch)
+	if err == nil || !strings.Contains(err.Error(), "unprocessed") {
+		t.Errorf("expected unprocessed items error, got %v", err)
+	}
+}
+
+func TestDynamoDBTransactionConflictRetried(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{"batchRetryDelay": "1ms"})
+	var conflicts int
+	db.Fault = func(operation string, input interface{}) error {
+		if operation != "TransactWriteItems" || conflicts >= 2 {
+			return nil
+		}
+		conflicts++
+		return &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("TransactionConflict")},
+			},
+		}
+	}
+	writeLargeBatch(t, s, 10)
+	checkLargeBatch(t, s, 10)
+
+	db.Fault = func(operation string, input interface{}) error {
+		return &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+			},
+		}
+	}
+	writer, err := s.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := writer.NewBatch()
+	batch.Set([]byte("k"), []byte("v"))
+	if err := writer.ExecuteBatch(batch); err == nil {
+		t.Error("expected a failed condition not to be retried")
+	}
+}
+
+func TestDynamoDBBatchConfig(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{"maxTransactItems": 101},
+		{"maxTransactItems": 0.5},
+		{"maxTransactBytes": "1MB"},
+		{"writeConcurrency": 0},
+		{"batchWriteItem": "true"},
+		{"batchRetryDelay": "soon"},
+		{"batchRetryDelay": "10s", "maxBatchRetryDelay": "1s"},
+	}
+	for _, config := range invalid {
+		config["tableName"] = "fake"
+		config["region"] = "eu-west-1"
+		if _, err := New(nil, config); err == nil {
+			t.Errorf("expected config %v to be rejected", config)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsclient "github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// clientConfigKeys are the config keys that configure the client the store creates,
+// which can't be used along with a client passed in config["db"].
+var clientConfigKeys = []string{
+	"region", "endpoint", "profile",
+	"roleARN", "roleSessionName", "roleExternalID", "roleDuration",
+	"accessKeyID", "secretAccessKey", "sessionToken", "credentials",
+	"httpClient", "httpTimeout",
+	"maxRetries", "minRetryDelay", "maxRetryDelay", "minThrottleDelay", "maxThrottleDelay",
+}
+
+// clientOptions configure the DynamoDB client the store creates.
+type clientOptions struct {
+	region   string
+	endpoint string
+	// profile is the shared config profile to load, from ~/.aws/config and
+	// ~/.aws/credentials, or the files named by AWS_CONFIG_FILE and
+	// AWS_SHARED_CREDENTIALS_FILE.
+	profile string
+	// roleARN is a role that's assumed, using the credentials from the profile or
+	// the environment, to make the store's requests.
+	roleARN         string
+	roleSessionName string
+	roleExternalID  string
+	roleDuration    time.Duration
+	// credentials are used instead of those from the environment or profile. They
+	// are either passed in config["credentials"], or are static credentials.
+	credentials *credentials.Credentials
+	// httpClient, or a client with httpTimeout, is used to make requests.
+	httpClient *http.Client
+	// retryer replaces the SDK's default retries, if any retry options are set.
+	retryer request.Retryer
+}
+
+func newClientOptions(config map[string]interface{}) (rv clientOptions, err error) {
+	if rv.region, err = configString(config, "region", ""); err != nil {
+		return
+	}
+	if rv.endpoint, err = configString(config, "endpoint", ""); err != nil {
+		return
+	}
+	if rv.profile, err = configString(config, "profile", ""); err != nil {
+		return
+	}
+	if rv.region == "" && rv.profile == "" {
+		return rv, errors.New("missing region in config")
+	}
+
+	if rv.roleARN, err = configString(config, "roleARN", ""); err != nil {
+		return
+	}
+	if rv.roleSessionName, err = configString(config, "roleSessionName", ""); err != nil {
+		return
+	}
+	if rv.roleExternalID, err = configString(config, "roleExternalID", ""); err != nil {
+		return
+	}
+	if rv.roleDuration, err = configDuration(config, "roleDuration", 0); err != nil {
+		return
+	}
+	if rv.roleARN == "" {
+		for _, key := range []string{"roleSessionName", "roleExternalID", "roleDuration"} {
+			if _, ok := config[key]; ok {
+				return rv, fmt.Errorf("dynamodb store, config[%s] requires config[roleARN]", key)
+			}
+		}
+	} else if rv.roleDuration != 0 && (rv.roleDuration < 15*time.Minute || rv.roleDuration > 12*time.Hour) {
+		return rv, fmt.Errorf("dynamodb store, config[roleDuration] must be between 15m and 12h, got %v", rv.roleDuration)
+	}
+
+	if rv.credentials, err = newCredentials(config); err != nil {
+		return
+	}
+	if rv.credentials != nil && rv.profile != "" {
+		return rv, errors.New("dynamodb store, config[profile] can't be used with credentials in the config")
+	}
+
+	if v, ok := config["httpClient"]; ok {
+		if rv.httpClient, ok = v.(*http.Client); !ok || rv.httpClient == nil {
+			return rv, fmt.Errorf("dynamodb store, config[httpClient] must be an *http.Client, got %T", v)
+		}
+		if _, ok := config["httpTimeout"]; ok {
+			return rv, errors.New("dynamodb store, config[httpTimeout] can't be used with config[httpClient], set the client's Timeout instead")
+		}
+	}
+	httpTimeout, err := configDuration(config, "httpTimeout", 0)
+	if err != nil {
+		return
+	}
+	if httpTimeout < 0 {
+		return rv, fmt.Errorf("dynamodb store, config[httpTimeout] must be positive, got %v", httpTimeout)
+	}
+	if httpTimeout > 0 {
+		rv.httpClient = &http.Client{Timeout: httpTimeout}
+	}
+
+	rv.retryer, err = newRetryer(config)
+	return
+}
+
+// newCredentials returns the credentials passed in config["credentials"], or static
+// credentials from the accessKeyID, secretAccessKey and sessionToken config keys,
+// or nil if there are neither.
+func newCredentials(config map[string]interface{}) (*credentials.Credentials, error) {
+	accessKeyID, err := configString(config, "accessKeyID", "")
+	if err != nil {
+		return nil, err
+	}
+	secretAccessKey, err := configString(config, "secretAccessKey", "")
+	if err != nil {
+		return nil, err
+	}
+	sessionToken, err := configString(config, "sessionToken", "")
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := config["credentials"]; ok {
+		creds, ok := v.(*credentials.Credentials)
+		if !ok || creds == nil {
+			return nil, fmt.Errorf("dynamodb store, config[credentials] must be a *credentials.Credentials, got %T", v)
+		}
+		if accessKeyID != "" || secretAccessKey != "" || sessionToken != "" {
+			return nil, errors.New("dynamodb store, config[credentials] can't be used with config[accessKeyID], config[secretAccessKey] or config[sessionToken]")
+		}
+		return creds, nil
+	}
+	if accessKeyID == "" && secretAccessKey == "" && sessionToken == "" {
+		return nil, nil
+	}
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("dynamodb store, config[accessKeyID] and config[secretAccessKey] must be set together")
+	}
+	return credentials.NewStaticCredentials(accessKeyID, secretAccessKey, sessionToken), nil
+}
+
+// newRetryer returns a retryer for the SDK's retries of failed requests, or nil
+// if none of the retry options are set.
+func newRetryer(config map[string]interface{}) (request.Retryer, error) {
+	var set bool
+	for _, key := range []string{"maxRetries", "minRetryDelay", "maxRetryDelay", "minThrottleDelay", "maxThrottleDelay"} {
+		if _, ok := config[key]; ok {
+			set = true
+		}
+	}
+	if !set {
+		return nil, nil
+	}
+	var rv awsclient.DefaultRetryer
+	var err error
+	if rv.NumMaxRetries, err = configIntRange(config, "maxRetries", awsclient.DefaultRetryerMaxNumRetries, 0, 100); err != nil {
+		return nil, err
+	}
+	if rv.MinRetryDelay, err = configDuration(config, "minRetryDelay", awsclient.DefaultRetryerMinRetryDelay); err != nil {
+		return nil, err
+	}
+	if rv.MaxRetryDelay, err = configDuration(config, "maxRetryDelay", awsclient.DefaultRetryerMaxRetryDelay); err != nil {
+		return nil, err
+	}
+	if rv.MinThrottleDelay, err = configDuration(config, "minThrottleDelay", awsclient.DefaultRetryerMinThrottleDelay); err != nil {
+		return nil, err
+	}
+	if rv.MaxThrottleDelay, err = configDuration(config, "maxThrottleDelay", awsclient.DefaultRetryerMaxThrottleDelay); err != nil {
+		return nil, err
+	}
+	if rv.MinRetryDelay <= 0 || rv.MaxRetryDelay < rv.MinRetryDelay {
+		return nil, fmt.Errorf("dynamodb store, config[minRetryDelay] must be positive and no more than config[maxRetryDelay], got %v and %v", rv.MinRetryDelay, rv.MaxRetryDelay)
+	}
+	if rv.MinThrottleDelay <= 0 || rv.MaxThrottleDelay < rv.MinThrottleDelay {
+		return nil, fmt.Errorf("dynamodb store, config[minThrottleDelay] must be positive and no more than config[maxThrottleDelay], got %v and %v", rv.MinThrottleDelay, rv.MaxThrottleDelay)
+	}
+	return rv, nil
+}
+
+// newDB returns the DB passed in the "db" config key, if there is one, otherwise
+// it creates a DynamoDB client configured by the rest of the config, whose retries
+// are counted in s.
+func newDB(config map[string]interface{}, s *stats) (DB, error) {
+	if v, ok := config["db"]; ok {
+		db, ok := v.(DB)
+		if !ok {
+			return nil, fmt.Errorf("dynamodb store, config[db] must implement DB, got %T", v)
+		}
+		for _, key := range clientConfigKeys {
+			if _, ok := config[key]; ok {
+				return nil, fmt.Errorf("dynamodb store, config[%s] can't be used with config[db]", key)
+			}
+		}
+		return db, nil
+	}
+	o, err := newClientOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := aws.NewConfig()
+	if o.region != "" {
+		cfg = cfg.WithRegion(o.region)
+	}
+	if o.endpoint != "" {
+		cfg = cfg.WithEndpoint(o.endpoint)
+	}
+	if o.credentials != nil {
+		cfg = cfg.WithCredentials(o.credentials)
+	}
+	if o.httpClient != nil {
+		cfg = cfg.WithHTTPClient(o.httpClient)
+	}
+	if o.retryer != nil {
+		cfg = request.WithRetryer(cfg, o.retryer)
+	}
+	options := session.Options{Config: *cfg}
+	if o.profile != "" {
+		options.Profile = o.profile
+		options.SharedConfigState = session.SharedConfigEnable
+	}
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, fmt.Errorf("dynamodb store, creating AWS session: %v", err)
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		return nil, fmt.Errorf("dynamodb store, missing region in config and in profile %q", o.profile)
+	}
+
+	var roleConfig []*aws.Config
+	if o.roleARN != "" {
+		creds := stscreds.NewCredentials(sess, o.roleARN, func(p *stscreds.AssumeRoleProvider) {
+			if o.roleSessionName != "" {
+				p.RoleSessionName = o.roleSessionName
+			}
+			if o.roleExternalID != "" {
+				p.ExternalID = aws.String(o.roleExternalID)
+			}
+			if o.roleDuration != 0 {
+				p.Duration = o.roleDuration
+			}
+		})
+		roleConfig = append(roleConfig, aws.NewConfig().WithCredentials(creds))
+	}
+	db := dynamodb.New(sess, roleConfig...)
+	s.addHandlers(&db.Handlers)
+	return db, nil
+}
@@ -0,0 +1,218 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve/index/store/dynamodb/fake"
+)
+
+// newClient creates a store with the config, and returns its DynamoDB client.
+func newClient(t *testing.T, config map[string]interface{}) *dynamodb.DynamoDB {
+	config["tableName"] = "test"
+	s, err := New(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*Store).db.(*statsDB).db.(*dynamodb.DynamoDB)
+}
+
+func TestDynamoDBClientConfig(t *testing.T) {
+	// The JSON config stored in an index's metadata, which the runtime config passed
+	// to OpenUsing is added to.
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"tableName": "test",
+		"region": "eu-west-1",
+		"endpoint": "http://localhost:8000",
+		"maxRetries": 5,
+		"minRetryDelay": "10ms",
+		"maxThrottleDelay": "10s",
+		"consistentRead": false
+	}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient := &http.Client{Timeout: time.Second}
+	runtimeConfig := map[string]interface{}{
+		"httpClient":  httpClient,
+		"credentials": credentials.NewStaticCredentials("id", "secret", ""),
+	}
+	for k, v := range runtimeConfig {
+		config[k] = v
+	}
+	db := newClient(t, config)
+	if region := aws.StringValue(db.Config.Region); region != "eu-west-1" {
+		t.Errorf("expected region eu-west-1, got %s", region)
+	}
+	if db.Endpoint != "http://localhost:8000" {
+		t.Errorf("expected the endpoint to be set, got %s", db.Endpoint)
+	}
+	if db.Config.HTTPClient != httpClient {
+		t.Error("expected the HTTP client to be used")
+	}
+	if db.MaxRetries() != 5 {
+		t.Errorf("expected 5 retries, got %d", db.MaxRetries())
+	}
+	creds, err := db.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "id" {
+		t.Errorf("expected the credentials to be used, got %s", creds.AccessKeyID)
+	}
+
+	db = newClient(t, map[string]interface{}{
+		"region":          "eu-west-1",
+		"httpTimeout":     "3s",
+		"accessKeyID":     "static",
+		"secretAccessKey": "secret",
+	})
+	if db.Config.HTTPClient.Timeout != 3*time.Second {
+		t.Errorf("expected a 3s timeout, got %v", db.Config.HTTPClient.Timeout)
+	}
+	if creds, err := db.Config.Credentials.Get(); err != nil || creds.AccessKeyID != "static" {
+		t.Errorf("expected static credentials, got %v, %v", creds, err)
+	}
+
+	newClient(t, map[string]interface{}{
+		"region":          "eu-west-1",
+		"roleARN":         "arn:aws:iam::123456789012:role/bleve",
+		"roleSessionName": "bleve",
+		"roleDuration":    "1h",
+	})
+}
+
+func TestDynamoDBClientProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynamodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(configFile, []byte("[profile bleve]\nregion = us-west-2\naws_access_key_id = profile\naws_secret_access_key = secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"AWS_CONFIG_FILE":             configFile,
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(dir, "credentials"),
+		"AWS_REGION":                  "",
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	db := newClient(t, map[string]interface{}{"profile": "bleve"})
+	if region := aws.StringValue(db.Config.Region); region != "us-west-2" {
+		t.Errorf("expected the profile's region, got %s", region)
+	}
+	creds, err := db.Config.Credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "profile" {
+		t.Errorf("expected the profile's credentials, got %s", creds.AccessKeyID)
+	}
+
+	// The region in the config overrides the profile's.
+	db = newClient(t, map[string]interface{}{"profile": "bleve", "region": "eu-west-1"})
+	if region := aws.StringValue(db.Config.Region); region != "eu-west-1" {
+		t.Errorf("expected the configured region, got %s", region)
+	}
+
+	_, err = New(nil, map[string]interface{}{"tableName": "test", "profile": "missing"})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected an error for a missing profile, got %v", err)
+	}
+}
+
+func TestDynamoDBInvalidClientConfig(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{},
+		{"region": 1},
+		{"region": "eu-west-1", "roleSessionName": "bleve"},
+		{"region": "eu-west-1", "roleARN": "arn", "roleDuration": "1m"},
+		{"region": "eu-west-1", "accessKeyID": "id"},
+		{"region": "eu-west-1", "sessionToken": "token"},
+		{"region": "eu-west-1", "credentials": "secret"},
+		{"region": "eu-west-1", "credentials": credentials.AnonymousCredentials, "accessKeyID": "id", "secretAccessKey": "secret"},
+		{"profile": "bleve", "accessKeyID": "id", "secretAccessKey": "secret"},
+		{"region": "eu-west-1", "httpClient": http.DefaultClient, "httpTimeout": "1s"},
+		{"region": "eu-west-1", "httpClient": "client"},
+		{"region": "eu-west-1", "httpTimeout": "-1s"},
+		{"region": "eu-west-1", "maxRetries": -1},
+		{"region": "eu-west-1", "minRetryDelay": "1s", "maxRetryDelay": "1ms"},
+		{"region": "eu-west-1", "maxThrottleDelay": "1ms"},
+		{"region": "eu-west-1", "consistentRead": "false"},
+		{"db": fake.New(), "region": "eu-west-1"},
+		{"db": "fake"},
+	}
+	for _, config := range invalid {
+		config["tableName"] = "test"
+		if _, err := New(nil, config); err == nil {
+			t.Errorf("expected config %v to be rejected", config)
+		}
+	}
+}
+
+func TestDynamoDBEventuallyConsistentReads(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{"consistentRead": false})
+	var m sync.Mutex
+	consistent := map[string][]bool{}
+	db.Fault = func(operation string, input interface{}) error {
+		m.Lock()
+		defer m.Unlock()
+		switch input := input.(type) {
+		case *dynamodb.GetItemInput:
+			consistent[operation] = append(consistent[operation], aws.BoolValue(input.ConsistentRead))
+		case *dynamodb.QueryInput:
+			consistent[operation] = append(consistent[operation], aws.BoolValue(input.ConsistentRead))
+		case *dynamodb.BatchGetItemInput:
+			for _, ka := range input.RequestItems {
+				consistent[operation] = append(consistent[operation], aws.BoolValue(ka.ConsistentRead))
+			}
+		}
+		return nil
+	}
+	writeLargeBatch(t, s, 10)
+	checkLargeBatch(t, s, 10)
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err := reader.MultiGet([][]byte{[]byte("k0001")}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]bool{
+		// Merges always read consistently, readers don't.
+		"BatchGetItem": {true, false},
+		"GetItem":      {false},
+		"Query":        {false},
+	}
+	for operation, reads := range expected {
+		if len(consistent[operation]) != len(reads) {
+			t.Errorf("expected %d %s calls, got %v", len(reads), operation, consistent[operation])
+			continue
+		}
+		for i, read := range reads {
+			if consistent[operation][i] != read {
+				t.Errorf("expected %s call %d to have ConsistentRead %v", operation, i, read)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package dynamodb
+
+import (
+	"fmt"
+	"time"
+)
+
+// configInt reads an integer from the config. Numbers decoded from JSON are
+// float64, so both ints and float64s are accepted.
+func configInt(config map[string]interface{}, key string, defaultValue int) (int, error) {
+	v, ok := config[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("dynamodb store, config[%s] must be a whole number, got %v", key, v)
+		}
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("dynamodb store, config[%s] must be a number, got %T", key, v)
+}
+
+// configIntRange reads an integer from the config, and checks that it's within the
+// inclusive range.
+func configIntRange(config map[string]interface{}, key string, defaultValue, min, max int) (int, error) {
+	v, err := configInt(config, key, defaultValue)
+	if err != nil {
+		return 0, err
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("dynamodb store, config[%s] must be between %d and %d, got %d", key, min, max, v)
+	}
+	return v, nil
+}
+
+// configBool reads a boolean from the config.
+func configBool(config map[string]interface{}, key string, defaultValue bool) (bool, error) {
+	v, ok := config[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("dynamodb store, config[%s] must be a bool, got %T", key, v)
+	}
+	return b, nil
+}
+
+// configDuration reads a duration from the config, either as a time.Duration or as a
+// string parsed by time.ParseDuration, e.g. "50ms".
+func configDuration(config map[string]interface{}, key string, defaultValue time.Duration) (time.Duration, error) {
+	v, ok := config[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("dynamodb store, config[%s]: %v", key, err)
+		}
+		return d, nil
+	}
+	return 0, fmt.Errorf("dynamodb store, config[%s] must be a duration string, got %T", key, v)
+}
+
+// configString reads a string from the config.
+func configString(config map[string]interface{}, key string, defaultValue string) (string, error) {
+	v, ok := config[key]
+	if !ok {
+		return defaultValue, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("dynamodb store, config[%s] must be a string, got %T", key, v)
+	}
+	return s, nil
+}
@@ -0,0 +1,181 @@
+/*
+Package dynamodb implements a bleve KVStore on top of a DynamoDB table.
+
+The table must have a string partition key named "pk" and a binary sort key named
+"sk". Every row of the index is stored as an item in a single partition, with the
+row's key in "sk" and "k", its value in the binary attribute "v", and a random
+revision in "rev", which changes whenever the item is written. A table can hold
+the partitions of many indexes.
+
+# Merges
+
+Merges are applied with the store's MergeOperator. Merges into a key that the
+same batch sets or deletes earlier are applied to the batch's value. Otherwise the
+stored item is read with BatchGetItem, the operands are merged into its value, and
+the result is put on condition that the item's revision hasn't changed. If another
+writer changed the item in the meantime, the transaction is cancelled, and the
+item is read and merged again before the transaction is retried, up to
+maxBatchRetries times. A set or delete after a merge in the same batch replaces it.
+
+# Configuration
+
+The store is configured through the kvconfig map passed to New:
+
+	tableName           (string, required) the name of the table.
+	partition           (string) the partition key of the index's items, defaults to "bleve".
+	partitionByIndex    (bool) use the path of the index as the partition, instead of
+	                    config[partition], see IndexPartition.
+	indexRoot           (string) with partitionByIndex, the directory the partitions
+	                    are relative to, instead of using the indexes' absolute paths.
+	shards              (number) spread the rows of each sharded row type over this many
+	                    partitions, see Sharding below. Defaults to 1, no sharding.
+	shardPrefixLength   (number) the length of the key prefix, including the row type,
+	                    that's hashed to choose a row's shard, defaults to 4.
+	shardRowTypes       (string) the row types that are sharded, defaults to "bdst".
+	consistentRead      (bool) whether readers use strongly consistent reads, defaults to
+	                    true. Set it to false to use cheaper, eventually consistent reads,
+	                    which may not see the most recent writes. Merges always read
+	                    consistently.
+	db                  (DB) a client to use instead of creating one, e.g. the fake. None
+	                    of the client options below can be used with it.
+	maxTransactItems    (number) the maximum number of items in each TransactWriteItems
+	                    call, from 1 to 100, defaults to 100.
+	maxTransactBytes    (number) the maximum size of each TransactWriteItems call, defaults
+	                    to 4MB.
+	batchWriteItem      (bool) write sets and deletes with BatchWriteItem, 25 at a time,
+	                    instead of with transactions. Defaults to false.
+	writeConcurrency    (number) how many chunks of a batch are written at the same time,
+	                    defaults to 4.
+	readConcurrency     (number) how many BatchGetItem calls a MultiGet makes at the same
+	                    time, defaults to 4.
+	maxBatchRetries     (number) how many times unprocessed BatchWriteItem requests,
+	                    unprocessed BatchGetItem keys, and transactions cancelled by
+	                    conflicts or throttling, are retried. Defaults to 10.
+	batchRetryDelay     (duration string) the delay before the first retry, which doubles
+	                    on each retry. Defaults to "50ms".
+	maxBatchRetryDelay  (duration string) the longest delay between retries, defaults
+	                    to "5s".
+
+The client the store creates is configured with:
+
+	region              (string) the AWS region, required unless db or profile is set.
+	endpoint            (string) overrides the DynamoDB endpoint, e.g. for DynamoDB Local.
+	profile             (string) a profile in the AWS shared config and credentials files,
+	                    which provides the region, unless it's set, and the credentials.
+	roleARN             (string) a role to assume to make requests, using the credentials
+	                    of the profile, the config or the environment.
+	roleSessionName     (string) the session name of the assumed role.
+	roleExternalID      (string) the external ID required to assume the role.
+	roleDuration        (duration string) how long the role's credentials last, from 15m
+	                    to 12h.
+	accessKeyID         (string) the key ID and secret of static credentials, which must be
+	secretAccessKey     set together, and can't be used with profile.
+	sessionToken        (string) the session token of temporary static credentials.
+	credentials         (*credentials.Credentials) credentials to use, instead of static
+	                    credentials or a profile.
+	httpClient          (*http.Client) the client used to make requests.
+	httpTimeout         (duration string) the timeout of each request, which can't be used
+	                    with httpClient.
+	maxRetries          (number) how many times the AWS SDK retries a failed request,
+	                    defaults to 3.
+	minRetryDelay       (duration string) the delays between the SDK's retries of failed
+	maxRetryDelay       requests, default to "30ms" and "300s".
+	minThrottleDelay    (duration string) the delays between the SDK's retries of throttled
+	maxThrottleDelay    requests, default to "500ms" and "300s".
+
+Values that can't be stored as JSON, such as db, credentials and httpClient, should be
+passed in the runtimeConfig of bleve.OpenUsing, which is added to the config stored
+with the index when it's opened.
+
+When the config has "error_if_exists", as it does when bleve.New creates an index,
+the store can only be opened if its partition is empty.
+
+# Sharding
+
+DynamoDB limits the throughput of each partition, so an index whose rows are all in
+one partition can only be written to and read from so quickly. With shards set to
+more than 1, the rows whose type, the first byte of the key, is in shardRowTypes
+are spread over that many partitions per type. By default these are the back
+index, dictionary, stored and term frequency rows of upsidedown. A row's shard is
+chosen by a hash of the first shardPrefixLength bytes of its key, and its partition
+key is the partition followed by "#", the row type in hex, "#" and the shard, e.g.
+"bleve#74#3". Other rows stay in the partition itself.
+
+Every row whose key starts with the same prefix of shardPrefixLength bytes is in
+the same shard, so Get, and iterators over a prefix at least that long, or over a
+range whose start and end share it, only read one partition. Other iterators query
+every partition that may hold their rows, and merge the sorted results. The
+sharding options must not be changed once an index has been written.
+
+# Tables
+
+NewTable returns a Table, which manages a table shared by many indexes. Its Create
+method creates the table with on-demand billing, or checks the schema of an
+existing table. Partitions lists the partitions in the table, which scans all of
+it, and DropPartition deletes the items of a partition a page at a time. Both
+account for the shards of the partitions, if the table's config has the same
+sharding options as its stores.
+
+RegisterKVStore registers a KVStore that stores each index in the partition named
+after the index's path, using the table's client and config, so that bleve.New can
+create indexes in the table once bleve.Config.DefaultKVStore is set to its name.
+The partition is the absolute path of the index, or its path relative to the
+table's indexRoot, which keeps the partitions the same when the indexes are opened
+from another working directory or host:
+
+	table, err := dynamodb.NewTable(map[string]interface{}{
+		"tableName": "indexes",
+		"region":    "eu-west-1",
+		"indexRoot": "indexes",
+	})
+	...
+	err = table.Create()
+	...
+	table.RegisterKVStore("dynamodb-indexes")
+	bleve.Config.DefaultKVStore = "dynamodb-indexes"
+	index, err := bleve.New("indexes/products", mapping) // in partition "products"
+
+DeleteIndex drops the partition of a closed index and removes its directory. It can
+be used as the RemoveIndex of the http package's DeleteIndexHandler.
+
+# Atomicity
+
+DynamoDB limits a transaction to 100 items and 4MB, so the Writer splits batches
+that are larger than maxTransactItems or maxTransactBytes into several calls:
+
+  - A batch that fits within a single transaction, and doesn't use batchWriteItem, is
+    written atomically: either every operation is applied or none are.
+  - A larger batch is written as several transactions. Each transaction is atomic,
+    but the batch as a whole is not. If ExecuteBatch returns an error, any of the
+    transactions may have been applied, and readers may see some of a batch's
+    operations before others while it's being written.
+  - With batchWriteItem, each individual put or delete is atomic, but nothing else is.
+  - A merge is applied exactly once if ExecuteBatch succeeds. If it fails, retrying
+    the batch may apply a merge twice.
+
+An index built on this store can be left inconsistent by a failed ExecuteBatch, in
+which case the documents in the failed batch should be indexed again.
+
+# Isolation
+
+Unlike the other KV stores, the store's readers are not isolated from writers:
+DynamoDB has no snapshot reads, so a reader, and an iterator that hasn't read all
+its pages yet, see the batches committed after they were opened. A reader only
+ever sees committed data, i.e. the isolation level is read committed, and with
+consistentRead it sees every batch committed before it read. This is why the
+store/test isolation conformance test doesn't apply to the store, which is instead
+tested for this behavior. upsidedown indexes keep working, as their writes are
+serialized, but a search may see some of the documents of a batch being indexed
+concurrently.
+
+# Stats
+
+The store implements store.KVStoreStats, so its stats appear under "kv" in the
+index's stats. For each of get_item, query, transact_write_items, batch_write_item
+and batch_get_item there are counts of calls, errors and throttled calls, and a
+latency histogram. The store also counts the read and write capacity units
+DynamoDB reports each call consumed, the iterators opened and the pages they read,
+the store's retries of unprocessed items and keys and of cancelled transactions,
+the retries made by the AWS SDK itself, and the number of throttled requests.
+*/
+package dynamodb
@@ -0,0 +1,77 @@
+package fake
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	readUnitBytes  = 4 * 1024
+	writeUnitBytes = 1024
+)
+
+// capacity accumulates the capacity units consumed by an operation on each table,
+// following DynamoDB's rules: a read unit covers 4KB read with strong consistency,
+// or twice that with eventual consistency, a write unit covers 1KB, and the
+// operations of a transaction cost twice as much.
+type capacity map[string]float64
+
+func units(size, unit int) float64 {
+	n := (size + unit - 1) / unit
+	if n < 1 {
+		n = 1
+	}
+	return float64(n)
+}
+
+func (c capacity) read(tableName string, size int, consistentRead *bool) {
+	u := units(size, readUnitBytes)
+	if !aws.BoolValue(consistentRead) {
+		u /= 2
+	}
+	c[tableName] += u
+}
+
+func (c capacity) transactRead(tableName string, size int) {
+	c[tableName] += 2 * units(size, readUnitBytes)
+}
+
+func (c capacity) write(tableName string, size int) {
+	c[tableName] += units(size, writeUnitBytes)
+}
+
+func (c capacity) transactWrite(tableName string, size int) {
+	c[tableName] += 2 * units(size, writeUnitBytes)
+}
+
+// consumed returns the consumed capacity of each table, if it was requested.
+func (c capacity) consumed(returnConsumedCapacity *string) []*dynamodb.ConsumedCapacity {
+	switch aws.StringValue(returnConsumedCapacity) {
+	case dynamodb.ReturnConsumedCapacityTotal, dynamodb.ReturnConsumedCapacityIndexes:
+	default:
+		return nil
+	}
+	var tableNames []string
+	for tableName := range c {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	rv := make([]*dynamodb.ConsumedCapacity, len(tableNames))
+	for i, tableName := range tableNames {
+		rv[i] = &dynamodb.ConsumedCapacity{
+			TableName:     aws.String(tableName),
+			CapacityUnits: aws.Float64(c[tableName]),
+		}
+	}
+	return rv
+}
+
+// consumedTable returns the consumed capacity of an operation on a single table.
+func (c capacity) consumedTable(returnConsumedCapacity *string) *dynamodb.ConsumedCapacity {
+	if rv := c.consumed(returnConsumedCapacity); len(rv) > 0 {
+		return rv[0]
+	}
+	return nil
+}
@@ -0,0 +1,874 @@
+package fake
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// The expression grammar is documented at
+// https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/Expressions.html
+// Only top-level attribute paths are supported, nested document paths are rejected.
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenName
+	tokenValue
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ","})
+			i++
+		case c == '=' || c == '+' || c == '-':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(c)})
+			i++
+		case c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(expr) && (expr[i+1] == '=' || (c == '<' && expr[i+1] == '>')) {
+				op += string(expr[i+1])
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op})
+			i += len(op)
+		case c == '#' || c == ':' || isIdentRune(c):
+			j := i + 1
+			for j < len(expr) && isIdentRune(rune(expr[j])) {
+				j++
+			}
+			kind := tokenIdent
+			if c == '#' {
+				kind = tokenName
+			} else if c == ':' {
+				kind = tokenValue
+			}
+			if j == i+1 && kind != tokenIdent {
+				return nil, fmt.Errorf("invalid expression %q: empty placeholder at position %d", expr, i)
+			}
+			tokens = append(tokens, token{kind: kind, text: expr[i:j]})
+			i = j
+		case c == '.' || c == '[':
+			return nil, fmt.Errorf("invalid expression %q: nested attribute paths are not supported", expr)
+		default:
+			return nil, fmt.Errorf("invalid expression %q: unexpected character %q at position %d", expr, c, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+func isIdentRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// parser converts expression tokens into conditions and update actions, resolving
+// placeholders as it goes, and recording which ones were used.
+type parser struct {
+	expr   string
+	tokens []token
+	pos    int
+	names  map[string]*string
+	values map[string]*dynamodb.AttributeValue
+
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newParser(names map[string]*string, values map[string]*dynamodb.AttributeValue) *parser {
+	return &parser{
+		names:      names,
+		values:     values,
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}
+}
+
+func (p *parser) reset(expr string) error {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return err
+	}
+	p.expr = expr
+	p.tokens = tokens
+	p.pos = 0
+	return nil
+}
+
+// checkUnused returns an error if any of the placeholders weren't used by any of the
+// parsed expressions, which is what DynamoDB does.
+func (p *parser) checkUnused() error {
+	for k := range p.names {
+		if !p.usedNames[k] {
+			return fmt.Errorf("value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", k)
+		}
+	}
+	for k := range p.values {
+		if !p.usedValues[k] {
+			return fmt.Errorf("value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", k)
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid expression %q: %s", p.expr, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isKeyword(t token, keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	t := p.next()
+	if t.kind != kind {
+		return p.errorf("expected %q, got %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *parser) expectEOF() error {
+	if t := p.peek(); t.kind != tokenEOF {
+		return p.errorf("unexpected token %q", t.text)
+	}
+	return nil
+}
+
+// operand is a value used by a condition or an update action.
+type operand interface {
+	eval(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error)
+}
+
+type pathOperand string
+
+func (o pathOperand) eval(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	return item[string(o)], nil
+}
+
+type valueOperand struct {
+	v *dynamodb.AttributeValue
+}
+
+func (o valueOperand) eval(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	return o.v, nil
+}
+
+type sizeOperand struct {
+	path pathOperand
+}
+
+func (o sizeOperand) eval(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	v := item[string(o.path)]
+	var n int
+	switch attributeType(v) {
+	case "":
+		return nil, nil
+	case dynamodb.ScalarAttributeTypeS:
+		n = len(*v.S)
+	case dynamodb.ScalarAttributeTypeB:
+		n = len(v.B)
+	case "SS":
+		n = len(v.SS)
+	case "NS":
+		n = len(v.NS)
+	case "BS":
+		n = len(v.BS)
+	case "L":
+		n = len(v.L)
+	case "M":
+		n = len(v.M)
+	default:
+		return nil, fmt.Errorf("invalid operand type for size(): %s", attributeType(v))
+	}
+	return &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(n))}, nil
+}
+
+type arithmeticOperand struct {
+	op          string
+	left, right operand
+}
+
+func (o arithmeticOperand) eval(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	l, err := o.left.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.right.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+	}
+	if l.N == nil || r.N == nil {
+		return nil, fmt.Errorf("incorrect operand type for operator %s", o.op)
+	}
+	ln, err := parseNumber(*l.N)
+	if err != nil {
+		return nil, err
+	}
+	rn, err := parseNumber(*r.N)
+	if err != nil {
+		return nil, err
+	}
+	if o.op == "-" {
+		rn.Neg(rn)
+	}
+	return &dynamodb.AttributeValue{N: aws.String(formatNumber(ln.Add(ln, rn)))}, nil
+}
+
+type ifNotExistsOperand struct {
+	path     pathOperand
+	fallback operand
+}
+
+func (o ifNotExistsOperand) eval(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	if v, ok := item[string(o.path)]; ok {
+		return v, nil
+	}
+	return o.fallback.eval(item)
+}
+
+type listAppendOperand struct {
+	left, right operand
+}
+
+func (o listAppendOperand) eval(item map[string]*dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	l, err := o.left.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.right.eval(item)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil || l.L == nil || r.L == nil {
+		return nil, fmt.Errorf("incorrect operand type for list_append")
+	}
+	return &dynamodb.AttributeValue{L: append(append([]*dynamodb.AttributeValue{}, l.L...), r.L...)}, nil
+}
+
+func (p *parser) parsePath() (pathOperand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenName:
+		name, ok := p.names[t.text]
+		if !ok || name == nil {
+			return "", p.errorf("an expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+		}
+		p.usedNames[t.text] = true
+		return pathOperand(*name), nil
+	case tokenIdent:
+		return pathOperand(t.text), nil
+	}
+	return "", p.errorf("expected attribute path, got %q", t.text)
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenValue:
+		p.next()
+		v, ok := p.values[t.text]
+		if !ok || v == nil {
+			return nil, p.errorf("an expression attribute value used in expression is not defined; attribute value: %s", t.text)
+		}
+		p.usedValues[t.text] = true
+		return valueOperand{v: v}, nil
+	case p.isKeyword(t, "size") && p.tokens[p.pos+1].kind == tokenLeftParen:
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return sizeOperand{path: path}, p.expect(tokenRightParen, ")")
+	}
+	return p.parsePath()
+}
+
+// condition is a parsed condition, filter or key condition expression.
+type condition interface {
+	eval(item map[string]*dynamodb.AttributeValue) (bool, error)
+}
+
+type andCondition []condition
+
+func (c andCondition) eval(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	for _, sub := range c {
+		ok, err := sub.eval(item)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type orCondition []condition
+
+func (c orCondition) eval(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	for _, sub := range c {
+		ok, err := sub.eval(item)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+type notCondition struct {
+	c condition
+}
+
+func (c notCondition) eval(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	ok, err := c.c.eval(item)
+	return !ok, err
+}
+
+type comparisonCondition struct {
+	op          string
+	left, right operand
+}
+
+func (c comparisonCondition) eval(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	l, err := c.left.eval(item)
+	if err != nil {
+		return false, err
+	}
+	r, err := c.right.eval(item)
+	if err != nil {
+		return false, err
+	}
+	switch c.op {
+	case "=":
+		return equalValues(l, r), nil
+	case "<>":
+		return !equalValues(l, r), nil
+	}
+	cmp, ok := compareValues(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unknown comparator %q", c.op)
+}
+
+type betweenCondition struct {
+	v, low, high operand
+}
+
+func (c betweenCondition) eval(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	ge, err := comparisonCondition{op: ">=", left: c.v, right: c.low}.eval(item)
+	if err != nil || !ge {
+		return false, err
+	}
+	return comparisonCondition{op: "<=", left: c.v, right: c.high}.eval(item)
+}
+
+type inCondition struct {
+	v    operand
+	list []operand
+}
+
+func (c inCondition) eval(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	for _, o := range c.list {
+		ok, err := comparisonCondition{op: "=", left: c.v, right: o}.eval(item)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+type functionCondition struct {
+	name string
+	args []operand
+}
+
+func (c functionCondition) eval(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	args := make([]*dynamodb.AttributeValue, len(c.args))
+	for i, o := range c.args {
+		v, err := o.eval(item)
+		if err != nil {
+			return false, err
+		}
+		args[i] = v
+	}
+	switch c.name {
+	case "attribute_exists":
+		return args[0] != nil, nil
+	case "attribute_not_exists":
+		return args[0] == nil, nil
+	case "attribute_type":
+		return args[0] != nil && args[1] != nil && args[1].S != nil && attributeType(args[0]) == *args[1].S, nil
+	case "begins_with":
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+		switch {
+		case args[0].S != nil && args[1].S != nil:
+			return strings.HasPrefix(*args[0].S, *args[1].S), nil
+		case args[0].B != nil && args[1].B != nil:
+			return bytes.HasPrefix(args[0].B, args[1].B), nil
+		}
+		return false, nil
+	case "contains":
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+		switch {
+		case args[0].S != nil && args[1].S != nil:
+			return strings.Contains(*args[0].S, *args[1].S), nil
+		case args[0].B != nil && args[1].B != nil:
+			return bytes.Contains(args[0].B, args[1].B), nil
+		case args[0].L != nil:
+			for _, v := range args[0].L {
+				if equalValues(v, args[1]) {
+					return true, nil
+				}
+			}
+		case args[0].SS != nil || args[0].NS != nil || args[0].BS != nil:
+			for _, v := range setElements(args[0]) {
+				if equalValues(v, args[1]) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown function %q", c.name)
+}
+
+var conditionFunctionArgs = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+func (p *parser) parseCondition(expr string) (condition, error) {
+	if err := p.reset(expr); err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.expectEOF()
+}
+
+func (p *parser) parseOr() (condition, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orCondition{c}
+	for p.isKeyword(p.peek(), "OR") {
+		p.next()
+		c, err = p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, c)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	c, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	and := andCondition{c}
+	for p.isKeyword(p.peek(), "AND") {
+		p.next()
+		c, err = p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, c)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.isKeyword(p.peek(), "NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{c: c}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	t := p.peek()
+	if t.kind == tokenLeftParen {
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(tokenRightParen, ")")
+	}
+	if t.kind == tokenIdent && p.tokens[p.pos+1].kind == tokenLeftParen {
+		name := strings.ToLower(t.text)
+		if argc, ok := conditionFunctionArgs[name]; ok {
+			p.next()
+			p.next()
+			args := make([]operand, argc)
+			for i := range args {
+				if i > 0 {
+					if err := p.expect(tokenComma, ","); err != nil {
+						return nil, err
+					}
+				}
+				var err error
+				if i == 0 {
+					args[i], err = p.parsePath()
+				} else {
+					args[i], err = p.parseOperand()
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			return functionCondition{name: name, args: args}, p.expect(tokenRightParen, ")")
+		}
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t = p.next()
+	switch {
+	case t.kind == tokenOperator && t.text != "+" && t.text != "-":
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return comparisonCondition{op: t.text, left: left, right: right}, nil
+	case p.isKeyword(t, "BETWEEN"):
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword(p.next(), "AND") {
+			return nil, p.errorf("expected AND in BETWEEN")
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenCondition{v: left, low: low, high: high}, nil
+	case p.isKeyword(t, "IN"):
+		if err := p.expect(tokenLeftParen, "("); err != nil {
+			return nil, err
+		}
+		var list []operand
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, o)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+		return inCondition{v: left, list: list}, p.expect(tokenRightParen, ")")
+	}
+	return nil, p.errorf("expected comparator, got %q", t.text)
+}
+
+// updateAction is a single clause of an update expression.
+type updateAction struct {
+	action string
+	path   pathOperand
+	value  operand
+}
+
+func (p *parser) parseUpdate(expr string) ([]updateAction, error) {
+	if err := p.reset(expr); err != nil {
+		return nil, err
+	}
+	var actions []updateAction
+	seen := map[string]bool{}
+	for p.peek().kind != tokenEOF {
+		t := p.next()
+		action := strings.ToUpper(t.text)
+		if t.kind != tokenIdent || (action != "SET" && action != "REMOVE" && action != "ADD" && action != "DELETE") {
+			return nil, p.errorf("expected SET, REMOVE, ADD or DELETE, got %q", t.text)
+		}
+		if seen[action] {
+			return nil, p.errorf("the %s section can only be used once in an update expression", action)
+		}
+		seen[action] = true
+		for {
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			ua := updateAction{action: action, path: path}
+			switch action {
+			case "SET":
+				if err := p.expect(tokenOperator, "="); err != nil {
+					return nil, err
+				}
+				ua.value, err = p.parseSetValue()
+			case "ADD", "DELETE":
+				ua.value, err = p.parseOperand()
+			}
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, ua)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if len(actions) == 0 {
+		return nil, p.errorf("the update expression is empty")
+	}
+	return actions, nil
+}
+
+func (p *parser) parseSetValue() (operand, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokenOperator && (t.text == "+" || t.text == "-") {
+		p.next()
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return arithmeticOperand{op: t.text, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseSetOperand() (operand, error) {
+	t := p.peek()
+	if t.kind != tokenIdent || p.tokens[p.pos+1].kind != tokenLeftParen {
+		return p.parseOperand()
+	}
+	name := strings.ToLower(t.text)
+	p.next()
+	p.next()
+	switch name {
+	case "if_not_exists":
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenComma, ","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return ifNotExistsOperand{path: path, fallback: fallback}, p.expect(tokenRightParen, ")")
+	case "list_append":
+		left, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenComma, ","); err != nil {
+			return nil, err
+		}
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return listAppendOperand{left: left, right: right}, p.expect(tokenRightParen, ")")
+	}
+	return nil, p.errorf("invalid function name in update expression: %s", t.text)
+}
+
+// applyUpdate applies the actions to a copy of the item. All of the values are
+// calculated from the item as it was before the update.
+func applyUpdate(item map[string]*dynamodb.AttributeValue, actions []updateAction) (map[string]*dynamodb.AttributeValue, error) {
+	rv := copyItem(item)
+	if rv == nil {
+		rv = map[string]*dynamodb.AttributeValue{}
+	}
+	for _, ua := range actions {
+		var v *dynamodb.AttributeValue
+		if ua.value != nil {
+			var err error
+			v, err = ua.value.eval(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		existing := item[string(ua.path)]
+		switch ua.action {
+		case "SET":
+			if v == nil {
+				return nil, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+			}
+			rv[string(ua.path)] = copyValue(v)
+		case "REMOVE":
+			delete(rv, string(ua.path))
+		case "ADD":
+			added, err := addValues(existing, v)
+			if err != nil {
+				return nil, err
+			}
+			rv[string(ua.path)] = added
+		case "DELETE":
+			if existing == nil {
+				continue
+			}
+			remaining, err := deleteValues(existing, v)
+			if err != nil {
+				return nil, err
+			}
+			if remaining == nil {
+				delete(rv, string(ua.path))
+				continue
+			}
+			rv[string(ua.path)] = remaining
+		}
+	}
+	return rv, nil
+}
+
+func addValues(existing, v *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	switch attributeType(v) {
+	case dynamodb.ScalarAttributeTypeN:
+		if existing == nil {
+			return copyValue(v), nil
+		}
+		if existing.N == nil {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		return arithmeticOperand{op: "+", left: valueOperand{v: existing}, right: valueOperand{v: v}}.eval(nil)
+	case "SS", "NS", "BS":
+		if existing == nil {
+			return copyValue(v), nil
+		}
+		if attributeType(existing) != attributeType(v) {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		rv := copyValue(existing)
+		for _, e := range setElements(v) {
+			if !containsValue(setElements(rv), e) {
+				appendSetElement(rv, e)
+			}
+		}
+		return rv, nil
+	}
+	return nil, fmt.Errorf("incorrect operand type for operator or function; operator: ADD, operand type: %s", attributeType(v))
+}
+
+func deleteValues(existing, v *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	if attributeType(existing) != attributeType(v) {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+	rv := &dynamodb.AttributeValue{}
+	for _, e := range setElements(existing) {
+		if !containsValue(setElements(v), e) {
+			appendSetElement(rv, e)
+		}
+	}
+	if attributeType(rv) == "" {
+		return nil, nil
+	}
+	return rv, nil
+}
+
+func setElements(v *dynamodb.AttributeValue) []*dynamodb.AttributeValue {
+	var rv []*dynamodb.AttributeValue
+	for _, s := range v.SS {
+		rv = append(rv, &dynamodb.AttributeValue{S: s})
+	}
+	for _, n := range v.NS {
+		rv = append(rv, &dynamodb.AttributeValue{N: n})
+	}
+	for _, b := range v.BS {
+		rv = append(rv, &dynamodb.AttributeValue{B: b})
+	}
+	return rv
+}
+
+func appendSetElement(set, e *dynamodb.AttributeValue) {
+	switch {
+	case e.S != nil:
+		set.SS = append(set.SS, aws.String(*e.S))
+	case e.N != nil:
+		set.NS = append(set.NS, aws.String(*e.N))
+	case e.B != nil:
+		set.BS = append(set.BS, append([]byte{}, e.B...))
+	}
+}
+
+func containsValue(values []*dynamodb.AttributeValue, v *dynamodb.AttributeValue) bool {
+	for _, e := range values {
+		if equalValues(e, v) {
+			return true
+		}
+	}
+	return false
+}
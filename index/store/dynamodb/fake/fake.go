@@ -0,0 +1,1158 @@
+// Package fake provides an in-process stand-in for the subset of the DynamoDB API
+// used by the dynamodb KVStore, so that it can be tested without DynamoDB Local.
+//
+// Tables are held in memory, and the behaviour that the store relies upon is
+// reproduced: items in a partition are ordered by sort key, queries are paged
+// using ExclusiveStartKey and LastEvaluatedKey, key condition, filter, condition
+// and update expressions are evaluated, and transactions are applied atomically
+// or cancelled.
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// MaxTransactItems is the maximum number of actions in a TransactWriteItems call.
+	MaxTransactItems = 100
+	// MaxTransactBytes is the maximum total size of the items in a TransactWriteItems call.
+	MaxTransactBytes = 4 * 1024 * 1024
+	// MaxItemBytes is the maximum size of a single item.
+	MaxItemBytes = 400 * 1024
+	// DefaultMaxPageBytes is the amount of data a Query reads before returning a page.
+	DefaultMaxPageBytes = 1024 * 1024
+	// MaxBatchWriteItems is the maximum number of requests in a BatchWriteItem call.
+	MaxBatchWriteItems = 25
+	// MaxBatchWriteBytes is the maximum total size of the items in a BatchWriteItem call.
+	MaxBatchWriteBytes = 16 * 1024 * 1024
+	// MaxBatchGetKeys is the maximum number of keys in a BatchGetItem call.
+	MaxBatchGetKeys = 100
+	// MaxBatchGetBytes is the amount of data a BatchGetItem call returns, any keys
+	// that don't fit are returned as UnprocessedKeys.
+	MaxBatchGetBytes = 16 * 1024 * 1024
+)
+
+// DB is an in-memory DynamoDB. The zero value is not usable, use New.
+type DB struct {
+	// MaxPageItems limits the number of items returned in each page of a Query, in
+	// addition to any Limit in the request. Setting it low exercises paging.
+	MaxPageItems int
+	// MaxPageBytes limits the size of each page of a Query.
+	MaxPageBytes int
+	// BatchWriteItemLimit limits the number of requests processed by each
+	// BatchWriteItem call, the rest are returned as UnprocessedItems as they would
+	// be when DynamoDB throttles the table.
+	BatchWriteItemLimit int
+	// BatchGetItemLimit limits the number of keys read by each BatchGetItem call, the
+	// rest are returned as UnprocessedKeys.
+	BatchGetItemLimit int
+	// Fault, if set, is called with the name and input of every operation before it
+	// runs. Returning an error makes the operation fail with that error, which lets
+	// tests simulate network failures and throttling.
+	Fault func(operation string, input interface{}) error
+
+	m      sync.RWMutex
+	tables map[string]*table
+}
+
+// New creates an empty in-memory DynamoDB.
+func New() *DB {
+	return &DB{
+		MaxPageBytes: DefaultMaxPageBytes,
+		tables:       map[string]*table{},
+	}
+}
+
+type table struct {
+	hashKey, hashKeyType   string
+	rangeKey, rangeKeyType string
+	partitions             map[string]*partition
+	// description is returned by DescribeTable.
+	description *dynamodb.TableDescription
+}
+
+// partition holds the items that share a partition key, ordered by sort key.
+type partition struct {
+	items []map[string]*dynamodb.AttributeValue
+}
+
+func newError(code, format string, args ...interface{}) error {
+	return awserr.New(code, fmt.Sprintf(format, args...), nil)
+}
+
+func validationError(format string, args ...interface{}) error {
+	return newError("ValidationException", format, args...)
+}
+
+func wrapValidationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(awserr.Error); ok {
+		return err
+	}
+	return validationError("%s", err.Error())
+}
+
+func resourceNotFound() error {
+	return newError(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found")
+}
+
+// CreateTable creates a table, which is active straight away. Only the attribute
+// definitions, key schema and billing mode are used.
+func (db *DB) CreateTable(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	name := aws.StringValue(input.TableName)
+	if len(name) < 3 {
+		return nil, validationError("TableName must be at least 3 characters long")
+	}
+	types := map[string]string{}
+	for _, ad := range input.AttributeDefinitions {
+		types[aws.StringValue(ad.AttributeName)] = aws.StringValue(ad.AttributeType)
+	}
+	t := &table{partitions: map[string]*partition{}}
+	for _, ks := range input.KeySchema {
+		name := aws.StringValue(ks.AttributeName)
+		typ, ok := types[name]
+		if !ok {
+			return nil, validationError("One or more parameter values were invalid: Some index key attributes are not defined in AttributeDefinitions")
+		}
+		switch aws.StringValue(ks.KeyType) {
+		case dynamodb.KeyTypeHash:
+			t.hashKey, t.hashKeyType = name, typ
+		case dynamodb.KeyTypeRange:
+			t.rangeKey, t.rangeKeyType = name, typ
+		}
+	}
+	if t.hashKey == "" {
+		return nil, validationError("One or more parameter values were invalid: Invalid KeySchema: Some index key attribute have no definition")
+	}
+
+	db.m.Lock()
+	defer db.m.Unlock()
+	if _, exists := db.tables[name]; exists {
+		return nil, newError(dynamodb.ErrCodeResourceInUseException, "Table already exists: %s", name)
+	}
+	billingMode := aws.StringValue(input.BillingMode)
+	if billingMode == "" {
+		billingMode = dynamodb.BillingModeProvisioned
+	}
+	t.description = &dynamodb.TableDescription{
+		TableName:            aws.String(name),
+		TableStatus:          aws.String(dynamodb.TableStatusActive),
+		AttributeDefinitions: input.AttributeDefinitions,
+		KeySchema:            input.KeySchema,
+		BillingModeSummary:   &dynamodb.BillingModeSummary{BillingMode: aws.String(billingMode)},
+	}
+	db.tables[name] = t
+	return &dynamodb.CreateTableOutput{TableDescription: t.description}, nil
+}
+
+// DescribeTable returns the description of a table.
+func (db *DB) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	if err := db.fault("DescribeTable", input); err != nil {
+		return nil, err
+	}
+	db.m.RLock()
+	defer db.m.RUnlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	for _, p := range t.partitions {
+		count += int64(len(p.items))
+	}
+	description := *t.description
+	description.ItemCount = aws.Int64(count)
+	return &dynamodb.DescribeTableOutput{Table: &description}, nil
+}
+
+// DeleteTable deletes a table and all of its items.
+func (db *DB) DeleteTable(input *dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	name := aws.StringValue(input.TableName)
+	if _, ok := db.tables[name]; !ok {
+		return nil, resourceNotFound()
+	}
+	delete(db.tables, name)
+	return &dynamodb.DeleteTableOutput{
+		TableDescription: &dynamodb.TableDescription{
+			TableName:   aws.String(name),
+			TableStatus: aws.String(dynamodb.TableStatusDeleting),
+		},
+	}, nil
+}
+
+func (db *DB) fault(operation string, input interface{}) error {
+	if db.Fault == nil {
+		return nil
+	}
+	return db.Fault(operation, input)
+}
+
+func (db *DB) table(name *string) (*table, error) {
+	t, ok := db.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, resourceNotFound()
+	}
+	return t, nil
+}
+
+func partitionID(v *dynamodb.AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return "S" + *v.S
+	case v.N != nil:
+		if n, err := parseNumber(*v.N); err == nil {
+			return "N" + n.RatString()
+		}
+		return "N" + *v.N
+	}
+	return "B" + string(v.B)
+}
+
+// checkKeyValue ensures that a key attribute value is present and has the type in the schema.
+func checkKeyValue(name, typ string, v *dynamodb.AttributeValue) error {
+	if v == nil {
+		return validationError("One or more parameter values were invalid: Missing the key %s in the item", name)
+	}
+	if attributeType(v) != typ {
+		return validationError("One or more parameter values were invalid: Type mismatch for key %s expected: %s actual: %s", name, typ, attributeType(v))
+	}
+	if (v.S != nil && *v.S == "") || (v.B != nil && len(v.B) == 0) {
+		return validationError("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty value. Key: %s", name)
+	}
+	return nil
+}
+
+// checkKey ensures that a key contains exactly the key attributes of the table.
+func (t *table) checkKey(key map[string]*dynamodb.AttributeValue) error {
+	expected := 1
+	if t.rangeKey != "" {
+		expected = 2
+	}
+	if len(key) != expected {
+		return validationError("The provided key element does not match the schema")
+	}
+	return t.checkItemKey(key)
+}
+
+func (t *table) checkItemKey(item map[string]*dynamodb.AttributeValue) error {
+	if err := checkKeyValue(t.hashKey, t.hashKeyType, item[t.hashKey]); err != nil {
+		return err
+	}
+	if t.rangeKey != "" {
+		return checkKeyValue(t.rangeKey, t.rangeKeyType, item[t.rangeKey])
+	}
+	return nil
+}
+
+func (t *table) compareRangeKey(a, b map[string]*dynamodb.AttributeValue) int {
+	if t.rangeKey == "" {
+		return 0
+	}
+	cmp, _ := compareValues(a[t.rangeKey], b[t.rangeKey])
+	return cmp
+}
+
+// find returns the partition holding the key, and the position that the key has, or
+// would have, within it.
+func (t *table) find(key map[string]*dynamodb.AttributeValue) (p *partition, index int, found bool) {
+	p = t.partitions[partitionID(key[t.hashKey])]
+	if p == nil {
+		return nil, 0, false
+	}
+	index = sort.Search(len(p.items), func(i int) bool {
+		return t.compareRangeKey(p.items[i], key) >= 0
+	})
+	found = index < len(p.items) && t.compareRangeKey(p.items[index], key) == 0
+	return
+}
+
+func (t *table) get(key map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	p, i, found := t.find(key)
+	if !found {
+		return nil
+	}
+	return p.items[i]
+}
+
+func (t *table) put(item map[string]*dynamodb.AttributeValue) {
+	p, i, found := t.find(item)
+	if p == nil {
+		p = &partition{}
+		t.partitions[partitionID(item[t.hashKey])] = p
+	}
+	if found {
+		p.items[i] = item
+		return
+	}
+	p.items = append(p.items, nil)
+	copy(p.items[i+1:], p.items[i:])
+	p.items[i] = item
+}
+
+func (t *table) delete(key map[string]*dynamodb.AttributeValue) {
+	p, i, found := t.find(key)
+	if !found {
+		return
+	}
+	p.items = append(p.items[:i], p.items[i+1:]...)
+	if len(p.items) == 0 {
+		delete(t.partitions, partitionID(key[t.hashKey]))
+	}
+}
+
+func (t *table) keyOf(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	rv := map[string]*dynamodb.AttributeValue{t.hashKey: copyValue(item[t.hashKey])}
+	if t.rangeKey != "" {
+		rv[t.rangeKey] = copyValue(item[t.rangeKey])
+	}
+	return rv
+}
+
+func projection(p *parser, expr *string) ([]string, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	if err := p.reset(*expr); err != nil {
+		return nil, err
+	}
+	var rv []string
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, string(path))
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+	return rv, p.expectEOF()
+}
+
+func project(item map[string]*dynamodb.AttributeValue, attributes []string) map[string]*dynamodb.AttributeValue {
+	if attributes == nil {
+		return copyItem(item)
+	}
+	rv := map[string]*dynamodb.AttributeValue{}
+	for _, a := range attributes {
+		if v, ok := item[a]; ok {
+			rv[a] = copyValue(v)
+		}
+	}
+	return rv
+}
+
+// GetItem returns a copy of the item with the given key, if it exists.
+func (db *DB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	if err := db.fault("GetItem", input); err != nil {
+		return nil, err
+	}
+	db.m.RLock()
+	defer db.m.RUnlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkKey(input.Key); err != nil {
+		return nil, err
+	}
+	p := newParser(input.ExpressionAttributeNames, nil)
+	attributes, err := projection(p, input.ProjectionExpression)
+	if err != nil {
+		return nil, wrapValidationError(err)
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, wrapValidationError(err)
+	}
+	rv := &dynamodb.GetItemOutput{}
+	c := capacity{}
+	item := t.get(input.Key)
+	if item != nil {
+		rv.Item = project(item, attributes)
+	}
+	c.read(*input.TableName, itemSize(item), input.ConsistentRead)
+	rv.ConsumedCapacity = c.consumedTable(input.ReturnConsumedCapacity)
+	return rv, nil
+}
+
+// keyCondition is a parsed key condition expression. The matching items of the
+// partition are those for which lower is true and upper is true, both of which are
+// monotonic over the sort key.
+type keyCondition struct {
+	partition    *dynamodb.AttributeValue
+	lower, upper func(sk *dynamodb.AttributeValue) bool
+}
+
+func (t *table) parseKeyCondition(p *parser, expr string) (*keyCondition, error) {
+	c, err := p.parseCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	conditions := []condition{c}
+	if and, ok := c.(andCondition); ok {
+		conditions = and
+	}
+	if len(conditions) > 2 {
+		return nil, fmt.Errorf("conditions can be of length 1 or 2 only")
+	}
+	kc := &keyCondition{
+		lower: func(*dynamodb.AttributeValue) bool { return true },
+		upper: func(*dynamodb.AttributeValue) bool { return true },
+	}
+	keyValue := func(o operand, name, typ string) (*dynamodb.AttributeValue, error) {
+		v, ok := o.(valueOperand)
+		if !ok {
+			return nil, fmt.Errorf("invalid KeyConditionExpression: the key condition must compare %s to a value", name)
+		}
+		if attributeType(v.v) != typ {
+			return nil, fmt.Errorf("one or more parameter values were invalid: Condition parameter type does not match schema type")
+		}
+		return v.v, nil
+	}
+	cmp := func(a, b *dynamodb.AttributeValue) int {
+		rv, _ := compareValues(a, b)
+		return rv
+	}
+	var hasRange bool
+	for _, c := range conditions {
+		switch c := c.(type) {
+		case comparisonCondition:
+			path, ok := c.left.(pathOperand)
+			if !ok {
+				return nil, fmt.Errorf("invalid KeyConditionExpression: the left side of a comparison must be a key attribute")
+			}
+			if string(path) == t.hashKey {
+				if c.op != "=" || kc.partition != nil {
+					return nil, fmt.Errorf("query key condition not supported")
+				}
+				if kc.partition, err = keyValue(c.right, t.hashKey, t.hashKeyType); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if string(path) != t.rangeKey || hasRange {
+				return nil, fmt.Errorf("query condition missed key schema element")
+			}
+			hasRange = true
+			v, err := keyValue(c.right, t.rangeKey, t.rangeKeyType)
+			if err != nil {
+				return nil, err
+			}
+			switch c.op {
+			case "=":
+				kc.lower = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, v) >= 0 }
+				kc.upper = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, v) <= 0 }
+			case "<":
+				kc.upper = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, v) < 0 }
+			case "<=":
+				kc.upper = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, v) <= 0 }
+			case ">":
+				kc.lower = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, v) > 0 }
+			case ">=":
+				kc.lower = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, v) >= 0 }
+			default:
+				return nil, fmt.Errorf("unsupported operator on KeyConditionExpression: operator: %s", c.op)
+			}
+		case betweenCondition:
+			if path, ok := c.v.(pathOperand); !ok || string(path) != t.rangeKey || hasRange {
+				return nil, fmt.Errorf("query condition missed key schema element")
+			}
+			hasRange = true
+			low, err := keyValue(c.low, t.rangeKey, t.rangeKeyType)
+			if err != nil {
+				return nil, err
+			}
+			high, err := keyValue(c.high, t.rangeKey, t.rangeKeyType)
+			if err != nil {
+				return nil, err
+			}
+			if cmp(low, high) > 0 {
+				return nil, fmt.Errorf("invalid KeyConditionExpression: the BETWEEN operator requires upper bound to be greater than or equal to lower bound")
+			}
+			kc.lower = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, low) >= 0 }
+			kc.upper = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, high) <= 0 }
+		case functionCondition:
+			if c.name != "begins_with" {
+				return nil, fmt.Errorf("invalid operator used in KeyConditionExpression: %s", c.name)
+			}
+			if path, ok := c.args[0].(pathOperand); !ok || string(path) != t.rangeKey || hasRange {
+				return nil, fmt.Errorf("query condition missed key schema element")
+			}
+			hasRange = true
+			prefix, err := keyValue(c.args[1], t.rangeKey, t.rangeKeyType)
+			if err != nil {
+				return nil, err
+			}
+			if prefix.N != nil {
+				return nil, fmt.Errorf("invalid KeyConditionExpression: incorrect operand type for operator or function; operator or function: begins_with, operand type: N")
+			}
+			begins := functionCondition{name: "begins_with", args: []operand{nil, valueOperand{v: prefix}}}
+			kc.lower = func(sk *dynamodb.AttributeValue) bool { return cmp(sk, prefix) >= 0 }
+			kc.upper = func(sk *dynamodb.AttributeValue) bool {
+				begins.args[0] = valueOperand{v: sk}
+				ok, _ := begins.eval(nil)
+				return ok || cmp(sk, prefix) < 0
+			}
+		default:
+			return nil, fmt.Errorf("invalid operator used in KeyConditionExpression")
+		}
+	}
+	if kc.partition == nil {
+		return nil, fmt.Errorf("query condition missed key schema element: %s", t.hashKey)
+	}
+	return kc, nil
+}
+
+// Query returns a page of the items in a partition that match the key condition and
+// filter expressions.
+func (db *DB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	if err := db.fault("Query", input); err != nil {
+		return nil, err
+	}
+	db.m.RLock()
+	defer db.m.RUnlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if input.IndexName != nil {
+		return nil, validationError("The table does not have the specified index: %s", *input.IndexName)
+	}
+	if input.KeyConditionExpression == nil {
+		return nil, validationError("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+	p := newParser(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	kc, err := t.parseKeyCondition(p, *input.KeyConditionExpression)
+	if err != nil {
+		return nil, wrapValidationError(err)
+	}
+	var filter condition
+	if input.FilterExpression != nil {
+		if filter, err = p.parseCondition(*input.FilterExpression); err != nil {
+			return nil, wrapValidationError(err)
+		}
+	}
+	attributes, err := projection(p, input.ProjectionExpression)
+	if err != nil {
+		return nil, wrapValidationError(err)
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, wrapValidationError(err)
+	}
+	limit := int(aws.Int64Value(input.Limit))
+	if input.Limit != nil && limit < 1 {
+		return nil, validationError("1 validation error detected: Value '%d' at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1", limit)
+	}
+	if db.MaxPageItems > 0 && (limit == 0 || db.MaxPageItems < limit) {
+		limit = db.MaxPageItems
+	}
+	forward := input.ScanIndexForward == nil || *input.ScanIndexForward
+
+	var items []map[string]*dynamodb.AttributeValue
+	if p := t.partitions[partitionID(kc.partition)]; p != nil {
+		items = p.items
+	}
+	lo := sort.Search(len(items), func(i int) bool { return kc.lower(items[i][t.rangeKey]) })
+	hi := sort.Search(len(items), func(i int) bool { return !kc.upper(items[i][t.rangeKey]) })
+	if input.ExclusiveStartKey != nil {
+		if err := t.checkKey(input.ExclusiveStartKey); err != nil {
+			return nil, validationError("The provided starting key is invalid: %s", err.Error())
+		}
+		if !equalValues(input.ExclusiveStartKey[t.hashKey], kc.partition) {
+			return nil, validationError("The provided starting key is invalid: The provided key element does not match the schema")
+		}
+		if forward {
+			start := sort.Search(len(items), func(i int) bool {
+				return t.compareRangeKey(items[i], input.ExclusiveStartKey) > 0
+			})
+			if start > lo {
+				lo = start
+			}
+		} else {
+			end := sort.Search(len(items), func(i int) bool {
+				return t.compareRangeKey(items[i], input.ExclusiveStartKey) >= 0
+			})
+			if end < hi {
+				hi = end
+			}
+		}
+	}
+
+	rv := &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{}}
+	var evaluated, size int
+	for n := 0; lo+n < hi; n++ {
+		i := lo + n
+		if !forward {
+			i = hi - 1 - n
+		}
+		item := items[i]
+		evaluated++
+		size += itemSize(item)
+		if filter != nil {
+			ok, err := filter.eval(item)
+			if err != nil {
+				return nil, wrapValidationError(err)
+			}
+			if !ok {
+				item = nil
+			}
+		}
+		if item != nil {
+			rv.Items = append(rv.Items, project(item, attributes))
+		}
+		if (limit > 0 && evaluated >= limit) || (db.MaxPageBytes > 0 && size >= db.MaxPageBytes) {
+			rv.LastEvaluatedKey = t.keyOf(items[i])
+			break
+		}
+	}
+	rv.Count = aws.Int64(int64(len(rv.Items)))
+	rv.ScannedCount = aws.Int64(int64(evaluated))
+	c := capacity{}
+	c.read(*input.TableName, size, input.ConsistentRead)
+	rv.ConsumedCapacity = c.consumedTable(input.ReturnConsumedCapacity)
+	if aws.StringValue(input.Select) == dynamodb.SelectCount {
+		rv.Items = nil
+	}
+	return rv, nil
+}
+
+// Scan returns a page of the items in a table that match the filter expression.
+// Partitions are scanned in the order of their keys, rather than of their hashes.
+func (db *DB) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	if err := db.fault("Scan", input); err != nil {
+		return nil, err
+	}
+	db.m.RLock()
+	defer db.m.RUnlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if input.IndexName != nil {
+		return nil, validationError("The table does not have the specified index: %s", *input.IndexName)
+	}
+	if input.Segment != nil || input.TotalSegments != nil {
+		return nil, validationError("Parallel scans are not supported")
+	}
+	p := newParser(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	var filter condition
+	if input.FilterExpression != nil {
+		if filter, err = p.parseCondition(*input.FilterExpression); err != nil {
+			return nil, wrapValidationError(err)
+		}
+	}
+	attributes, err := projection(p, input.ProjectionExpression)
+	if err != nil {
+		return nil, wrapValidationError(err)
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, wrapValidationError(err)
+	}
+	limit := int(aws.Int64Value(input.Limit))
+	if input.Limit != nil && limit < 1 {
+		return nil, validationError("1 validation error detected: Value '%d' at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1", limit)
+	}
+	if db.MaxPageItems > 0 && (limit == 0 || db.MaxPageItems < limit) {
+		limit = db.MaxPageItems
+	}
+
+	ids := make([]string, 0, len(t.partitions))
+	for id := range t.partitions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var startID string
+	if input.ExclusiveStartKey != nil {
+		if err := t.checkKey(input.ExclusiveStartKey); err != nil {
+			return nil, validationError("The provided starting key is invalid: %s", err.Error())
+		}
+		startID = partitionID(input.ExclusiveStartKey[t.hashKey])
+		ids = ids[sort.SearchStrings(ids, startID):]
+	}
+
+	rv := &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{}}
+	var evaluated, size int
+scan:
+	for _, id := range ids {
+		items := t.partitions[id].items
+		if input.ExclusiveStartKey != nil && id == startID {
+			items = items[sort.Search(len(items), func(i int) bool {
+				return t.rangeKey != "" && t.compareRangeKey(items[i], input.ExclusiveStartKey) > 0
+			}):]
+		}
+		for _, item := range items {
+			evaluated++
+			size += itemSize(item)
+			match := true
+			if filter != nil {
+				if match, err = filter.eval(item); err != nil {
+					return nil, wrapValidationError(err)
+				}
+			}
+			if match {
+				rv.Items = append(rv.Items, project(item, attributes))
+			}
+			if (limit > 0 && evaluated >= limit) || (db.MaxPageBytes > 0 && size >= db.MaxPageBytes) {
+				rv.LastEvaluatedKey = t.keyOf(item)
+				break scan
+			}
+		}
+	}
+	rv.Count = aws.Int64(int64(len(rv.Items)))
+	rv.ScannedCount = aws.Int64(int64(evaluated))
+	c := capacity{}
+	c.read(*input.TableName, size, input.ConsistentRead)
+	rv.ConsumedCapacity = c.consumedTable(input.ReturnConsumedCapacity)
+	if aws.StringValue(input.Select) == dynamodb.SelectCount {
+		rv.Items = nil
+	}
+	return rv, nil
+}
+
+// writeRequest is a parsed Put, Update, Delete or ConditionCheck.
+type writeRequest struct {
+	tableName string
+	t         *table
+	key       map[string]*dynamodb.AttributeValue
+	item      map[string]*dynamodb.AttributeValue
+	condition condition
+	update    []updateAction
+	delete    bool
+}
+
+func (db *DB) parseWrite(tableName *string, key, item map[string]*dynamodb.AttributeValue, conditionExpression, updateExpression *string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (*writeRequest, error) {
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	wr := &writeRequest{tableName: aws.StringValue(tableName), t: t, key: key, item: item}
+	if item != nil {
+		if err := t.checkItemKey(item); err != nil {
+			return nil, err
+		}
+		if size := itemSize(item); size > MaxItemBytes {
+			return nil, validationError("Item size has exceeded the maximum allowed size")
+		}
+		wr.key = t.keyOf(item)
+	} else if err := t.checkKey(key); err != nil {
+		return nil, err
+	}
+	p := newParser(names, values)
+	if conditionExpression != nil {
+		if wr.condition, err = p.parseCondition(*conditionExpression); err != nil {
+			return nil, wrapValidationError(err)
+		}
+	}
+	if updateExpression != nil {
+		if wr.update, err = p.parseUpdate(*updateExpression); err != nil {
+			return nil, wrapValidationError(err)
+		}
+		for _, ua := range wr.update {
+			if string(ua.path) == t.hashKey || string(ua.path) == t.rangeKey {
+				return nil, validationError("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", ua.path)
+			}
+		}
+	}
+	if err := p.checkUnused(); err != nil {
+		return nil, wrapValidationError(err)
+	}
+	return wr, nil
+}
+
+// check evaluates the condition against the current item.
+func (wr *writeRequest) check() (ok bool, err error) {
+	if wr.condition == nil {
+		return true, nil
+	}
+	existing := wr.t.get(wr.key)
+	if existing == nil {
+		existing = map[string]*dynamodb.AttributeValue{}
+	}
+	return wr.condition.eval(existing)
+}
+
+// next calculates the item that will be stored by the write, or nil if the item will be deleted.
+func (wr *writeRequest) next() (map[string]*dynamodb.AttributeValue, error) {
+	switch {
+	case wr.delete:
+		return nil, nil
+	case wr.update != nil:
+		item, err := applyUpdate(wr.t.get(wr.key), wr.update)
+		if err != nil {
+			return nil, wrapValidationError(err)
+		}
+		for k, v := range wr.key {
+			item[k] = copyValue(v)
+		}
+		if itemSize(item) > MaxItemBytes {
+			return nil, validationError("Item size to update has exceeded the maximum allowed size")
+		}
+		return item, nil
+	}
+	return copyItem(wr.item), nil
+}
+
+// size returns the size DynamoDB charges a write for, which is the larger of the
+// existing item and the item that replaces it.
+func (wr *writeRequest) size(item map[string]*dynamodb.AttributeValue) int {
+	size := itemSize(item)
+	if existing := itemSize(wr.t.get(wr.key)); existing > size {
+		size = existing
+	}
+	return size
+}
+
+func (wr *writeRequest) apply(item map[string]*dynamodb.AttributeValue) {
+	if item == nil {
+		wr.t.delete(wr.key)
+		return
+	}
+	wr.t.put(item)
+}
+
+func conditionalCheckFailed() error {
+	return newError(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+}
+
+func (db *DB) write(wr *writeRequest, err error) error {
+	if err != nil {
+		return err
+	}
+	ok, err := wr.check()
+	if err != nil {
+		return wrapValidationError(err)
+	}
+	if !ok {
+		return conditionalCheckFailed()
+	}
+	item, err := wr.next()
+	if err != nil {
+		return err
+	}
+	wr.apply(item)
+	return nil
+}
+
+// PutItem creates or replaces an item.
+func (db *DB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	if err := db.fault("PutItem", input); err != nil {
+		return nil, err
+	}
+	db.m.Lock()
+	defer db.m.Unlock()
+	err := db.write(db.parseWrite(input.TableName, nil, input.Item, input.ConditionExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues))
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// UpdateItem updates an item, creating it if it doesn't exist.
+func (db *DB) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	if err := db.fault("UpdateItem", input); err != nil {
+		return nil, err
+	}
+	db.m.Lock()
+	defer db.m.Unlock()
+	if input.UpdateExpression == nil {
+		return nil, validationError("UpdateExpression is required")
+	}
+	wr, err := db.parseWrite(input.TableName, input.Key, nil, input.ConditionExpression, input.UpdateExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err = db.write(wr, err); err != nil {
+		return nil, err
+	}
+	rv := &dynamodb.UpdateItemOutput{}
+	if aws.StringValue(input.ReturnValues) == dynamodb.ReturnValueAllNew {
+		rv.Attributes = copyItem(wr.t.get(wr.key))
+	}
+	return rv, nil
+}
+
+// DeleteItem deletes an item.
+func (db *DB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	if err := db.fault("DeleteItem", input); err != nil {
+		return nil, err
+	}
+	db.m.Lock()
+	defer db.m.Unlock()
+	wr, err := db.parseWrite(input.TableName, input.Key, nil, input.ConditionExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if wr != nil {
+		wr.delete = true
+	}
+	if err := db.write(wr, err); err != nil {
+		return nil, err
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// TransactWriteItems applies all of the actions, or none of them if any condition fails.
+func (db *DB) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := db.fault("TransactWriteItems", input); err != nil {
+		return nil, err
+	}
+	db.m.Lock()
+	defer db.m.Unlock()
+	if len(input.TransactItems) == 0 || len(input.TransactItems) > MaxTransactItems {
+		return nil, validationError("1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to %d and greater than or equal to 1", MaxTransactItems)
+	}
+	requests := make([]*writeRequest, len(input.TransactItems))
+	seen := map[string]bool{}
+	var size int
+	for i, ti := range input.TransactItems {
+		var wr *writeRequest
+		var err error
+		switch {
+		case ti.Put != nil:
+			wr, err = db.parseWrite(ti.Put.TableName, nil, ti.Put.Item, ti.Put.ConditionExpression, nil, ti.Put.ExpressionAttributeNames, ti.Put.ExpressionAttributeValues)
+			size += itemSize(ti.Put.Item)
+		case ti.Update != nil:
+			wr, err = db.parseWrite(ti.Update.TableName, ti.Update.Key, nil, ti.Update.ConditionExpression, ti.Update.UpdateExpression, ti.Update.ExpressionAttributeNames, ti.Update.ExpressionAttributeValues)
+			if err == nil && wr.update == nil {
+				err = validationError("UpdateExpression is required")
+			}
+		case ti.Delete != nil:
+			wr, err = db.parseWrite(ti.Delete.TableName, ti.Delete.Key, nil, ti.Delete.ConditionExpression, nil, ti.Delete.ExpressionAttributeNames, ti.Delete.ExpressionAttributeValues)
+			if wr != nil {
+				wr.delete = true
+			}
+		case ti.ConditionCheck != nil:
+			if ti.ConditionCheck.ConditionExpression == nil {
+				return nil, validationError("ConditionExpression is required")
+			}
+			wr, err = db.parseWrite(ti.ConditionCheck.TableName, ti.ConditionCheck.Key, nil, ti.ConditionCheck.ConditionExpression, nil, ti.ConditionCheck.ExpressionAttributeNames, ti.ConditionCheck.ExpressionAttributeValues)
+		default:
+			err = validationError("TransactItems can only contain one of Check, Put, Update or Delete")
+		}
+		if err != nil {
+			return nil, err
+		}
+		id := wr.tableName + "/" + partitionID(wr.key[wr.t.hashKey])
+		if wr.t.rangeKey != "" {
+			id += "/" + partitionID(wr.key[wr.t.rangeKey])
+		}
+		if seen[id] {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+		seen[id] = true
+		requests[i] = wr
+	}
+	if size > MaxTransactBytes {
+		return nil, validationError("Transaction request size exceeds the maximum allowed size of %d bytes", MaxTransactBytes)
+	}
+
+	// Check every condition, and calculate every new item, before applying any of them.
+	reasons := make([]*dynamodb.CancellationReason, len(requests))
+	items := make([]map[string]*dynamodb.AttributeValue, len(requests))
+	var cancelled bool
+	for i, wr := range requests {
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String("None")}
+		ok, err := wr.check()
+		if err == nil && !ok {
+			reasons[i] = &dynamodb.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: aws.String("The conditional request failed"),
+			}
+			cancelled = true
+			continue
+		}
+		if err == nil && input.TransactItems[i].ConditionCheck == nil {
+			items[i], err = wr.next()
+		}
+		if err != nil {
+			reasons[i] = &dynamodb.CancellationReason{
+				Code:    aws.String("ValidationError"),
+				Message: aws.String(err.Error()),
+			}
+			cancelled = true
+		}
+	}
+	if cancelled {
+		codes := make([]string, len(reasons))
+		for i, r := range reasons {
+			codes[i] = *r.Code
+		}
+		return nil, &dynamodb.TransactionCanceledException{
+			CancellationReasons: reasons,
+			Message_:            aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))),
+		}
+	}
+	c := capacity{}
+	for i, wr := range requests {
+		if input.TransactItems[i].ConditionCheck == nil {
+			c.transactWrite(wr.tableName, wr.size(items[i]))
+			wr.apply(items[i])
+		} else {
+			c.transactRead(wr.tableName, itemSize(wr.t.get(wr.key)))
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{
+		ConsumedCapacity: c.consumed(input.ReturnConsumedCapacity),
+	}, nil
+}
+
+// BatchWriteItem puts and deletes items. Unlike TransactWriteItems, the requests
+// aren't atomic, and some of them may be returned unprocessed.
+func (db *DB) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := db.fault("BatchWriteItem", input); err != nil {
+		return nil, err
+	}
+	db.m.Lock()
+	defer db.m.Unlock()
+	var count, size int
+	type request struct {
+		tableName string
+		wr        *writeRequest
+		original  *dynamodb.WriteRequest
+	}
+	var requests []request
+	seen := map[string]bool{}
+	for tableName, writeRequests := range input.RequestItems {
+		for _, r := range writeRequests {
+			var wr *writeRequest
+			var err error
+			switch {
+			case r.PutRequest != nil && r.DeleteRequest == nil:
+				wr, err = db.parseWrite(aws.String(tableName), nil, r.PutRequest.Item, nil, nil, nil, nil)
+				size += itemSize(r.PutRequest.Item)
+			case r.DeleteRequest != nil && r.PutRequest == nil:
+				wr, err = db.parseWrite(aws.String(tableName), r.DeleteRequest.Key, nil, nil, nil, nil, nil)
+				if wr != nil {
+					wr.delete = true
+				}
+			default:
+				err = validationError("Supplied AttributeValue has more than one datatypes set, must contain exactly one of the supported datatypes")
+			}
+			if err != nil {
+				return nil, err
+			}
+			id := tableName + "/" + partitionID(wr.key[wr.t.hashKey])
+			if wr.t.rangeKey != "" {
+				id += "/" + partitionID(wr.key[wr.t.rangeKey])
+			}
+			if seen[id] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+			seen[id] = true
+			requests = append(requests, request{tableName: tableName, wr: wr, original: r})
+			count++
+		}
+	}
+	if count == 0 || count > MaxBatchWriteItems {
+		return nil, validationError("1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Map value must satisfy constraint: [Member must have length less than or equal to %d, Member must have length greater than or equal to 1]", MaxBatchWriteItems)
+	}
+	if size > MaxBatchWriteBytes {
+		return nil, validationError("Item size has exceeded the maximum allowed size")
+	}
+	rv := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{}}
+	c := capacity{}
+	for i, r := range requests {
+		if db.BatchWriteItemLimit > 0 && i >= db.BatchWriteItemLimit {
+			rv.UnprocessedItems[r.tableName] = append(rv.UnprocessedItems[r.tableName], r.original)
+			continue
+		}
+		item, err := r.wr.next()
+		if err != nil {
+			return nil, err
+		}
+		c.write(r.tableName, r.wr.size(item))
+		r.wr.apply(item)
+	}
+	rv.ConsumedCapacity = c.consumed(input.ReturnConsumedCapacity)
+	return rv, nil
+}
+
+// BatchGetItem reads items by key. The items are returned in reverse order, because
+// DynamoDB doesn't return them in the order they were requested, and callers
+// shouldn't rely on it.
+func (db *DB) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	if err := db.fault("BatchGetItem", input); err != nil {
+		return nil, err
+	}
+	db.m.RLock()
+	defer db.m.RUnlock()
+	type request struct {
+		tableName  string
+		t          *table
+		key        map[string]*dynamodb.AttributeValue
+		attributes []string
+		ka         *dynamodb.KeysAndAttributes
+	}
+	var requests []request
+	for tableName, ka := range input.RequestItems {
+		t, err := db.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+		if ka == nil || len(ka.Keys) == 0 {
+			return nil, validationError("1 validation error detected: Value at 'requestItems.%s.member.keys' failed to satisfy constraint: Member must have length greater than or equal to 1", tableName)
+		}
+		p := newParser(ka.ExpressionAttributeNames, nil)
+		attributes, err := projection(p, ka.ProjectionExpression)
+		if err != nil {
+			return nil, wrapValidationError(err)
+		}
+		if err := p.checkUnused(); err != nil {
+			return nil, wrapValidationError(err)
+		}
+		seen := map[string]bool{}
+		for _, key := range ka.Keys {
+			if err := t.checkKey(key); err != nil {
+				return nil, err
+			}
+			id := partitionID(key[t.hashKey])
+			if t.rangeKey != "" {
+				id += "/" + partitionID(key[t.rangeKey])
+			}
+			if seen[id] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+			seen[id] = true
+			requests = append(requests, request{tableName: tableName, t: t, key: key, attributes: attributes, ka: ka})
+		}
+	}
+	if len(requests) == 0 || len(requests) > MaxBatchGetKeys {
+		return nil, validationError("Too many items requested for the BatchGetItem call")
+	}
+	rv := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}
+	var size int
+	c := capacity{}
+	for i, r := range requests {
+		if (db.BatchGetItemLimit > 0 && i >= db.BatchGetItemLimit) || size >= MaxBatchGetBytes {
+			unprocessed, ok := rv.UnprocessedKeys[r.tableName]
+			if !ok {
+				unprocessed = &dynamodb.KeysAndAttributes{
+					ConsistentRead:           r.ka.ConsistentRead,
+					ExpressionAttributeNames: r.ka.ExpressionAttributeNames,
+					ProjectionExpression:     r.ka.ProjectionExpression,
+				}
+				rv.UnprocessedKeys[r.tableName] = unprocessed
+			}
+			unprocessed.Keys = append(unprocessed.Keys, r.key)
+			continue
+		}
+		item := r.t.get(r.key)
+		c.read(r.tableName, itemSize(item), r.ka.ConsistentRead)
+		if item == nil {
+			continue
+		}
+		size += itemSize(item)
+		rv.Responses[r.tableName] = append([]map[string]*dynamodb.AttributeValue{project(item, r.attributes)}, rv.Responses[r.tableName]...)
+	}
+	rv.ConsumedCapacity = c.consumed(input.ReturnConsumedCapacity)
+	return rv, nil
+}
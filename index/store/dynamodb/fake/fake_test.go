@@ -0,0 +1,568 @@
+package fake
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func newTestDB(t *testing.T) *DB {
+	db := New()
+	_, err := db.CreateTable(&dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String("B")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("sk"), KeyType: aws.String("RANGE")},
+		},
+		TableName: aws.String("test"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func key(pk, sk string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"pk": {S: aws.String(pk)},
+		"sk": {B: []byte(sk)},
+	}
+}
+
+func put(t *testing.T, db *DB, pk string, sks ...string) {
+	for _, sk := range sks {
+		item := key(pk, sk)
+		item["v"] = &dynamodb.AttributeValue{S: aws.String("value-" + sk)}
+		_, err := db.PutItem(&dynamodb.PutItemInput{TableName: aws.String("test"), Item: item})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func sortKeys(items []map[string]*dynamodb.AttributeValue) []string {
+	rv := []string{}
+	for _, item := range items {
+		rv = append(rv, string(item["sk"].B))
+	}
+	return rv
+}
+
+func errorCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return fmt.Sprintf("%v", err)
+}
+
+func TestQueryKeyConditions(t *testing.T) {
+	db := newTestDB(t)
+	put(t, db, "a", "a", "ab", "abc", "b", "ba", "c")
+	put(t, db, "b", "a", "b")
+
+	tests := []struct {
+		expr     string
+		values   map[string]*dynamodb.AttributeValue
+		expected []string
+	}{
+		{
+			expr:     "pk = :pk",
+			expected: []string{"a", "ab", "abc", "b", "ba", "c"},
+		},
+		{
+			expr:     "pk = :pk AND sk = :v",
+			values:   map[string]*dynamodb.AttributeValue{":v": {B: []byte("b")}},
+			expected: []string{"b"},
+		},
+		{
+			expr:     "pk = :pk AND sk < :v",
+			values:   map[string]*dynamodb.AttributeValue{":v": {B: []byte("b")}},
+			expected: []string{"a", "ab", "abc"},
+		},
+		{
+			expr:     "pk = :pk AND sk <= :v",
+			values:   map[string]*dynamodb.AttributeValue{":v": {B: []byte("b")}},
+			expected: []string{"a", "ab", "abc", "b"},
+		},
+		{
+			expr:     "pk = :pk AND sk > :v",
+			values:   map[string]*dynamodb.AttributeValue{":v": {B: []byte("b")}},
+			expected: []string{"ba", "c"},
+		},
+		{
+			expr:     "pk = :pk AND sk >= :v",
+			values:   map[string]*dynamodb.AttributeValue{":v": {B: []byte("b")}},
+			expected: []string{"b", "ba", "c"},
+		},
+		{
+			expr:     "pk = :pk AND sk BETWEEN :s AND :e",
+			values:   map[string]*dynamodb.AttributeValue{":s": {B: []byte("ab")}, ":e": {B: []byte("b")}},
+			expected: []string{"ab", "abc", "b"},
+		},
+		{
+			expr:     "pk = :pk AND begins_with(sk, :v)",
+			values:   map[string]*dynamodb.AttributeValue{":v": {B: []byte("ab")}},
+			expected: []string{"ab", "abc"},
+		},
+	}
+	for _, test := range tests {
+		values := map[string]*dynamodb.AttributeValue{":pk": {S: aws.String("a")}}
+		for k, v := range test.values {
+			values[k] = v
+		}
+		for _, pageSize := range []int{0, 1, 2} {
+			db.MaxPageItems = pageSize
+			var actual []string
+			var startKey map[string]*dynamodb.AttributeValue
+			for {
+				qo, err := db.Query(&dynamodb.QueryInput{
+					TableName:                 aws.String("test"),
+					KeyConditionExpression:    aws.String(test.expr),
+					ExpressionAttributeValues: values,
+					ExclusiveStartKey:         startKey,
+				})
+				if err != nil {
+					t.Fatalf("%s: %v", test.expr, err)
+				}
+				actual = append(actual, sortKeys(qo.Items)...)
+				if qo.LastEvaluatedKey == nil {
+					break
+				}
+				startKey = qo.LastEvaluatedKey
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("%s with page size %d: expected %v, got %v", test.expr, pageSize, test.expected, actual)
+			}
+		}
+	}
+}
+
+func TestQueryBackwardsWithFilter(t *testing.T) {
+	db := newTestDB(t)
+	put(t, db, "a", "a", "b", "c", "d")
+	qo, err := db.Query(&dynamodb.QueryInput{
+		TableName:                aws.String("test"),
+		KeyConditionExpression:   aws.String("#pk = :pk"),
+		FilterExpression:         aws.String("NOT (#v = :b OR #v IN (:c))"),
+		ExpressionAttributeNames: map[string]*string{"#pk": aws.String("pk"), "#v": aws.String("v")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String("a")},
+			":b":  {S: aws.String("value-b")},
+			":c":  {S: aws.String("value-c")},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"d", "a"}, sortKeys(qo.Items); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if *qo.ScannedCount != 4 || *qo.Count != 2 {
+		t.Errorf("expected 4 scanned and 2 returned, got %d and %d", *qo.ScannedCount, *qo.Count)
+	}
+}
+
+func TestScanPaged(t *testing.T) {
+	db := newTestDB(t)
+	db.MaxPageItems = 2
+	put(t, db, "b", "a", "b", "c")
+	put(t, db, "a", "a", "b")
+	var scanned []string
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String("test"),
+		FilterExpression:         aws.String("#sk <> :b"),
+		ProjectionExpression:     aws.String("#pk, #sk"),
+		ExpressionAttributeNames: map[string]*string{"#pk": aws.String("pk"), "#sk": aws.String("sk")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":b": {B: []byte("b")},
+		},
+	}
+	for pages := 1; ; pages++ {
+		so, err := db.Scan(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range so.Items {
+			if item["v"] != nil {
+				t.Errorf("expected only the projected attributes, got %v", item)
+			}
+			scanned = append(scanned, *item["pk"].S+string(item["sk"].B))
+		}
+		if so.LastEvaluatedKey == nil {
+			break
+		}
+		if pages > 3 {
+			t.Fatal("expected the scan to end")
+		}
+		input.ExclusiveStartKey = so.LastEvaluatedKey
+	}
+	if expected := []string{"aa", "ba", "bc"}; !reflect.DeepEqual(expected, scanned) {
+		t.Errorf("expected %v, got %v", expected, scanned)
+	}
+}
+
+func TestDescribeTable(t *testing.T) {
+	db := newTestDB(t)
+	put(t, db, "a", "a", "b")
+	dto, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := aws.StringValue(dto.Table.TableStatus); status != dynamodb.TableStatusActive {
+		t.Errorf("expected the table to be active, got %s", status)
+	}
+	if mode := aws.StringValue(dto.Table.BillingModeSummary.BillingMode); mode != dynamodb.BillingModeProvisioned {
+		t.Errorf("expected provisioned billing, got %s", mode)
+	}
+	if count := aws.Int64Value(dto.Table.ItemCount); count != 2 {
+		t.Errorf("expected 2 items, got %d", count)
+	}
+	_, err = db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("missing")})
+	if code := errorCode(err); code != dynamodb.ErrCodeResourceNotFoundException {
+		t.Errorf("expected a missing table not to be found, got %s", code)
+	}
+}
+
+func TestQueryValidation(t *testing.T) {
+	db := newTestDB(t)
+	tests := []struct {
+		expr   string
+		names  map[string]*string
+		values map[string]*dynamodb.AttributeValue
+	}{
+		{expr: "sk = :v", values: map[string]*dynamodb.AttributeValue{":v": {B: []byte("a")}}},
+		{expr: "pk = :v", values: map[string]*dynamodb.AttributeValue{":v": {B: []byte("a")}}},
+		{expr: "pk = :v", values: map[string]*dynamodb.AttributeValue{":v": {S: aws.String("a")}, ":unused": {S: aws.String("a")}}},
+		{expr: "pk = :v", names: map[string]*string{"#unused": aws.String("a")}, values: map[string]*dynamodb.AttributeValue{":v": {S: aws.String("a")}}},
+		{expr: "pk = :missing"},
+		{expr: "pk = :v AND sk <> :v", values: map[string]*dynamodb.AttributeValue{":v": {S: aws.String("a")}}},
+		{expr: "pk = :v OR sk = :v", values: map[string]*dynamodb.AttributeValue{":v": {S: aws.String("a")}}},
+	}
+	for _, test := range tests {
+		_, err := db.Query(&dynamodb.QueryInput{
+			TableName:                 aws.String("test"),
+			KeyConditionExpression:    aws.String(test.expr),
+			ExpressionAttributeNames:  test.names,
+			ExpressionAttributeValues: test.values,
+		})
+		if errorCode(err) != "ValidationException" {
+			t.Errorf("%s: expected a validation error, got %v", test.expr, err)
+		}
+	}
+	_, err := db.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("missing"),
+		KeyConditionExpression: aws.String("pk = :pk"),
+	})
+	if errorCode(err) != dynamodb.ErrCodeResourceNotFoundException {
+		t.Errorf("expected resource not found, got %v", err)
+	}
+}
+
+func TestGetItemReturnsCopy(t *testing.T) {
+	db := newTestDB(t)
+	put(t, db, "a", "a")
+	gio, err := db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("test"), Key: key("a", "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	*gio.Item["v"].S = "changed"
+	gio, err = db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("test"), Key: key("a", "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gio.Item["v"].S != "value-a" {
+		t.Errorf("expected the stored item to be unchanged, got %q", *gio.Item["v"].S)
+	}
+	gio, err = db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("test"), Key: key("a", "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gio.Item != nil {
+		t.Errorf("expected no item, got %v", gio.Item)
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	db := newTestDB(t)
+	update := func(expr string, values map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+		uo, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:                 aws.String("test"),
+			Key:                       key("a", "a"),
+			UpdateExpression:          aws.String(expr),
+			ExpressionAttributeValues: values,
+			ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return uo.Attributes, nil
+	}
+	n := func(s string) *dynamodb.AttributeValue {
+		return &dynamodb.AttributeValue{N: aws.String(s)}
+	}
+
+	item, err := update("ADD c :n SET s = :s", map[string]*dynamodb.AttributeValue{":n": n("5"), ":s": {S: aws.String("x")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *item["c"].N != "5" || *item["s"].S != "x" {
+		t.Errorf("unexpected item %v", item)
+	}
+	item, err = update("ADD c :n", map[string]*dynamodb.AttributeValue{":n": n("-7")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *item["c"].N != "-2" {
+		t.Errorf("expected -2, got %s", *item["c"].N)
+	}
+	item, err = update("SET c = c + :n, d = if_not_exists(d, :n) REMOVE s", map[string]*dynamodb.AttributeValue{":n": n("1.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *item["c"].N != "-0.5" || *item["d"].N != "1.5" || item["s"] != nil {
+		t.Errorf("unexpected item %v", item)
+	}
+	_, err = update("SET sk = :n", map[string]*dynamodb.AttributeValue{":n": n("1")})
+	if errorCode(err) != "ValidationException" {
+		t.Errorf("expected a validation error when updating a key attribute, got %v", err)
+	}
+	_, err = update("ADD s :s", map[string]*dynamodb.AttributeValue{":s": {S: aws.String("x")}})
+	if errorCode(err) != "ValidationException" {
+		t.Errorf("expected a validation error when adding a string, got %v", err)
+	}
+}
+
+func TestConditionExpressions(t *testing.T) {
+	db := newTestDB(t)
+	putIf := func(sk, condition string, values map[string]*dynamodb.AttributeValue) error {
+		item := key("a", sk)
+		item["v"] = &dynamodb.AttributeValue{N: aws.String("1")}
+		_, err := db.PutItem(&dynamodb.PutItemInput{
+			TableName:                 aws.String("test"),
+			Item:                      item,
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
+		})
+		return err
+	}
+	if err := putIf("a", "attribute_not_exists(sk)", nil); err != nil {
+		t.Fatal(err)
+	}
+	err := putIf("a", "attribute_not_exists(sk)", nil)
+	if errorCode(err) != dynamodb.ErrCodeConditionalCheckFailedException {
+		t.Errorf("expected conditional check failure, got %v", err)
+	}
+	one := map[string]*dynamodb.AttributeValue{":one": {N: aws.String("1.0")}}
+	if err := putIf("a", "v = :one AND size(sk) = :one", one); err != nil {
+		t.Errorf("expected condition to pass, got %v", err)
+	}
+	if err := putIf("a", "attribute_type(v, :n) AND v BETWEEN :zero AND :one", map[string]*dynamodb.AttributeValue{
+		":n":    {S: aws.String("N")},
+		":zero": {N: aws.String("0")},
+		":one":  {N: aws.String("1")},
+	}); err != nil {
+		t.Errorf("expected condition to pass, got %v", err)
+	}
+	err = putIf("a", "v > :one", one)
+	if errorCode(err) != dynamodb.ErrCodeConditionalCheckFailedException {
+		t.Errorf("expected conditional check failure, got %v", err)
+	}
+}
+
+func TestTransactWriteItems(t *testing.T) {
+	db := newTestDB(t)
+	put(t, db, "a", "a", "b")
+
+	putItem := func(sk string) *dynamodb.TransactWriteItem {
+		item := key("a", sk)
+		item["v"] = &dynamodb.AttributeValue{S: aws.String("new")}
+		return &dynamodb.TransactWriteItem{Put: &dynamodb.Put{TableName: aws.String("test"), Item: item}}
+	}
+	deleteItem := func(sk string) *dynamodb.TransactWriteItem {
+		return &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{TableName: aws.String("test"), Key: key("a", sk)}}
+	}
+	check := func(sk, condition string) *dynamodb.TransactWriteItem {
+		return &dynamodb.TransactWriteItem{ConditionCheck: &dynamodb.ConditionCheck{
+			TableName:           aws.String("test"),
+			Key:                 key("a", sk),
+			ConditionExpression: aws.String(condition),
+		}}
+	}
+	items := func() []string {
+		qo, err := db.Query(&dynamodb.QueryInput{
+			TableName:                 aws.String("test"),
+			KeyConditionExpression:    aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":pk": {S: aws.String("a")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sortKeys(qo.Items)
+	}
+
+	// A failed condition cancels the whole transaction.
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{putItem("c"), deleteItem("a"), check("z", "attribute_exists(sk)")},
+	})
+	tce, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		t.Fatalf("expected the transaction to be cancelled, got %v", err)
+	}
+	if len(tce.CancellationReasons) != 3 || *tce.CancellationReasons[0].Code != "None" || *tce.CancellationReasons[2].Code != "ConditionalCheckFailed" {
+		t.Errorf("unexpected cancellation reasons %v", tce.CancellationReasons)
+	}
+	if expected, actual := []string{"a", "b"}, items(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{putItem("c"), deleteItem("a"), check("b", "attribute_exists(sk)")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"b", "c"}, items(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// DynamoDB rejects transactions that touch an item more than once, or are too large.
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{putItem("d"), deleteItem("d")},
+	})
+	if errorCode(err) != "ValidationException" {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+	var tooMany []*dynamodb.TransactWriteItem
+	for i := 0; i <= MaxTransactItems; i++ {
+		tooMany = append(tooMany, putItem(fmt.Sprintf("item%d", i)))
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: tooMany})
+	if errorCode(err) != "ValidationException" {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
+
+func TestBatchWriteItem(t *testing.T) {
+	db := newTestDB(t)
+	put(t, db, "a", "a")
+	db.BatchWriteItemLimit = 2
+	requests := []*dynamodb.WriteRequest{
+		{DeleteRequest: &dynamodb.DeleteRequest{Key: key("a", "a")}},
+	}
+	for _, sk := range []string{"b", "c", "d"} {
+		requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: key("a", sk)}})
+	}
+	bwo, err := db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{"test": requests},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unprocessed := bwo.UnprocessedItems["test"]; len(unprocessed) != 2 || unprocessed[0] != requests[2] {
+		t.Errorf("expected the last two requests to be unprocessed, got %v", unprocessed)
+	}
+	qo, err := db.Query(&dynamodb.QueryInput{
+		TableName:                 aws.String("test"),
+		KeyConditionExpression:    aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":pk": {S: aws.String("a")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"b"}, sortKeys(qo.Items); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	_, err = db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{"test": {requests[1], requests[1]}},
+	})
+	if errorCode(err) != "ValidationException" {
+		t.Errorf("expected duplicate keys to be rejected, got %v", err)
+	}
+}
+
+func TestConsumedCapacity(t *testing.T) {
+	db := newTestDB(t)
+	put(t, db, "p", "a", "b")
+
+	gio, err := db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("test"), Key: key("p", "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gio.ConsumedCapacity != nil {
+		t.Errorf("expected no consumed capacity unless it's requested, got %v", gio.ConsumedCapacity)
+	}
+	gio, err = db.GetItem(&dynamodb.GetItemInput{
+		TableName:              aws.String("test"),
+		Key:                    key("p", "a"),
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if units := aws.Float64Value(gio.ConsumedCapacity.CapacityUnits); units != 0.5 {
+		t.Errorf("expected an eventually consistent read to consume 0.5 units, got %v", units)
+	}
+
+	large := key("p", "c")
+	large["v"] = &dynamodb.AttributeValue{B: make([]byte, 2500)}
+	small := func(sk string) map[string]*dynamodb.AttributeValue {
+		item := key("p", sk)
+		item["v"] = &dynamodb.AttributeValue{S: aws.String("v")}
+		return item
+	}
+	tio, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: &dynamodb.Put{TableName: aws.String("test"), Item: large}},
+			{Put: &dynamodb.Put{TableName: aws.String("test"), Item: small("d")}},
+		},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tio.ConsumedCapacity) != 1 || aws.Float64Value(tio.ConsumedCapacity[0].CapacityUnits) != 8 {
+		t.Errorf("expected a transaction writing 3KB and 1KB to consume 8 units, got %v", tio.ConsumedCapacity)
+	}
+
+	bwo, err := db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{
+			"test": {
+				{PutRequest: &dynamodb.PutRequest{Item: small("e")}},
+				{PutRequest: &dynamodb.PutRequest{Item: small("f")}},
+				{DeleteRequest: &dynamodb.DeleteRequest{Key: key("p", "c")}},
+			},
+		},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bwo.ConsumedCapacity) != 1 || aws.Float64Value(bwo.ConsumedCapacity[0].CapacityUnits) != 5 {
+		t.Errorf("expected the batch to consume 5 units, got %v", bwo.ConsumedCapacity)
+	}
+
+	qo, err := db.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("test"),
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String("p")},
+		},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if units := aws.Float64Value(qo.ConsumedCapacity.CapacityUnits); units != 1 {
+		t.Errorf("expected a small consistent query to consume 1 unit, got %v", units)
+	}
+}
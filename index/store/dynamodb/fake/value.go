@@ -0,0 +1,198 @@
+package fake
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// attributeType returns the DynamoDB type descriptor of the value, e.g. "S", "N" or "B".
+func attributeType(v *dynamodb.AttributeValue) string {
+	switch {
+	case v == nil:
+		return ""
+	case v.S != nil:
+		return dynamodb.ScalarAttributeTypeS
+	case v.N != nil:
+		return dynamodb.ScalarAttributeTypeN
+	case v.B != nil:
+		return dynamodb.ScalarAttributeTypeB
+	case v.BOOL != nil:
+		return "BOOL"
+	case v.NULL != nil:
+		return "NULL"
+	case v.SS != nil:
+		return "SS"
+	case v.NS != nil:
+		return "NS"
+	case v.BS != nil:
+		return "BS"
+	case v.L != nil:
+		return "L"
+	case v.M != nil:
+		return "M"
+	}
+	return ""
+}
+
+func parseNumber(n string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", n)
+	}
+	return r, nil
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := r.FloatString(38)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// compareValues compares two scalar values of the same type. ok is false when the
+// values can't be compared, which makes any comparison that uses them false.
+func compareValues(a, b *dynamodb.AttributeValue) (cmp int, ok bool) {
+	at := attributeType(a)
+	if at == "" || at != attributeType(b) {
+		return 0, false
+	}
+	switch at {
+	case dynamodb.ScalarAttributeTypeS:
+		return strings.Compare(*a.S, *b.S), true
+	case dynamodb.ScalarAttributeTypeB:
+		return bytes.Compare(a.B, b.B), true
+	case dynamodb.ScalarAttributeTypeN:
+		an, err := parseNumber(*a.N)
+		if err != nil {
+			return 0, false
+		}
+		bn, err := parseNumber(*b.N)
+		if err != nil {
+			return 0, false
+		}
+		return an.Cmp(bn), true
+	}
+	return 0, false
+}
+
+// equalValues compares values of any type for equality.
+func equalValues(a, b *dynamodb.AttributeValue) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	if attributeType(a) == "" || attributeType(a) != attributeType(b) {
+		return false
+	}
+	// Fall back to the string representation for the set and document types.
+	return a.String() == b.String()
+}
+
+func copyValue(v *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if v == nil {
+		return nil
+	}
+	rv := &dynamodb.AttributeValue{}
+	if v.S != nil {
+		rv.S = aws.String(*v.S)
+	}
+	if v.N != nil {
+		rv.N = aws.String(*v.N)
+	}
+	if v.B != nil {
+		rv.B = append([]byte{}, v.B...)
+	}
+	if v.BOOL != nil {
+		rv.BOOL = aws.Bool(*v.BOOL)
+	}
+	if v.NULL != nil {
+		rv.NULL = aws.Bool(*v.NULL)
+	}
+	if v.SS != nil {
+		rv.SS = make([]*string, len(v.SS))
+		for i, s := range v.SS {
+			rv.SS[i] = aws.String(*s)
+		}
+	}
+	if v.NS != nil {
+		rv.NS = make([]*string, len(v.NS))
+		for i, s := range v.NS {
+			rv.NS[i] = aws.String(*s)
+		}
+	}
+	if v.BS != nil {
+		rv.BS = make([][]byte, len(v.BS))
+		for i, b := range v.BS {
+			rv.BS[i] = append([]byte{}, b...)
+		}
+	}
+	if v.L != nil {
+		rv.L = make([]*dynamodb.AttributeValue, len(v.L))
+		for i, lv := range v.L {
+			rv.L[i] = copyValue(lv)
+		}
+	}
+	if v.M != nil {
+		rv.M = copyItem(v.M)
+	}
+	return rv
+}
+
+func copyItem(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	rv := make(map[string]*dynamodb.AttributeValue, len(item))
+	for k, v := range item {
+		rv[k] = copyValue(v)
+	}
+	return rv
+}
+
+// valueSize approximates the size DynamoDB uses for capacity and limit calculations.
+func valueSize(v *dynamodb.AttributeValue) int {
+	if v == nil {
+		return 0
+	}
+	switch {
+	case v.S != nil:
+		return len(*v.S)
+	case v.N != nil:
+		return (len(*v.N)+1)/2 + 1
+	case v.B != nil:
+		return len(v.B)
+	case v.BOOL != nil, v.NULL != nil:
+		return 1
+	}
+	size := 3
+	for _, s := range v.SS {
+		size += len(*s)
+	}
+	for _, s := range v.NS {
+		size += (len(*s)+1)/2 + 1
+	}
+	for _, b := range v.BS {
+		size += len(b)
+	}
+	for _, lv := range v.L {
+		size += valueSize(lv) + 1
+	}
+	for k, mv := range v.M {
+		size += len(k) + valueSize(mv) + 1
+	}
+	return size
+}
+
+func itemSize(item map[string]*dynamodb.AttributeValue) int {
+	var size int
+	for k, v := range item {
+		size += len(k) + valueSize(v)
+	}
+	return size
+}
@@ -1,6 +1,8 @@
 package dynamodb
 
 import (
+	"bytes"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
@@ -10,10 +12,12 @@ func isKeyNullOrEmpty(lastEvaluatedKey map[string]*dynamodb.AttributeValue) bool
 }
 
 type PrefixIterator struct {
-	store  *Store
-	prefix []byte
-	err    error
-	valid  bool
+	store     *Store
+	partition string
+	prefix    []byte
+	seek      []byte
+	err       error
+	valid     bool
 
 	lastEvaluatedKey map[string]*dynamodb.AttributeValue
 	index            int
@@ -24,50 +28,69 @@ type PrefixIterator struct {
 }
 
 func (i *PrefixIterator) Seek(k []byte) {
-	qi := &dynamodb.QueryInput{
-		TableName:              &i.store.tableName,
-		ConsistentRead:         aws.Bool(true),
-		KeyConditionExpression: aws.String("#pk = :pk AND begins_with(#sk, :prefix)"),
-		ExpressionAttributeNames: map[string]*string{
-			"#pk": aws.String("pk"),
-			"#sk": aws.String("sk"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":pk":     partitionKeyAttributeValue(i.store.partition),
-			":prefix": {B: i.prefix},
-		},
-		ExclusiveStartKey: i.lastEvaluatedKey,
-	}
-	if k != nil {
-		qi.KeyConditionExpression = aws.String("#pk = :pk AND #sk >= :k")
-		qi.ExpressionAttributeNames["#k"] = aws.String("k")
-		qi.ExpressionAttributeValues[":k"] = &dynamodb.AttributeValue{B: k}
-		qi.FilterExpression = aws.String("begins_with(#k, :prefix)")
-	}
-	qo, err := i.store.db.Query(qi)
-	if err != nil {
-		i.err = err
-		i.valid = false
+	if i.err != nil {
+		// The iterator stays invalid once it has failed.
 		return
 	}
-	i.lastEvaluatedKey = qo.LastEvaluatedKey
-	i.items = qo.Items
-	i.index = 0
-	i.valid = len(qo.Items) > 0
-	if i.valid {
-		item := i.items[i.index]
-		i.key = item["sk"].B
-		i.val, _ = recordToValue(item)
-		i.index++
+	// We're starting a new set of results, so wipe out the paging.
+	i.lastEvaluatedKey = nil
+	i.seek = nil
+	if k != nil && bytes.Compare(k, i.prefix) > 0 {
+		i.seek = k
+	}
+	i.query()
+}
+
+// query reads the next page of results, skipping pages that the filter expression
+// left empty.
+func (i *PrefixIterator) query() {
+	for {
+		qi := &dynamodb.QueryInput{
+			TableName:              &i.store.tableName,
+			ConsistentRead:         aws.Bool(i.store.consistentRead),
+			KeyConditionExpression: aws.String("#pk = :pk AND begins_with(#sk, :prefix)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#pk": aws.String("pk"),
+				"#sk": aws.String("sk"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":pk":     partitionKeyAttributeValue(i.partition),
+				":prefix": {B: i.prefix},
+			},
+			ExclusiveStartKey: i.lastEvaluatedKey,
+		}
+		if i.seek != nil {
+			qi.KeyConditionExpression = aws.String("#pk = :pk AND #sk >= :k")
+			qi.ExpressionAttributeNames["#k"] = aws.String("k")
+			qi.ExpressionAttributeValues[":k"] = &dynamodb.AttributeValue{B: i.seek}
+			qi.FilterExpression = aws.String("begins_with(#k, :prefix)")
+		}
+		i.store.s.iteratorPage()
+		qo, err := i.store.db.Query(qi)
+		if err != nil {
+			i.err = err
+			i.valid = false
+			return
+		}
+		i.lastEvaluatedKey = qo.LastEvaluatedKey
+		i.items = qo.Items
+		i.index = 0
+		if len(qo.Items) > 0 || isKeyNullOrEmpty(i.lastEvaluatedKey) {
+			break
+		}
 	}
+	i.Next()
 }
 
 func (i *PrefixIterator) Next() {
+	if i.err != nil {
+		return
+	}
 	// There's no more items in the current page.
 	if i.index > len(i.items)-1 {
 		// Grab another page if there is one.
 		if !isKeyNullOrEmpty(i.lastEvaluatedKey) {
-			i.Seek(nil)
+			i.query()
 			return
 		}
 		// If there isn't, we're finished.
@@ -75,10 +98,16 @@ func (i *PrefixIterator) Next() {
 		return
 	}
 	item := i.items[i.index]
+	val, err := recordToValue(item)
+	if err != nil {
+		i.err = err
+		i.valid = false
+		return
+	}
 	i.key = item["sk"].B
-	i.val, _ = recordToValue(item)
-	//TODO: Handle the error.
+	i.val = val
 	i.index++
+	i.valid = true
 }
 
 func (i *PrefixIterator) Current() ([]byte, []byte, bool) {
@@ -97,6 +126,11 @@ func (i *PrefixIterator) Valid() bool {
 	return i.valid
 }
 
+// Err returns the error that made the iterator invalid, if any.
+func (i *PrefixIterator) Err() error {
+	return i.err
+}
+
 func (i *PrefixIterator) Close() error {
 	return i.err
 }
@@ -0,0 +1,64 @@
+package dynamodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blevesearch/bleve/index/store"
+)
+
+func TestDynamoDBIteratorError(t *testing.T) {
+	s, db := openFake(t, nil)
+	db.MaxPageItems = 1
+	writeLargeBatch(t, s, 10)
+
+	queryErr := errors.New("query failed")
+	for _, name := range []string{"prefix", "range"} {
+		reader, err := s.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Fault = nil
+		var it store.KVIterator
+		if name == "prefix" {
+			it = reader.PrefixIterator([]byte("k"))
+		} else {
+			it = reader.RangeIterator([]byte("k"), nil)
+		}
+		if _, _, valid := it.Current(); !valid {
+			t.Fatalf("%s: expected the first item to be read", name)
+		}
+		if err := store.IteratorErr(it); err != nil {
+			t.Errorf("%s: expected no error yet, got %v", name, err)
+		}
+
+		// The next page fails, which ends the iteration with an error rather than
+		// at the end of the range.
+		db.Fault = func(operation string, input interface{}) error {
+			if operation == "Query" {
+				return queryErr
+			}
+			return nil
+		}
+		it.Next()
+		if _, _, valid := it.Current(); valid {
+			t.Errorf("%s: expected the iterator to be invalid", name)
+		}
+		if err := store.IteratorErr(it); err != queryErr {
+			t.Errorf("%s: expected the query error, got %v", name, err)
+		}
+
+		// The error sticks, even once queries succeed again.
+		db.Fault = nil
+		it.Seek([]byte("k0005"))
+		if _, _, valid := it.Current(); valid {
+			t.Errorf("%s: expected the iterator to stay invalid after seeking", name)
+		}
+		if err := it.Close(); err != queryErr {
+			t.Errorf("%s: expected Close to return the query error, got %v", name, err)
+		}
+		if err := reader.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package dynamodb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// mergeOp is a merge into the stored value of a key. The item is read, the operands
+// are merged into its value with the MergeOperator, and the result is written back
+// on condition that the item hasn't changed since it was read. If it has, the
+// item is read and merged again.
+type mergeOp struct {
+	key      []byte
+	operands [][]byte
+	// item is the conditional put of the merged value, which is rebuilt in place
+	// whenever the item is read again.
+	item *dynamodb.TransactWriteItem
+}
+
+func (bs *Store) fullMerge(key, existingVal []byte, operands [][]byte) ([]byte, error) {
+	if bs.mo == nil {
+		return nil, fmt.Errorf("dynamodb store, merge into %q without a merge operator", key)
+	}
+	mergedVal, fullMergeOk := bs.mo.FullMerge(key, existingVal, operands)
+	if !fullMergeOk {
+		return nil, fmt.Errorf("merge operator returned failure")
+	}
+	return mergedVal, nil
+}
+
+// resolveMerge merges the op's operands into the existing item, which is nil if
+// there isn't one, and sets op.item to a put of the result that's conditional on
+// the item's revision.
+func (bs *Store) resolveMerge(op *mergeOp, existing map[string]*dynamodb.AttributeValue) error {
+	var existingVal []byte
+	condition := "attribute_not_exists(#sk)"
+	names := map[string]*string{"#sk": aws.String("sk")}
+	var values map[string]*dynamodb.AttributeValue
+	if existing != nil {
+		var err error
+		existingVal, err = recordToValue(existing)
+		if err != nil {
+			return err
+		}
+		names["#rev"] = aws.String("rev")
+		if rev := existing["rev"]; rev != nil {
+			condition = "#rev = :rev"
+			delete(names, "#sk")
+			values = map[string]*dynamodb.AttributeValue{":rev": rev}
+		} else {
+			condition = "attribute_exists(#sk) AND attribute_not_exists(#rev)"
+		}
+	}
+	mergedVal, err := bs.fullMerge(op.key, existingVal, op.operands)
+	if err != nil {
+		return err
+	}
+	put := newPut(bs.tableName, bs.sharding.partitionKey(op.key), op.key, mergedVal)
+	put.ConditionExpression = aws.String(condition)
+	put.ExpressionAttributeNames = names
+	put.ExpressionAttributeValues = values
+	op.item.Put = put
+	return nil
+}
+
+// readMerges reads the items the merges apply to, and resolves each merge.
+func (bs *Store) readMerges(ops []*mergeOp) error {
+	keys := make([][]byte, len(ops))
+	for i, op := range ops {
+		keys[i] = op.key
+	}
+	var m sync.Mutex
+	existing := map[string]map[string]*dynamodb.AttributeValue{}
+	// The items are always read consistently, to avoid conflicts with recent writes.
+	err := bs.getItems(keys, true, func(item map[string]*dynamodb.AttributeValue) error {
+		m.Lock()
+		defer m.Unlock()
+		existing[string(item["sk"].B)] = item
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if err := bs.resolveMerge(op, existing[string(op.key)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBatch applies the batch's merges and writes it. Merges into a key that the
+// batch also sets or deletes are applied to the batch's value, the rest are applied
+// to the stored value.
+func (bs *Store) writeBatch(batch *DynamoDBBatch) error {
+	items := make(map[string]*dynamodb.TransactWriteItem, len(batch.tx)+len(batch.merge.Merges))
+	for k, item := range batch.tx {
+		items[k] = item
+	}
+	merges := map[*dynamodb.TransactWriteItem]*mergeOp{}
+	var ops []*mergeOp
+	for k, operands := range batch.merge.Merges {
+		key := []byte(k)
+		if item, ok := items[k]; ok {
+			var val []byte
+			if item.Put != nil {
+				val = item.Put.Item["v"].B
+			}
+			mergedVal, err := bs.fullMerge(key, val, operands)
+			if err != nil {
+				return err
+			}
+			items[k] = &dynamodb.TransactWriteItem{Put: newPut(bs.tableName, bs.sharding.partitionKey(key), key, mergedVal)}
+			continue
+		}
+		op := &mergeOp{key: key, operands: operands, item: &dynamodb.TransactWriteItem{}}
+		items[k] = op.item
+		merges[op.item] = op
+		ops = append(ops, op)
+	}
+	if len(ops) > 0 {
+		if err := bs.readMerges(ops); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sorted := make([]*dynamodb.TransactWriteItem, len(keys))
+	for i, k := range keys {
+		sorted[i] = items[k]
+	}
+	return bs.writeItems(sorted, merges)
+}
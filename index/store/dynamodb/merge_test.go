@@ -0,0 +1,204 @@
+package dynamodb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/index/store/dynamodb/fake"
+)
+
+// appendMerge is a merge operator that appends the operands to the value, which
+// can't be expressed as an update in DynamoDB.
+type appendMerge struct{}
+
+func (m *appendMerge) FullMerge(key, existingValue []byte, operands [][]byte) ([]byte, bool) {
+	rv := append([]byte{}, existingValue...)
+	for _, operand := range operands {
+		if bytes.Equal(operand, []byte("fail")) {
+			return nil, false
+		}
+		rv = append(rv, operand...)
+	}
+	return rv, true
+}
+
+func (m *appendMerge) PartialMerge(key, leftOperand, rightOperand []byte) ([]byte, bool) {
+	return nil, false
+}
+
+func (m *appendMerge) Name() string {
+	return "append"
+}
+
+// openAppend opens a store using the appendMerge operator on the fake.
+func openAppend(t *testing.T, db *fake.DB) store.KVStore {
+	rv, err := New(&appendMerge{}, map[string]interface{}{"tableName": "fake", "db": db, "batchRetryDelay": "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+func execute(t *testing.T, s store.KVStore, ops func(batch store.KVBatch)) error {
+	writer, err := s.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	batch := writer.NewBatch()
+	ops(batch)
+	return writer.ExecuteBatch(batch)
+}
+
+func checkValue(t *testing.T, s store.KVStore, key string, expected []byte) {
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	val, err := reader.Get([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, expected) {
+		t.Errorf("expected %s to be %q, got %q", key, expected, val)
+	}
+}
+
+func TestDynamoDBMergeOperator(t *testing.T) {
+	_, db := openFake(t, nil)
+	s := openAppend(t, db)
+	err := execute(t, s, func(batch store.KVBatch) {
+		batch.Merge([]byte("a"), []byte("1"))
+		batch.Merge([]byte("a"), []byte("2"))
+		// Merges into a value set earlier in the batch apply to that value.
+		batch.Set([]byte("b"), []byte("x"))
+		batch.Merge([]byte("b"), []byte("3"))
+		// A value set later in the batch replaces the merges.
+		batch.Merge([]byte("c"), []byte("4"))
+		batch.Set([]byte("c"), []byte("y"))
+		batch.Delete([]byte("d"))
+		batch.Merge([]byte("d"), []byte("5"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValue(t, s, "a", []byte("12"))
+	checkValue(t, s, "b", []byte("x3"))
+	checkValue(t, s, "c", []byte("y"))
+	checkValue(t, s, "d", []byte("5"))
+
+	err = execute(t, s, func(batch store.KVBatch) {
+		batch.Merge([]byte("a"), []byte("3"))
+		batch.Merge([]byte("c"), []byte("z"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValue(t, s, "a", []byte("123"))
+	checkValue(t, s, "c", []byte("yz"))
+
+	err = execute(t, s, func(batch store.KVBatch) {
+		batch.Merge([]byte("a"), []byte("fail"))
+	})
+	if err == nil {
+		t.Error("expected the merge operator's failure to be returned")
+	}
+	checkValue(t, s, "a", []byte("123"))
+}
+
+func TestDynamoDBValuesAreNotInterpreted(t *testing.T) {
+	s, _ := openFake(t, nil)
+	values := map[string][]byte{
+		"t1": {'t', 0xff, 0, 1, 2, 3, 4, 5, 6},
+		"t2": {1, 0, 0, 0, 0, 0, 0, 0},
+		"t3": {},
+	}
+	err := execute(t, s, func(batch store.KVBatch) {
+		for k, v := range values {
+			batch.Set([]byte(k), v)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		checkValue(t, s, k, v)
+	}
+}
+
+func TestDynamoDBMergeConflict(t *testing.T) {
+	_, db := openFake(t, nil)
+	s := openAppend(t, db)
+	err := execute(t, s, func(batch store.KVBatch) {
+		batch.Merge([]byte("a"), []byte("1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another writer replaces the value between the merge reading it and writing it.
+	var replaced int
+	var replacing bool
+	db.Fault = func(operation string, input interface{}) error {
+		if operation != "TransactWriteItems" || replacing || replaced >= 2 {
+			return nil
+		}
+		replacing = true
+		defer func() { replacing = false }()
+		replaced++
+		return execute(t, openAppend(t, db), func(batch store.KVBatch) {
+			batch.Set([]byte("a"), []byte(strings.Repeat("x", replaced)))
+		})
+	}
+	err = execute(t, s, func(batch store.KVBatch) {
+		batch.Merge([]byte("a"), []byte("2"))
+		batch.Set([]byte("b"), []byte("b"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValue(t, s, "a", []byte("xx2"))
+	checkValue(t, s, "b", []byte("b"))
+	if replaced != 2 {
+		t.Errorf("expected the value to be replaced twice, got %d", replaced)
+	}
+
+	// A failed condition of anything but a merge isn't retried.
+	db.Fault = func(operation string, input interface{}) error {
+		if operation != "TransactWriteItems" {
+			return nil
+		}
+		return &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("None")},
+				{Code: aws.String("ConditionalCheckFailed")},
+			},
+		}
+	}
+	err = execute(t, s, func(batch store.KVBatch) {
+		batch.Merge([]byte("a"), []byte("3"))
+		batch.Set([]byte("b"), []byte("c"))
+	})
+	if err == nil {
+		t.Error("expected the cancelled transaction to fail")
+	}
+}
+
+func TestDynamoDBMergeWithoutOperator(t *testing.T) {
+	_, db := openFake(t, nil)
+	s, err := New(nil, map[string]interface{}{"tableName": "fake", "db": db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = execute(t, s, func(batch store.KVBatch) {
+		batch.Merge([]byte("a"), []byte("1"))
+	})
+	if err == nil {
+		t.Error("expected a merge without a merge operator to fail")
+	}
+}
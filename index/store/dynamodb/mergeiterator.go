@@ -0,0 +1,110 @@
+package dynamodb
+
+import (
+	"bytes"
+
+	"github.com/blevesearch/bleve/index/store"
+)
+
+// MergeIterator merges the sorted rows of iterators over several partitions into
+// a single sorted stream. The partitions hold different keys, so there are no
+// duplicates to resolve.
+type MergeIterator struct {
+	store     *Store
+	iterators []store.KVIterator
+	// current is the index of the iterator with the smallest key, or -1 if they're
+	// all finished.
+	current int
+}
+
+func newMergeIterator(s *Store, iterators []store.KVIterator) *MergeIterator {
+	rv := &MergeIterator{
+		store:     s,
+		iterators: iterators,
+	}
+	rv.Seek(nil)
+	return rv
+}
+
+// updateCurrent finds the iterator with the smallest key. If any iterator failed,
+// the merged stream would be missing rows, so it ends.
+func (i *MergeIterator) updateCurrent() {
+	i.current = -1
+	if i.Err() != nil {
+		return
+	}
+	var currentKey []byte
+	for n, it := range i.iterators {
+		key, _, valid := it.Current()
+		if valid && (i.current < 0 || bytes.Compare(key, currentKey) < 0) {
+			i.current = n
+			currentKey = key
+		}
+	}
+}
+
+// Seek seeks every iterator concurrently, since each has to query its partition.
+func (i *MergeIterator) Seek(k []byte) {
+	if i.Err() != nil {
+		return
+	}
+	tasks := make([]func() error, len(i.iterators))
+	for n, it := range i.iterators {
+		it := it
+		tasks[n] = func() error {
+			it.Seek(k)
+			return nil
+		}
+	}
+	_ = runTasks(tasks, i.store.bo.readConcurrency)
+	i.updateCurrent()
+}
+
+func (i *MergeIterator) Next() {
+	if i.current < 0 {
+		return
+	}
+	i.iterators[i.current].Next()
+	i.updateCurrent()
+}
+
+func (i *MergeIterator) Current() ([]byte, []byte, bool) {
+	if i.current < 0 {
+		return nil, nil, false
+	}
+	return i.iterators[i.current].Current()
+}
+
+func (i *MergeIterator) Key() []byte {
+	key, _, _ := i.Current()
+	return key
+}
+
+func (i *MergeIterator) Value() []byte {
+	_, val, _ := i.Current()
+	return val
+}
+
+func (i *MergeIterator) Valid() bool {
+	return i.current >= 0
+}
+
+// Err returns the error of the first iterator that failed, if any.
+func (i *MergeIterator) Err() error {
+	for _, it := range i.iterators {
+		if err := store.IteratorErr(it); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *MergeIterator) Close() error {
+	var rv error
+	for _, it := range i.iterators {
+		if err := it.Close(); err != nil && rv == nil {
+			rv = err
+		}
+	}
+	return rv
+}
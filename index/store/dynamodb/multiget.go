@@ -0,0 +1,109 @@
+package dynamodb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// MaxBatchGetKeys is the maximum number of keys DynamoDB accepts in a BatchGetItem call.
+const MaxBatchGetKeys = 100
+
+// multiGet reads the keys with BatchGetItem, 100 at a time, and returns the values
+// in the same order as the keys. Missing keys have nil values.
+func (bs *Store) multiGet(keys [][]byte) ([][]byte, error) {
+	rv := make([][]byte, len(keys))
+
+	// BatchGetItem rejects duplicate keys, so each key is only requested once.
+	positions := map[string][]int{}
+	var unique [][]byte
+	for i, key := range keys {
+		k := string(key)
+		if _, ok := positions[k]; !ok {
+			unique = append(unique, key)
+		}
+		positions[k] = append(positions[k], i)
+	}
+
+	var m sync.Mutex
+	found := func(item map[string]*dynamodb.AttributeValue) error {
+		value, err := recordToValue(item)
+		if err != nil {
+			return err
+		}
+		m.Lock()
+		defer m.Unlock()
+		for n, i := range positions[string(item["sk"].B)] {
+			if n > 0 {
+				// Each position gets its own copy, because the caller owns the values.
+				value = append([]byte{}, value...)
+			}
+			rv[i] = value
+		}
+		return nil
+	}
+	if err := bs.getItems(unique, bs.consistentRead, found); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// getItems reads the items with the given keys, which must be unique, with
+// BatchGetItem, 100 at a time, and calls found for each item that exists. found
+// may be called concurrently.
+func (bs *Store) getItems(keys [][]byte, consistentRead bool, found func(item map[string]*dynamodb.AttributeValue) error) error {
+	var tasks []func() error
+	for start := 0; start < len(keys); start += MaxBatchGetKeys {
+		end := start + MaxBatchGetKeys
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk := keys[start:end]
+		tasks = append(tasks, func() error { return bs.batchGet(chunk, consistentRead, found) })
+	}
+	return runTasks(tasks, bs.bo.readConcurrency)
+}
+
+// batchGet reads up to 100 keys, retrying any that DynamoDB leaves unprocessed
+// because of throttling or the 16MB response limit, and calls found for each key
+// that exists.
+func (bs *Store) batchGet(keys [][]byte, consistentRead bool, found func(item map[string]*dynamodb.AttributeValue) error) error {
+	request := make([]map[string]*dynamodb.AttributeValue, len(keys))
+	for i, key := range keys {
+		request[i] = map[string]*dynamodb.AttributeValue{
+			"pk": partitionKeyAttributeValue(bs.sharding.partitionKey(key)),
+			"sk": sortKeyAttributeValue(key),
+		}
+	}
+	for retry := 0; ; retry++ {
+		bgo, err := bs.db.BatchGetItem(&dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				bs.tableName: {
+					Keys:           request,
+					ConsistentRead: aws.Bool(consistentRead),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		for _, item := range bgo.Responses[bs.tableName] {
+			if err := found(item); err != nil {
+				return err
+			}
+		}
+		unprocessed := bgo.UnprocessedKeys[bs.tableName]
+		if unprocessed == nil || len(unprocessed.Keys) == 0 {
+			return nil
+		}
+		if retry >= bs.bo.maxRetries {
+			return fmt.Errorf("dynamodb store, %d keys were still unprocessed after %d retries", len(unprocessed.Keys), retry)
+		}
+		request = unprocessed.Keys
+		bs.s.retry()
+		time.Sleep(bs.bo.backoff(retry))
+	}
+}
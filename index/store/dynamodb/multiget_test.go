@@ -0,0 +1,70 @@
+package dynamodb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDynamoDBMultiGet(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{"batchRetryDelay": "1ms"})
+	writeLargeBatch(t, s, 250)
+	var calls countCalls
+	db.Fault = calls.fault
+	// Only read some of the keys in each call, so that the reader has to retry.
+	db.BatchGetItemLimit = 30
+
+	var keys [][]byte
+	var expected [][]byte
+	for i := 249; i >= 0; i-- {
+		keys = append(keys, []byte(fmt.Sprintf("k%04d", i)))
+		expected = append(expected, []byte(fmt.Sprintf("v%d", i)))
+	}
+	keys = append(keys, []byte("missing"), []byte("k0001"))
+	expected = append(expected, nil, []byte("v1"))
+
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	values, err := reader.MultiGet(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %q, got %q", expected, values)
+	}
+	if calls.count("BatchGetItem") < 251/30 {
+		t.Errorf("expected unprocessed keys to be retried, got %d calls", calls.count("BatchGetItem"))
+	}
+	if calls.count("GetItem") != 0 {
+		t.Errorf("expected no calls to GetItem, got %d", calls.count("GetItem"))
+	}
+
+	// The reader owns the values, so duplicate keys mustn't share them.
+	values[len(values)-1][0] = 'x'
+	if string(values[len(values)-4]) != "v1" {
+		t.Errorf("expected duplicate keys to have their own values, got %q", values[len(values)-4])
+	}
+}
+
+func TestDynamoDBMultiGetRetriesExhausted(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{
+		"maxBatchRetries":    1,
+		"batchRetryDelay":    "1ms",
+		"maxBatchRetryDelay": "1ms",
+	})
+	writeLargeBatch(t, s, 10)
+	db.BatchGetItemLimit = 1
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	_, err = reader.MultiGet([][]byte{[]byte("k0001"), []byte("k0002"), []byte("k0003")})
+	if err == nil || !strings.Contains(err.Error(), "unprocessed") {
+		t.Errorf("expected unprocessed keys error, got %v", err)
+	}
+}
@@ -2,19 +2,19 @@ package dynamodb
 
 import (
 	"bytes"
-	"encoding/json"
-	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 type RangeIterator struct {
-	store *Store
-	start []byte
-	end   []byte
-	err   error
-	valid bool
+	store     *Store
+	partition string
+	start     []byte
+	end       []byte
+	seek      []byte
+	err       error
+	valid     bool
 
 	lastEvaluatedKey map[string]*dynamodb.AttributeValue
 	index            int
@@ -25,69 +25,85 @@ type RangeIterator struct {
 }
 
 func (i *RangeIterator) Seek(k []byte) {
-	start := i.start
-	if start == nil || (k != nil && bytes.Compare(k, start) > 0) {
-		// We're starting a new set of results, so wipe out the paging.
-		start = k
-		i.lastEvaluatedKey = nil
+	if i.err != nil {
+		// The iterator stays invalid once it has failed.
+		return
 	}
-	qi := &dynamodb.QueryInput{
-		TableName:              &i.store.tableName,
-		ConsistentRead:         aws.Bool(true),
-		KeyConditionExpression: aws.String("#pk = :pk"),
-		ExpressionAttributeNames: map[string]*string{
-			"#pk": aws.String("pk"),
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":pk": partitionKeyAttributeValue(i.store.partition),
-		},
-		ExclusiveStartKey: i.lastEvaluatedKey,
+	// We're starting a new set of results, so wipe out the paging.
+	i.lastEvaluatedKey = nil
+	i.seek = i.start
+	if k != nil && bytes.Compare(k, i.start) > 0 {
+		i.seek = k
 	}
-	if start != nil {
-		qi.KeyConditionExpression = aws.String("#pk = :pk AND #sk >= :start")
-		qi.ExpressionAttributeNames["#sk"] = aws.String("sk")
-		qi.ExpressionAttributeValues[":start"] = &dynamodb.AttributeValue{B: start}
+	if i.seek != nil && i.end != nil && bytes.Compare(i.seek, i.end) >= 0 {
+		// The start is at or after the end, so we shouldn't return any results.
+		i.items = nil
+		i.valid = false
+		return
 	}
-	if start != nil && i.end != nil {
-		if bytes.Compare(start, i.end) > 0 {
-			// The start is after the end, so we shouldn't return any results.
+	i.query()
+}
+
+// query reads the next page of results, skipping pages that the filter expression
+// left empty.
+func (i *RangeIterator) query() {
+	for {
+		qi := &dynamodb.QueryInput{
+			TableName:              &i.store.tableName,
+			ConsistentRead:         aws.Bool(i.store.consistentRead),
+			KeyConditionExpression: aws.String("#pk = :pk"),
+			ExpressionAttributeNames: map[string]*string{
+				"#pk": aws.String("pk"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":pk": partitionKeyAttributeValue(i.partition),
+			},
+			ExclusiveStartKey: i.lastEvaluatedKey,
+		}
+		switch {
+		case i.seek != nil && i.end != nil:
+			qi.KeyConditionExpression = aws.String("#pk = :pk AND #sk BETWEEN :start AND :end")
+			qi.ExpressionAttributeNames["#sk"] = aws.String("sk")
+			qi.ExpressionAttributeValues[":start"] = &dynamodb.AttributeValue{B: i.seek}
+			qi.ExpressionAttributeValues[":end"] = &dynamodb.AttributeValue{B: i.end}
+			// Filter out the finishing match, because Bleve doesn't expect an inclusive set of results.
+			qi.ExpressionAttributeNames["#k"] = aws.String("k")
+			qi.FilterExpression = aws.String("#k < :end")
+		case i.seek != nil:
+			qi.KeyConditionExpression = aws.String("#pk = :pk AND #sk >= :start")
+			qi.ExpressionAttributeNames["#sk"] = aws.String("sk")
+			qi.ExpressionAttributeValues[":start"] = &dynamodb.AttributeValue{B: i.seek}
+		case i.end != nil:
+			qi.KeyConditionExpression = aws.String("#pk = :pk AND #sk < :end")
+			qi.ExpressionAttributeNames["#sk"] = aws.String("sk")
+			qi.ExpressionAttributeValues[":end"] = &dynamodb.AttributeValue{B: i.end}
+		}
+		i.store.s.iteratorPage()
+		qo, err := i.store.db.Query(qi)
+		if err != nil {
+			i.err = err
 			i.valid = false
 			return
 		}
-		qi.KeyConditionExpression = aws.String("#pk = :pk AND #sk BETWEEN :start AND :end")
-		qi.ExpressionAttributeNames["#sk"] = aws.String("sk")
-		qi.ExpressionAttributeValues[":start"] = &dynamodb.AttributeValue{B: start}
-		qi.ExpressionAttributeValues[":end"] = &dynamodb.AttributeValue{B: i.end}
-		// Filter out the finishing match, because Bleve doesn't expect an inclusive set of results.
-		qi.ExpressionAttributeNames["#k"] = aws.String("k")
-		qi.FilterExpression = aws.String("#k < :end")
-	}
-	qo, err := i.store.db.Query(qi)
-	if err != nil {
-		j, _ := json.MarshalIndent(qi, "", "  ")
-		fmt.Println(string(j))
-		i.err = err
-		i.valid = false
-		return
-	}
-	i.lastEvaluatedKey = qo.LastEvaluatedKey
-	i.items = qo.Items
-	i.index = 0
-	i.valid = len(qo.Items) > 0
-	if i.valid {
-		item := i.items[i.index]
-		i.key = item["sk"].B
-		i.val, _ = recordToValue(item)
-		i.index++
+		i.lastEvaluatedKey = qo.LastEvaluatedKey
+		i.items = qo.Items
+		i.index = 0
+		if len(qo.Items) > 0 || isKeyNullOrEmpty(i.lastEvaluatedKey) {
+			break
+		}
 	}
+	i.Next()
 }
 
 func (i *RangeIterator) Next() {
+	if i.err != nil {
+		return
+	}
 	// There's no more items in the current page.
 	if i.index > len(i.items)-1 {
 		// Grab another page if there is one.
 		if !isKeyNullOrEmpty(i.lastEvaluatedKey) {
-			i.Seek(nil)
+			i.query()
 			return
 		}
 		// If there isn't, we're finished.
@@ -95,10 +111,16 @@ func (i *RangeIterator) Next() {
 		return
 	}
 	item := i.items[i.index]
+	val, err := recordToValue(item)
+	if err != nil {
+		i.err = err
+		i.valid = false
+		return
+	}
 	i.key = item["sk"].B
-	i.val, _ = recordToValue(item)
-	//TODO: Handle the error.
+	i.val = val
 	i.index++
+	i.valid = true
 }
 
 func (i *RangeIterator) Current() ([]byte, []byte, bool) {
@@ -117,6 +139,11 @@ func (i *RangeIterator) Valid() bool {
 	return i.valid
 }
 
+// Err returns the error that made the iterator invalid, if any.
+func (i *RangeIterator) Err() error {
+	return i.err
+}
+
 func (i *RangeIterator) Close() error {
 	return i.err
 }
@@ -15,21 +15,28 @@ type Reader struct {
 }
 
 func (r *Reader) Get(key []byte) ([]byte, error) {
-	output, err := r.store.db.GetItem(&dynamodb.GetItemInput{TableName: &r.store.tableName, ConsistentRead: aws.Bool(true), Key: map[string]*dynamodb.AttributeValue{
-		"pk": partitionKeyAttributeValue(r.store.partition),
+	output, err := r.store.db.GetItem(&dynamodb.GetItemInput{TableName: &r.store.tableName, ConsistentRead: aws.Bool(r.store.consistentRead), Key: map[string]*dynamodb.AttributeValue{
+		"pk": partitionKeyAttributeValue(r.store.sharding.partitionKey(key)),
 		"sk": sortKeyAttributeValue(key),
 	}})
 	if err != nil {
 		return nil, err
 	}
+	if output.Item == nil {
+		return nil, nil
+	}
 	return recordToValue(output.Item)
 }
 
 func recordToValue(record map[string]*dynamodb.AttributeValue) ([]byte, error) {
+	if record["v"] == nil {
+		return nil, fmt.Errorf("expected record with 'v' attribute, got %+v", record)
+	}
 	if record["v"].B != nil {
 		return record["v"].B, nil
 	}
 	if record["v"].N != nil {
+		// Earlier versions of the store wrote merged counters as numbers.
 		v := make([]byte, 8)
 		vv, err := strconv.ParseUint(*record["v"].N, 10, 64)
 		if err != nil {
@@ -42,27 +49,55 @@ func recordToValue(record map[string]*dynamodb.AttributeValue) ([]byte, error) {
 }
 
 func (r *Reader) MultiGet(keys [][]byte) ([][]byte, error) {
-	//TODO: Replace this with BatchGetItem
-	return store.MultiGet(r, keys)
+	return r.store.multiGet(keys)
 }
 
 func (r *Reader) PrefixIterator(prefix []byte) store.KVIterator {
-	rv := &PrefixIterator{
-		store:  r.store,
-		prefix: prefix,
+	r.store.s.iterator()
+	partitions := r.store.sharding.prefixPartitions(prefix)
+	if len(partitions) == 1 {
+		rv := &PrefixIterator{
+			store:     r.store,
+			partition: partitions[0],
+			prefix:    prefix,
+		}
+		rv.Seek(nil)
+		return rv
+	}
+	iterators := make([]store.KVIterator, len(partitions))
+	for i, partition := range partitions {
+		iterators[i] = &PrefixIterator{
+			store:     r.store,
+			partition: partition,
+			prefix:    prefix,
+		}
 	}
-	rv.Seek(nil)
-	return rv
+	return newMergeIterator(r.store, iterators)
 }
 
 func (r *Reader) RangeIterator(start, end []byte) store.KVIterator {
-	rv := &RangeIterator{
-		store: r.store,
-		start: start,
-		end:   end,
+	r.store.s.iterator()
+	partitions := r.store.sharding.rangePartitions(start, end)
+	if len(partitions) == 1 {
+		rv := &RangeIterator{
+			store:     r.store,
+			partition: partitions[0],
+			start:     start,
+			end:       end,
+		}
+		rv.Seek(nil)
+		return rv
+	}
+	iterators := make([]store.KVIterator, len(partitions))
+	for i, partition := range partitions {
+		iterators[i] = &RangeIterator{
+			store:     r.store,
+			partition: partition,
+			start:     start,
+			end:       end,
+		}
 	}
-	rv.Seek(nil)
-	return rv
+	return newMergeIterator(r.store, iterators)
 }
 
 func (r *Reader) Close() error {
@@ -0,0 +1,166 @@
+package dynamodb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// sharding decides which partition each row of a store is in. Without sharding,
+// every row is in the store's partition. With it, the rows of the sharded row
+// types, whose type is the first byte of the key, are spread over several
+// partitions per type, by a hash of a prefix of the key. Rows that share that
+// prefix are always in the same partition, so a scan of a longer prefix only
+// reads one partition, while other scans merge the rows of every partition that
+// may hold them.
+type sharding struct {
+	partition string
+	// shards is the number of partitions of each sharded row type, sharding is
+	// disabled if it's less than 2.
+	shards int
+	// prefixLength is the length of the prefix of the key, including its row type,
+	// that's hashed to choose its shard.
+	prefixLength int
+	// rowTypes are the sharded row types.
+	rowTypes [256]bool
+}
+
+// defaultShardRowTypes are upsidedown's back index, dictionary, stored and term
+// frequency rows, which make up most of an index's rows and traffic.
+const defaultShardRowTypes = "bdst"
+
+func newSharding(config map[string]interface{}, partition string) (rv sharding, err error) {
+	rv.partition = partition
+	if rv.shards, err = configIntRange(config, "shards", 1, 1, 1000); err != nil {
+		return
+	}
+	if rv.prefixLength, err = configIntRange(config, "shardPrefixLength", 4, 1, 1024); err != nil {
+		return
+	}
+	rowTypes, err := configString(config, "shardRowTypes", defaultShardRowTypes)
+	if err != nil {
+		return
+	}
+	if rowTypes == "" {
+		return rv, errors.New("dynamodb store, config[shardRowTypes] can't be empty")
+	}
+	for i := 0; i < len(rowTypes); i++ {
+		rv.rowTypes[rowTypes[i]] = true
+	}
+	if rv.shards < 2 {
+		for _, key := range []string{"shardPrefixLength", "shardRowTypes"} {
+			if _, ok := config[key]; ok {
+				return rv, fmt.Errorf("dynamodb store, config[%s] requires config[shards]", key)
+			}
+		}
+	}
+	return rv, nil
+}
+
+func (s sharding) sharded(rowType byte) bool {
+	return s.shards > 1 && s.rowTypes[rowType]
+}
+
+// shardPartition returns the partition key of a shard of a row type.
+func (s sharding) shardPartition(rowType byte, shard int) string {
+	return fmt.Sprintf("%s#%02x#%d", s.partition, rowType, shard)
+}
+
+// partitionKey returns the partition key of the row with the key.
+func (s sharding) partitionKey(key []byte) string {
+	if len(key) == 0 || !s.sharded(key[0]) {
+		return s.partition
+	}
+	prefix := key
+	if len(prefix) > s.prefixLength {
+		prefix = prefix[:s.prefixLength]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(prefix)
+	return s.shardPartition(key[0], int(h.Sum32()%uint32(s.shards)))
+}
+
+// rowTypePartitions returns the partition keys that hold the rows whose types are
+// from first to last, inclusive.
+func (s sharding) rowTypePartitions(first, last int) []string {
+	var rv []string
+	unsharded := false
+	for t := first; t <= last; t++ {
+		if !s.sharded(byte(t)) {
+			unsharded = true
+			continue
+		}
+		for shard := 0; shard < s.shards; shard++ {
+			rv = append(rv, s.shardPartition(byte(t), shard))
+		}
+	}
+	if unsharded {
+		rv = append([]string{s.partition}, rv...)
+	}
+	return rv
+}
+
+// allPartitions returns every partition key the store's rows may be in.
+func (s sharding) allPartitions() []string {
+	return s.rowTypePartitions(0, 255)
+}
+
+// prefixPartitions returns the partition keys that hold the rows whose keys start
+// with the prefix.
+func (s sharding) prefixPartitions(prefix []byte) []string {
+	switch {
+	case len(prefix) == 0:
+		return s.allPartitions()
+	case !s.sharded(prefix[0]) || len(prefix) >= s.prefixLength:
+		return []string{s.partitionKey(prefix)}
+	}
+	return s.rowTypePartitions(int(prefix[0]), int(prefix[0]))
+}
+
+// rangePartitions returns the partition keys that hold the rows whose keys are
+// from start, inclusive, to end, exclusive. Either may be nil.
+func (s sharding) rangePartitions(start, end []byte) []string {
+	if len(start) >= s.prefixLength && len(end) >= s.prefixLength &&
+		bytes.Equal(start[:s.prefixLength], end[:s.prefixLength]) {
+		// Every key in the range has the same prefix.
+		return []string{s.partitionKey(start)}
+	}
+	first, last := 0, 255
+	if len(start) > 0 {
+		first = int(start[0])
+	}
+	if end != nil {
+		if len(end) == 0 {
+			return nil
+		}
+		last = int(end[0])
+		if len(end) == 1 {
+			// The keys of end's row type are all at or after end.
+			last--
+		}
+	}
+	return s.rowTypePartitions(first, last)
+}
+
+// basePartition returns the partition of the store that a partition key belongs to.
+func (s sharding) basePartition(pk string) string {
+	if s.shards < 2 {
+		return pk
+	}
+	i := strings.LastIndexByte(pk, '#')
+	if i < 4 || pk[i-3] != '#' {
+		return pk
+	}
+	rowType, err := strconv.ParseUint(pk[i-2:i], 16, 8)
+	if err != nil || !s.sharded(byte(rowType)) {
+		return pk
+	}
+	shard, err := strconv.Atoi(pk[i+1:])
+	if err != nil || shard < 0 || shard >= s.shards || strconv.Itoa(shard) != pk[i+1:] {
+		return pk
+	}
+	return pk[:i-3]
+}
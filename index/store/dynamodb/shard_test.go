@@ -0,0 +1,164 @@
+package dynamodb
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/index/store/test"
+)
+
+// openSharded opens a store on the fake whose keys starting with a, b, c or d are
+// spread over 4 shards by their first 2 bytes, and whose queries return one item
+// per page.
+func openSharded(t *testing.T) store.KVStore {
+	rv, db := openFake(t, map[string]interface{}{
+		"shards":            4,
+		"shardPrefixLength": 2,
+		"shardRowTypes":     "abcd",
+	})
+	db.MaxPageItems = 1
+	return rv
+}
+
+func TestDynamoDBShardedKVCrud(t *testing.T) {
+	test.CommonTestKVCrud(t, openSharded(t))
+}
+
+func TestDynamoDBShardedPrefixIterator(t *testing.T) {
+	test.CommonTestPrefixIterator(t, openSharded(t))
+}
+
+func TestDynamoDBShardedPrefixIteratorSeek(t *testing.T) {
+	test.CommonTestPrefixIteratorSeek(t, openSharded(t))
+}
+
+func TestDynamoDBShardedRangeIterator(t *testing.T) {
+	test.CommonTestRangeIterator(t, openSharded(t))
+}
+
+func TestDynamoDBShardedRangeIteratorSeek(t *testing.T) {
+	test.CommonTestRangeIteratorSeek(t, openSharded(t))
+}
+
+func TestDynamoDBShardedMerge(t *testing.T) {
+	s, _ := openFake(t, map[string]interface{}{"shards": 4, "shardRowTypes": "ch"})
+	test.CommonTestMerge(t, s)
+}
+
+func TestDynamoDBShardedLargeBatch(t *testing.T) {
+	s, _ := openFake(t, map[string]interface{}{"shards": 8, "shardPrefixLength": 3, "shardRowTypes": "km"})
+	writeLargeBatch(t, s, 120)
+	checkLargeBatch(t, s, 120)
+}
+
+func TestDynamoDBShardPartitions(t *testing.T) {
+	sharding, err := newSharding(map[string]interface{}{
+		"shards":            3,
+		"shardPrefixLength": 3,
+		"shardRowTypes":     "bt",
+	}, "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := map[string]bool{}
+	for _, key := range []string{"b1", "b12", "b123", "b124", "t0000", "t0001", "t0100", "t9999"} {
+		pk := sharding.partitionKey([]byte(key))
+		used[pk] = true
+		if base := sharding.basePartition(pk); base != "index" {
+			t.Errorf("expected %s to be a shard of index, got %s", pk, base)
+		}
+	}
+	if len(used) < 3 {
+		t.Errorf("expected the keys to be spread over several shards, got %v", used)
+	}
+	if sharding.partitionKey([]byte("b123")) != sharding.partitionKey([]byte("b124")) {
+		t.Error("expected keys with the same prefix to be in the same shard")
+	}
+	for _, key := range []string{"", "v", "s123"} {
+		if pk := sharding.partitionKey([]byte(key)); pk != "index" {
+			t.Errorf("expected %q not to be sharded, got %s", key, pk)
+		}
+	}
+	for _, pk := range []string{"index", "index#74#3", "index#73#0", "other#74"} {
+		if base := sharding.basePartition(pk); base != pk {
+			t.Errorf("expected %s not to be a shard, got %s", pk, base)
+		}
+	}
+
+	for _, tc := range []struct {
+		prefix     string
+		partitions int
+	}{
+		{"", 7},
+		{"t", 3},
+		{"t0", 3},
+		{"t00", 1},
+		{"t0000", 1},
+		{"s", 1},
+	} {
+		if partitions := sharding.prefixPartitions([]byte(tc.prefix)); len(partitions) != tc.partitions {
+			t.Errorf("expected prefix %q to be in %d partitions, got %v", tc.prefix, tc.partitions, partitions)
+		}
+	}
+	for _, tc := range []struct {
+		start, end []byte
+		partitions int
+	}{
+		{nil, nil, 7},
+		{[]byte("b"), []byte("c"), 3},
+		{[]byte("b"), []byte("t"), 4},
+		{[]byte("b"), []byte("t0"), 7},
+		{[]byte("t000"), []byte("t001"), 1},
+		{[]byte("t000"), []byte("t010"), 3},
+		{[]byte("u"), nil, 1},
+		{nil, []byte("b"), 1},
+	} {
+		if partitions := sharding.rangePartitions(tc.start, tc.end); len(partitions) != tc.partitions {
+			t.Errorf("expected range %q-%q to be in %d partitions, got %v", tc.start, tc.end, tc.partitions, partitions)
+		}
+	}
+}
+
+func TestDynamoDBInvalidShardConfig(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"shards": 0},
+		{"shards": 2, "shardPrefixLength": 0},
+		{"shards": 2, "shardRowTypes": ""},
+		{"shardRowTypes": "t"},
+		{"shardPrefixLength": 2},
+	} {
+		if _, err := newSharding(config, "index"); err == nil {
+			t.Errorf("expected config %v to be rejected", config)
+		}
+	}
+}
+
+func TestDynamoDBTableShardedPartitions(t *testing.T) {
+	_, db := openFake(t, nil)
+	table, err := NewTable(map[string]interface{}{"tableName": "fake", "db": db, "shards": 4, "shardRowTypes": "km"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]store.KVStore{}
+	for _, partition := range []string{"a", "b"} {
+		s, err := New(&test.TestMergeCounter{}, map[string]interface{}{
+			"tableName":     "fake",
+			"db":            db,
+			"partition":     partition,
+			"shards":        4,
+			"shardRowTypes": "km",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeLargeBatch(t, s, 40)
+		stores[partition] = s
+	}
+	checkPartitions(t, table, "a", "b")
+	if err := table.DropPartition("a"); err != nil {
+		t.Fatal(err)
+	}
+	checkPartitions(t, table, "b")
+	checkLargeBatch(t, stores["b"], 40)
+}
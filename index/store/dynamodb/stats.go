@@ -1,13 +1,254 @@
 package dynamodb
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve/index/store/metrics"
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// The DynamoDB operations made by the store, which are counted separately.
+const (
+	opGetItem = iota
+	opQuery
+	opTransactWriteItems
+	opBatchWriteItem
+	opBatchGetItem
+	numOps
+)
+
+var opNames = [numOps]string{
+	opGetItem:            "get_item",
+	opQuery:              "query",
+	opTransactWriteItems: "transact_write_items",
+	opBatchWriteItem:     "batch_write_item",
+	opBatchGetItem:       "batch_get_item",
+}
+
+type opStats struct {
+	calls     uint64
+	errors    uint64
+	throttled uint64
+	timer     gometrics.Timer
+}
+
+// stats counts the calls the store makes to DynamoDB, and the capacity they consume.
 type stats struct {
-	store *Store
+	iterators        uint64
+	iteratorPages    uint64
+	retries          uint64
+	sdkRetries       uint64
+	throttled        uint64
+	unprocessedItems uint64
+	unprocessedKeys  uint64
+
+	ops [numOps]opStats
+
+	m                  sync.Mutex
+	readCapacityUnits  float64
+	writeCapacityUnits float64
+}
+
+func newStats() *stats {
+	rv := &stats{}
+	for i := range rv.ops {
+		rv.ops[i].timer = gometrics.NewTimer()
+	}
+	return rv
+}
+
+// isThrottled returns true if a request failed because DynamoDB throttled it,
+// including transactions cancelled because one of their items was throttled.
+func isThrottled(err error) bool {
+	if request.IsErrorThrottle(err) {
+		return true
+	}
+	if tce, ok := err.(*dynamodb.TransactionCanceledException); ok {
+		for _, reason := range tce.CancellationReasons {
+			switch aws.StringValue(reason.Code) {
+			case "ThrottlingError", "ProvisionedThroughputExceeded":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *stats) record(op int, start time.Time, err error) {
+	o := &s.ops[op]
+	o.timer.UpdateSince(start)
+	atomic.AddUint64(&o.calls, 1)
+	if err != nil {
+		atomic.AddUint64(&o.errors, 1)
+		if isThrottled(err) {
+			atomic.AddUint64(&o.throttled, 1)
+			atomic.AddUint64(&s.throttled, 1)
+		}
+	}
+}
+
+func (s *stats) consumed(write bool, capacity ...*dynamodb.ConsumedCapacity) {
+	var units float64
+	for _, c := range capacity {
+		if c != nil {
+			units += aws.Float64Value(c.CapacityUnits)
+		}
+	}
+	s.m.Lock()
+	if write {
+		s.writeCapacityUnits += units
+	} else {
+		s.readCapacityUnits += units
+	}
+	s.m.Unlock()
+}
+
+func (s *stats) iterator() {
+	atomic.AddUint64(&s.iterators, 1)
+}
+
+func (s *stats) iteratorPage() {
+	atomic.AddUint64(&s.iteratorPages, 1)
+}
+
+func (s *stats) retry() {
+	atomic.AddUint64(&s.retries, 1)
+}
+
+func (s *stats) unprocessed(items, keys int) {
+	atomic.AddUint64(&s.unprocessedItems, uint64(items))
+	atomic.AddUint64(&s.unprocessedKeys, uint64(keys))
+}
+
+// addHandlers counts the requests that the AWS SDK retries itself, before the
+// store sees an error, along with those it retried because they were throttled.
+func (s *stats) addHandlers(handlers *request.Handlers) {
+	handlers.Retry.PushBack(func(r *request.Request) {
+		if request.IsErrorThrottle(r.Error) {
+			atomic.AddUint64(&s.throttled, 1)
+		}
+	})
+	handlers.AfterRetry.PushBack(func(r *request.Request) {
+		// The error is cleared when the request is going to be retried.
+		if r.Error == nil {
+			atomic.AddUint64(&s.sdkRetries, 1)
+		}
+	})
+}
+
+func (s *stats) statsMap() map[string]interface{} {
+	ms := map[string]interface{}{}
+	for i := range s.ops {
+		o := &s.ops[i]
+		ms[opNames[i]] = map[string]interface{}{
+			"calls":     atomic.LoadUint64(&o.calls),
+			"errors":    atomic.LoadUint64(&o.errors),
+			"throttled": atomic.LoadUint64(&o.throttled),
+			"latency":   metrics.TimerMap(o.timer),
+		}
+	}
+	ms["iterators"] = atomic.LoadUint64(&s.iterators)
+	ms["iterator_pages"] = atomic.LoadUint64(&s.iteratorPages)
+	ms["retries"] = atomic.LoadUint64(&s.retries)
+	ms["sdk_retries"] = atomic.LoadUint64(&s.sdkRetries)
+	ms["throttled"] = atomic.LoadUint64(&s.throttled)
+	ms["unprocessed_items"] = atomic.LoadUint64(&s.unprocessedItems)
+	ms["unprocessed_keys"] = atomic.LoadUint64(&s.unprocessedKeys)
+	s.m.Lock()
+	ms["read_capacity_units"] = s.readCapacityUnits
+	ms["write_capacity_units"] = s.writeCapacityUnits
+	s.m.Unlock()
+	return ms
 }
 
 func (s *stats) MarshalJSON() ([]byte, error) {
-	//TODO: Update the code to track the number of API calls made, and the number of read/write units consumed.
-	bs := map[string]interface{}{}
-	return json.Marshal(bs)
+	m := s.statsMap()
+	return json.Marshal(m)
+}
+
+// statsDB wraps the DB, recording the stats of each call, and asking DynamoDB to
+// return the capacity each call consumes.
+type statsDB struct {
+	db DB
+	s  *stats
+}
+
+func returnConsumedCapacity(v *string) *string {
+	if v == nil {
+		return aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	}
+	return v
+}
+
+func (d *statsDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	input.ReturnConsumedCapacity = returnConsumedCapacity(input.ReturnConsumedCapacity)
+	start := time.Now()
+	output, err := d.db.GetItem(input)
+	d.s.record(opGetItem, start, err)
+	if output != nil {
+		d.s.consumed(false, output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (d *statsDB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	input.ReturnConsumedCapacity = returnConsumedCapacity(input.ReturnConsumedCapacity)
+	start := time.Now()
+	output, err := d.db.Query(input)
+	d.s.record(opQuery, start, err)
+	if output != nil {
+		d.s.consumed(false, output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (d *statsDB) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	input.ReturnConsumedCapacity = returnConsumedCapacity(input.ReturnConsumedCapacity)
+	start := time.Now()
+	output, err := d.db.TransactWriteItems(input)
+	d.s.record(opTransactWriteItems, start, err)
+	if output != nil {
+		d.s.consumed(true, output.ConsumedCapacity...)
+	}
+	return output, err
+}
+
+func (d *statsDB) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	input.ReturnConsumedCapacity = returnConsumedCapacity(input.ReturnConsumedCapacity)
+	start := time.Now()
+	output, err := d.db.BatchWriteItem(input)
+	d.s.record(opBatchWriteItem, start, err)
+	if output != nil {
+		d.s.consumed(true, output.ConsumedCapacity...)
+		var unprocessed int
+		for _, requests := range output.UnprocessedItems {
+			unprocessed += len(requests)
+		}
+		d.s.unprocessed(unprocessed, 0)
+	}
+	return output, err
+}
+
+func (d *statsDB) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	input.ReturnConsumedCapacity = returnConsumedCapacity(input.ReturnConsumedCapacity)
+	start := time.Now()
+	output, err := d.db.BatchGetItem(input)
+	d.s.record(opBatchGetItem, start, err)
+	if output != nil {
+		d.s.consumed(false, output.ConsumedCapacity...)
+		var unprocessed int
+		for _, ka := range output.UnprocessedKeys {
+			if ka != nil {
+				unprocessed += len(ka.Keys)
+			}
+		}
+		d.s.unprocessed(0, unprocessed)
+	}
+	return output, err
 }
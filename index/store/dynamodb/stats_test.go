@@ -0,0 +1,96 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve/index/store"
+)
+
+func opStat(t *testing.T, s store.KVStore, op, name string) uint64 {
+	ms := s.(store.KVStoreStats).StatsMap()
+	om, ok := ms[op].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected stats for %s, got %v", op, ms)
+	}
+	return om[name].(uint64)
+}
+
+func TestDynamoDBStats(t *testing.T) {
+	s, db := openFake(t, map[string]interface{}{"batchRetryDelay": "1ms"})
+	db.MaxPageItems = 3
+	writeLargeBatch(t, s, 10)
+	checkLargeBatch(t, s, 10)
+
+	if calls := opStat(t, s, "transact_write_items", "calls"); calls != 1 {
+		t.Errorf("expected 1 transaction, got %d", calls)
+	}
+	if calls := opStat(t, s, "get_item", "calls"); calls != 1 {
+		t.Errorf("expected 1 get, got %d", calls)
+	}
+	ms := s.(store.KVStoreStats).StatsMap()
+	if ms["iterators"] != uint64(1) {
+		t.Errorf("expected 1 iterator, got %v", ms["iterators"])
+	}
+	// 10 items in pages of 3, and a final page to find there are no more.
+	if ms["iterator_pages"] != uint64(4) || opStat(t, s, "query", "calls") != 4 {
+		t.Errorf("expected 4 pages, got %v", ms["iterator_pages"])
+	}
+	if units := ms["write_capacity_units"].(float64); units != 22 {
+		t.Errorf("expected a transaction of 11 items to consume 22 write units, got %v", units)
+	}
+	if units := ms["read_capacity_units"].(float64); units != 6 {
+		t.Errorf("expected reading the merged item, 4 queries and a get to consume 6 read units, got %v", units)
+	}
+
+	// Throttled requests are counted, as are the store's retries of them.
+	faulted := map[string]bool{}
+	db.Fault = func(operation string, input interface{}) error {
+		if faulted[operation] || operation == "BatchGetItem" {
+			return nil
+		}
+		faulted[operation] = true
+		if operation == "TransactWriteItems" {
+			return &dynamodb.TransactionCanceledException{
+				CancellationReasons: []*dynamodb.CancellationReason{
+					{Code: aws.String("ThrottlingError")},
+				},
+			}
+		}
+		return awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throttled", nil)
+	}
+	writeLargeBatch(t, s, 10)
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err := reader.Get([]byte("k0000")); err == nil {
+		t.Error("expected the throttled get to fail")
+	}
+	ms = s.(store.KVStoreStats).StatsMap()
+	if ms["throttled"] != uint64(2) || ms["retries"] != uint64(1) {
+		t.Errorf("expected 2 throttled requests and 1 retry, got %v and %v", ms["throttled"], ms["retries"])
+	}
+	if errors := opStat(t, s, "transact_write_items", "errors"); errors != 1 {
+		t.Errorf("expected 1 failed transaction, got %d", errors)
+	}
+	if throttled := opStat(t, s, "get_item", "throttled"); throttled != 1 {
+		t.Errorf("expected 1 throttled get, got %d", throttled)
+	}
+
+	buf, err := json.Marshal(s.(store.KVStoreStats).Stats())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["batch_get_item"].(map[string]interface{})["latency"]; !ok {
+		t.Errorf("expected latency stats, got %s", buf)
+	}
+}
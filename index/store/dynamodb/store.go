@@ -3,9 +3,9 @@ package dynamodb
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"path/filepath"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/blevesearch/bleve/index/store"
 	"github.com/blevesearch/bleve/registry"
@@ -15,42 +15,128 @@ const (
 	Name = "dynamodb"
 )
 
+// DB is the subset of the DynamoDB API used by the Store. It's implemented by
+// *dynamodb.DynamoDB, and by the in-process fake in the fake package.
+type DB interface {
+	GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	Query(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	TransactWriteItems(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchWriteItem(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	BatchGetItem(*dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
+}
+
 type Store struct {
 	tableName string
-	partition string
-	db        *dynamodb.DynamoDB
+	sharding  sharding
+	db        DB
 	mo        store.MergeOperator
+	bo        batchOptions
+	s         *stats
+	// consistentRead is false if readers use eventually consistent reads.
+	consistentRead bool
 }
 
 func New(mo store.MergeOperator, config map[string]interface{}) (store.KVStore, error) {
-	partition, ok := config["partition"].(string)
-	if !ok {
-		partition = "bleve"
-	}
 	tableName, ok := config["tableName"].(string)
 	if !ok {
 		return nil, errors.New("missing tableName in config")
 	}
-	region, ok := config["region"].(string)
-	if !ok {
-		return nil, errors.New("missing region in config")
+	partition, err := newPartition(config)
+	if err != nil {
+		return nil, err
 	}
-	db := dynamodb.New(session.New(aws.NewConfig().WithRegion(region)))
-
-	// Set the endpoint, if provided.
-	endpoint, ok := config["endpoint"].(string)
-	if endpoint != "" {
-		db.Endpoint = endpoint
+	sharding, err := newSharding(config, partition)
+	if err != nil {
+		return nil, err
+	}
+	bo, err := newBatchOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	consistentRead, err := configBool(config, "consistentRead", true)
+	if err != nil {
+		return nil, err
+	}
+	s := newStats()
+	db, err := newDB(config, s)
+	if err != nil {
+		return nil, err
 	}
 
 	rv := Store{
 		tableName: tableName,
-		partition: partition,
-		db:        db,
+		sharding:  sharding,
+		db:        &statsDB{db: db, s: s},
+		mo:        mo,
+		bo:        bo,
+		s:         s,
+
+		consistentRead: consistentRead,
+	}
+	errorIfExists, ok := config["error_if_exists"].(bool)
+	if ok && errorIfExists {
+		empty, err := rv.isEmpty()
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			return nil, fmt.Errorf("dynamodb store, partition %q of table %s already exists", partition, tableName)
+		}
 	}
 	return &rv, nil
 }
 
+// newPartition returns the partition key of the store's items, which is either
+// config["partition"], or with config["partitionByIndex"], the path of the
+// index whose store is at config["path"], relative to config["indexRoot"] if
+// it's set.
+func newPartition(config map[string]interface{}) (string, error) {
+	partitionByIndex, err := configBool(config, "partitionByIndex", false)
+	if err != nil {
+		return "", err
+	}
+	partition, err := configString(config, "partition", "")
+	if err != nil {
+		return "", err
+	}
+	if partitionByIndex {
+		if partition != "" {
+			return "", errors.New("dynamodb store, config[partition] can't be used with config[partitionByIndex]")
+		}
+		path, err := configString(config, "path", "")
+		if err != nil {
+			return "", err
+		}
+		if path == "" {
+			return "", errors.New("dynamodb store, config[partitionByIndex] requires the index to have a path")
+		}
+		indexRoot, err := configString(config, "indexRoot", "")
+		if err != nil {
+			return "", err
+		}
+		// bleve keeps the store of the index at path in path/store.
+		return IndexPartition(indexRoot, filepath.Dir(path))
+	}
+	if _, ok := config["partition"]; ok && partition == "" {
+		return "", errors.New("dynamodb store, config[partition] can't be empty")
+	}
+	if partition == "" {
+		partition = "bleve"
+	}
+	return partition, nil
+}
+
+// isEmpty returns true if the store has no items, in any of its partitions.
+func (bs *Store) isEmpty() (bool, error) {
+	reader := &Reader{store: bs}
+	it := reader.RangeIterator(nil, nil)
+	_, _, valid := it.Current()
+	if err := it.Close(); err != nil {
+		return false, err
+	}
+	return !valid, nil
+}
+
 func (bs *Store) Close() error {
 	return nil
 }
@@ -68,9 +154,11 @@ func (bs *Store) Writer() (store.KVWriter, error) {
 }
 
 func (bs *Store) Stats() json.Marshaler {
-	return &stats{
-		store: bs,
-	}
+	return bs.s
+}
+
+func (bs *Store) StatsMap() map[string]interface{} {
+	return bs.s.statsMap()
 }
 
 func init() {
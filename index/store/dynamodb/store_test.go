@@ -1,28 +1,58 @@
 package dynamodb
 
 import (
+	"flag"
+	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/index/store/dynamodb/fake"
 	"github.com/blevesearch/bleve/index/store/test"
 	"github.com/google/uuid"
 )
 
 const region = "eu-west-1"
 
-func createLocalTable(t *testing.T) (name string) {
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
-	if err != nil {
-		t.Fatalf("failed to create test db session: %v", err)
-		return
+var endpoint = flag.String("endpoint", "", "run the tests against a DynamoDB endpoint, e.g. http://localhost:8000 for DynamoDB Local, instead of the in-process fake")
+
+// testDB is implemented by both the DynamoDB client and the fake.
+type testDB interface {
+	DB
+	CreateTable(*dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error)
+	DeleteTable(*dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error)
+}
+
+var testClient testDB
+var testClientOnce sync.Once
+
+// client returns the database shared by the tests, each of which uses its own table.
+func client(t *testing.T) testDB {
+	testClientOnce.Do(func() {
+		if *endpoint == "" {
+			testClient = fake.New()
+			return
+		}
+		sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+		if err != nil {
+			t.Fatalf("failed to create test db session: %v", err)
+		}
+		db := dynamodb.New(sess)
+		db.Endpoint = *endpoint
+		testClient = db
+	})
+	if testClient == nil {
+		t.Fatal("failed to create test db client")
 	}
+	return testClient
+}
+
+func createLocalTable(t *testing.T) (name string) {
 	name = uuid.New().String()
-	client := dynamodb.New(sess)
-	client.Endpoint = "http://localhost:8000"
-	_, err = client.CreateTable(&dynamodb.CreateTableInput{
+	_, err := client(t).CreateTable(&dynamodb.CreateTableInput{
 		AttributeDefinitions: []*dynamodb.AttributeDefinition{
 			{
 				AttributeName: aws.String("pk"),
@@ -53,13 +83,7 @@ func createLocalTable(t *testing.T) (name string) {
 }
 
 func deleteLocalTable(t *testing.T, name string) {
-	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
-	if err != nil {
-		return
-	}
-	client := dynamodb.New(sess)
-	client.Endpoint = "http://localhost:8000"
-	_, err = client.DeleteTable(&dynamodb.DeleteTableInput{
+	_, err := client(t).DeleteTable(&dynamodb.DeleteTableInput{
 		TableName: aws.String(name),
 	})
 	if err != nil {
@@ -69,7 +93,7 @@ func deleteLocalTable(t *testing.T, name string) {
 
 func open(t *testing.T, mo store.MergeOperator) (rv store.KVStore, tableName string) {
 	tableName = createLocalTable(t)
-	rv, err := New(mo, map[string]interface{}{"tableName": tableName, "region": region, "endpoint": "http://localhost:8000"})
+	rv, err := New(mo, map[string]interface{}{"tableName": tableName, "db": client(t)})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -90,10 +114,72 @@ func TestDynamoDBKVCrud(t *testing.T) {
 	test.CommonTestKVCrud(t, s)
 }
 
+// TestDynamoDBReaderIsolation checks the isolation of readers documented in
+// the Isolation section of the package, in place of CommonTestReaderIsolation:
+// readers see the batches committed after they were opened.
 func TestDynamoDBReaderIsolation(t *testing.T) {
 	s, tableName := open(t, nil)
 	defer cleanup(t, s, tableName)
-	test.CommonTestReaderIsolation(t, s)
+
+	set := func(k, v string) {
+		writer, err := s.Writer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := writer.NewBatch()
+		batch.Set([]byte(k), []byte(v))
+		err = writer.ExecuteBatch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	set("a", "val-a")
+	reader, err := s.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	val, err := reader.Get([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "val-a" {
+		t.Errorf("expected val-a, got %q", val)
+	}
+
+	// a batch committed after the reader was opened is visible to it
+	set("b", "val-b")
+	val, err = reader.Get([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "val-b" {
+		t.Errorf("expected the reader to see val-b, got %q", val)
+	}
+	var keys []string
+	it := reader.RangeIterator([]byte("a"), []byte("c"))
+	for it.Valid() {
+		key, _, _ := it.Current()
+		keys = append(keys, string(key))
+		it.Next()
+	}
+	err = it.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("expected the iterator to see a and b, got %v", keys)
+	}
 }
 
 func TestDynamoDBReaderOwnsGetBytes(t *testing.T) {
@@ -133,9 +219,60 @@ func TestDynamoDBRangeIteratorSeek(t *testing.T) {
 }
 
 func TestDynamoDBMerge(t *testing.T) {
-	s, tableName := open(t, nil)
+	s, tableName := open(t, &test.TestMergeCounter{})
 	defer cleanup(t, s, tableName)
 	test.CommonTestMerge(t, s)
 }
 
-//TODO: Add config test.
+// openFake opens a store backed by a new fake, which is returned so that tests can
+// change its behaviour.
+func openFake(t *testing.T, config map[string]interface{}) (store.KVStore, *fake.DB) {
+	db := fake.New()
+	_, err := db.CreateTable(&dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String("B")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("sk"), KeyType: aws.String("RANGE")},
+		},
+		TableName: aws.String("fake"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeConfig := map[string]interface{}{"tableName": "fake", "db": db}
+	for k, v := range config {
+		storeConfig[k] = v
+	}
+	rv, err := New(&test.TestMergeCounter{}, storeConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv, db
+}
+
+// openPaged opens a store backed by a fake that returns one item per page, so that
+// iterators have to page through every result.
+func openPaged(t *testing.T) store.KVStore {
+	rv, db := openFake(t, nil)
+	db.MaxPageItems = 1
+	return rv
+}
+
+func TestDynamoDBPrefixIteratorPaged(t *testing.T) {
+	test.CommonTestPrefixIterator(t, openPaged(t))
+}
+
+func TestDynamoDBPrefixIteratorSeekPaged(t *testing.T) {
+	test.CommonTestPrefixIteratorSeek(t, openPaged(t))
+}
+
+func TestDynamoDBRangeIteratorPaged(t *testing.T) {
+	test.CommonTestRangeIterator(t, openPaged(t))
+}
+
+func TestDynamoDBRangeIteratorSeekPaged(t *testing.T) {
+	test.CommonTestRangeIteratorSeek(t, openPaged(t))
+}
@@ -0,0 +1,312 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/registry"
+)
+
+// TableDB is the subset of the DynamoDB API used by Table to create a table and
+// manage the partitions in it. It's implemented by *dynamodb.DynamoDB, and by the
+// in-process fake in the fake package.
+type TableDB interface {
+	DB
+	CreateTable(*dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error)
+	Scan(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+}
+
+const (
+	// tableStatusDelay is the time between checks of the status of a table that's
+	// being created.
+	tableStatusDelay = 2 * time.Second
+	// tableStatusTimeout is how long Create waits for a table to become active.
+	tableStatusTimeout = 5 * time.Minute
+)
+
+// Table is a DynamoDB table that holds the partitions of many stores, one per
+// index.
+type Table struct {
+	name string
+	db   TableDB
+	// config is the config of the stores in the table, without the options of the
+	// client, which the stores share.
+	config map[string]interface{}
+	bo     batchOptions
+	// sharding is the sharding of the stores, without their partition.
+	sharding sharding
+	s        *stats
+}
+
+// NewTable returns the table named by config["tableName"], using a client
+// configured by the rest of the config like New does. The config's batch and read
+// options are used by every store opened with RegisterKVStore.
+func NewTable(config map[string]interface{}) (*Table, error) {
+	tableName, ok := config["tableName"].(string)
+	if !ok {
+		return nil, errors.New("missing tableName in config")
+	}
+	bo, err := newBatchOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := configBool(config, "consistentRead", true); err != nil {
+		return nil, err
+	}
+	if _, err := configString(config, "indexRoot", ""); err != nil {
+		return nil, err
+	}
+	sharding, err := newSharding(config, "")
+	if err != nil {
+		return nil, err
+	}
+	s := newStats()
+	db, err := newDB(config, s)
+	if err != nil {
+		return nil, err
+	}
+	tdb, ok := db.(TableDB)
+	if !ok {
+		return nil, fmt.Errorf("dynamodb store, config[db] must implement TableDB to manage a table, got %T", db)
+	}
+	storeConfig := map[string]interface{}{}
+	for k, v := range config {
+		storeConfig[k] = v
+	}
+	for _, key := range clientConfigKeys {
+		delete(storeConfig, key)
+	}
+	delete(storeConfig, "db")
+	delete(storeConfig, "partition")
+	return &Table{
+		name:     tableName,
+		db:       tdb,
+		config:   storeConfig,
+		bo:       bo,
+		sharding: sharding,
+		s:        s,
+	}, nil
+}
+
+// Create creates the table, with on-demand billing, if it doesn't exist already,
+// and waits for it to become active. If it exists, Create checks that it has the
+// key schema the store needs.
+func (t *Table) Create() error {
+	_, err := t.db.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String(t.name),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeB)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String("sk"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceInUseException {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("dynamodb store, creating table %s: %v", t.name, err)
+	}
+	for deadline := time.Now().Add(tableStatusTimeout); ; {
+		dto, err := t.db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(t.name)})
+		if err != nil {
+			return fmt.Errorf("dynamodb store, describing table %s: %v", t.name, err)
+		}
+		switch status := aws.StringValue(dto.Table.TableStatus); status {
+		case dynamodb.TableStatusActive, dynamodb.TableStatusUpdating:
+			return checkKeySchema(dto.Table)
+		case dynamodb.TableStatusCreating:
+			if time.Now().After(deadline) {
+				return fmt.Errorf("dynamodb store, table %s still wasn't active after %v", t.name, tableStatusTimeout)
+			}
+			time.Sleep(tableStatusDelay)
+		default:
+			return fmt.Errorf("dynamodb store, table %s is %s", t.name, status)
+		}
+	}
+}
+
+// checkKeySchema returns an error unless the table has a string partition key named
+// "pk" and a binary sort key named "sk".
+func checkKeySchema(table *dynamodb.TableDescription) error {
+	types := map[string]string{}
+	for _, ad := range table.AttributeDefinitions {
+		types[aws.StringValue(ad.AttributeName)] = aws.StringValue(ad.AttributeType)
+	}
+	keys := map[string]string{}
+	for _, ks := range table.KeySchema {
+		name := aws.StringValue(ks.AttributeName)
+		keys[aws.StringValue(ks.KeyType)] = name + " (" + types[name] + ")"
+	}
+	if len(keys) != 2 || keys[dynamodb.KeyTypeHash] != "pk (S)" || keys[dynamodb.KeyTypeRange] != "sk (B)" {
+		return fmt.Errorf("dynamodb store, table %s has partition key %s and sort key %s, expected pk (S) and sk (B)",
+			aws.StringValue(table.TableName), keys[dynamodb.KeyTypeHash], keys[dynamodb.KeyTypeRange])
+	}
+	return nil
+}
+
+// Partitions returns the partitions in the table, in order, with the shards of
+// each partition listed as the partition itself. It has to scan the whole table,
+// reading every item.
+func (t *Table) Partitions() ([]string, error) {
+	partitions := map[string]struct{}{}
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(t.name),
+		ProjectionExpression:     aws.String("#pk"),
+		ExpressionAttributeNames: map[string]*string{"#pk": aws.String("pk")},
+	}
+	for {
+		so, err := t.db.Scan(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range so.Items {
+			if pk := item["pk"]; pk != nil && pk.S != nil {
+				partitions[t.sharding.basePartition(*pk.S)] = struct{}{}
+			}
+		}
+		if isKeyNullOrEmpty(so.LastEvaluatedKey) {
+			break
+		}
+		input.ExclusiveStartKey = so.LastEvaluatedKey
+	}
+	rv := make([]string, 0, len(partitions))
+	for partition := range partitions {
+		rv = append(rv, partition)
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+// DropPartition deletes every item in the partition, including those in its
+// shards. The partition is read a page at a time, and each page is deleted with
+// BatchWriteItem before the next is read. The partition shouldn't be written to
+// while it's being dropped.
+func (t *Table) DropPartition(partition string) error {
+	sharding := t.sharding
+	sharding.partition = partition
+	bs := &Store{
+		tableName: t.name,
+		sharding:  sharding,
+		db:        &statsDB{db: t.db, s: t.s},
+		bo:        t.bo,
+		s:         t.s,
+	}
+	for _, pk := range sharding.allPartitions() {
+		if err := bs.deletePartitionKey(pk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePartitionKey deletes every item with the partition key.
+func (bs *Store) deletePartitionKey(pk string) error {
+	input := &dynamodb.QueryInput{
+		TableName:                aws.String(bs.tableName),
+		ConsistentRead:           aws.Bool(true),
+		KeyConditionExpression:   aws.String("#pk = :pk"),
+		ProjectionExpression:     aws.String("#pk, #sk"),
+		ExpressionAttributeNames: map[string]*string{"#pk": aws.String("pk"), "#sk": aws.String("sk")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": partitionKeyAttributeValue(pk),
+		},
+	}
+	for {
+		qo, err := bs.db.Query(input)
+		if err != nil {
+			return err
+		}
+		requests := make([]*dynamodb.WriteRequest, len(qo.Items))
+		for i, item := range qo.Items {
+			requests[i] = &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: item}}
+		}
+		var tasks []func() error
+		for _, chunk := range chunkWriteRequests(requests) {
+			chunk := chunk
+			tasks = append(tasks, func() error { return bs.batchWrite(chunk) })
+		}
+		if err := runTasks(tasks, bs.bo.writeConcurrency); err != nil {
+			return err
+		}
+		if isKeyNullOrEmpty(qo.LastEvaluatedKey) {
+			return nil
+		}
+		input.ExclusiveStartKey = qo.LastEvaluatedKey
+	}
+}
+
+// IndexPartition returns the partition of the index at indexPath, in a table whose
+// stores are opened with RegisterKVStore: the path of the index relative to
+// indexRoot, or its absolute path if indexRoot is empty, with forward slashes.
+// Two distinct indexes never share a partition, even if their directories have
+// the same name. An index outside indexRoot has no partition.
+func IndexPartition(indexRoot, indexPath string) (string, error) {
+	path, err := filepath.Abs(indexPath)
+	if err != nil {
+		return "", err
+	}
+	if indexRoot == "" {
+		return filepath.ToSlash(path), nil
+	}
+	root, err := filepath.Abs(indexRoot)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("dynamodb store, index %s isn't in the index root %s", indexPath, indexRoot)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// RegisterKVStore registers a KVStore named name, which stores each index in the
+// table, in the partition named after the index's path, see IndexPartition. Setting
+// bleve.Config.DefaultKVStore to name lets bleve.New, which can't be passed a
+// kvconfig, create indexes in the table. Like other KVStores, name must only be
+// registered once.
+func (t *Table) RegisterKVStore(name string) {
+	registry.RegisterKVStore(name, func(mo store.MergeOperator, config map[string]interface{}) (store.KVStore, error) {
+		storeConfig := map[string]interface{}{}
+		for k, v := range t.config {
+			storeConfig[k] = v
+		}
+		for k, v := range config {
+			storeConfig[k] = v
+		}
+		storeConfig["db"] = t.db
+		if _, ok := storeConfig["partition"]; !ok {
+			storeConfig["partitionByIndex"] = true
+		}
+		return New(mo, storeConfig)
+	})
+}
+
+// DeleteIndex drops the partition of the index at indexPath, and then removes
+// the index's directory. The index must be closed, and must have been created with
+// a store registered by RegisterKVStore, without a partition in its kvconfig.
+func (t *Table) DeleteIndex(indexPath string) error {
+	indexRoot, _ := t.config["indexRoot"].(string)
+	partition, err := IndexPartition(indexRoot, indexPath)
+	if err != nil {
+		return err
+	}
+	if err := t.DropPartition(partition); err != nil {
+		return err
+	}
+	return os.RemoveAll(indexPath)
+}
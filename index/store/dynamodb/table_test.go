@@ -0,0 +1,237 @@
+package dynamodb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/index/store/dynamodb/fake"
+	"github.com/blevesearch/bleve/index/store/test"
+)
+
+func newTable(t *testing.T, db *fake.DB) *Table {
+	rv, err := NewTable(map[string]interface{}{"tableName": "indexes", "db": db, "batchRetryDelay": "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+func checkPartitions(t *testing.T, table *Table, expected ...string) {
+	partitions, err := table.Partitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partitions) != len(expected) || (len(expected) > 0 && !reflect.DeepEqual(partitions, expected)) {
+		t.Errorf("expected partitions %v, got %v", expected, partitions)
+	}
+}
+
+func TestDynamoDBTableCreate(t *testing.T) {
+	db := fake.New()
+	table := newTable(t, db)
+	if err := table.Create(); err != nil {
+		t.Fatal(err)
+	}
+	dto, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("indexes")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := aws.StringValue(dto.Table.BillingModeSummary.BillingMode); mode != dynamodb.BillingModePayPerRequest {
+		t.Errorf("expected on-demand billing, got %s", mode)
+	}
+	// Creating a table that exists checks its schema.
+	if err := table.Create(); err != nil {
+		t.Errorf("expected the existing table to be used, got %v", err)
+	}
+
+	_, err = db.CreateTable(&dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String("S")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("sk"), KeyType: aws.String("RANGE")},
+		},
+		TableName: aws.String("strings"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err = NewTable(map[string]interface{}{"tableName": "strings", "db": db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Create(); err == nil || !strings.Contains(err.Error(), "sk (S)") {
+		t.Errorf("expected a table with the wrong schema to be rejected, got %v", err)
+	}
+}
+
+func TestDynamoDBTablePartitions(t *testing.T) {
+	db := fake.New()
+	db.MaxPageItems = 7
+	table := newTable(t, db)
+	if err := table.Create(); err != nil {
+		t.Fatal(err)
+	}
+	checkPartitions(t, table)
+	stores := map[string]store.KVStore{}
+	for _, partition := range []string{"b", "a", "c"} {
+		s, err := New(&test.TestMergeCounter{}, map[string]interface{}{"tableName": "indexes", "db": db, "partition": partition})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeLargeBatch(t, s, 60)
+		stores[partition] = s
+	}
+	checkPartitions(t, table, "a", "b", "c")
+
+	if err := table.DropPartition("b"); err != nil {
+		t.Fatal(err)
+	}
+	checkPartitions(t, table, "a", "c")
+	checkLargeBatch(t, stores["a"], 60)
+	checkLargeBatch(t, stores["c"], 60)
+	// Dropping a partition that doesn't exist does nothing.
+	if err := table.DropPartition("b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDynamoDBErrorIfExists(t *testing.T) {
+	s, db := openFake(t, nil)
+	config := map[string]interface{}{"tableName": "fake", "db": db, "error_if_exists": true}
+	if _, err := New(nil, config); err != nil {
+		t.Errorf("expected an empty partition to be opened, got %v", err)
+	}
+	writeLargeBatch(t, s, 1)
+	if _, err := New(nil, config); err == nil {
+		t.Error("expected a partition with items to be rejected")
+	}
+	config["partition"] = "other"
+	if _, err := New(nil, config); err != nil {
+		t.Errorf("expected another partition to be opened, got %v", err)
+	}
+}
+
+func TestDynamoDBPartitionConfig(t *testing.T) {
+	absProducts, err := filepath.Abs(filepath.Join("data", "products"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		config    map[string]interface{}
+		partition string
+	}{
+		{map[string]interface{}{}, "bleve"},
+		{map[string]interface{}{"partition": "index"}, "index"},
+		{map[string]interface{}{"partitionByIndex": true, "path": filepath.Join("data", "products", "store"), "indexRoot": "data"}, "products"},
+		{map[string]interface{}{"partitionByIndex": true, "path": filepath.Join("data", "a", "idx", "store"), "indexRoot": "data"}, "a/idx"},
+		{map[string]interface{}{"partitionByIndex": true, "path": filepath.Join("data", "b", "idx", "store"), "indexRoot": "data"}, "b/idx"},
+		{map[string]interface{}{"partitionByIndex": true, "path": filepath.Join("data", "products", "store")}, filepath.ToSlash(absProducts)},
+		{map[string]interface{}{"partitionByIndex": true, "path": filepath.Join("other", "products", "store"), "indexRoot": "data"}, ""},
+		{map[string]interface{}{"partitionByIndex": false, "path": filepath.Join("data", "products", "store")}, "bleve"},
+		{map[string]interface{}{"partition": ""}, ""},
+		{map[string]interface{}{"partitionByIndex": true}, ""},
+		{map[string]interface{}{"partitionByIndex": true, "partition": "index", "path": "index"}, ""},
+	} {
+		partition, err := newPartition(tc.config)
+		if tc.partition == "" {
+			if err == nil {
+				t.Errorf("expected config %v to be rejected, got partition %q", tc.config, partition)
+			}
+			continue
+		}
+		if err != nil || partition != tc.partition {
+			t.Errorf("expected config %v to have partition %q, got %q, %v", tc.config, tc.partition, partition, err)
+		}
+	}
+}
+
+func TestDynamoDBTableIndexes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynamodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := NewTable(map[string]interface{}{"tableName": "indexes", "db": fake.New(), "indexRoot": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Create(); err != nil {
+		t.Fatal(err)
+	}
+	table.RegisterKVStore("dynamodb-test-indexes")
+	defer func(name string) {
+		bleve.Config.DefaultKVStore = name
+	}(bleve.Config.DefaultKVStore)
+	bleve.Config.DefaultKVStore = "dynamodb-test-indexes"
+
+	// The directories of orders and archive/orders have the same name, but the
+	// indexes have distinct partitions.
+	if err := os.Mkdir(filepath.Join(dir, "archive"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"products", "orders", filepath.Join("archive", "orders")} {
+		idx, err := bleve.New(filepath.Join(dir, name), bleve.NewIndexMapping())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Index("1", map[string]interface{}{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkPartitions(t, table, "archive/orders", "orders", "products")
+
+	// Creating an index again fails, rather than reusing the partition's items.
+	if err := os.RemoveAll(filepath.Join(dir, "orders")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bleve.New(filepath.Join(dir, "orders"), bleve.NewIndexMapping()); err == nil {
+		t.Error("expected creating an index over an existing partition to fail")
+	}
+
+	if err := table.DeleteIndex(filepath.Join(dir, "orders")); err != nil {
+		t.Fatal(err)
+	}
+	checkPartitions(t, table, "archive/orders", "products")
+	if err := table.DeleteIndex(filepath.Join(dir, "archive", "orders")); err != nil {
+		t.Fatal(err)
+	}
+	checkPartitions(t, table, "products")
+
+	idx, err := bleve.Open(filepath.Join(dir, "products"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected the products index to have 1 document, got %d", count)
+	}
+	if err := idx.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.DeleteIndex(filepath.Join(dir, "products")); err != nil {
+		t.Fatal(err)
+	}
+	checkPartitions(t, table)
+	if _, err := os.Stat(filepath.Join(dir, "products")); !os.IsNotExist(err) {
+		t.Errorf("expected the index's directory to be removed, got %v", err)
+	}
+}
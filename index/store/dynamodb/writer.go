@@ -1,9 +1,8 @@
 package dynamodb
 
 import (
-	"encoding/base64"
-	"encoding/binary"
 	"fmt"
+	"math/rand"
 	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -16,21 +15,32 @@ type Writer struct {
 }
 
 func (w *Writer) NewBatch() store.KVBatch {
-	return NewDynamoDBBatch(w.store.tableName, w.store.partition)
+	return newDynamoDBBatch(w.store.tableName, w.store.sharding, w.store.mo)
 }
 
-func NewDynamoDBBatch(tableName, partition string) store.KVBatch {
+// NewDynamoDBBatch returns a batch for a store whose rows are all in one partition.
+func NewDynamoDBBatch(tableName, partition string, mo store.MergeOperator) store.KVBatch {
+	return newDynamoDBBatch(tableName, sharding{partition: partition}, mo)
+}
+
+func newDynamoDBBatch(tableName string, sharding sharding, mo store.MergeOperator) *DynamoDBBatch {
 	return &DynamoDBBatch{
 		tableName: tableName,
-		partition: partition,
+		sharding:  sharding,
+		mo:        mo,
 		tx:        map[string]*dynamodb.TransactWriteItem{},
+		merge:     store.NewEmulatedMerge(mo),
 	}
 }
 
+// DynamoDBBatch holds the sets and deletes of a batch, and the merges, which are
+// applied when the batch is executed.
 type DynamoDBBatch struct {
 	tableName string
-	partition string
+	sharding  sharding
+	mo        store.MergeOperator
 	tx        map[string]*dynamodb.TransactWriteItem
+	merge     *store.EmulatedMerge
 }
 
 func partitionKeyAttributeValue(partition string) *dynamodb.AttributeValue {
@@ -45,14 +55,31 @@ func valueAttributeByteArrayValue(value []byte) *dynamodb.AttributeValue {
 	return &dynamodb.AttributeValue{B: value}
 }
 
-func valueAttributeNumberValue(value []byte) *dynamodb.AttributeValue {
-	vv := int64(binary.LittleEndian.Uint64(value))
-	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(vv, 10))}
+// revisionAttributeValue returns a new random revision. Every put writes a new
+// revision, so that a merge can check that the item it read hasn't been replaced
+// before it writes the merged value.
+func revisionAttributeValue() *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(rand.Int63(), 10))}
+}
+
+func newPut(tableName, partition string, key, val []byte) *dynamodb.Put {
+	return &dynamodb.Put{
+		TableName: aws.String(tableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"pk":  partitionKeyAttributeValue(partition),
+			"sk":  sortKeyAttributeValue(key),
+			"k":   sortKeyAttributeValue(key), // Duplicate of sk to allow filter expression in the PrefixIterator.
+			"v":   valueAttributeByteArrayValue(val),
+			"rev": revisionAttributeValue(),
+		},
+	}
 }
 
 func (batch *DynamoDBBatch) setTx(key []byte, item *dynamodb.TransactWriteItem) {
-	k := base64.RawStdEncoding.EncodeToString(key)
+	k := string(key)
 	batch.tx[k] = item
+	// The item replaces the value, along with any merges into it earlier in the batch.
+	delete(batch.merge.Merges, k)
 }
 
 func (batch *DynamoDBBatch) Set(key, val []byte) {
@@ -61,23 +88,9 @@ func (batch *DynamoDBBatch) Set(key, val []byte) {
 	cv := make([]byte, len(val))
 	copy(cv, val)
 
-	item := &dynamodb.TransactWriteItem{
-		Put: &dynamodb.Put{
-			TableName: aws.String(batch.tableName),
-			Item: map[string]*dynamodb.AttributeValue{
-				"pk": partitionKeyAttributeValue(batch.partition),
-				"sk": sortKeyAttributeValue(ck),
-				"k":  sortKeyAttributeValue(ck), // Duplicate of sk to allow filter expression in the PrefixIterator.
-				"v":  valueAttributeByteArrayValue(cv),
-			},
-		},
-	}
-	if ck[0] == 't' {
-		// It must be a term frequency row, replace it with a number so that the database
-		// can carry out merge operations.
-		item.Put.Item["v"] = valueAttributeNumberValue(cv)
-	}
-	batch.setTx(ck, item)
+	batch.setTx(ck, &dynamodb.TransactWriteItem{
+		Put: newPut(batch.tableName, batch.sharding.partitionKey(ck), ck, cv),
+	})
 }
 
 func (batch *DynamoDBBatch) Delete(key []byte) {
@@ -88,7 +101,7 @@ func (batch *DynamoDBBatch) Delete(key []byte) {
 		Delete: &dynamodb.Delete{
 			TableName: aws.String(batch.tableName),
 			Key: map[string]*dynamodb.AttributeValue{
-				"pk": partitionKeyAttributeValue(batch.partition),
+				"pk": partitionKeyAttributeValue(batch.sharding.partitionKey(ck)),
 				"sk": sortKeyAttributeValue(ck),
 			},
 		},
@@ -98,6 +111,7 @@ func (batch *DynamoDBBatch) Delete(key []byte) {
 
 func (batch *DynamoDBBatch) Reset() {
 	batch.tx = map[string]*dynamodb.TransactWriteItem{}
+	batch.merge = store.NewEmulatedMerge(batch.mo)
 }
 
 func (batch *DynamoDBBatch) Close() error {
@@ -109,43 +123,8 @@ func (batch *DynamoDBBatch) Merge(key, val []byte) {
 	copy(ck, key)
 	cv := make([]byte, len(val))
 	copy(cv, val)
-	//TODO: It seems that there's only one implementation of merge at the moment, the upsideDownMerge at index/upsidedown/row_merge.go, so this merge is going to replicate that behaviour in DynamoDB using the set operation. This means peeking at the row type when writing to write an N item instead of a B item.
-	vv := int64(binary.LittleEndian.Uint64(cv))
-	if item, hasExisting := batch.tx[base64.RawStdEncoding.EncodeToString(ck)]; hasExisting {
-		//TODO: How should we handle the case that the number can't be parsed? The only place to return an error is on close.
-		existingValue, _ := strconv.ParseInt(*item.Update.ExpressionAttributeValues[":vv"].N, 10, 64)
-		item.Update.ExpressionAttributeValues[":vv"].N = aws.String(strconv.FormatInt(existingValue+vv, 10))
-		return
-	}
-	item := &dynamodb.TransactWriteItem{
-		Update: &dynamodb.Update{
-			TableName:        aws.String(batch.tableName),
-			UpdateExpression: aws.String("ADD #v :vv SET #k = :k"),
-			ExpressionAttributeNames: map[string]*string{
-				"#v": aws.String("v"),
-				"#k": aws.String("k"),
-			},
-			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-				":vv": {N: aws.String(strconv.FormatInt(vv, 10))},
-				":k":  sortKeyAttributeValue(ck),
-			},
-			Key: map[string]*dynamodb.AttributeValue{
-				"pk": partitionKeyAttributeValue(batch.partition),
-				"sk": sortKeyAttributeValue(ck),
-			},
-		},
-	}
-	batch.setTx(ck, item)
-}
 
-func (batch *DynamoDBBatch) Items() []*dynamodb.TransactWriteItem {
-	items := make([]*dynamodb.TransactWriteItem, len(batch.tx))
-	var i int
-	for _, v := range batch.tx {
-		items[i] = v
-		i++
-	}
-	return items
+	batch.merge.Merge(ck, cv)
 }
 
 func (w *Writer) NewBatchEx(options store.KVBatchOptions) ([]byte, store.KVBatch, error) {
@@ -157,10 +136,7 @@ func (w *Writer) ExecuteBatch(batch store.KVBatch) (err error) {
 	if !ok {
 		return fmt.Errorf("wrong type of batch, expected DynamoDBBatch, got %t", batch)
 	}
-	_, err = w.store.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
-		TransactItems: dynamoDBBatch.Items(),
-	})
-	return
+	return w.store.writeBatch(dynamoDBBatch)
 }
 
 func (w *Writer) Close() error {
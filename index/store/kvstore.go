@@ -93,6 +93,25 @@ type KVIterator interface {
 	Close() error
 }
 
+// KVIteratorErr is an optional interface that KVIterators can implement
+// if they can become invalid because of an error, such as a failed
+// network request, rather than because they reached the end of their
+// range.
+type KVIteratorErr interface {
+	// Err returns the error that made the iterator invalid, or nil
+	// if it's still valid or reached the end of its range
+	Err() error
+}
+
+// IteratorErr returns the error that made the iterator invalid, if
+// it implements KVIteratorErr, otherwise nil
+func IteratorErr(it KVIterator) error {
+	if ie, ok := it.(KVIteratorErr); ok {
+		return ie.Err()
+	}
+	return nil
+}
+
 // KVWriter is an abstraction for mutating the KVStore
 // KVWriter does **NOT** enforce restrictions of a single writer
 // if the underlying KVStore allows concurrent writes, the
@@ -49,6 +49,10 @@ func (i *Iterator) Valid() bool {
 	return i.o.Valid()
 }
 
+func (i *Iterator) Err() error {
+	return store.IteratorErr(i.o)
+}
+
 func (i *Iterator) Close() error {
 	err := i.o.Close()
 	if err != nil {
@@ -15,6 +15,7 @@
 package test
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -48,20 +49,19 @@ func CommonTestReaderIsolation(t *testing.T, s store.KVStore) {
 	// this hack writes enough initial data such that
 	// the subsequent writes do not require additional
 	// space
-	//TODO: The maximum batch size of a transaction in DynamoDB is 25 records, so this code will always fail.
-	//hackSize := 1000
-	//batch := writer.NewBatch()
-	//for i := 0; i < hackSize; i++ {
-	//k := fmt.Sprintf("x%d", i)
-	//batch.Set([]byte(k), []byte("filler"))
-	//}
-	//err = writer.ExecuteBatch(batch)
-	//if err != nil {
-	//t.Fatal(err)
-	//}
+	hackSize := 1000
+	batch := writer.NewBatch()
+	for i := 0; i < hackSize; i++ {
+		k := fmt.Sprintf("x%d", i)
+		batch.Set([]byte(k), []byte("filler"))
+	}
+	err = writer.ExecuteBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
 	// **************************************************
 
-	batch := writer.NewBatch()
+	batch = writer.NewBatch()
 	batch.Set([]byte("a"), []byte("val-a"))
 	err = writer.ExecuteBatch(batch)
 	if err != nil {
@@ -19,7 +19,6 @@ import (
 	"time"
 
 	"github.com/blevesearch/bleve/index"
-	"github.com/blevesearch/bleve/index/store/boltdb"
 
 	"github.com/blevesearch/bleve/document"
 )
@@ -33,7 +32,7 @@ func TestDump(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -134,7 +133,8 @@ func TestDump(t *testing.T) {
 	// 2 text term row count (2 different text terms)
 	// 16 numeric term row counts (shared for both docs, same numeric value)
 	// 16 date term row counts (shared for both docs, same date value)
-	expectedAllRowCount := int(1 + fieldsCount + (2 * expectedDocRowCount) + 2 + 2 + int((2 * (64 / document.DefaultPrecisionStep))))
+	// fieldsCount field stats rows
+	expectedAllRowCount := int(1 + fieldsCount + (2 * expectedDocRowCount) + 2 + 2 + int((2 * (64 / document.DefaultPrecisionStep))) + fieldsCount)
 	allRowCount := 0
 	allRows := reader.DumpAll()
 	for range allRows {
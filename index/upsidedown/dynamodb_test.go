@@ -0,0 +1,202 @@
+package upsidedown
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/store/dynamodb"
+	"github.com/blevesearch/bleve/index/store/dynamodb/fake"
+)
+
+// newDynamoDBTestConfig returns store config for a new in-process DynamoDB fake.
+func newDynamoDBTestConfig(t *testing.T) map[string]interface{} {
+	db := fake.New()
+	_, err := db.CreateTable(&awsdynamodb.CreateTableInput{
+		AttributeDefinitions: []*awsdynamodb.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("sk"), AttributeType: aws.String("B")},
+		},
+		KeySchema: []*awsdynamodb.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("sk"), KeyType: aws.String("RANGE")},
+		},
+		TableName: aws.String("bleve"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"tableName": "bleve",
+		"db":        db,
+	}
+}
+
+// dynamoDBIndexTests are the index tests that are run against the dynamodb store.
+var dynamoDBIndexTests = []struct {
+	name string
+	test func(t *testing.T)
+}{
+	{"IndexOpenReopen", TestIndexOpenReopen},
+	{"IndexInsert", TestIndexInsert},
+	{"IndexInsertThenDelete", TestIndexInsertThenDelete},
+	{"IndexInsertThenUpdate", TestIndexInsertThenUpdate},
+	{"IndexInsertMultiple", TestIndexInsertMultiple},
+	{"IndexInsertWithStore", TestIndexInsertWithStore},
+	{"IndexInternalCRUD", TestIndexInternalCRUD},
+	{"IndexBatch", TestIndexBatch},
+	{"IndexInsertUpdateDeleteWithMultipleTypesStored", TestIndexInsertUpdateDeleteWithMultipleTypesStored},
+	{"IndexInsertFields", TestIndexInsertFields},
+	{"IndexUpdateComposites", TestIndexUpdateComposites},
+	{"IndexFieldsMisc", TestIndexFieldsMisc},
+	{"IndexTermReaderCompositeFields", TestIndexTermReaderCompositeFields},
+	{"IndexDocumentVisitFieldTerms", TestIndexDocumentVisitFieldTerms},
+	{"ConcurrentUpdate", TestConcurrentUpdate},
+	{"LargeField", TestLargeField},
+	{"IndexReader", TestIndexReader},
+	{"IndexDocIdReader", TestIndexDocIdReader},
+	{"IndexDocIdOnlyReader", TestIndexDocIdOnlyReader},
+	{"IndexFieldDict", TestIndexFieldDict},
+	{"IndexFieldStats", TestIndexFieldStats},
+	{"Dump", TestDump},
+}
+
+// runDynamoDBIndexTests runs the index tests against the dynamodb store, with the
+// options added to its config.
+func runDynamoDBIndexTests(t *testing.T, options map[string]interface{}) {
+	defer func(name string, config map[string]interface{}) {
+		testStoreName, testStoreConfig = name, config
+	}(testStoreName, testStoreConfig)
+	for _, test := range dynamoDBIndexTests {
+		testStoreName = dynamodb.Name
+		testStoreConfig = newDynamoDBTestConfig(t)
+		for k, v := range options {
+			testStoreConfig[k] = v
+		}
+		t.Run(test.name, test.test)
+	}
+}
+
+func TestDynamoDBIndex(t *testing.T) {
+	runDynamoDBIndexTests(t, nil)
+}
+
+// TestDynamoDBShardedIndex runs the index tests with the hot rows spread over
+// several partitions, so that scans of a whole row type, such as the back index
+// rows read by the DocIDReader, merge the rows of every shard.
+func TestDynamoDBShardedIndex(t *testing.T) {
+	runDynamoDBIndexTests(t, map[string]interface{}{
+		"shards":            4,
+		"shardPrefixLength": 2,
+	})
+}
+
+func TestDynamoDBIndexStats(t *testing.T) {
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewUpsideDownCouch(dynamodb.Name, newDynamoDBTestConfig(t), analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	kv, ok := idx.StatsMap()["kv"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected kv stats, got %v", idx.StatsMap())
+	}
+	if kv["write_capacity_units"].(float64) <= 0 {
+		t.Errorf("expected opening the index to write to DynamoDB, got %v", kv)
+	}
+}
+
+func TestDynamoDBIndexReaderError(t *testing.T) {
+	config := newDynamoDBTestConfig(t)
+	db := config["db"].(*fake.DB)
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewUpsideDownCouch(dynamodb.Name, config, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Fault = nil
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	doc := document.NewDocument("1")
+	doc.AddField(document.NewTextField("name", []uint64{}, []byte("test")))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queryErr := errors.New("query failed")
+	db.Fault = func(operation string, input interface{}) error {
+		if operation == "Query" {
+			return queryErr
+		}
+		return nil
+	}
+	indexReader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = indexReader.Close()
+	}()
+
+	// A failed query isn't mistaken for the end of the results.
+	tfr, err := indexReader.TermFieldReader([]byte("test"), "name", true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tfr.Next(nil); err != queryErr {
+		t.Errorf("expected the term field reader to return the query error, got %v", err)
+	}
+	if _, err := tfr.Advance(index.IndexInternalID("1"), nil); err != queryErr {
+		t.Errorf("expected advancing the term field reader to return the query error, got %v", err)
+	}
+	_ = tfr.Close()
+
+	dir, err := indexReader.DocIDReaderAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.Next(); err != queryErr {
+		t.Errorf("expected the doc id reader to return the query error, got %v", err)
+	}
+	_ = dir.Close()
+
+	dict, err := indexReader.FieldDict("name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dict.Next(); err != queryErr {
+		t.Errorf("expected the field dict to return the query error, got %v", err)
+	}
+	_ = dict.Close()
+
+	if _, err := indexReader.Document("1"); err != queryErr {
+		t.Errorf("expected loading the document to return the query error, got %v", err)
+	}
+	if _, err := indexReader.Fields(); err != queryErr {
+		t.Errorf("expected listing the fields to return the query error, got %v", err)
+	}
+}
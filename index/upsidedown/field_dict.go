@@ -54,7 +54,7 @@ func newUpsideDownCouchFieldDict(indexReader *IndexReader, field uint16, startTe
 func (r *UpsideDownCouchFieldDict) Next() (*index.DictEntry, error) {
 	key, val, valid := r.iterator.Current()
 	if !valid {
-		return nil, nil
+		return nil, store.IteratorErr(r.iterator)
 	}
 
 	err := r.dictRow.parseDictionaryK(key)
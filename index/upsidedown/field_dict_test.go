@@ -32,7 +32,7 @@ func TestIndexFieldDict(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -184,3 +184,240 @@ func TestIndexFieldDict(t *testing.T) {
 		t.Errorf("expected %#v, got %#v", expectedTerms, terms)
 	}
 }
+
+func TestIndexFieldStats(t *testing.T) {
+	defer func() {
+		err := DestroyTest()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	doc := document.NewDocument("1")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("test one two"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	doc = document.NewDocument("2")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("test test"), testAnalyzer))
+	doc.AddField(document.NewTextFieldWithAnalyzer("desc", []uint64{}, []byte("eat more rice"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+
+	checkFieldStats(t, idx, map[string]index.FieldStats{
+		"name":    {Docs: 2, TotalTerms: 5},
+		"desc":    {Docs: 1, TotalTerms: 3},
+		"missing": {},
+	})
+
+	// updating a doc replaces its field lengths, and fields it no longer has
+	doc = document.NewDocument("2")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("test test test test"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	checkFieldStats(t, idx, map[string]index.FieldStats{
+		"name": {Docs: 2, TotalTerms: 7},
+		"desc": {},
+	})
+
+	batch := index.NewBatch()
+	batch.Delete("1")
+	doc = document.NewDocument("3")
+	doc.AddField(document.NewTextFieldWithAnalyzer("desc", []uint64{}, []byte("eat rice"), testAnalyzer))
+	batch.Update(doc)
+	err = idx.Batch(batch)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	checkFieldStats(t, idx, map[string]index.FieldStats{
+		"name": {Docs: 1, TotalTerms: 4},
+		"desc": {Docs: 1, TotalTerms: 2},
+	})
+
+	err = idx.Delete("2")
+	if err != nil {
+		t.Errorf("Error deleting entry from index: %v", err)
+	}
+	checkFieldStats(t, idx, map[string]index.FieldStats{
+		"name": {},
+		"desc": {Docs: 1, TotalTerms: 2},
+	})
+}
+
+func TestIndexFieldStatsUpgrade(t *testing.T) {
+	defer func() {
+		err := DestroyTest()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	analysisQueue := index.NewAnalysisQueue(1)
+	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Errorf("error opening index: %v", err)
+	}
+
+	doc := document.NewDocument("1")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("test one two"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+	doc = document.NewDocument("2")
+	doc.AddField(document.NewTextFieldWithAnalyzer("name", []uint64{}, []byte("test test"), testAnalyzer))
+	err = idx.Update(doc)
+	if err != nil {
+		t.Errorf("Error updating index: %v", err)
+	}
+
+	// remove the field stats rows and set the version of the indexes built
+	// before they were maintained
+	kvstore, err := idx.Advanced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvwriter, err := kvstore.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := kvwriter.NewBatch()
+	batch.Delete(NewFieldStatsRow(0, 0, 0).Key())
+	batch.Set(VersionKey, NewVersionRow(versionWithoutFieldStats).Value())
+	err = kvwriter.ExecuteBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = kvwriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]index.FieldStats{
+		"name": {Docs: 2, TotalTerms: 5},
+	}
+
+	// a read-only index counts them in memory, when first needed
+	readOnlyConfig := map[string]interface{}{"read_only": true}
+	for k, v := range boltTestConfig {
+		readOnlyConfig[k] = v
+	}
+	idx, err = NewUpsideDownCouch(boltdb.Name, readOnlyConfig, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	if idx.(*UpsideDownCouch).countedFieldStats != nil {
+		t.Errorf("expected the field stats not to be counted when opening the index")
+	}
+	checkFieldStats(t, idx, expected)
+	checkVersion(t, idx, versionWithoutFieldStats)
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// otherwise the index is upgraded when opened
+	idx, err = NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Open()
+	if err != nil {
+		t.Fatalf("error opening index: %v", err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	checkVersion(t, idx, Version)
+	checkFieldStats(t, idx, expected)
+	if idx.(*UpsideDownCouch).countedFieldStats != nil {
+		t.Errorf("expected the field stats to be written out")
+	}
+}
+
+func checkVersion(t *testing.T, idx index.Index, expected uint8) {
+	kvstore, err := idx.Advanced()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvreader, err := kvstore.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := kvreader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	val, err := kvreader.Get(VersionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vr, err := NewVersionRowKV(VersionKey, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vr.version != expected {
+		t.Errorf("expected version %d, got %d", expected, vr.version)
+	}
+}
+
+func checkFieldStats(t *testing.T, idx index.Index, expected map[string]index.FieldStats) {
+	indexReader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := indexReader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for field, expectedStats := range expected {
+		actual, err := indexReader.(index.IndexReaderFieldStats).FieldStats(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expectedStats {
+			t.Errorf("expected %s stats %+v, got %+v", field, expectedStats, actual)
+		}
+	}
+}
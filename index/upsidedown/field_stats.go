@@ -0,0 +1,152 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upsidedown
+
+import (
+	"math"
+
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/store"
+)
+
+// fieldStatsDelta is the change to the statistics of a field made by
+// a batch, it is written as a merge of the field's FieldStatsRow
+type fieldStatsDelta struct {
+	docs       int64
+	totalTerms int64
+}
+
+type fieldStatsDeltas map[uint16]fieldStatsDelta
+
+// add counts the document with the given field lengths
+func (d fieldStatsDeltas) add(fieldLengths map[uint16]uint64) {
+	for field, length := range fieldLengths {
+		delta := d[field]
+		delta.docs++
+		delta.totalTerms += int64(length)
+		d[field] = delta
+	}
+}
+
+// remove uncounts the document with the given field lengths
+func (d fieldStatsDeltas) remove(fieldLengths map[uint16]uint64) {
+	for field, length := range fieldLengths {
+		delta := d[field]
+		delta.docs--
+		delta.totalTerms -= int64(length)
+		d[field] = delta
+	}
+}
+
+// fieldLengthFromNorm recovers the length of a field in a document,
+// which is the sum of the frequencies of its terms, from the norm
+// stored in each of its term frequency rows.
+func fieldLengthFromNorm(norm float32) uint64 {
+	if norm <= 0 {
+		return 0
+	}
+	return uint64(math.Round(1 / (float64(norm) * float64(norm))))
+}
+
+// fieldLengthsFromRows returns the lengths of the fields with at least
+// one term, in the analyzed rows of a document.
+func fieldLengthsFromRows(rows []index.IndexRow) map[uint16]uint64 {
+	var rv map[uint16]uint64
+	for _, row := range rows {
+		tfr, ok := row.(*TermFrequencyRow)
+		if !ok {
+			continue
+		}
+		if _, seen := rv[tfr.field]; !seen {
+			if rv == nil {
+				rv = make(map[uint16]uint64)
+			}
+			rv[tfr.field] = fieldLengthFromNorm(tfr.norm)
+		}
+	}
+	return rv
+}
+
+// fieldLengthsForDoc returns the lengths of the fields with at least
+// one term, in the indexed document with the given back index row. It
+// reads a single term frequency row per field.
+func fieldLengthsForDoc(kvreader store.KVReader, backIndexRow *BackIndexRow) (map[uint16]uint64, error) {
+	if backIndexRow == nil {
+		return nil, nil
+	}
+	var rv map[uint16]uint64
+	tfr := NewTermFrequencyRow(nil, 0, backIndexRow.doc, 0, 0)
+	for _, entry := range backIndexRow.termsEntries {
+		if len(entry.Terms) == 0 {
+			continue
+		}
+		field := uint16(entry.GetField())
+		if _, seen := rv[field]; seen {
+			continue
+		}
+		tfr.term = []byte(entry.Terms[0])
+		tfr.field = field
+		val, err := kvreader.Get(tfr.Key())
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		err = tfr.parseV(val, false)
+		if err != nil {
+			return nil, err
+		}
+		if rv == nil {
+			rv = make(map[uint16]uint64)
+		}
+		rv[field] = fieldLengthFromNorm(tfr.norm)
+	}
+	return rv, nil
+}
+
+// countFieldStats computes the statistics of all the fields from the
+// indexed documents.
+func countFieldStats(kvreader store.KVReader) (rv fieldStatsDeltas, err error) {
+	it := kvreader.PrefixIterator([]byte{'b'})
+	defer func() {
+		if cerr := it.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+
+	rv = make(fieldStatsDeltas)
+	key, val, valid := it.Current()
+	for valid {
+		var backIndexRow *BackIndexRow
+		backIndexRow, err = NewBackIndexRowKV(key, val)
+		if err != nil {
+			return nil, err
+		}
+		var fieldLengths map[uint16]uint64
+		fieldLengths, err = fieldLengthsForDoc(kvreader, backIndexRow)
+		if err != nil {
+			return nil, err
+		}
+		rv.add(fieldLengths)
+
+		it.Next()
+		key, val, valid = it.Current()
+	}
+	if err = store.IteratorErr(it); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
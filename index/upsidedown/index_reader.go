@@ -107,6 +107,9 @@ func (i *IndexReader) Document(id string) (doc *document.Document, err error) {
 		it.Next()
 		key, val, valid = it.Current()
 	}
+	if err = store.IteratorErr(it); err != nil {
+		doc = nil
+	}
 	return
 }
 
@@ -174,9 +177,47 @@ func (i *IndexReader) Fields() (fields []string, err error) {
 		it.Next()
 		key, val, valid = it.Current()
 	}
+	if err = store.IteratorErr(it); err != nil {
+		fields = nil
+	}
 	return
 }
 
+// FieldStats returns the statistics of a field, as maintained in its
+// field stats row.
+func (i *IndexReader) FieldStats(field string) (index.FieldStats, error) {
+	fieldIndex, fieldExists := i.index.fieldCache.FieldNamed(field, false)
+	if !fieldExists {
+		return index.FieldStats{}, nil
+	}
+
+	if i.index.version == versionWithoutFieldStats {
+		fieldStats, err := i.index.countedFieldStatsFor(i.kvreader)
+		if err != nil {
+			return index.FieldStats{}, err
+		}
+		delta := fieldStats[uint16(fieldIndex)]
+		return index.FieldStats{
+			Docs:       uint64(delta.docs),
+			TotalTerms: uint64(delta.totalTerms),
+		}, nil
+	}
+
+	fsr := NewFieldStatsRow(uint16(fieldIndex), 0, 0)
+	val, err := i.kvreader.Get(fsr.Key())
+	if err != nil || val == nil {
+		return index.FieldStats{}, err
+	}
+	err = fsr.parseV(val)
+	if err != nil {
+		return index.FieldStats{}, err
+	}
+	return index.FieldStats{
+		Docs:       fsr.docs,
+		TotalTerms: fsr.totalTerms,
+	}, nil
+}
+
 func (i *IndexReader) GetInternal(key []byte) ([]byte, error) {
 	internalRow := NewInternalRow(key, nil)
 	return i.kvreader.Get(internalRow.Key())
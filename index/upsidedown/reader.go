@@ -142,6 +142,7 @@ func (r *UpsideDownCouchTermFieldReader) Next(preAlloced *index.TermFieldDoc) (*
 			}
 			return rv, nil
 		}
+		return nil, store.IteratorErr(r.iterator)
 	}
 	return nil, nil
 }
@@ -179,6 +180,7 @@ func (r *UpsideDownCouchTermFieldReader) Advance(docID index.IndexInternalID, pr
 			}
 			return rv, nil
 		}
+		return nil, store.IteratorErr(r.iterator)
 	}
 	return nil, nil
 }
@@ -294,7 +296,7 @@ func (r *UpsideDownCouchDocIDReader) Next() (index.IndexInternalID, error) {
 			return rv, nil
 		}
 	}
-	return nil, nil
+	return nil, store.IteratorErr(r.iterator)
 }
 
 func (r *UpsideDownCouchDocIDReader) Advance(docID index.IndexInternalID) (index.IndexInternalID, error) {
@@ -352,7 +354,7 @@ func (r *UpsideDownCouchDocIDReader) Advance(docID index.IndexInternalID) (index
 			return rv, nil
 		}
 	}
-	return nil, nil
+	return nil, store.IteratorErr(r.iterator)
 }
 
 func (r *UpsideDownCouchDocIDReader) Close() error {
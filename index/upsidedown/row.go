@@ -66,6 +66,8 @@ func ParseFromKeyValue(key, value []byte) (UpsideDownCouchRow, error) {
 			return NewStoredRowKV(key, value)
 		case 'i':
 			return NewInternalRowKV(key, value)
+		case 'l':
+			return NewFieldStatsRowKV(key, value)
 		}
 		return nil, fmt.Errorf("Unknown field type '%s'", string(key[0]))
 	}
@@ -360,6 +362,121 @@ func dictionaryRowParseV(value []byte) (uint64, error) {
 	return count, nil
 }
 
+// FIELD STATS
+
+const FieldStatsRowMaxValueSize = 2 * binary.MaxVarintLen64
+
+// fieldStatsDeltaSize is the size of the merge operands applied to
+// field stats rows, a little endian int64 delta of the docs followed
+// by one of the total terms
+const fieldStatsDeltaSize = 16
+
+type FieldStatsRow struct {
+	field      uint16
+	docs       uint64
+	totalTerms uint64
+}
+
+func (fsr *FieldStatsRow) Key() []byte {
+	buf := make([]byte, fsr.KeySize())
+	size, _ := fsr.KeyTo(buf)
+	return buf[:size]
+}
+
+func (fsr *FieldStatsRow) KeySize() int {
+	return 3
+}
+
+func (fsr *FieldStatsRow) KeyTo(buf []byte) (int, error) {
+	return fieldStatsRowKeyTo(buf, fsr.field), nil
+}
+
+func fieldStatsRowKeyTo(buf []byte, field uint16) int {
+	buf[0] = 'l'
+	binary.LittleEndian.PutUint16(buf[1:3], field)
+	return 3
+}
+
+func (fsr *FieldStatsRow) Value() []byte {
+	buf := make([]byte, fsr.ValueSize())
+	size, _ := fsr.ValueTo(buf)
+	return buf[:size]
+}
+
+func (fsr *FieldStatsRow) ValueSize() int {
+	return FieldStatsRowMaxValueSize
+}
+
+func (fsr *FieldStatsRow) ValueTo(buf []byte) (int, error) {
+	used := binary.PutUvarint(buf, fsr.docs)
+	used += binary.PutUvarint(buf[used:], fsr.totalTerms)
+	return used, nil
+}
+
+func (fsr *FieldStatsRow) String() string {
+	return fmt.Sprintf("Field Stats: %d Docs: %d Total Terms: %d", fsr.field, fsr.docs, fsr.totalTerms)
+}
+
+func NewFieldStatsRow(field uint16, docs, totalTerms uint64) *FieldStatsRow {
+	return &FieldStatsRow{
+		field:      field,
+		docs:       docs,
+		totalTerms: totalTerms,
+	}
+}
+
+func NewFieldStatsRowKV(key, value []byte) (*FieldStatsRow, error) {
+	rv, err := NewFieldStatsRowK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rv.parseV(value)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func NewFieldStatsRowK(key []byte) (*FieldStatsRow, error) {
+	if len(key) != 3 {
+		return nil, fmt.Errorf("invalid field stats key, expected 3 bytes, got %d", len(key))
+	}
+	return &FieldStatsRow{
+		field: binary.LittleEndian.Uint16(key[1:3]),
+	}, nil
+}
+
+func (fsr *FieldStatsRow) parseV(value []byte) error {
+	docs, nread := binary.Uvarint(value)
+	if nread <= 0 {
+		return fmt.Errorf("FieldStatsRow parse Uvarint error, nread: %d", nread)
+	}
+	totalTerms, n := binary.Uvarint(value[nread:])
+	if n <= 0 {
+		return fmt.Errorf("FieldStatsRow parse Uvarint error, nread: %d", n)
+	}
+	fsr.docs = docs
+	fsr.totalTerms = totalTerms
+	return nil
+}
+
+// applyDelta adds a field stats merge operand to the row, without
+// letting either count go below zero
+func (fsr *FieldStatsRow) applyDelta(operand []byte) {
+	fsr.docs = addDelta(fsr.docs, int64(binary.LittleEndian.Uint64(operand[0:8])))
+	fsr.totalTerms = addDelta(fsr.totalTerms, int64(binary.LittleEndian.Uint64(operand[8:16])))
+}
+
+func addDelta(count uint64, delta int64) uint64 {
+	if delta < 0 && uint64(-delta) > count {
+		return 0
+	} else if delta < 0 {
+		return count - uint64(-delta)
+	}
+	return count + uint64(delta)
+}
+
 // TERM FIELD FREQUENCY
 
 type TermVector struct {
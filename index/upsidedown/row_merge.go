@@ -34,6 +34,10 @@ func init() {
 type upsideDownMerge struct{}
 
 func (m *upsideDownMerge) FullMerge(key, existingValue []byte, operands [][]byte) ([]byte, bool) {
+	if len(key) > 0 && key[0] == 'l' {
+		return m.fullMergeFieldStats(key, existingValue, operands)
+	}
+
 	// set up record based on key
 	dr, err := NewDictionaryRowK(key)
 	if err != nil {
@@ -63,7 +67,42 @@ func (m *upsideDownMerge) FullMerge(key, existingValue []byte, operands [][]byte
 	return dr.Value(), true
 }
 
+func (m *upsideDownMerge) fullMergeFieldStats(key, existingValue []byte, operands [][]byte) ([]byte, bool) {
+	fsr, err := NewFieldStatsRowK(key)
+	if err != nil {
+		return nil, false
+	}
+	if len(existingValue) > 0 {
+		err = fsr.parseV(existingValue)
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	for _, operand := range operands {
+		if len(operand) != fieldStatsDeltaSize {
+			return nil, false
+		}
+		fsr.applyDelta(operand)
+	}
+
+	return fsr.Value(), true
+}
+
 func (m *upsideDownMerge) PartialMerge(key, leftOperand, rightOperand []byte) ([]byte, bool) {
+	if len(key) > 0 && key[0] == 'l' {
+		if len(leftOperand) != fieldStatsDeltaSize || len(rightOperand) != fieldStatsDeltaSize {
+			return nil, false
+		}
+		rv := make([]byte, fieldStatsDeltaSize)
+		for i := 0; i < fieldStatsDeltaSize; i += 8 {
+			left := int64(binary.LittleEndian.Uint64(leftOperand[i:]))
+			right := int64(binary.LittleEndian.Uint64(rightOperand[i:]))
+			binary.LittleEndian.PutUint64(rv[i:], uint64(left+right))
+		}
+		return rv, true
+	}
+
 	left := int64(binary.LittleEndian.Uint64(leftOperand))
 	right := int64(binary.LittleEndian.Uint64(rightOperand))
 	rv := make([]byte, 8)
@@ -50,6 +50,68 @@ func TestPartialMerge(t *testing.T) {
 
 }
 
+func TestFieldStatsMerge(t *testing.T) {
+	delta := func(docs, totalTerms int64) []byte {
+		rv := make([]byte, fieldStatsDeltaSize)
+		binary.LittleEndian.PutUint64(rv, uint64(docs))
+		binary.LittleEndian.PutUint64(rv[8:], uint64(totalTerms))
+		return rv
+	}
+
+	tests := []struct {
+		existing *FieldStatsRow
+		in       [][]byte
+		out      *FieldStatsRow
+	}{
+		{
+			in:  [][]byte{delta(1, 3), delta(1, 5), delta(1, 2)},
+			out: NewFieldStatsRow(1, 3, 10),
+		},
+		{
+			existing: NewFieldStatsRow(1, 3, 10),
+			in:       [][]byte{delta(-1, -5), delta(1, 7)},
+			out:      NewFieldStatsRow(1, 3, 12),
+		},
+		// counts don't go below zero
+		{
+			existing: NewFieldStatsRow(1, 1, 2),
+			in:       [][]byte{delta(-2, -3)},
+			out:      NewFieldStatsRow(1, 0, 0),
+		},
+	}
+
+	mo := &upsideDownMerge{}
+	key := NewFieldStatsRow(1, 0, 0).Key()
+	for _, test := range tests {
+		var existing []byte
+		if test.existing != nil {
+			existing = test.existing.Value()
+		}
+		actual, ok := mo.FullMerge(key, existing, test.in)
+		if !ok {
+			t.Fatalf("expected full merge ok")
+		}
+		if !bytes.Equal(actual, test.out.Value()) {
+			t.Errorf("expected %v, got %v", test.out.Value(), actual)
+		}
+
+		partial := test.in[0]
+		for _, next := range test.in[1:] {
+			partial, ok = mo.PartialMerge(key, partial, next)
+			if !ok {
+				t.Fatalf("expected partial merge ok")
+			}
+		}
+		actual, ok = mo.FullMerge(key, existing, [][]byte{partial})
+		if !ok {
+			t.Fatalf("expected full merge ok")
+		}
+		if !bytes.Equal(actual, test.out.Value()) {
+			t.Errorf("expected %v after partial merge, got %v", test.out.Value(), actual)
+		}
+	}
+}
+
 func decodeCount(in []byte) uint64 {
 	buf := bytes.NewBuffer(in)
 	count, _ := binary.ReadUvarint(buf)
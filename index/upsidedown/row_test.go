@@ -53,6 +53,11 @@ func TestRows(t *testing.T) {
 			[]byte{'d', 0, 0, 'b', 'e', 'e', 'r'},
 			[]byte{27},
 		},
+		{
+			NewFieldStatsRow(1, 27, 300),
+			[]byte{'l', 1, 0},
+			[]byte{27, 172, 2},
+		},
 		{
 			NewTermFrequencyRow([]byte{'b', 'e', 'e', 'r'}, 0, []byte("catz"), 3, 3.14),
 			[]byte{'t', 0, 0, 'b', 'e', 'e', 'r', ByteSeparator, 'c', 'a', 't', 'z'},
@@ -167,6 +172,16 @@ func TestInvalidRows(t *testing.T) {
 			[]byte{'f', 0, 0},
 			[]byte{},
 		},
+		// type l, invalid key (missing field)
+		{
+			[]byte{'l'},
+			[]byte{27, 172, 2},
+		},
+		// type l, invalid val (missing total terms)
+		{
+			[]byte{'l', 1, 0},
+			[]byte{27},
+		},
 		// type t, invalid key (missing field)
 		{
 			[]byte{'t'},
@@ -45,7 +45,14 @@ const RowBufferSize = 4 * 1024
 
 var VersionKey = []byte{'v'}
 
-const Version uint8 = 7
+// Version 8 added the field stats rows. Version 7 indexes are upgraded
+// when opened, counting the stats of every field from the back index,
+// which reads one term frequency row per field of each document.
+const Version uint8 = 8
+
+// versionWithoutFieldStats is the version of the indexes built before
+// the field stats rows, which read-only indexes count when first needed.
+const versionWithoutFieldStats uint8 = 7
 
 var IncompatibleVersion = fmt.Errorf("incompatible version, %d is supported", Version)
 
@@ -63,6 +70,11 @@ type UpsideDownCouch struct {
 	// fields protected by m
 	docCount uint64
 
+	// the statistics of the fields of a read-only index built before
+	// they were maintained in field stats rows, counted when first needed
+	countedFieldStatsMutex sync.Mutex
+	countedFieldStats      fieldStatsDeltas
+
 	writeMutex sync.Mutex
 }
 
@@ -70,6 +82,8 @@ type docBackIndexRow struct {
 	docID        string
 	doc          *document.Document // If deletion, doc will be nil.
 	backIndexRow *BackIndexRow
+	// the lengths of the doc's fields, before this batch
+	fieldLengths map[uint16]uint64
 }
 
 func NewUpsideDownCouch(storeName string, storeConfig map[string]interface{}, analysisQueue *index.AnalysisQueue) (index.Index, error) {
@@ -90,7 +104,7 @@ func (udc *UpsideDownCouch) init(kvwriter store.KVWriter) (err error) {
 		{NewVersionRow(udc.version)},
 	}
 
-	err = udc.batchRows(kvwriter, nil, rowsAll, nil)
+	err = udc.batchRows(kvwriter, nil, rowsAll, nil, nil)
 	return
 }
 
@@ -115,6 +129,9 @@ func (udc *UpsideDownCouch) loadSchema(kvreader store.KVReader) (err error) {
 		it.Next()
 		key, val, valid = it.Current()
 	}
+	if err = store.IteratorErr(it); err != nil {
+		return
+	}
 
 	val, err = kvreader.Get([]byte{'v'})
 	if err != nil {
@@ -125,10 +142,11 @@ func (udc *UpsideDownCouch) loadSchema(kvreader store.KVReader) (err error) {
 	if err != nil {
 		return
 	}
-	if vr.version != Version {
+	if vr.version != Version && vr.version != versionWithoutFieldStats {
 		err = IncompatibleVersion
 		return
 	}
+	udc.version = vr.version
 
 	return
 }
@@ -147,7 +165,7 @@ func PutRowBuffer(buf []byte) {
 	rowBufferPool.Put(buf)
 }
 
-func (udc *UpsideDownCouch) batchRows(writer store.KVWriter, addRowsAll [][]UpsideDownCouchRow, updateRowsAll [][]UpsideDownCouchRow, deleteRowsAll [][]UpsideDownCouchRow) (err error) {
+func (udc *UpsideDownCouch) batchRows(writer store.KVWriter, addRowsAll [][]UpsideDownCouchRow, updateRowsAll [][]UpsideDownCouchRow, deleteRowsAll [][]UpsideDownCouchRow, fieldStatsDeltas fieldStatsDeltas) (err error) {
 	dictionaryDeltas := make(map[string]int64)
 
 	// count up bytes needed for buffering.
@@ -220,6 +238,15 @@ func (udc *UpsideDownCouch) batchRows(writer store.KVWriter, addRowsAll [][]Upsi
 		mergeKeyBytes += len(dictRowKey)
 	}
 
+	for field, delta := range fieldStatsDeltas {
+		if delta == (fieldStatsDelta{}) {
+			delete(fieldStatsDeltas, field)
+		}
+	}
+	mergeNum += len(fieldStatsDeltas)
+	mergeKeyBytes += 3 * len(fieldStatsDeltas)
+	mergeValBytes += fieldStatsDeltaSize * len(fieldStatsDeltas)
+
 	// prepare batch
 	totBytes := addKeyBytes + addValBytes +
 		updateKeyBytes + updateValBytes +
@@ -288,6 +315,14 @@ func (udc *UpsideDownCouch) batchRows(writer store.KVWriter, addRowsAll [][]Upsi
 		buf = buf[dictRowKeyLen+DictionaryRowMaxValueSize:]
 	}
 
+	for field, delta := range fieldStatsDeltas {
+		fieldStatsRowKeyLen := fieldStatsRowKeyTo(buf, field)
+		binary.LittleEndian.PutUint64(buf[fieldStatsRowKeyLen:], uint64(delta.docs))
+		binary.LittleEndian.PutUint64(buf[fieldStatsRowKeyLen+8:], uint64(delta.totalTerms))
+		wb.Merge(buf[:fieldStatsRowKeyLen], buf[fieldStatsRowKeyLen:fieldStatsRowKeyLen+fieldStatsDeltaSize])
+		buf = buf[fieldStatsRowKeyLen+fieldStatsDeltaSize:]
+	}
+
 	// write out the batch
 	return writer.ExecuteBatch(wb)
 }
@@ -335,6 +370,26 @@ func (udc *UpsideDownCouch) Open() (err error) {
 		udc.m.Lock()
 		udc.docCount, err = udc.countDocs(kvreader)
 		udc.m.Unlock()
+		if err != nil {
+			_ = kvreader.Close()
+			return
+		}
+
+		if udc.version == versionWithoutFieldStats && !udc.readOnly() {
+			var fieldStats fieldStatsDeltas
+			fieldStats, err = countFieldStats(kvreader)
+			if err != nil {
+				_ = kvreader.Close()
+				return
+			}
+
+			err = kvreader.Close()
+			if err != nil {
+				return
+			}
+
+			return udc.upgradeFieldStats(fieldStats)
+		}
 
 		err = kvreader.Close()
 	} else {
@@ -362,6 +417,50 @@ func (udc *UpsideDownCouch) Open() (err error) {
 	return
 }
 
+func (udc *UpsideDownCouch) readOnly() bool {
+	ro, ok := udc.storeConfig["read_only"].(bool)
+	return ok && ro
+}
+
+// upgradeFieldStats writes out the field stats counted when opening an
+// index built before they were maintained, along with the version row.
+func (udc *UpsideDownCouch) upgradeFieldStats(fieldStats fieldStatsDeltas) (err error) {
+	var kvwriter store.KVWriter
+	kvwriter, err = udc.store.Writer()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if cerr := kvwriter.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+
+	rowsAll := [][]UpsideDownCouchRow{
+		{NewVersionRow(Version)},
+	}
+	err = udc.batchRows(kvwriter, nil, rowsAll, nil, fieldStats)
+	if err == nil {
+		udc.version = Version
+	}
+	return
+}
+
+// countedFieldStatsFor returns the field stats of a read-only index built
+// before they were maintained, counting them the first time.
+func (udc *UpsideDownCouch) countedFieldStatsFor(kvreader store.KVReader) (fieldStatsDeltas, error) {
+	udc.countedFieldStatsMutex.Lock()
+	defer udc.countedFieldStatsMutex.Unlock()
+	if udc.countedFieldStats == nil {
+		fieldStats, err := countFieldStats(kvreader)
+		if err != nil {
+			return nil, err
+		}
+		udc.countedFieldStats = fieldStats
+	}
+	return udc.countedFieldStats, nil
+}
+
 func (udc *UpsideDownCouch) countDocs(kvreader store.KVReader) (count uint64, err error) {
 	it := kvreader.PrefixIterator([]byte{'b'})
 	defer func() {
@@ -376,6 +475,7 @@ func (udc *UpsideDownCouch) countDocs(kvreader store.KVReader) (count uint64, er
 		it.Next()
 		_, _, valid = it.Current()
 	}
+	err = store.IteratorErr(it)
 
 	return
 }
@@ -404,6 +504,7 @@ func (udc *UpsideDownCouch) rowCount() (count uint64, err error) {
 		it.Next()
 		_, _, valid = it.Current()
 	}
+	err = store.IteratorErr(it)
 
 	return
 }
@@ -446,16 +547,49 @@ func (udc *UpsideDownCouch) Update(doc *document.Document) (err error) {
 		return
 	}
 
+	var fieldLengths map[uint16]uint64
+	fieldLengths, err = fieldLengthsForDoc(kvreader, backIndexRow)
+	if err != nil {
+		_ = kvreader.Close()
+		atomic.AddUint64(&udc.stats.errors, 1)
+		return
+	}
+
 	err = kvreader.Close()
 	if err != nil {
 		return
 	}
 
-	return udc.UpdateWithAnalysis(doc, result, backIndexRow)
+	return udc.updateWithAnalysis(doc, result, backIndexRow, fieldLengths)
 }
 
 func (udc *UpsideDownCouch) UpdateWithAnalysis(doc *document.Document,
 	result *index.AnalysisResult, backIndexRow *BackIndexRow) (err error) {
+	var fieldLengths map[uint16]uint64
+	if backIndexRow != nil {
+		var kvreader store.KVReader
+		kvreader, err = udc.store.Reader()
+		if err != nil {
+			return
+		}
+		fieldLengths, err = fieldLengthsForDoc(kvreader, backIndexRow)
+		if cerr := kvreader.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+		if err != nil {
+			atomic.AddUint64(&udc.stats.errors, 1)
+			return
+		}
+	}
+
+	return udc.updateWithAnalysis(doc, result, backIndexRow, fieldLengths)
+}
+
+// updateWithAnalysis indexes the analyzed doc, replacing the one with
+// the given back index row and field lengths if it exists.
+func (udc *UpsideDownCouch) updateWithAnalysis(doc *document.Document,
+	result *index.AnalysisResult, backIndexRow *BackIndexRow,
+	fieldLengths map[uint16]uint64) (err error) {
 	// start a writer for this update
 	indexStart := time.Now()
 	var kvwriter store.KVWriter
@@ -485,7 +619,11 @@ func (udc *UpsideDownCouch) UpdateWithAnalysis(doc *document.Document,
 		deleteRowsAll = append(deleteRowsAll, deleteRows)
 	}
 
-	err = udc.batchRows(kvwriter, addRowsAll, updateRowsAll, deleteRowsAll)
+	fieldStatsDeltas := make(fieldStatsDeltas)
+	fieldStatsDeltas.remove(fieldLengths)
+	fieldStatsDeltas.add(fieldLengthsFromRows(result.Rows))
+
+	err = udc.batchRows(kvwriter, addRowsAll, updateRowsAll, deleteRowsAll, fieldStatsDeltas)
 	if err == nil && backIndexRow == nil {
 		udc.m.Lock()
 		udc.docCount++
@@ -668,6 +806,14 @@ func (udc *UpsideDownCouch) Delete(id string) (err error) {
 		return
 	}
 
+	var fieldLengths map[uint16]uint64
+	fieldLengths, err = fieldLengthsForDoc(kvreader, backIndexRow)
+	if err != nil {
+		_ = kvreader.Close()
+		atomic.AddUint64(&udc.stats.errors, 1)
+		return
+	}
+
 	err = kvreader.Close()
 	if err != nil {
 		return
@@ -697,7 +843,10 @@ func (udc *UpsideDownCouch) Delete(id string) (err error) {
 		deleteRowsAll = append(deleteRowsAll, deleteRows)
 	}
 
-	err = udc.batchRows(kvwriter, nil, nil, deleteRowsAll)
+	fieldStatsDeltas := make(fieldStatsDeltas)
+	fieldStatsDeltas.remove(fieldLengths)
+
+	err = udc.batchRows(kvwriter, nil, nil, deleteRowsAll, fieldStatsDeltas)
 	if err == nil {
 		udc.m.Lock()
 		udc.docCount--
@@ -861,7 +1010,13 @@ func (udc *UpsideDownCouch) Batch(batch *index.Batch) (err error) {
 				return
 			}
 
-			docBackIndexRowCh <- &docBackIndexRow{docID, doc, backIndexRow}
+			fieldLengths, err := fieldLengthsForDoc(kvreader, backIndexRow)
+			if err != nil {
+				docBackIndexRowErr = err
+				return
+			}
+
+			docBackIndexRowCh <- &docBackIndexRow{docID, doc, backIndexRow, fieldLengths}
 		}
 	}()
 
@@ -909,6 +1064,8 @@ func (udc *UpsideDownCouch) Batch(batch *index.Batch) (err error) {
 		deleteRowsAll = append(deleteRowsAll, deleteRows)
 	}
 
+	fieldStatsDeltas := make(fieldStatsDeltas)
+
 	// process back index rows as they arrive
 	for dbir := range docBackIndexRowCh {
 		if dbir.doc == nil && dbir.backIndexRow != nil {
@@ -917,6 +1074,7 @@ func (udc *UpsideDownCouch) Batch(batch *index.Batch) (err error) {
 			if len(deleteRows) > 0 {
 				deleteRowsAll = append(deleteRowsAll, deleteRows)
 			}
+			fieldStatsDeltas.remove(dbir.fieldLengths)
 			docsDeleted++
 		} else if dbir.doc != nil {
 			addRows, updateRows, deleteRows := udc.mergeOldAndNew(dbir.backIndexRow, newRowsMap[dbir.docID])
@@ -929,6 +1087,8 @@ func (udc *UpsideDownCouch) Batch(batch *index.Batch) (err error) {
 			if len(deleteRows) > 0 {
 				deleteRowsAll = append(deleteRowsAll, deleteRows)
 			}
+			fieldStatsDeltas.remove(dbir.fieldLengths)
+			fieldStatsDeltas.add(fieldLengthsFromRows(newRowsMap[dbir.docID]))
 			if dbir.backIndexRow == nil {
 				docsAdded++
 			}
@@ -946,7 +1106,7 @@ func (udc *UpsideDownCouch) Batch(batch *index.Batch) (err error) {
 		return
 	}
 
-	err = udc.batchRows(kvwriter, addRowsAll, updateRowsAll, deleteRowsAll)
+	err = udc.batchRows(kvwriter, addRowsAll, updateRowsAll, deleteRowsAll, fieldStatsDeltas)
 	if err != nil {
 		_ = kvwriter.Close()
 		atomic.AddUint64(&udc.stats.errors, 1)
@@ -34,6 +34,11 @@ import (
 	"github.com/blevesearch/bleve/registry"
 )
 
+// testStoreName and testStoreConfig choose the KVStore that the index tests use, so
+// that the same tests can be run against other stores.
+var testStoreName = boltdb.Name
+var testStoreConfig = boltTestConfig
+
 var testAnalyzer = &analysis.Analyzer{
 	Tokenizer: regexpTokenizer.NewRegexpTokenizer(regexp.MustCompile(`\w+`)),
 }
@@ -47,7 +52,7 @@ func TestIndexOpenReopen(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -89,7 +94,7 @@ func TestIndexOpenReopen(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	idx, err = NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err = NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -114,7 +119,7 @@ func TestIndexInsert(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -170,8 +175,8 @@ func TestIndexInsert(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// should have 4 rows (1 for version, 1 for schema field, and 1 for single term, and 1 for the term count, and 1 for the back index entry)
-	expectedLength := uint64(1 + 1 + 1 + 1 + 1)
+	// should have 6 rows (1 for version, 1 for schema field, and 1 for single term, and 1 for the term count, and 1 for the field stats, and 1 for the back index entry)
+	expectedLength := uint64(1 + 1 + 1 + 1 + 1 + 1)
 	rowCount, err := idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -190,7 +195,7 @@ func TestIndexInsertThenDelete(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -298,8 +303,8 @@ func TestIndexInsertThenDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// should have 2 rows (1 for version, 1 for schema field, 1 for dictionary row garbage)
-	expectedLength := uint64(1 + 1 + 1)
+	// should have 4 rows (1 for version, 1 for schema field, 1 for dictionary row garbage, 1 for the emptied field stats)
+	expectedLength := uint64(1 + 1 + 1 + 1)
 	rowCount, err := idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -318,7 +323,7 @@ func TestIndexInsertThenUpdate(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -348,8 +353,8 @@ func TestIndexInsertThenUpdate(t *testing.T) {
 		t.Errorf("Error deleting entry from index: %v", err)
 	}
 
-	// should have 2 rows (1 for version, 1 for schema field, and 2 for the two term, and 2 for the term counts, and 1 for the back index entry)
-	expectedLength := uint64(1 + 1 + 2 + 2 + 1)
+	// should have 8 rows (1 for version, 1 for schema field, and 2 for the two term, and 2 for the term counts, and 1 for the field stats, and 1 for the back index entry)
+	expectedLength := uint64(1 + 1 + 2 + 2 + 1 + 1)
 	rowCount, err := idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -367,7 +372,7 @@ func TestIndexInsertThenUpdate(t *testing.T) {
 	}
 
 	// should have 2 rows (1 for version, 1 for schema field, and 1 for the remaining term, and 2 for the term diciontary, and 1 for the back index entry)
-	expectedLength = uint64(1 + 1 + 1 + 2 + 1)
+	expectedLength = uint64(1 + 1 + 1 + 2 + 1 + 1)
 	rowCount, err = idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -386,7 +391,7 @@ func TestIndexInsertMultiple(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -413,8 +418,8 @@ func TestIndexInsertMultiple(t *testing.T) {
 	}
 	expectedCount++
 
-	// should have 4 rows (1 for version, 1 for schema field, and 2 for single term, and 1 for the term count, and 2 for the back index entries)
-	expectedLength := uint64(1 + 1 + 2 + 1 + 2)
+	// should have 8 rows (1 for version, 1 for schema field, and 2 for single term, and 1 for the term count, and 1 for the field stats, and 2 for the back index entries)
+	expectedLength := uint64(1 + 1 + 2 + 1 + 1 + 2)
 	rowCount, err := idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -429,7 +434,7 @@ func TestIndexInsertMultiple(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	idx, err = NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err = NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -478,7 +483,7 @@ func TestIndexInsertWithStore(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -534,8 +539,8 @@ func TestIndexInsertWithStore(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// should have 6 rows (1 for version, 1 for schema field, and 1 for single term, and 1 for the stored field and 1 for the term count, and 1 for the back index entry)
-	expectedLength := uint64(1 + 1 + 1 + 1 + 1 + 1)
+	// should have 7 rows (1 for version, 1 for schema field, and 1 for single term, and 1 for the stored field and 1 for the term count, and 1 for the field stats, and 1 for the back index entry)
+	expectedLength := uint64(1 + 1 + 1 + 1 + 1 + 1 + 1)
 	rowCount, err := idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -581,7 +586,7 @@ func TestIndexInternalCRUD(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -675,7 +680,7 @@ func TestIndexBatch(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -776,7 +781,7 @@ func TestIndexInsertUpdateDeleteWithMultipleTypesStored(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -848,8 +853,9 @@ func TestIndexInsertUpdateDeleteWithMultipleTypesStored(t *testing.T) {
 	// 1 for the text term count
 	// 16 for numeric term counts
 	// 16 for date term counts
+	// 3 for the field stats
 	// 1 for the back index entry
-	expectedLength := uint64(1 + 3 + 1 + (64 / document.DefaultPrecisionStep) + (64 / document.DefaultPrecisionStep) + 3 + 1 + (64 / document.DefaultPrecisionStep) + (64 / document.DefaultPrecisionStep) + 1)
+	expectedLength := uint64(1 + 3 + 1 + (64 / document.DefaultPrecisionStep) + (64 / document.DefaultPrecisionStep) + 3 + 1 + (64 / document.DefaultPrecisionStep) + (64 / document.DefaultPrecisionStep) + 3 + 1)
 	rowCount, err := idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -996,7 +1002,7 @@ func TestIndexInsertFields(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1056,7 +1062,7 @@ func TestIndexUpdateComposites(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1086,8 +1092,9 @@ func TestIndexUpdateComposites(t *testing.T) {
 	// 4 for text term
 	// 2 for the stored field
 	// 4 for the text term count
+	// 3 for the field stats
 	// 1 for the back index entry
-	expectedLength := uint64(1 + 3 + 4 + 2 + 4 + 1)
+	expectedLength := uint64(1 + 3 + 4 + 2 + 4 + 3 + 1)
 	rowCount, err := idx.(*UpsideDownCouch).rowCount()
 	if err != nil {
 		t.Error(err)
@@ -1153,7 +1160,7 @@ func TestIndexFieldsMisc(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1200,7 +1207,7 @@ func TestIndexTermReaderCompositeFields(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1261,7 +1268,7 @@ func TestIndexDocumentVisitFieldTerms(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1357,7 +1364,7 @@ func TestConcurrentUpdate(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1418,7 +1425,7 @@ func TestLargeField(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1458,7 +1465,7 @@ func TestIndexBatchPersistedCallbackWithErrorUpsideDown(t *testing.T) {
 	}()
 
 	analysisQueue := index.NewAnalysisQueue(1)
-	idx, err := NewUpsideDownCouch(boltdb.Name, boltTestConfig, analysisQueue)
+	idx, err := NewUpsideDownCouch(testStoreName, testStoreConfig, analysisQueue)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -16,6 +16,7 @@ package bleve
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/blevesearch/bleve/index/store"
 	"github.com/blevesearch/bleve/mapping"
 	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
 )
 
 type indexAliasImpl struct {
@@ -449,6 +451,59 @@ func createChildSearchRequest(req *SearchRequest) *SearchRequest {
 	return &rv
 }
 
+var errNoIndexReader = fmt.Errorf("index has no reader")
+
+// leafIndexes returns the indexes, with the aliases among them replaced
+// by the indexes they alias.
+func leafIndexes(indexes []Index) []Index {
+	var rv []Index
+	for _, in := range indexes {
+		if alias, ok := in.(*indexAliasImpl); ok {
+			alias.VisitIndexes(func(in Index) {
+				rv = append(rv, leafIndexes([]Index{in})...)
+			})
+			continue
+		}
+		rv = append(rv, in)
+	}
+	return rv
+}
+
+// resolveMoreLikeThis returns the query with its more like this queries
+// resolved with the statistics of all the indexes, which the indexes
+// searched alone don't have. If any of them has no reader, such as a
+// remote index, the query is returned as is, for each to resolve alone.
+func resolveMoreLikeThis(q query.Query, indexes []Index) (query.Query, error) {
+	leaves := leafIndexes(indexes)
+	if len(leaves) == 0 {
+		return q, nil
+	}
+	var readers []index.IndexReader
+	defer func() {
+		for _, r := range readers {
+			_ = r.Close()
+		}
+	}()
+	rv, err := query.ResolveMoreLikeThisQueries(q, func() ([]index.IndexReader, error) {
+		for _, in := range leaves {
+			i, _, err := in.Advanced()
+			if err != nil || i == nil {
+				return nil, errNoIndexReader
+			}
+			r, err := i.Reader()
+			if err != nil {
+				return nil, err
+			}
+			readers = append(readers, r)
+		}
+		return readers, nil
+	}, leaves[0].Mapping())
+	if err == errNoIndexReader {
+		return q, nil
+	}
+	return rv, err
+}
+
 type asyncSearchResult struct {
 	Name   string
 	Result *SearchResult
@@ -480,9 +535,16 @@ func MultiSearch(ctx context.Context, req *SearchRequest, indexes ...Index) (*Se
 		waitGroup.Done()
 	}
 
+	childQuery, err := resolveMoreLikeThis(req.Query, indexes)
+	if err != nil {
+		return nil, err
+	}
+
 	waitGroup.Add(len(indexes))
 	for _, in := range indexes {
-		go searchChildIndex(in, createChildSearchRequest(req))
+		childReq := createChildSearchRequest(req)
+		childReq.Query = childQuery
+		go searchChildIndex(in, childReq)
 	}
 
 	// on another go routine, close after finished
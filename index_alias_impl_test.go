@@ -18,15 +18,18 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/blevesearch/bleve/document"
 	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/scorch"
 	"github.com/blevesearch/bleve/index/store"
 	"github.com/blevesearch/bleve/mapping"
 	"github.com/blevesearch/bleve/numeric"
 	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
 )
 
 func TestIndexAliasSingle(t *testing.T) {
@@ -1349,3 +1352,97 @@ func (i *stubIndex) Name() string {
 func (i *stubIndex) SetName(name string) {
 	i.name = name
 }
+
+func TestMultiSearchMoreLikeThis(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx1, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx1.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	idx2, err := NewMemOnly(NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx2.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for idx, docs := range map[Index]map[string]string{
+		idx1: {
+			"a": "stout porter stout porter ale",
+			"b": "lager pilsner",
+		},
+		idx2: {
+			"c": "stout porter",
+			"d": "ale ale",
+			"e": "lager",
+		},
+	} {
+		for id, desc := range docs {
+			err = idx.Index(id, map[string]interface{}{"desc": desc})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	alias := NewIndexAlias(idx1, idx2)
+
+	like := NewMoreLikeThisQuery([]string{"a"}, []string{"desc"})
+	like.MinDocFreq = 1
+	likeIncluded := NewMoreLikeThisQuery([]string{"a"}, []string{"desc"})
+	likeIncluded.MinDocFreq = 1
+	likeIncluded.Include = true
+	likeText := NewMoreLikeThisTextQuery("lager lager ale", []string{"desc"})
+	likeText.MinTermFreq = 1
+	likeText.MinDocFreq = 1
+	likeText.MaxQueryTerms = 1
+	likeFrequent := NewMoreLikeThisTextQuery("lager ale", []string{"desc"})
+	likeFrequent.MinTermFreq = 1
+	likeFrequent.MinDocFreq = 3
+
+	tests := []struct {
+		q   query.Query
+		ids []string
+	}{
+		// The terms of a found in idx1 are searched for in idx2 too.
+		{q: like, ids: []string{"c"}},
+		{q: likeIncluded, ids: []string{"a", "c"}},
+		{q: likeText, ids: []string{"b", "e"}},
+		{q: likeFrequent, ids: nil},
+		{q: NewConjunctionQuery(like, NewTermQuery("porter")), ids: []string{"c"}},
+	}
+	for i, test := range tests {
+		res, err := alias.Search(NewSearchRequest(test.q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.ID)
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("test %d: expected hits %v, got %v", i, test.ids, ids)
+		}
+	}
+
+	// An index alone only has its own statistics.
+	res, err := idx1.Search(NewSearchRequest(likeIncluded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].ID != "a" {
+		t.Errorf("expected only a to match in its index, got %v", res.Hits)
+	}
+}
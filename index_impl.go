@@ -482,6 +482,7 @@ func (i *indexImpl) SearchInContext(ctx context.Context, req *SearchRequest) (sr
 		Explain:            req.Explain,
 		IncludeTermVectors: req.IncludeLocations || req.Highlight != nil,
 		Score:              req.Score,
+		Similarity:         similarityForField(i.m),
 	})
 	if err != nil {
 		return nil, err
@@ -922,3 +923,19 @@ func (m *searchHitSorter) Less(i, j int) bool {
 	c := m.sort.Compare(m.cachedScoring, m.cachedDesc, m.hits[i], m.hits[j])
 	return c < 0
 }
+
+// similarityForField returns the similarity configured by the mapping for
+// a field, nil meaning the default one.
+func similarityForField(im mapping.IndexMapping) func(field string) search.Similarity {
+	m, ok := im.(mapping.SimilarityMapping)
+	if !ok {
+		return nil
+	}
+	return func(field string) search.Similarity {
+		name := m.SimilarityNameForPath(field)
+		if name == "" {
+			return nil
+		}
+		return m.SimilarityNamed(name)
+	}
+}
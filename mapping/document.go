@@ -75,6 +75,12 @@ func (dm *DocumentMapping) Validate(cache *registry.Cache) error {
 				return err
 			}
 		}
+		if field.Similarity != "" {
+			_, err = cache.SimilarityNamed(field.Similarity)
+			if err != nil {
+				return err
+			}
+		}
 		switch field.Type {
 		case "text", "datetime", "number", "boolean", "geopoint":
 		default:
@@ -95,6 +101,17 @@ func (dm *DocumentMapping) analyzerNameForPath(path string) string {
 	return ""
 }
 
+// similarityNameForPath attempts to first find the field
+// described by this path, then returns the similarity
+// configured for that field
+func (dm *DocumentMapping) similarityNameForPath(path string) string {
+	field := dm.fieldDescribedByPath(path)
+	if field != nil {
+		return field.Similarity
+	}
+	return ""
+}
+
 func (dm *DocumentMapping) fieldDescribedByPath(path string) *FieldMapping {
 	pathElements := decodePath(path)
 	if len(pathElements) > 1 {
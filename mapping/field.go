@@ -59,6 +59,11 @@ type FieldMapping struct {
 	// DocValues, if true makes the index uninverting possible for this field
 	// It is useful for faceting and sorting queries.
 	DocValues bool `json:"docvalues,omitempty"`
+
+	// Similarity specifies the name of the similarity used to score the
+	// matches in this field. If empty, the IndexMapping.DefaultSimilarity
+	// is used.
+	Similarity string `json:"similarity,omitempty"`
 }
 
 // NewTextFieldMapping returns a default field mapping for text
@@ -330,6 +335,11 @@ func (fm *FieldMapping) UnmarshalJSON(data []byte) error {
 			if err != nil {
 				return err
 			}
+		case "similarity":
+			err := json.Unmarshal(v, &fm.Similarity)
+			if err != nil {
+				return err
+			}
 		default:
 			invalidKeys = append(invalidKeys, k)
 		}
@@ -23,6 +23,7 @@ import (
 	"github.com/blevesearch/bleve/analysis/datetime/optional"
 	"github.com/blevesearch/bleve/document"
 	"github.com/blevesearch/bleve/registry"
+	"github.com/blevesearch/bleve/search"
 )
 
 var MappingJSONStrict = false
@@ -48,6 +49,7 @@ type IndexMappingImpl struct {
 	DefaultAnalyzer       string                      `json:"default_analyzer"`
 	DefaultDateTimeParser string                      `json:"default_datetime_parser"`
 	DefaultField          string                      `json:"default_field"`
+	DefaultSimilarity     string                      `json:"default_similarity,omitempty"`
 	StoreDynamic          bool                        `json:"store_dynamic"`
 	IndexDynamic          bool                        `json:"index_dynamic"`
 	DocValuesDynamic      bool                        `json:"docvalues_dynamic"`
@@ -143,6 +145,23 @@ func (im *IndexMappingImpl) AddCustomDateTimeParser(name string, config map[stri
 	return nil
 }
 
+// AddCustomSimilarity defines a custom similarity for use in this mapping,
+// such as BM25 with tuned parameters:
+//
+//   err := m.AddCustomSimilarity("short_bm25", map[string]interface{}{
+//       "type": scorer.BM25SimilarityName,
+//       "k1":   1.0,
+//       "b":    0.3,
+//   })
+func (im *IndexMappingImpl) AddCustomSimilarity(name string, config map[string]interface{}) error {
+	_, err := im.cache.DefineSimilarity(name, config)
+	if err != nil {
+		return err
+	}
+	im.CustomAnalysis.Similarities[name] = config
+	return nil
+}
+
 // NewIndexMapping creates a new IndexMapping that will use all the default indexing rules
 func NewIndexMapping() *IndexMappingImpl {
 	return &IndexMappingImpl{
@@ -172,6 +191,12 @@ func (im *IndexMappingImpl) Validate() error {
 	if err != nil {
 		return err
 	}
+	if im.DefaultSimilarity != "" {
+		_, err = im.cache.SimilarityNamed(im.DefaultSimilarity)
+		if err != nil {
+			return err
+		}
+	}
 	err = im.DefaultMapping.Validate(im.cache)
 	if err != nil {
 		return err
@@ -254,6 +279,11 @@ func (im *IndexMappingImpl) UnmarshalJSON(data []byte) error {
 			if err != nil {
 				return err
 			}
+		case "default_similarity":
+			err := json.Unmarshal(v, &im.DefaultSimilarity)
+			if err != nil {
+				return err
+			}
 		case "default_mapping":
 			err := json.Unmarshal(v, &im.DefaultMapping)
 			if err != nil {
@@ -394,6 +424,33 @@ func (im *IndexMappingImpl) AnalyzerNamed(name string) *analysis.Analyzer {
 	return analyzer
 }
 
+// SimilarityNameForPath returns the name of the similarity explicitly
+// configured for the field at the provided path, in any document type,
+// or else the default similarity, an empty name meaning the classic
+// TF-IDF similarity.
+func (im *IndexMappingImpl) SimilarityNameForPath(path string) string {
+	for _, docMapping := range im.TypeMapping {
+		similarityName := docMapping.similarityNameForPath(path)
+		if similarityName != "" {
+			return similarityName
+		}
+	}
+	similarityName := im.DefaultMapping.similarityNameForPath(path)
+	if similarityName != "" {
+		return similarityName
+	}
+	return im.DefaultSimilarity
+}
+
+func (im *IndexMappingImpl) SimilarityNamed(name string) search.Similarity {
+	similarity, err := im.cache.SimilarityNamed(name)
+	if err != nil {
+		logger.Printf("error using similarity named: %s", name)
+		return nil
+	}
+	return similarity
+}
+
 func (im *IndexMappingImpl) DateTimeParserNamed(name string) analysis.DateTimeParser {
 	if name == "" {
 		name = im.DefaultDateTimeParser
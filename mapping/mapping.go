@@ -20,6 +20,7 @@ import (
 
 	"github.com/blevesearch/bleve/analysis"
 	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/search"
 )
 
 // A Classifier is an interface describing any object which knows how to
@@ -56,3 +57,11 @@ type IndexMapping interface {
 	AnalyzerNameForPath(path string) string
 	AnalyzerNamed(name string) *analysis.Analyzer
 }
+
+// SimilarityMapping is an optional interface of index mappings which
+// choose the similarity scoring the terms of each field, mappings
+// without it use the default similarity.
+type SimilarityMapping interface {
+	SimilarityNameForPath(path string) string
+	SimilarityNamed(name string) search.Similarity
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/blevesearch/bleve/analysis/tokenizer/exception"
 	"github.com/blevesearch/bleve/analysis/tokenizer/regexp"
 	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/search/scorer"
 )
 
 var mappingSource = []byte(`{
@@ -1171,3 +1172,59 @@ func TestWrongAnalyzerSearchableAs(t *testing.T) {
 		t.Errorf("expected analyzer name `xyz`, got `%s`", analyzerName)
 	}
 }
+
+func TestMappingSimilarity(t *testing.T) {
+	var m IndexMappingImpl
+	err := json.Unmarshal([]byte(`{
+		"default_similarity": "bm25",
+		"default_mapping": {
+			"properties": {
+				"title": {
+					"fields": [{"type": "text", "similarity": "short_bm25"}]
+				},
+				"body": {
+					"fields": [{"type": "text"}]
+				}
+			}
+		},
+		"analysis": {
+			"similarities": {
+				"short_bm25": {"type": "bm25", "k1": 1.0, "b": 0.3}
+			}
+		}
+	}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		"title": "short_bm25",
+		"body":  "bm25",
+		"other": "bm25",
+	} {
+		if actual := m.SimilarityNameForPath(path); actual != expected {
+			t.Errorf("expected similarity %s for %s, got %s", expected, path, actual)
+		}
+	}
+	similarity := m.SimilarityNamed("short_bm25")
+	if !reflect.DeepEqual(similarity, &scorer.BM25Similarity{K1: 1.0, B: 0.3}) {
+		t.Errorf("expected the custom bm25 similarity, got %#v", similarity)
+	}
+
+	// a mapping without any similarity uses the default one
+	if actual := NewIndexMapping().SimilarityNameForPath("title"); actual != "" {
+		t.Errorf("expected no similarity, got %s", actual)
+	}
+
+	m2 := NewIndexMapping()
+	fieldMapping := NewTextFieldMapping()
+	fieldMapping.Similarity = "unknown"
+	m2.DefaultMapping.AddFieldMappingsAt("title", fieldMapping)
+	if err := m2.Validate(); err == nil {
+		t.Errorf("expected error for unknown similarity")
+	}
+}
@@ -216,3 +216,59 @@ func NewGeoBoundingBoxQuery(topLeftLon, topLeftLat, bottomRightLon, bottomRightL
 func NewGeoDistanceQuery(lon, lat float64, distance string) *query.GeoDistanceQuery {
 	return query.NewGeoDistanceQuery(lon, lat, distance)
 }
+
+// NewSpanTermQuery creates a new Query for the spans
+// of an exact term, to be combined by other span
+// queries.
+func NewSpanTermQuery(term string) *query.SpanTermQuery {
+	return query.NewSpanTermQuery(term)
+}
+
+// NewSpanNearQuery creates a new Query for spans of
+// all the clauses, with at most slop positions between
+// them, in the order of the clauses if inOrder is true.
+func NewSpanNearQuery(clauses []query.SpanQuery, slop int, inOrder bool) *query.SpanNearQuery {
+	return query.NewSpanNearQuery(clauses, slop, inOrder)
+}
+
+// NewSpanOrQuery creates a new Query for the spans
+// of any of the clauses.
+func NewSpanOrQuery(clauses []query.SpanQuery) *query.SpanOrQuery {
+	return query.NewSpanOrQuery(clauses)
+}
+
+// NewSpanNotQuery creates a new Query for the spans
+// of include that don't overlap spans of exclude,
+// nor come within pre positions after them or post
+// positions before them.
+func NewSpanNotQuery(include, exclude query.SpanQuery, pre, post int) *query.SpanNotQuery {
+	return query.NewSpanNotQuery(include, exclude, pre, post)
+}
+
+// NewSpanFirstQuery creates a new Query for the spans
+// of the clause ending within the first end positions
+// of the field.
+func NewSpanFirstQuery(clause query.SpanQuery, end int) *query.SpanFirstQuery {
+	return query.NewSpanFirstQuery(clause, end)
+}
+
+// NewMoreLikeThisQuery creates a new Query for finding
+// documents similar to the documents with the given
+// IDs, in the given fields, or the default search
+// field if there are none.
+func NewMoreLikeThisQuery(ids []string, fields []string) *query.MoreLikeThisQuery {
+	return query.NewMoreLikeThisQuery(ids, fields)
+}
+
+// NewMoreLikeThisTextQuery creates a new Query for
+// finding documents similar to the given text.
+func NewMoreLikeThisTextQuery(text string, fields []string) *query.MoreLikeThisQuery {
+	return query.NewMoreLikeThisTextQuery(text, fields)
+}
+
+// NewFunctionScoreQuery creates a new Query matching
+// the documents of the query, with their scores
+// combined with those of the functions.
+func NewFunctionScoreQuery(q query.Query, functions ...*query.ScoreFunction) *query.FunctionScoreQuery {
+	return query.NewFunctionScoreQuery(q, functions...)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/search"
 	"github.com/blevesearch/bleve/search/highlight"
 )
 
@@ -37,6 +38,9 @@ var tokenFilters = make(TokenFilterRegistry, 0)
 var analyzers = make(AnalyzerRegistry, 0)
 var dateTimeParsers = make(DateTimeParserRegistry, 0)
 
+// scoring
+var similarities = make(SimilarityRegistry, 0)
+
 type Cache struct {
 	CharFilters        *CharFilterCache
 	Tokenizers         *TokenizerCache
@@ -47,6 +51,7 @@ type Cache struct {
 	FragmentFormatters *FragmentFormatterCache
 	Fragmenters        *FragmenterCache
 	Highlighters       *HighlighterCache
+	Similarities       *SimilarityCache
 }
 
 func NewCache() *Cache {
@@ -60,6 +65,7 @@ func NewCache() *Cache {
 		FragmentFormatters: NewFragmentFormatterCache(),
 		Fragmenters:        NewFragmenterCache(),
 		Highlighters:       NewHighlighterCache(),
+		Similarities:       NewSimilarityCache(),
 	}
 }
 
@@ -182,3 +188,15 @@ func (c *Cache) DefineHighlighter(name string, config map[string]interface{}) (h
 	}
 	return c.Highlighters.DefineHighlighter(name, typ, config, c)
 }
+
+func (c *Cache) SimilarityNamed(name string) (search.Similarity, error) {
+	return c.Similarities.SimilarityNamed(name, c)
+}
+
+func (c *Cache) DefineSimilarity(name string, config map[string]interface{}) (search.Similarity, error) {
+	typ, err := typeFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return c.Similarities.DefineSimilarity(name, typ, config, c)
+}
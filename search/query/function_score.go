@@ -0,0 +1,362 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/geo"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/searcher"
+)
+
+var scoreScriptsMutex sync.RWMutex
+var scoreScripts = map[string]searcher.ScoreScript{}
+
+// RegisterScoreScript registers a Go function scoring the documents of
+// function score queries with script functions of that name.
+func RegisterScoreScript(name string, script searcher.ScoreScript) {
+	scoreScriptsMutex.Lock()
+	scoreScripts[name] = script
+	scoreScriptsMutex.Unlock()
+}
+
+func scoreScriptNamed(name string) (searcher.ScoreScript, error) {
+	scoreScriptsMutex.RLock()
+	script, ok := scoreScripts[name]
+	scoreScriptsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no score script named '%s' registered", name)
+	}
+	return script, nil
+}
+
+var functionScoreModes = map[string]searcher.FunctionScoreMode{
+	"":         searcher.FunctionScoreMultiply,
+	"multiply": searcher.FunctionScoreMultiply,
+	"sum":      searcher.FunctionScoreSum,
+	"max":      searcher.FunctionScoreMax,
+	"replace":  searcher.FunctionScoreReplace,
+}
+
+type FunctionScoreQuery struct {
+	FunctionScore Query            `json:"function_score"`
+	Functions     []*ScoreFunction `json:"functions"`
+	ScoreMode     string           `json:"score_mode,omitempty"`
+	BoostMode     string           `json:"boost_mode,omitempty"`
+	BoostVal      *Boost           `json:"boost,omitempty"`
+}
+
+// NewFunctionScoreQuery creates a new Query matching
+// the documents of the query, with their scores
+// combined with those of the functions, by multiplying
+// them, unless the BoostMode is sum, max or replace.
+// The scores of the functions are combined with each
+// other by multiplying them, unless the ScoreMode is
+// sum or max.
+func NewFunctionScoreQuery(query Query, functions ...*ScoreFunction) *FunctionScoreQuery {
+	return &FunctionScoreQuery{
+		FunctionScore: query,
+		Functions:     functions,
+	}
+}
+
+func (q *FunctionScoreQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *FunctionScoreQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *FunctionScoreQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	err := q.Validate()
+	if err != nil {
+		return nil, err
+	}
+	functions := make([]searcher.ScoreFunction, 0, len(q.Functions))
+	for _, f := range q.Functions {
+		sf, err := f.scoreFunction(i)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, sf)
+	}
+	child, err := q.FunctionScore.Searcher(i, m, options)
+	if err != nil {
+		return nil, err
+	}
+	s, err := searcher.NewFunctionScoreSearcher(child, functions,
+		functionScoreModes[q.ScoreMode], functionScoreModes[q.BoostMode],
+		q.BoostVal.Value(), options)
+	if err != nil {
+		_ = child.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (q *FunctionScoreQuery) Validate() error {
+	if q.FunctionScore == nil {
+		return fmt.Errorf("function score query must have a query")
+	}
+	if vq, ok := q.FunctionScore.(ValidatableQuery); ok {
+		err := vq.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if mode, ok := functionScoreModes[q.ScoreMode]; !ok || mode == searcher.FunctionScoreReplace {
+		return fmt.Errorf("unknown function score mode: %s", q.ScoreMode)
+	}
+	if _, ok := functionScoreModes[q.BoostMode]; !ok {
+		return fmt.Errorf("unknown function boost mode: %s", q.BoostMode)
+	}
+	for _, f := range q.Functions {
+		err := f.validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *FunctionScoreQuery) UnmarshalJSON(data []byte) error {
+	tmp := struct {
+		FunctionScore json.RawMessage  `json:"function_score"`
+		Functions     []*ScoreFunction `json:"functions"`
+		ScoreMode     string           `json:"score_mode"`
+		BoostMode     string           `json:"boost_mode"`
+		BoostVal      *Boost           `json:"boost,omitempty"`
+	}{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	q.FunctionScore, err = ParseQuery(tmp.FunctionScore)
+	if err != nil {
+		return err
+	}
+	q.Functions = tmp.Functions
+	q.ScoreMode = tmp.ScoreMode
+	q.BoostMode = tmp.BoostMode
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+// A ScoreFunction of a FunctionScoreQuery is one of
+// the functions, whose scores are multiplied by the
+// Weight, unless it's zero, or just the Weight.
+type ScoreFunction struct {
+	FieldValueFactor *FieldValueFactorFunction `json:"field_value_factor,omitempty"`
+	Gauss            *DecayFunction            `json:"gauss,omitempty"`
+	Exp              *DecayFunction            `json:"exp,omitempty"`
+	Linear           *DecayFunction            `json:"linear,omitempty"`
+	RandomScore      *RandomScoreFunction      `json:"random_score,omitempty"`
+	Script           *ScriptScoreFunction      `json:"script,omitempty"`
+	Weight           float64                   `json:"weight,omitempty"`
+}
+
+func (f *ScoreFunction) validate() error {
+	var n int
+	for _, set := range []bool{f.FieldValueFactor != nil, f.Gauss != nil,
+		f.Exp != nil, f.Linear != nil, f.RandomScore != nil, f.Script != nil} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("score function must be only one function")
+	}
+	if n == 0 && f.Weight == 0 {
+		return fmt.Errorf("score function must be a function or a weight")
+	}
+	return nil
+}
+
+func (f *ScoreFunction) scoreFunction(i index.IndexReader) (rv searcher.ScoreFunction, err error) {
+	switch {
+	case f.FieldValueFactor != nil:
+		rv, err = f.FieldValueFactor.scoreFunction(i)
+	case f.Gauss != nil:
+		rv, err = f.Gauss.scoreFunction(i, searcher.GaussDecay)
+	case f.Exp != nil:
+		rv, err = f.Exp.scoreFunction(i, searcher.ExpDecay)
+	case f.Linear != nil:
+		rv, err = f.Linear.scoreFunction(i, searcher.LinearDecay)
+	case f.RandomScore != nil:
+		rv = searcher.NewRandomScoreFunction(i, f.RandomScore.Seed)
+	case f.Script != nil:
+		rv, err = f.Script.scoreFunction(i)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Weight != 0 {
+		rv = searcher.WeightedScoreFunction(rv, f.Weight)
+	}
+	return rv, nil
+}
+
+// A FieldValueFactorFunction scores documents by the
+// first value of a numeric field, multiplied by the
+// Factor, unless it's zero, and modified by one of
+// none, log, log1p, log2p, ln, ln1p, ln2p, square,
+// sqrt or reciprocal. Documents without a value have
+// the Missing value, or aren't scored if it's nil.
+type FieldValueFactorFunction struct {
+	Field    string   `json:"field"`
+	Factor   float64  `json:"factor,omitempty"`
+	Modifier string   `json:"modifier,omitempty"`
+	Missing  *float64 `json:"missing,omitempty"`
+}
+
+func (f *FieldValueFactorFunction) scoreFunction(i index.IndexReader) (searcher.ScoreFunction, error) {
+	factor := f.Factor
+	if factor == 0 {
+		factor = 1
+	}
+	return searcher.NewFieldValueFactorFunction(i, f.Field, factor, f.Modifier, f.Missing)
+}
+
+// A DecayFunction scores documents 1 when the nearest
+// value of the field is within Offset of the Origin,
+// decaying to Decay, or 0.5 if it's zero, Scale further
+// away. The Origin of a numeric field is a number, of a
+// datetime field a date string, with durations like
+// "36h" or "7d" for the Scale and Offset, and of a geo
+// field a geo point, with distances like "10km".
+// Documents without a value aren't scored.
+type DecayFunction struct {
+	Field  string      `json:"field"`
+	Origin interface{} `json:"origin"`
+	Scale  interface{} `json:"scale"`
+	Offset interface{} `json:"offset,omitempty"`
+	Decay  float64     `json:"decay,omitempty"`
+}
+
+func (f *DecayFunction) scoreFunction(i index.IndexReader, shape searcher.DecayShape) (searcher.ScoreFunction, error) {
+	decay := f.Decay
+	if decay == 0 {
+		decay = 0.5
+	}
+	switch origin := f.Origin.(type) {
+	case float64, int:
+		scale, err := decayNumber(f.Scale)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := decayNumber(f.Offset)
+		if err != nil {
+			return nil, err
+		}
+		o, _ := decayNumber(origin)
+		return searcher.NewNumericDecayFunction(i, f.Field, shape, o, scale, offset, decay)
+	case string:
+		t, err := queryTimeFromString(origin)
+		if err != nil {
+			break
+		}
+		scale, err := decayDuration(f.Scale)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := decayDuration(f.Offset)
+		if err != nil {
+			return nil, err
+		}
+		return searcher.NewDateTimeDecayFunction(i, f.Field, shape, t, scale, offset, decay)
+	}
+	lon, lat, ok := geo.ExtractGeoPoint(f.Origin)
+	if !ok {
+		return nil, fmt.Errorf("decay function origin must be a number, a date or a geo point, got %v",
+			f.Origin)
+	}
+	scale, err := decayDistance(f.Scale)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := decayDistance(f.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewGeoDecayFunction(i, f.Field, shape, lon, lat, scale, offset, decay)
+}
+
+func decayNumber(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("decay function scale and offset must be numbers, got %v", v)
+}
+
+func decayDuration(v interface{}) (time.Duration, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		if strings.HasSuffix(v, "d") {
+			days, err := strconv.ParseFloat(strings.TrimSuffix(v, "d"), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid decay function duration: %s", v)
+			}
+			return time.Duration(days * float64(24*time.Hour)), nil
+		}
+		return time.ParseDuration(v)
+	}
+	return 0, fmt.Errorf("decay function scale and offset must be durations, got %v", v)
+}
+
+func decayDistance(v interface{}) (float64, error) {
+	if s, ok := v.(string); ok {
+		return geo.ParseDistance(s)
+	}
+	return decayNumber(v)
+}
+
+// A RandomScoreFunction scores documents between 0 and
+// 1, at random, but the same for the same Seed.
+type RandomScoreFunction struct {
+	Seed int64 `json:"seed"`
+}
+
+// A ScriptScoreFunction scores documents with the Go
+// function registered by RegisterScoreScript with its
+// Name, which is given its Params.
+type ScriptScoreFunction struct {
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+func (f *ScriptScoreFunction) scoreFunction(i index.IndexReader) (searcher.ScoreFunction, error) {
+	script, err := scoreScriptNamed(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewScriptScoreFunction(i, f.Name, script, f.Params), nil
+}
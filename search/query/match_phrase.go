@@ -27,6 +27,7 @@ type MatchPhraseQuery struct {
 	MatchPhrase string `json:"match_phrase"`
 	FieldVal    string `json:"field,omitempty"`
 	Analyzer    string `json:"analyzer,omitempty"`
+	Slop        int    `json:"slop,omitempty"`
 	BoostVal    *Boost `json:"boost,omitempty"`
 }
 
@@ -82,6 +83,7 @@ func (q *MatchPhraseQuery) Searcher(i index.IndexReader, m mapping.IndexMapping,
 	if len(tokens) > 0 {
 		phrase := tokenStreamToPhrase(tokens)
 		phraseQuery := NewMultiPhraseQuery(phrase, field)
+		phraseQuery.Slop = q.Slop
 		phraseQuery.SetBoost(q.BoostVal.Value())
 		return phraseQuery.Searcher(i, m, options)
 	}
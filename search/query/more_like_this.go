@@ -0,0 +1,389 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search"
+)
+
+// The defaults of the MoreLikeThisQuery options left zero.
+var (
+	MoreLikeThisMinTermFreq   = 2
+	MoreLikeThisMinDocFreq    = 5
+	MoreLikeThisMaxQueryTerms = 25
+)
+
+type MoreLikeThisQuery struct {
+	Like          []string `json:"like,omitempty"`
+	LikeText      string   `json:"like_text,omitempty"`
+	Analyzer      string   `json:"analyzer,omitempty"`
+	Fields        []string `json:"fields,omitempty"`
+	MinTermFreq   int      `json:"min_term_freq,omitempty"`
+	MinDocFreq    int      `json:"min_doc_freq,omitempty"`
+	MaxDocFreq    int      `json:"max_doc_freq,omitempty"`
+	MaxQueryTerms int      `json:"max_query_terms,omitempty"`
+	Include       bool     `json:"include,omitempty"`
+	BoostVal      *Boost   `json:"boost,omitempty"`
+}
+
+// NewMoreLikeThisQuery creates a new Query for finding
+// documents similar to the documents with the given
+// IDs, in the given fields, or the default search
+// field if there are none.
+// The terms of the documents occurring at least
+// MinTermFreq times, in at least MinDocFreq and at
+// most MaxDocFreq documents, are weighted by their
+// frequency and inverse document frequency, and the
+// MaxQueryTerms best are searched for.
+// The fields must have been indexed with doc values,
+// and the documents themselves aren't matched unless
+// Include is true.
+func NewMoreLikeThisQuery(ids []string, fields []string) *MoreLikeThisQuery {
+	return &MoreLikeThisQuery{
+		Like:   ids,
+		Fields: fields,
+	}
+}
+
+// NewMoreLikeThisTextQuery creates a new Query for
+// finding documents similar to the given text, which
+// is analyzed by the Analyzer, or that of each field.
+func NewMoreLikeThisTextQuery(text string, fields []string) *MoreLikeThisQuery {
+	return &MoreLikeThisQuery{
+		LikeText: text,
+		Fields:   fields,
+	}
+}
+
+func (q *MoreLikeThisQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *MoreLikeThisQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *MoreLikeThisQuery) Validate() error {
+	if len(q.Like) == 0 && q.LikeText == "" {
+		return fmt.Errorf("more like this query must have documents or text to be like")
+	}
+	if q.MinTermFreq < 0 || q.MinDocFreq < 0 || q.MaxDocFreq < 0 || q.MaxQueryTerms < 0 {
+		return fmt.Errorf("more like this query options must not be negative")
+	}
+	return nil
+}
+
+func (q *MoreLikeThisQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	rq, err := q.Resolve([]index.IndexReader{i}, m)
+	if err != nil {
+		return nil, err
+	}
+	return rq.Searcher(i, m, options)
+}
+
+type moreLikeThisTerm struct {
+	field string
+	term  string
+	score float64
+}
+
+// Resolve returns the query searching for the terms chosen, with the
+// statistics of all the readers, which together hold the documents.
+func (q *MoreLikeThisQuery) Resolve(readers []index.IndexReader, m mapping.IndexMapping) (Query, error) {
+	err := q.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = []string{m.DefaultSearchField()}
+	}
+
+	var numDocs uint64
+	for _, r := range readers {
+		n, err := r.DocCount()
+		if err != nil {
+			return nil, err
+		}
+		numDocs += n
+	}
+
+	var terms []moreLikeThisTerm
+	for _, field := range fields {
+		tfs, err := q.termFreqs(readers, m, field)
+		if err != nil {
+			return nil, err
+		}
+		minTermFreq := q.MinTermFreq
+		if minTermFreq == 0 {
+			minTermFreq = MoreLikeThisMinTermFreq
+		}
+		candidates := make([]string, 0, len(tfs))
+		for term, tf := range tfs {
+			if tf >= minTermFreq {
+				candidates = append(candidates, term)
+			}
+		}
+		sort.Strings(candidates)
+		dfs, err := docFreqs(readers, field, candidates)
+		if err != nil {
+			return nil, err
+		}
+		minDocFreq := q.MinDocFreq
+		if minDocFreq == 0 {
+			minDocFreq = MoreLikeThisMinDocFreq
+		}
+		for _, term := range candidates {
+			df := dfs[term]
+			if df == 0 || df < uint64(minDocFreq) ||
+				(q.MaxDocFreq > 0 && df > uint64(q.MaxDocFreq)) {
+				continue
+			}
+			idf := 1.0 + math.Log(float64(numDocs)/float64(df+1))
+			terms = append(terms, moreLikeThisTerm{
+				field: field,
+				term:  term,
+				score: float64(tfs[term]) * idf,
+			})
+		}
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].score != terms[j].score {
+			return terms[i].score > terms[j].score
+		}
+		if terms[i].field != terms[j].field {
+			return terms[i].field < terms[j].field
+		}
+		return terms[i].term < terms[j].term
+	})
+	maxQueryTerms := q.MaxQueryTerms
+	if maxQueryTerms == 0 {
+		maxQueryTerms = MoreLikeThisMaxQueryTerms
+	}
+	if len(terms) > maxQueryTerms {
+		terms = terms[:maxQueryTerms]
+	}
+	if len(terms) == 0 {
+		return NewMatchNoneQuery(), nil
+	}
+
+	// the best term gets the query's boost, the others proportionately less
+	disjuncts := make([]Query, 0, len(terms))
+	for _, t := range terms {
+		tq := NewTermQuery(t.term)
+		tq.SetField(t.field)
+		tq.SetBoost(q.Boost() * t.score / terms[0].score)
+		disjuncts = append(disjuncts, tq)
+	}
+	var rv Query = NewDisjunctionQuery(disjuncts)
+	if len(q.Like) > 0 && !q.Include {
+		rv = NewBooleanQuery([]Query{rv}, nil, []Query{NewDocIDQuery(q.Like)})
+	}
+	return rv, nil
+}
+
+// termFreqs returns the frequencies of the terms of the field in the
+// documents and text being liked.
+func (q *MoreLikeThisQuery) termFreqs(readers []index.IndexReader,
+	m mapping.IndexMapping, field string) (map[string]int, error) {
+	rv := make(map[string]int)
+	for _, r := range readers {
+		for _, id := range q.Like {
+			err := docTermFreqs(r, id, field, rv)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if q.LikeText != "" {
+		analyzerName := q.Analyzer
+		if analyzerName == "" {
+			analyzerName = m.AnalyzerNameForPath(field)
+		}
+		analyzer := m.AnalyzerNamed(analyzerName)
+		if analyzer == nil {
+			return nil, fmt.Errorf("no analyzer named '%s' registered", analyzerName)
+		}
+		for _, token := range analyzer.Analyze([]byte(q.LikeText)) {
+			rv[string(token.Term)]++
+		}
+	}
+	return rv, nil
+}
+
+// docTermFreqs adds the frequencies of the terms of the field in the
+// document to tfs, if the reader has the document.
+func docTermFreqs(r index.IndexReader, id string, field string,
+	tfs map[string]int) error {
+	internalID, err := r.InternalID(id)
+	if err != nil || internalID == nil {
+		return err
+	}
+	var terms []string
+	err = r.DocumentVisitFieldTerms(internalID, []string{field},
+		func(_ string, term []byte) {
+			terms = append(terms, string(term))
+		})
+	if err != nil {
+		return err
+	}
+	var tfd index.TermFieldDoc
+	for _, term := range terms {
+		tfr, err := r.TermFieldReader([]byte(term), field, true, false, false)
+		if err != nil {
+			return err
+		}
+		next, err := tfr.Advance(internalID, tfd.Reset())
+		if err == nil && next != nil && next.ID.Equals(internalID) {
+			tfs[term] += int(next.Freq)
+		}
+		if cerr := tfr.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// docFreqs returns the number of documents of all the readers with each
+// of the terms, which are sorted, in the field.
+func docFreqs(readers []index.IndexReader, field string,
+	terms []string) (map[string]uint64, error) {
+	rv := make(map[string]uint64, len(terms))
+	if len(terms) == 0 {
+		return rv, nil
+	}
+	for _, r := range readers {
+		if ir, ok := r.(index.IndexReaderOnly); ok {
+			onlyTerms := make([][]byte, 0, len(terms))
+			for _, term := range terms {
+				onlyTerms = append(onlyTerms, []byte(term))
+			}
+			fieldDict, err := ir.FieldDictOnly(field, onlyTerms, true)
+			if err != nil {
+				return nil, err
+			}
+			entry, err := fieldDict.Next()
+			for err == nil && entry != nil {
+				rv[entry.Term] += entry.Count
+				entry, err = fieldDict.Next()
+			}
+			if cerr := fieldDict.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, term := range terms {
+			tfr, err := r.TermFieldReader([]byte(term), field, false, false, false)
+			if err != nil {
+				return nil, err
+			}
+			rv[term] += tfr.Count()
+			err = tfr.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rv, nil
+}
+
+// ResolveMoreLikeThisQueries returns the query, with any more like this
+// queries in it replaced by the queries they resolve to with the
+// statistics of all the readers, leaving the query itself unchanged.
+// The readers are only asked for if there are any.
+func ResolveMoreLikeThisQueries(query Query, readers func() ([]index.IndexReader, error),
+	m mapping.IndexMapping) (Query, error) {
+	var rs []index.IndexReader
+	var resolve func(query Query) (Query, error)
+	var resolveSlice func(queries []Query) ([]Query, bool, error)
+
+	resolveSlice = func(queries []Query) ([]Query, bool, error) {
+		var changed bool
+		resolved := make([]Query, 0, len(queries))
+		for _, q := range queries {
+			rq, err := resolve(q)
+			if err != nil {
+				return nil, false, err
+			}
+			changed = changed || rq != q
+			resolved = append(resolved, rq)
+		}
+		return resolved, changed, nil
+	}
+
+	resolve = func(query Query) (Query, error) {
+		switch q := query.(type) {
+		case *MoreLikeThisQuery:
+			if rs == nil {
+				var err error
+				rs, err = readers()
+				if err != nil {
+					return nil, err
+				}
+			}
+			return q.Resolve(rs, m)
+		case *ConjunctionQuery:
+			children, changed, err := resolveSlice(q.Conjuncts)
+			if err != nil || !changed {
+				return q, err
+			}
+			rq := *q
+			rq.Conjuncts = children
+			return &rq, nil
+		case *DisjunctionQuery:
+			children, changed, err := resolveSlice(q.Disjuncts)
+			if err != nil || !changed {
+				return q, err
+			}
+			rq := *q
+			rq.Disjuncts = children
+			return &rq, nil
+		case *BooleanQuery:
+			children, changed, err := resolveSlice([]Query{q.Must, q.Should, q.MustNot})
+			if err != nil || !changed {
+				return q, err
+			}
+			rq := *q
+			rq.Must, rq.Should, rq.MustNot = children[0], children[1], children[2]
+			return &rq, nil
+		case *FunctionScoreQuery:
+			child, err := resolve(q.FunctionScore)
+			if err != nil || child == q.FunctionScore {
+				return q, err
+			}
+			rq := *q
+			rq.FunctionScore = child
+			return &rq, nil
+		default:
+			return query, nil
+		}
+	}
+	return resolve(query)
+}
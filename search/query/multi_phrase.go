@@ -27,6 +27,7 @@ import (
 type MultiPhraseQuery struct {
 	Terms    [][]string `json:"terms"`
 	Field    string     `json:"field,omitempty"`
+	Slop     int        `json:"slop,omitempty"`
 	BoostVal *Boost     `json:"boost,omitempty"`
 }
 
@@ -56,6 +57,9 @@ func (q *MultiPhraseQuery) Boost() float64 {
 }
 
 func (q *MultiPhraseQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	if q.Slop > 0 {
+		return searcher.NewSloppyMultiPhraseSearcher(i, q.Terms, q.Field, q.Slop, options)
+	}
 	return searcher.NewMultiPhraseSearcher(i, q.Terms, q.Field, options)
 }
 
@@ -63,6 +67,9 @@ func (q *MultiPhraseQuery) Validate() error {
 	if len(q.Terms) < 1 {
 		return fmt.Errorf("phrase query must contain at least one term")
 	}
+	if q.Slop < 0 {
+		return fmt.Errorf("phrase query slop must not be negative")
+	}
 	return nil
 }
 
@@ -75,6 +82,7 @@ func (q *MultiPhraseQuery) UnmarshalJSON(data []byte) error {
 	}
 	q.Terms = tmp.Terms
 	q.Field = tmp.Field
+	q.Slop = tmp.Slop
 	q.BoostVal = tmp.BoostVal
 	return nil
 }
@@ -27,6 +27,7 @@ import (
 type PhraseQuery struct {
 	Terms    []string `json:"terms"`
 	Field    string   `json:"field,omitempty"`
+	Slop     int      `json:"slop,omitempty"`
 	BoostVal *Boost   `json:"boost,omitempty"`
 }
 
@@ -53,6 +54,9 @@ func (q *PhraseQuery) Boost() float64 {
 }
 
 func (q *PhraseQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	if q.Slop > 0 {
+		return searcher.NewSloppyPhraseSearcher(i, q.Terms, q.Field, q.Slop, options)
+	}
 	return searcher.NewPhraseSearcher(i, q.Terms, q.Field, options)
 }
 
@@ -60,6 +64,9 @@ func (q *PhraseQuery) Validate() error {
 	if len(q.Terms) < 1 {
 		return fmt.Errorf("phrase query must contain at least one term")
 	}
+	if q.Slop < 0 {
+		return fmt.Errorf("phrase query slop must not be negative")
+	}
 	return nil
 }
 
@@ -72,6 +79,7 @@ func (q *PhraseQuery) UnmarshalJSON(data []byte) error {
 	}
 	q.Terms = tmp.Terms
 	q.Field = tmp.Field
+	q.Slop = tmp.Slop
 	q.BoostVal = tmp.BoostVal
 	return nil
 }
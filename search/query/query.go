@@ -107,6 +107,70 @@ func ParseQuery(input []byte) (Query, error) {
 		}
 		return &rv, nil
 	}
+	_, isFunctionScoreQuery := tmp["function_score"]
+	if isFunctionScoreQuery {
+		var rv FunctionScoreQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
+	_, hasLike := tmp["like"]
+	_, hasLikeText := tmp["like_text"]
+	if hasLike || hasLikeText {
+		var rv MoreLikeThisQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
+	_, isSpanTermQuery := tmp["span_term"]
+	if isSpanTermQuery {
+		var rv SpanTermQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
+	_, isSpanNearQuery := tmp["span_near"]
+	if isSpanNearQuery {
+		var rv SpanNearQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
+	_, isSpanOrQuery := tmp["span_or"]
+	if isSpanOrQuery {
+		var rv SpanOrQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
+	_, isSpanNotQuery := tmp["span_not"]
+	if isSpanNotQuery {
+		var rv SpanNotQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
+	_, isSpanFirstQuery := tmp["span_first"]
+	if isSpanFirstQuery {
+		var rv SpanFirstQuery
+		err := json.Unmarshal(input, &rv)
+		if err != nil {
+			return nil, err
+		}
+		return &rv, nil
+	}
 	_, hasMust := tmp["must"]
 	_, hasShould := tmp["should"]
 	_, hasMustNot := tmp["must_not"]
@@ -341,6 +405,13 @@ func expandQuery(m mapping.IndexMapping, query Query) (Query, error) {
 				return nil, err
 			}
 			return q, nil
+		case *FunctionScoreQuery:
+			var err error
+			q.FunctionScore, err = expand(q.FunctionScore)
+			if err != nil {
+				return nil, err
+			}
+			return q, nil
 		default:
 			return query, nil
 		}
@@ -28,6 +28,14 @@ type QueryStringQuery struct {
 // NewQueryStringQuery creates a new Query used for
 // finding documents that satisfy a query string.  The
 // query string is a small query language for humans.
+// Besides +/- prefixed clauses, it has parenthesized
+// groups, field-scoped groups like title:(foo bar),
+// ranges like field:[a TO b} and the operators NOT,
+// AND and OR, in order of decreasing precedence.
+// Brackets which don't start a complete group or range,
+// like those of f(x) or {x}, are part of terms.
+// Operators without their operands, like the AND of
+// `a AND`, are terms too.
 func NewQueryStringQuery(query string) *QueryStringQuery {
 	return &QueryStringQuery{
 		Query: query,
@@ -19,10 +19,16 @@ s string
 n int
 f float64
 q Query
-pf *float64}
+pf *float64
+b bool
+c *queryClause
+cs []*queryClause
+ors [][]*queryClause
+rb *queryRangeBound}
 
 %token tSTRING tPHRASE tPLUS tMINUS tCOLON tBOOST tNUMBER tSTRING tGREATER tLESS
-tEQUAL tTILDE
+tEQUAL tTILDE tLPAREN tRPAREN tAND tOR tNOT tLBRACKET tRBRACKET tLBRACE tRBRACE
+tTO
 
 %type <s>                tSTRING
 %type <s>                tPHRASE
@@ -33,42 +39,108 @@ tEQUAL tTILDE
 %type <q>                searchBase
 %type <pf>                searchSuffix
 %type <n>                searchPrefix
+%type <cs>                searchParts
+%type <c>                searchPart
+%type <ors>                orExpr
+%type <cs>                andExpr
+%type <c>                notExpr
+%type <q>                primary
+%type <q>                rangeQuery
+%type <b>                rangeStart
+%type <b>                rangeEnd
+%type <rb>                rangeBound
 
 %%
 
 input:
 searchParts {
 	logDebugGrammar("INPUT")
+	for _, clause := range $1 {
+		addQueryClause(yylex.(*lexerWrapper).query, clause)
+	}
 };
 
 searchParts:
-searchPart searchParts {
+searchParts searchPart {
 	logDebugGrammar("SEARCH PARTS")
+	$$ = append($1, $2)
 }
 |
 searchPart {
 	logDebugGrammar("SEARCH PART")
+	$$ = []*queryClause{$1}
 };
 
 searchPart:
-searchPrefix searchBase searchSuffix {
-	query := $2
-	if $3 != nil {
+orExpr {
+	$$ = orClause($1)
+};
+
+orExpr:
+orExpr tOR andExpr {
+	logDebugGrammar("OR")
+	$$ = append($1, $3)
+}
+|
+andExpr {
+	$$ = [][]*queryClause{$1}
+};
+
+andExpr:
+andExpr tAND notExpr {
+	logDebugGrammar("AND")
+	$$ = append($1, $3)
+}
+|
+notExpr {
+	$$ = []*queryClause{$1}
+};
+
+notExpr:
+tNOT notExpr {
+	logDebugGrammar("NOT")
+	$$ = &queryClause{occur: queryMustNot, q: clauseQuery($2)}
+}
+|
+searchPrefix primary {
+	$$ = &queryClause{occur: $1, q: $2}
+};
+
+primary:
+searchBase searchSuffix {
+	query := $1
+	if $2 != nil {
 		if query, ok := query.(BoostableQuery); ok {
-			query.SetBoost(*$3)
+			query.SetBoost(*$2)
 			}
 	}
-	switch($1) {
-		case queryShould:
-			yylex.(*lexerWrapper).query.AddShould(query)
-		case queryMust:
-			yylex.(*lexerWrapper).query.AddMust(query)
-		case queryMustNot:
-			yylex.(*lexerWrapper).query.AddMustNot(query)
+	$$ = query
+}
+|
+tLPAREN searchParts tRPAREN searchSuffix {
+	logDebugGrammar("GROUP")
+	query := groupQuery($2)
+	if $4 != nil {
+		if query, ok := query.(BoostableQuery); ok {
+			query.SetBoost(*$4)
+		}
+	}
+	$$ = query
+}
+|
+tSTRING tCOLON tLPAREN searchParts tRPAREN searchSuffix {
+	field := $1
+	logDebugGrammar("FIELD - %s GROUP", field)
+	query := groupQuery($4)
+	setQueryStringField(query, field)
+	if $6 != nil {
+		if query, ok := query.(BoostableQuery); ok {
+			query.SetBoost(*$6)
+		}
 	}
+	$$ = query
 };
 
-
 searchPrefix:
 /* empty */ {
 	$$ = queryShould
@@ -147,6 +219,18 @@ tPHRASE {
 	$$ = q
 }
 |
+tPHRASE tTILDE {
+	phrase := $1
+	slop, err := strconv.ParseFloat($2, 64)
+	if err != nil {
+		yylex.(*lexerWrapper).lex.Error(fmt.Sprintf("invalid slop value: %v", err))
+	}
+	logDebugGrammar("SLOPPY PHRASE - %s %f", phrase, slop)
+	q := NewMatchPhraseQuery(phrase)
+	q.Slop = int(slop)
+	$$ = q
+}
+|
 tSTRING tCOLON tSTRING {
 	field := $1
 	str := $3
@@ -190,6 +274,20 @@ tSTRING tCOLON tPHRASE {
 	$$ = q
 }
 |
+tSTRING tCOLON tPHRASE tTILDE {
+	field := $1
+	phrase := $3
+	slop, err := strconv.ParseFloat($4, 64)
+	if err != nil {
+		yylex.(*lexerWrapper).lex.Error(fmt.Sprintf("invalid slop value: %v", err))
+	}
+	logDebugGrammar("FIELD - %s SLOPPY PHRASE - %s %f", field, phrase, slop)
+	q := NewMatchPhraseQuery(phrase)
+	q.Slop = int(slop)
+	q.SetField(field)
+	$$ = q
+}
+|
 tSTRING tCOLON tGREATER posOrNegNumber {
 	field := $1
 	min, err := strconv.ParseFloat($4, 64)
@@ -300,6 +398,59 @@ tSTRING tCOLON tLESS tEQUAL tPHRASE {
 	q := NewDateRangeInclusiveQuery(time.Time{}, maxTime, nil, &maxInclusive)
 	q.SetField(field)
 	$$ = q
+}
+|
+tSTRING tCOLON rangeQuery {
+	field := $1
+	logDebugGrammar("FIELD - %s RANGE", field)
+	q := $3
+	setQueryStringField(q, field)
+	$$ = q
+}
+|
+rangeQuery {
+	$$ = $1
+};
+
+rangeQuery:
+rangeStart rangeBound tTO rangeBound rangeEnd {
+	logDebugGrammar("RANGE")
+	q, err := rangeQueryForQueryString($2, $4, $1, $5)
+	if err != nil {
+		yylex.(*lexerWrapper).lex.Error(err.Error())
+	}
+	$$ = q
+};
+
+rangeStart:
+tLBRACKET {
+	$$ = true
+}
+|
+tLBRACE {
+	$$ = false
+};
+
+rangeEnd:
+tRBRACKET {
+	$$ = true
+}
+|
+tRBRACE {
+	$$ = false
+};
+
+rangeBound:
+tSTRING {
+	$$ = &queryRangeBound{s: $1}
+}
+|
+tPHRASE {
+	$$ = &queryRangeBound{s: $1, phrase: true}
+}
+|
+posOrNegNumber {
+	$$ = &queryRangeBound{s: $1, number: true}
 };
 
 searchSuffix:
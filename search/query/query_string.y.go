@@ -1,3 +1,4 @@
+//line query_string.y:2
 package query
 
 import __yyfmt__ "fmt"
@@ -24,6 +25,11 @@ type yySymType struct {
 	f   float64
 	q   Query
 	pf  *float64
+	b   bool
+	c   *queryClause
+	cs  []*queryClause
+	ors [][]*queryClause
+	rb  *queryRangeBound
 }
 
 const tSTRING = 57346
@@ -37,6 +43,16 @@ const tGREATER = 57353
 const tLESS = 57354
 const tEQUAL = 57355
 const tTILDE = 57356
+const tLPAREN = 57357
+const tRPAREN = 57358
+const tAND = 57359
+const tOR = 57360
+const tNOT = 57361
+const tLBRACKET = 57362
+const tRBRACKET = 57363
+const tLBRACE = 57364
+const tRBRACE = 57365
+const tTO = 57366
 
 var yyToknames = [...]string{
 	"$end",
@@ -53,7 +69,18 @@ var yyToknames = [...]string{
 	"tLESS",
 	"tEQUAL",
 	"tTILDE",
+	"tLPAREN",
+	"tRPAREN",
+	"tAND",
+	"tOR",
+	"tNOT",
+	"tLBRACKET",
+	"tRBRACKET",
+	"tLBRACE",
+	"tRBRACE",
+	"tTO",
 }
+
 var yyStatenames = [...]string{}
 
 const yyEofCode = 1
@@ -65,73 +92,88 @@ var yyExca = [...]int{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 3,
-	1, 3,
-	-2, 5,
+	-1, 2,
+	1, 1,
+	-2, 14,
 }
 
-const yyNprod = 28
 const yyPrivate = 57344
 
-var yyTokenNames []string
-var yyStates []string
-
-const yyLast = 42
+const yyLast = 88
 
 var yyAct = [...]int{
-
-	17, 16, 18, 23, 22, 30, 3, 21, 19, 20,
-	29, 26, 22, 22, 1, 21, 21, 15, 28, 25,
-	24, 27, 34, 14, 22, 13, 31, 21, 32, 33,
-	22, 9, 11, 21, 5, 6, 2, 10, 4, 12,
-	7, 8,
+	27, 36, 33, 3, 2, 21, 11, 41, 43, 66,
+	38, 67, 12, 37, 44, 45, 47, 13, 40, 58,
+	52, 38, 29, 23, 37, 24, 55, 57, 38, 9,
+	10, 37, 42, 11, 54, 30, 46, 18, 20, 60,
+	49, 31, 7, 19, 51, 50, 53, 56, 17, 32,
+	59, 9, 10, 23, 11, 24, 61, 9, 10, 63,
+	6, 68, 48, 5, 7, 28, 1, 39, 14, 65,
+	7, 22, 34, 35, 26, 38, 25, 64, 37, 38,
+	15, 62, 37, 38, 4, 8, 37, 16,
 }
-var yyPact = [...]int{
 
-	28, -1000, -1000, 28, 27, -1000, -1000, -1000, 16, 9,
-	-1000, -1000, -1000, -1000, -1000, -3, -11, -1000, -1000, 6,
-	5, -1000, -5, -1000, -1000, 23, -1000, -1000, 17, -1000,
-	-1000, -1000, -1000, -1000, -1000,
+var yyPact = [...]int{
+	45, -1000, 45, -1000, -6, 0, -1000, 45, 33, -1000,
+	-1000, -1000, 45, 45, -1000, -1000, 56, 45, 27, -1000,
+	35, -1000, 68, -1000, -1000, 0, -1000, -1000, -1000, 51,
+	3, -1000, -1000, -8, -1000, -1000, -1000, -1000, 52, 56,
+	45, 30, -1000, 6, 21, 14, -1000, 68, -1000, -1000,
+	23, -1000, -1000, -1000, 76, -1000, -1000, 72, -1000, -12,
+	56, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
 }
-var yyPgo = [...]int{
 
-	0, 0, 41, 39, 38, 14, 36, 6,
+var yyPgo = [...]int{
+	0, 1, 87, 0, 85, 4, 3, 84, 63, 60,
+	80, 5, 71, 69, 2, 66,
 }
-var yyR1 = [...]int{
 
-	0, 5, 6, 6, 7, 4, 4, 4, 2, 2,
+var yyR1 = [...]int{
+	0, 15, 5, 5, 6, 7, 7, 8, 8, 9,
+	9, 10, 10, 10, 4, 4, 4, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
-	2, 2, 2, 2, 3, 3, 1, 1,
+	2, 2, 2, 2, 2, 2, 2, 11, 12, 12,
+	13, 13, 14, 14, 14, 3, 3, 1, 1,
 }
-var yyR2 = [...]int{
 
-	0, 1, 2, 1, 3, 0, 1, 1, 1, 2,
-	4, 1, 1, 3, 3, 3, 4, 5, 4, 5,
-	4, 5, 4, 5, 0, 1, 1, 2,
+var yyR2 = [...]int{
+	0, 1, 2, 1, 1, 3, 1, 3, 1, 2,
+	2, 2, 4, 6, 0, 1, 1, 1, 2, 4,
+	1, 1, 2, 3, 3, 3, 4, 4, 5, 4,
+	5, 4, 5, 4, 5, 3, 1, 5, 1, 1,
+	1, 1, 1, 1, 1, 0, 1, 1, 2,
 }
-var yyChk = [...]int{
 
-	-1000, -5, -6, -7, -4, 6, 7, -6, -2, 4,
-	10, 5, -3, 9, 14, 8, 4, -1, 5, 11,
-	12, 10, 7, 14, -1, 13, 5, -1, 13, 5,
-	10, -1, 5, -1, 5,
+var yyChk = [...]int{
+	-1000, -15, -5, -6, -7, -8, -9, 19, -4, 6,
+	7, -6, 18, 17, -9, -10, -2, 15, 4, 10,
+	5, -11, -12, 20, 22, -8, -9, -3, 9, -5,
+	8, 14, 14, -14, 4, 5, -1, 10, 7, 16,
+	15, 4, -1, 5, 11, 12, -11, 24, 10, -3,
+	-5, 14, 14, -1, 13, 5, -1, 13, 5, -14,
+	16, -1, 5, -1, 5, -13, 21, 23, -3,
 }
-var yyDef = [...]int{
 
-	5, -2, 1, -2, 0, 6, 7, 2, 24, 8,
-	11, 12, 4, 25, 9, 0, 13, 14, 15, 0,
-	0, 26, 0, 10, 16, 0, 20, 18, 0, 22,
-	27, 17, 21, 19, 23,
+var yyDef = [...]int{
+	14, -2, -2, 3, 4, 6, 8, 14, 0, 15,
+	16, 2, 14, 14, 9, 10, 45, 14, 17, 20,
+	21, 36, 0, 38, 39, 5, 7, 11, 46, 14,
+	0, 18, 22, 0, 42, 43, 44, 47, 0, 45,
+	14, 23, 24, 25, 0, 0, 35, 0, 48, 12,
+	14, 19, 26, 27, 0, 31, 29, 0, 33, 0,
+	45, 28, 32, 30, 34, 37, 40, 41, 13,
 }
-var yyTok1 = [...]int{
 
+var yyTok1 = [...]int{
 	1,
 }
-var yyTok2 = [...]int{
 
+var yyTok2 = [...]int{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
-	12, 13, 14,
+	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
+	22, 23, 24,
 }
+
 var yyTok3 = [...]int{
 	0,
 }
@@ -475,64 +517,135 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:40
+//line query_string.y:56
 		{
 			logDebugGrammar("INPUT")
+			for _, clause := range yyDollar[1].cs {
+				addQueryClause(yylex.(*lexerWrapper).query, clause)
+			}
 		}
 	case 2:
 		yyDollar = yyS[yypt-2 : yypt+1]
-		//line query_string.y:45
+//line query_string.y:64
 		{
 			logDebugGrammar("SEARCH PARTS")
+			yyVAL.cs = append(yyDollar[1].cs, yyDollar[2].c)
 		}
 	case 3:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:49
+//line query_string.y:69
 		{
 			logDebugGrammar("SEARCH PART")
+			yyVAL.cs = []*queryClause{yyDollar[1].c}
 		}
 	case 4:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:75
+		{
+			yyVAL.c = orClause(yyDollar[1].ors)
+		}
+	case 5:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line query_string.y:54
+//line query_string.y:80
+		{
+			logDebugGrammar("OR")
+			yyVAL.ors = append(yyDollar[1].ors, yyDollar[3].cs)
+		}
+	case 6:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:85
 		{
-			query := yyDollar[2].q
-			if yyDollar[3].pf != nil {
+			yyVAL.ors = [][]*queryClause{yyDollar[1].cs}
+		}
+	case 7:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line query_string.y:90
+		{
+			logDebugGrammar("AND")
+			yyVAL.cs = append(yyDollar[1].cs, yyDollar[3].c)
+		}
+	case 8:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:95
+		{
+			yyVAL.cs = []*queryClause{yyDollar[1].c}
+		}
+	case 9:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:100
+		{
+			logDebugGrammar("NOT")
+			yyVAL.c = &queryClause{occur: queryMustNot, q: clauseQuery(yyDollar[2].c)}
+		}
+	case 10:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:105
+		{
+			yyVAL.c = &queryClause{occur: yyDollar[1].n, q: yyDollar[2].q}
+		}
+	case 11:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:110
+		{
+			query := yyDollar[1].q
+			if yyDollar[2].pf != nil {
 				if query, ok := query.(BoostableQuery); ok {
-					query.SetBoost(*yyDollar[3].pf)
+					query.SetBoost(*yyDollar[2].pf)
 				}
 			}
-			switch yyDollar[1].n {
-			case queryShould:
-				yylex.(*lexerWrapper).query.AddShould(query)
-			case queryMust:
-				yylex.(*lexerWrapper).query.AddMust(query)
-			case queryMustNot:
-				yylex.(*lexerWrapper).query.AddMustNot(query)
+			yyVAL.q = query
+		}
+	case 12:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line query_string.y:120
+		{
+			logDebugGrammar("GROUP")
+			query := groupQuery(yyDollar[2].cs)
+			if yyDollar[4].pf != nil {
+				if query, ok := query.(BoostableQuery); ok {
+					query.SetBoost(*yyDollar[4].pf)
+				}
 			}
+			yyVAL.q = query
 		}
-	case 5:
+	case 13:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line query_string.y:131
+		{
+			field := yyDollar[1].s
+			logDebugGrammar("FIELD - %s GROUP", field)
+			query := groupQuery(yyDollar[4].cs)
+			setQueryStringField(query, field)
+			if yyDollar[6].pf != nil {
+				if query, ok := query.(BoostableQuery); ok {
+					query.SetBoost(*yyDollar[6].pf)
+				}
+			}
+			yyVAL.q = query
+		}
+	case 14:
 		yyDollar = yyS[yypt-0 : yypt+1]
-		//line query_string.y:73
+//line query_string.y:145
 		{
 			yyVAL.n = queryShould
 		}
-	case 6:
+	case 15:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:77
+//line query_string.y:149
 		{
 			logDebugGrammar("PLUS")
 			yyVAL.n = queryMust
 		}
-	case 7:
+	case 16:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:82
+//line query_string.y:154
 		{
 			logDebugGrammar("MINUS")
 			yyVAL.n = queryMustNot
 		}
-	case 8:
+	case 17:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:88
+//line query_string.y:160
 		{
 			str := yyDollar[1].s
 			logDebugGrammar("STRING - %s", str)
@@ -546,9 +659,9 @@ yydefault:
 			}
 			yyVAL.q = q
 		}
-	case 9:
+	case 18:
 		yyDollar = yyS[yypt-2 : yypt+1]
-		//line query_string.y:102
+//line query_string.y:174
 		{
 			str := yyDollar[1].s
 			fuzziness, err := strconv.ParseFloat(yyDollar[2].s, 64)
@@ -560,9 +673,9 @@ yydefault:
 			q.SetFuzziness(int(fuzziness))
 			yyVAL.q = q
 		}
-	case 10:
+	case 19:
 		yyDollar = yyS[yypt-4 : yypt+1]
-		//line query_string.y:114
+//line query_string.y:186
 		{
 			field := yyDollar[1].s
 			str := yyDollar[3].s
@@ -576,9 +689,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 11:
+	case 20:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:128
+//line query_string.y:200
 		{
 			str := yyDollar[1].s
 			logDebugGrammar("STRING - %s", str)
@@ -593,18 +706,32 @@ yydefault:
 			q.queryStringMode = true
 			yyVAL.q = q
 		}
-	case 12:
+	case 21:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:143
+//line query_string.y:215
 		{
 			phrase := yyDollar[1].s
 			logDebugGrammar("PHRASE - %s", phrase)
 			q := NewMatchPhraseQuery(phrase)
 			yyVAL.q = q
 		}
-	case 13:
+	case 22:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line query_string.y:222
+		{
+			phrase := yyDollar[1].s
+			slop, err := strconv.ParseFloat(yyDollar[2].s, 64)
+			if err != nil {
+				yylex.(*lexerWrapper).lex.Error(fmt.Sprintf("invalid slop value: %v", err))
+			}
+			logDebugGrammar("SLOPPY PHRASE - %s %f", phrase, slop)
+			q := NewMatchPhraseQuery(phrase)
+			q.Slop = int(slop)
+			yyVAL.q = q
+		}
+	case 23:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line query_string.y:150
+//line query_string.y:234
 		{
 			field := yyDollar[1].s
 			str := yyDollar[3].s
@@ -620,9 +747,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 14:
+	case 24:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line query_string.y:166
+//line query_string.y:250
 		{
 			field := yyDollar[1].s
 			str := yyDollar[3].s
@@ -640,9 +767,9 @@ yydefault:
 			q.queryStringMode = true
 			yyVAL.q = q
 		}
-	case 15:
+	case 25:
 		yyDollar = yyS[yypt-3 : yypt+1]
-		//line query_string.y:184
+//line query_string.y:268
 		{
 			field := yyDollar[1].s
 			phrase := yyDollar[3].s
@@ -651,9 +778,25 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 16:
+	case 26:
 		yyDollar = yyS[yypt-4 : yypt+1]
-		//line query_string.y:193
+//line query_string.y:277
+		{
+			field := yyDollar[1].s
+			phrase := yyDollar[3].s
+			slop, err := strconv.ParseFloat(yyDollar[4].s, 64)
+			if err != nil {
+				yylex.(*lexerWrapper).lex.Error(fmt.Sprintf("invalid slop value: %v", err))
+			}
+			logDebugGrammar("FIELD - %s SLOPPY PHRASE - %s %f", field, phrase, slop)
+			q := NewMatchPhraseQuery(phrase)
+			q.Slop = int(slop)
+			q.SetField(field)
+			yyVAL.q = q
+		}
+	case 27:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line query_string.y:291
 		{
 			field := yyDollar[1].s
 			min, err := strconv.ParseFloat(yyDollar[4].s, 64)
@@ -666,9 +809,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 17:
+	case 28:
 		yyDollar = yyS[yypt-5 : yypt+1]
-		//line query_string.y:206
+//line query_string.y:304
 		{
 			field := yyDollar[1].s
 			min, err := strconv.ParseFloat(yyDollar[5].s, 64)
@@ -681,9 +824,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 18:
+	case 29:
 		yyDollar = yyS[yypt-4 : yypt+1]
-		//line query_string.y:219
+//line query_string.y:317
 		{
 			field := yyDollar[1].s
 			max, err := strconv.ParseFloat(yyDollar[4].s, 64)
@@ -696,9 +839,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 19:
+	case 30:
 		yyDollar = yyS[yypt-5 : yypt+1]
-		//line query_string.y:232
+//line query_string.y:330
 		{
 			field := yyDollar[1].s
 			max, err := strconv.ParseFloat(yyDollar[5].s, 64)
@@ -711,9 +854,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 20:
+	case 31:
 		yyDollar = yyS[yypt-4 : yypt+1]
-		//line query_string.y:245
+//line query_string.y:343
 		{
 			field := yyDollar[1].s
 			minInclusive := false
@@ -728,9 +871,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 21:
+	case 32:
 		yyDollar = yyS[yypt-5 : yypt+1]
-		//line query_string.y:260
+//line query_string.y:358
 		{
 			field := yyDollar[1].s
 			minInclusive := true
@@ -745,9 +888,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 22:
+	case 33:
 		yyDollar = yyS[yypt-4 : yypt+1]
-		//line query_string.y:275
+//line query_string.y:373
 		{
 			field := yyDollar[1].s
 			maxInclusive := false
@@ -762,9 +905,9 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 23:
+	case 34:
 		yyDollar = yyS[yypt-5 : yypt+1]
-		//line query_string.y:290
+//line query_string.y:388
 		{
 			field := yyDollar[1].s
 			maxInclusive := true
@@ -779,15 +922,84 @@ yydefault:
 			q.SetField(field)
 			yyVAL.q = q
 		}
-	case 24:
+	case 35:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line query_string.y:403
+		{
+			field := yyDollar[1].s
+			logDebugGrammar("FIELD - %s RANGE", field)
+			q := yyDollar[3].q
+			setQueryStringField(q, field)
+			yyVAL.q = q
+		}
+	case 36:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:411
+		{
+			yyVAL.q = yyDollar[1].q
+		}
+	case 37:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line query_string.y:416
+		{
+			logDebugGrammar("RANGE")
+			q, err := rangeQueryForQueryString(yyDollar[2].rb, yyDollar[4].rb, yyDollar[1].b, yyDollar[5].b)
+			if err != nil {
+				yylex.(*lexerWrapper).lex.Error(err.Error())
+			}
+			yyVAL.q = q
+		}
+	case 38:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:426
+		{
+			yyVAL.b = true
+		}
+	case 39:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:430
+		{
+			yyVAL.b = false
+		}
+	case 40:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:435
+		{
+			yyVAL.b = true
+		}
+	case 41:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:439
+		{
+			yyVAL.b = false
+		}
+	case 42:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:444
+		{
+			yyVAL.rb = &queryRangeBound{s: yyDollar[1].s}
+		}
+	case 43:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:448
+		{
+			yyVAL.rb = &queryRangeBound{s: yyDollar[1].s, phrase: true}
+		}
+	case 44:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line query_string.y:452
+		{
+			yyVAL.rb = &queryRangeBound{s: yyDollar[1].s, number: true}
+		}
+	case 45:
 		yyDollar = yyS[yypt-0 : yypt+1]
-		//line query_string.y:306
+//line query_string.y:457
 		{
 			yyVAL.pf = nil
 		}
-	case 25:
+	case 46:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:310
+//line query_string.y:461
 		{
 			yyVAL.pf = nil
 			boost, err := strconv.ParseFloat(yyDollar[1].s, 64)
@@ -798,15 +1010,15 @@ yydefault:
 			}
 			logDebugGrammar("BOOST %f", boost)
 		}
-	case 26:
+	case 47:
 		yyDollar = yyS[yypt-1 : yypt+1]
-		//line query_string.y:322
+//line query_string.y:473
 		{
 			yyVAL.s = yyDollar[1].s
 		}
-	case 27:
+	case 48:
 		yyDollar = yyS[yypt-2 : yypt+1]
-		//line query_string.y:326
+//line query_string.y:477
 		{
 			yyVAL.s = "-" + yyDollar[2].s
 		}
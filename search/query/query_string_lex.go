@@ -17,6 +17,7 @@ package query
 import (
 	"bufio"
 	"io"
+	"regexp"
 	"strings"
 	"unicode"
 )
@@ -44,12 +45,141 @@ type queryStringLex struct {
 	nextRune      rune
 	nextRuneSize  int
 	atEOF         bool
+	inRange       bool
+	groups        int // The groups open.
+	tokenParens   int // The parentheses open in the token, which aren't groups.
+	prevTokenType int // The type of the token last returned.
 }
 
 func (l *queryStringLex) reset() {
 	l.buf = ""
 	l.inEscape = false
 	l.seenDot = false
+	l.tokenParens = 0
+}
+
+// closes returns whether the rune closes a group or range, ending the
+// token before it.
+func (l *queryStringLex) closes(next rune) bool {
+	return (next == ')' && l.groups > 0 && l.tokenParens == 0) ||
+		(l.inRange && (next == ']' || next == '}'))
+}
+
+// addRune adds a rune that isn't escaped to the token.
+func (l *queryStringLex) addRune(next rune) {
+	if next == '(' {
+		l.tokenParens++
+	} else if next == ')' && l.tokenParens > 0 {
+		l.tokenParens--
+	}
+	l.buf += string(next)
+}
+
+// For backward compatibility, brackets only start a group or range at
+// the start of a token, and when followed by the rest of it, so that
+// terms like f(x), {x} or :) are still strings. The lookahead is bounded
+// by the size of the input buffer, past which a group is assumed.
+
+// groupAhead returns whether the input after a ( has a non-empty group
+// closed by a matching ).
+func (l *queryStringLex) groupAhead() bool {
+	rest, err := l.in.Peek(l.in.Size())
+	depth := 1
+	empty := true
+	var inPhrase bool
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == '\\':
+			i++
+		case inPhrase:
+			inPhrase = c != '"'
+		case c == '"':
+			inPhrase = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return !empty
+			}
+		}
+		if !unicode.IsSpace(rune(c)) {
+			empty = false
+		}
+	}
+	// the input may go on past the buffer if it's full
+	return err == nil
+}
+
+var rangeAheadRegexp = regexp.MustCompile(`^\s*("(\\.|[^"\\])*"|(\\.|[^\s\\])+)` +
+	`\s+TO\s+("(\\.|[^"\\])*"|(\\.|[^\s\\\]}])+)\s*[\]}]`)
+
+// rangeAhead returns whether the input after a [ or { has the bounds of
+// a range, and its end.
+func (l *queryStringLex) rangeAhead() bool {
+	rest, _ := l.in.Peek(l.in.Size())
+	return rangeAheadRegexp.Match(rest)
+}
+
+// Likewise AND, OR and NOT are only operators when they have operands,
+// so that queries being typed, like `a AND`, still search for the words.
+
+// afterOperand returns whether the token last returned ends an operand.
+func (l *queryStringLex) afterOperand() bool {
+	switch l.prevTokenType {
+	case tSTRING, tPHRASE, tNUMBER, tBOOST, tTILDE, tRPAREN, tRBRACKET, tRBRACE:
+		return true
+	}
+	return false
+}
+
+// expectsOperand returns whether the token last returned must be
+// followed by an operand, which a NOT can't be.
+func (l *queryStringLex) expectsOperand() bool {
+	switch l.prevTokenType {
+	case tPLUS, tMINUS, tCOLON, tGREATER, tLESS, tEQUAL, tLBRACKET, tLBRACE, tTO:
+		return true
+	}
+	return false
+}
+
+// operandAhead returns whether the input after an operator ended by the
+// given rune starts an operand, past any NOTs.
+func (l *queryStringLex) operandAhead(next rune, eof bool) bool {
+	if eof || next != ' ' {
+		return false
+	}
+	rest, err := l.in.Peek(l.in.Size())
+	i := 0
+	for {
+		for i < len(rest) && unicode.IsSpace(rune(rest[i])) {
+			i++
+		}
+		if i == len(rest) {
+			// the input may go on past the buffer if it's full
+			return err == nil
+		}
+		if rest[i] == ')' && l.groups > 0 {
+			return false
+		}
+		start := i
+		for i < len(rest) && !unicode.IsSpace(rune(rest[i])) &&
+			!(rest[i] == ')' && l.groups > 0) && rest[i] != ':' {
+			i++
+		}
+		if i < len(rest) && rest[i] == ':' {
+			// a field name
+			return true
+		}
+		switch string(rest[start:i]) {
+		case "AND", "OR":
+			return false
+		case "NOT":
+			continue
+		}
+		return true
+	}
 }
 
 func (l *queryStringLex) Error(msg string) {
@@ -79,6 +209,7 @@ func (l *queryStringLex) Lex(lval *yySymType) int {
 	rv := l.nextTokenType
 	l.nextToken = nil
 	l.nextTokenType = 0
+	l.prevTokenType = rv
 	return rv
 }
 
@@ -110,6 +241,29 @@ func startState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	case '+', '-', ':', '>', '<', '=':
 		l.buf += string(next)
 		return singleCharOpState, true
+	case '(':
+		if l.groupAhead() {
+			l.buf += string(next)
+			return singleCharOpState, true
+		}
+	case ')':
+		if l.groups > 0 {
+			l.buf += string(next)
+			return singleCharOpState, true
+		}
+	case '[', '{':
+		if l.rangeAhead() {
+			l.buf += string(next)
+			return singleCharOpState, true
+		}
+	case ']', '}':
+		if l.inRange {
+			l.buf += string(next)
+			return singleCharOpState, true
+		}
+	case '/':
+		l.buf += string(next)
+		return inRegexState, true
 	case '^':
 		return inBoostState, true
 	case '~':
@@ -124,7 +278,7 @@ func startState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		l.buf += string(next)
 		return inNumOrStrState, true
 	case !unicode.IsSpace(next):
-		l.buf += string(next)
+		l.addRune(next)
 		return inStrState, true
 	}
 
@@ -185,6 +339,30 @@ func singleCharOpState(l *queryStringLex, next rune, eof bool) (lexState, bool)
 	case "=":
 		l.nextTokenType = tEQUAL
 		logDebugTokens("EQUAL")
+	case "(":
+		l.nextTokenType = tLPAREN
+		l.groups++
+		logDebugTokens("LPAREN")
+	case ")":
+		l.nextTokenType = tRPAREN
+		l.groups--
+		logDebugTokens("RPAREN")
+	case "[":
+		l.nextTokenType = tLBRACKET
+		l.inRange = true
+		logDebugTokens("LBRACKET")
+	case "]":
+		l.nextTokenType = tRBRACKET
+		l.inRange = false
+		logDebugTokens("RBRACKET")
+	case "{":
+		l.nextTokenType = tLBRACE
+		l.inRange = true
+		logDebugTokens("LBRACE")
+	case "}":
+		l.nextTokenType = tRBRACE
+		l.inRange = false
+		logDebugTokens("RBRACE")
 	}
 
 	l.reset()
@@ -193,8 +371,8 @@ func singleCharOpState(l *queryStringLex, next rune, eof bool) (lexState, bool)
 
 func inBoostState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 
-	// only a non-escaped space ends the boost (or eof)
-	if eof || (!l.inEscape && next == ' ') {
+	// only a non-escaped space or closing bracket ends the boost (or eof)
+	if eof || (!l.inEscape && (next == ' ' || l.closes(next))) {
 		// end boost
 		l.nextTokenType = tBOOST
 		if l.buf == "" {
@@ -205,7 +383,7 @@ func inBoostState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		}
 		logDebugTokens("BOOST - '%s'", l.nextToken.s)
 		l.reset()
-		return startState, true
+		return startState, eof || next == ' '
 	} else if !l.inEscape && next == '\\' {
 		l.inEscape = true
 	} else if l.inEscape {
@@ -221,8 +399,8 @@ func inBoostState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 
 func inTildeState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 
-	// only a non-escaped space ends the tilde (or eof)
-	if eof || (!l.inEscape && next == ' ') {
+	// only a non-escaped space or closing bracket ends the tilde (or eof)
+	if eof || (!l.inEscape && (next == ' ' || l.closes(next))) {
 		// end tilde
 		l.nextTokenType = tTILDE
 		if l.buf == "" {
@@ -233,7 +411,7 @@ func inTildeState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		}
 		logDebugTokens("TILDE - '%s'", l.nextToken.s)
 		l.reset()
-		return startState, true
+		return startState, eof || next == ' '
 	} else if !l.inEscape && next == '\\' {
 		l.inEscape = true
 	} else if l.inEscape {
@@ -248,8 +426,8 @@ func inTildeState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 }
 
 func inNumOrStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
-	// only a non-escaped space ends the tilde (or eof)
-	if eof || (!l.inEscape && next == ' ') {
+	// only a non-escaped space or closing bracket ends the number (or eof)
+	if eof || (!l.inEscape && (next == ' ' || l.closes(next))) {
 		// end number
 		l.nextTokenType = tNUMBER
 		l.nextToken = &yySymType{
@@ -257,7 +435,7 @@ func inNumOrStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		}
 		logDebugTokens("NUMBER - '%s'", l.nextToken.s)
 		l.reset()
-		return startState, true
+		return startState, eof || next == ' '
 	} else if !l.inEscape && next == '\\' {
 		l.inEscape = true
 		return inNumOrStrState, true
@@ -282,15 +460,28 @@ func inNumOrStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 	}
 
 	// doesn't look like an number, transition
-	l.buf += string(next)
+	l.addRune(next)
 	return inStrState, true
 }
 
 func inStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
-	// end on non-escped space, colon, tilde, boost (or eof)
-	if eof || (!l.inEscape && (next == ' ' || next == ':' || next == '^' || next == '~')) {
-		// end string
+	// end on non-escped space, colon, tilde, boost, closing bracket (or eof)
+	if eof || (!l.inEscape && (next == ' ' || next == ':' || next == '^' || next == '~' ||
+		l.closes(next))) {
+		// end string, unless it's an operator, which a field name isn't
 		l.nextTokenType = tSTRING
+		if eof || next != ':' {
+			switch {
+			case l.buf == "AND" && l.afterOperand() && l.operandAhead(next, eof):
+				l.nextTokenType = tAND
+			case l.buf == "OR" && l.afterOperand() && l.operandAhead(next, eof):
+				l.nextTokenType = tOR
+			case l.buf == "NOT" && !l.expectsOperand() && l.operandAhead(next, eof):
+				l.nextTokenType = tNOT
+			case l.buf == "TO" && l.inRange:
+				l.nextTokenType = tTO
+			}
+		}
 		l.nextToken = &yySymType{
 			s: l.buf,
 		}
@@ -298,7 +489,7 @@ func inStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		l.reset()
 
 		consumed := true
-		if !eof && (next == ':' || next == '^' || next == '~') {
+		if !eof && next != ' ' {
 			consumed = false
 		}
 
@@ -310,12 +501,35 @@ func inStrState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
 		l.inEscape = false
 		l.buf += unescape(string(next))
 	} else {
-		l.buf += string(next)
+		l.addRune(next)
 	}
 
 	return inStrState, true
 }
 
+func inRegexState(l *queryStringLex, next rune, eof bool) (lexState, bool) {
+	// an unterminated regular expression is just a string
+	if eof {
+		return inStrState(l, next, eof)
+	}
+
+	// only a non-escaped / ends the regular expression, whose escapes are
+	// its own
+	if !l.inEscape && next == '/' {
+		l.buf += string(next)
+		return inStrState, true
+	} else if !l.inEscape && next == '\\' {
+		l.inEscape = true
+	} else if l.inEscape {
+		l.inEscape = false
+		l.buf += "\\" + string(next)
+	} else {
+		l.buf += string(next)
+	}
+
+	return inRegexState, true
+}
+
 func logDebugTokens(format string, v ...interface{}) {
 	if debugLexer {
 		logger.Printf(format, v...)
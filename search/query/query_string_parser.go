@@ -27,7 +27,9 @@ package query
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var debugParser bool
@@ -63,6 +65,193 @@ const (
 	queryMustNot
 )
 
+// queryClause is a query of the syntax with how it occurs in the boolean
+// query it's added to, by the +/- prefix or NOT before it.
+type queryClause struct {
+	occur int
+	q     Query
+}
+
+func addQueryClause(q *BooleanQuery, clause *queryClause) {
+	switch clause.occur {
+	case queryShould:
+		q.AddShould(clause.q)
+	case queryMust:
+		q.AddMust(clause.q)
+	case queryMustNot:
+		q.AddMustNot(clause.q)
+	}
+}
+
+// clauseQuery returns a query matching the documents the clause allows,
+// on its own.
+func clauseQuery(clause *queryClause) Query {
+	if clause.occur == queryMustNot {
+		return NewBooleanQueryForQueryString(nil, nil, []Query{clause.q})
+	}
+	return clause.q
+}
+
+// orClause returns the clause of the operands of an expression joined by
+// AND and OR, where AND binds more tightly. A lone operand keeps its
+// prefix, so the syntax without operators means what it always has, and
+// otherwise the expression is a should clause, like any other.
+func orClause(ors [][]*queryClause) *queryClause {
+	if len(ors) == 1 && len(ors[0]) == 1 {
+		return ors[0][0]
+	}
+	if len(ors) == 1 {
+		return &queryClause{occur: queryShould, q: andQuery(ors[0])}
+	}
+	disjuncts := make([]Query, 0, len(ors))
+	for _, clauses := range ors {
+		disjuncts = append(disjuncts, andQuery(clauses))
+	}
+	q := NewDisjunctionQuery(disjuncts)
+	q.queryStringMode = true
+	return &queryClause{occur: queryShould, q: q}
+}
+
+// andQuery returns a query requiring each of the operands joined by AND,
+// and none of those negated.
+func andQuery(clauses []*queryClause) Query {
+	if len(clauses) == 1 {
+		return clauseQuery(clauses[0])
+	}
+	q := NewBooleanQueryForQueryString(nil, nil, nil)
+	for _, clause := range clauses {
+		if clause.occur == queryMustNot {
+			q.AddMustNot(clause.q)
+		} else {
+			q.AddMust(clause.q)
+		}
+	}
+	return q
+}
+
+// groupQuery returns the query of a parenthesized group, which combines
+// its clauses like those of the whole query string.
+func groupQuery(clauses []*queryClause) Query {
+	if len(clauses) == 1 && clauses[0].occur != queryMustNot {
+		return clauses[0].q
+	}
+	q := NewBooleanQueryForQueryString(nil, nil, nil)
+	for _, clause := range clauses {
+		addQueryClause(q, clause)
+	}
+	return q
+}
+
+// setQueryStringField sets the field of the queries in a field-scoped
+// group that don't name their own.
+func setQueryStringField(q Query, field string) {
+	switch q := q.(type) {
+	case *BooleanQuery:
+		if q.Must != nil {
+			setQueryStringField(q.Must, field)
+		}
+		if q.Should != nil {
+			setQueryStringField(q.Should, field)
+		}
+		if q.MustNot != nil {
+			setQueryStringField(q.MustNot, field)
+		}
+	case *ConjunctionQuery:
+		for _, conjunct := range q.Conjuncts {
+			setQueryStringField(conjunct, field)
+		}
+	case *DisjunctionQuery:
+		for _, disjunct := range q.Disjuncts {
+			setQueryStringField(disjunct, field)
+		}
+	case FieldableQuery:
+		if q.Field() == "" {
+			q.SetField(field)
+		}
+	}
+}
+
+// queryRangeBound is a bound of a range in the syntax, where * is open.
+type queryRangeBound struct {
+	s      string
+	phrase bool
+	number bool
+}
+
+func (b *queryRangeBound) open() bool {
+	return !b.phrase && b.s == "*"
+}
+
+// rangeQueryForQueryString returns a numeric range query if the bounds
+// are numbers, a date range query if they're phrases, and otherwise a
+// term range query.
+func rangeQueryForQueryString(min, max *queryRangeBound,
+	minInclusive, maxInclusive bool) (FieldableQuery, error) {
+	if min.open() && max.open() {
+		return nil, fmt.Errorf("range must have a lower or upper bound")
+	}
+
+	numeric, date := true, true
+	for _, b := range []*queryRangeBound{min, max} {
+		if !b.open() {
+			numeric = numeric && b.number
+			date = date && b.phrase
+		}
+	}
+
+	var minIncl, maxIncl *bool
+	if !min.open() {
+		minIncl = &minInclusive
+	}
+	if !max.open() {
+		maxIncl = &maxInclusive
+	}
+
+	switch {
+	case numeric:
+		var minVal, maxVal *float64
+		for _, v := range []struct {
+			b   *queryRangeBound
+			val **float64
+		}{{min, &minVal}, {max, &maxVal}} {
+			if v.b.open() {
+				continue
+			}
+			f, err := strconv.ParseFloat(v.b.s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing number: %v", err)
+			}
+			*v.val = &f
+		}
+		return NewNumericRangeInclusiveQuery(minVal, maxVal, minIncl, maxIncl), nil
+	case date:
+		var minTime, maxTime time.Time
+		var err error
+		if !min.open() {
+			minTime, err = queryTimeFromString(min.s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time: %v", err)
+			}
+		}
+		if !max.open() {
+			maxTime, err = queryTimeFromString(max.s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time: %v", err)
+			}
+		}
+		return NewDateRangeInclusiveQuery(minTime, maxTime, minIncl, maxIncl), nil
+	}
+
+	var minTerm, maxTerm string
+	if !min.open() {
+		minTerm = min.s
+	}
+	if !max.open() {
+		maxTerm = max.s
+	}
+	return NewTermRangeInclusiveQuery(minTerm, maxTerm, minIncl, maxIncl), nil
+}
+
 type lexerWrapper struct {
 	lex   yyLexer
 	errs  []string
@@ -200,6 +200,35 @@ func TestQuerySyntaxParserValid(t *testing.T) {
 				},
 				nil),
 		},
+		{
+			input:   `"test phrase 1"~2`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewMatchPhraseQuery("test phrase 1")
+						q.Slop = 2
+						return q
+					}(),
+				},
+				nil),
+		},
+		{
+			input:   `field3:"test phrase 2"~3`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewMatchPhraseQuery("test phrase 2")
+						q.Slop = 3
+						q.SetField("field3")
+						return q
+					}(),
+				},
+				nil),
+		},
 		{
 			input:   `+field4:"test phrase 1"`,
 			mapping: mapping.NewIndexMapping(),
@@ -811,6 +840,367 @@ func TestQuerySyntaxParserValid(t *testing.T) {
 				},
 				nil),
 		},
+		{
+			input:   `(a OR b) AND NOT c`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewBooleanQueryForQueryString(
+						[]Query{
+							func() Query {
+								q := NewDisjunctionQuery([]Query{
+									NewMatchQuery("a"),
+									NewMatchQuery("b"),
+								})
+								q.queryStringMode = true
+								return q
+							}(),
+						},
+						nil,
+						[]Query{
+							NewMatchQuery("c"),
+						}),
+				},
+				nil),
+		},
+		// AND binds more tightly than OR
+		{
+			input:   `a OR b AND c`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewDisjunctionQuery([]Query{
+							NewMatchQuery("a"),
+							NewBooleanQueryForQueryString(
+								[]Query{
+									NewMatchQuery("b"),
+									NewMatchQuery("c"),
+								},
+								nil,
+								nil),
+						})
+						q.queryStringMode = true
+						return q
+					}(),
+				},
+				nil),
+		},
+		{
+			input:   `NOT x`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				nil,
+				[]Query{
+					NewMatchQuery("x"),
+				}),
+		},
+		{
+			input:   `+(a -b)^2 c`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				[]Query{
+					func() Query {
+						q := NewBooleanQueryForQueryString(
+							nil,
+							[]Query{
+								NewMatchQuery("a"),
+							},
+							[]Query{
+								NewMatchQuery("b"),
+							})
+						q.SetBoost(2)
+						return q
+					}(),
+				},
+				[]Query{
+					NewMatchQuery("c"),
+				},
+				nil),
+		},
+		// a field-scoped group sets the field of the queries without one
+		{
+			input:   `title:(foo other:"bar baz" ba*)`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewBooleanQueryForQueryString(
+						nil,
+						[]Query{
+							func() Query {
+								q := NewMatchQuery("foo")
+								q.SetField("title")
+								return q
+							}(),
+							func() Query {
+								q := NewMatchPhraseQuery("bar baz")
+								q.SetField("other")
+								return q
+							}(),
+							func() Query {
+								q := NewWildcardQuery("ba*")
+								q.SetField("title")
+								return q
+							}(),
+						},
+						nil),
+				},
+				nil),
+		},
+		{
+			input:   `name:(/jo(hn)?/)`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewRegexpQuery("jo(hn)?")
+						q.SetField("name")
+						return q
+					}(),
+				},
+				nil),
+		},
+		// a field may be named like an operator
+		{
+			input:   `NOT:x`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewMatchQuery("x")
+						q.SetField("NOT")
+						return q
+					}(),
+				},
+				nil),
+		},
+		{
+			input:   `field:[2 TO 5}`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewNumericRangeInclusiveQuery(&twoPointOh, &fivePointOh, &theTruth, &theFalsehood)
+						q.SetField("field")
+						return q
+					}(),
+				},
+				nil),
+		},
+		{
+			input:   `field:{-5 TO *]`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewNumericRangeInclusiveQuery(&minusFivePointOh, nil, &theFalsehood, nil)
+						q.SetField("field")
+						return q
+					}(),
+				},
+				nil),
+		},
+		{
+			input:   `field:["2006-01-02T15:04:05Z" TO *]`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewDateRangeInclusiveQuery(theDate, time.Time{}, &theTruth, nil)
+						q.SetField("field")
+						return q
+					}(),
+				},
+				nil),
+		},
+		{
+			input:   `[apple TO pear]`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewTermRangeInclusiveQuery("apple", "pear", &theTruth, &theTruth),
+				},
+				nil),
+		},
+		// operators without operands are terms, as before they were
+		// supported
+		{
+			input:   `a AND`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("a"),
+					NewMatchQuery("AND"),
+				},
+				nil),
+		},
+		{
+			input:   `OR`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("OR"),
+				},
+				nil),
+		},
+		{
+			input:   `a NOT`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("a"),
+					NewMatchQuery("NOT"),
+				},
+				nil),
+		},
+		{
+			input:   `AND OR NOT`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("AND"),
+					NewMatchQuery("OR"),
+					NewMatchQuery("NOT"),
+				},
+				nil),
+		},
+		{
+			input:   `OR a`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("OR"),
+					NewMatchQuery("a"),
+				},
+				nil),
+		},
+		{
+			input:   `NOT`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("NOT"),
+				},
+				nil),
+		},
+		// brackets that don't start a group or range are part of terms, as
+		// before groups and ranges were supported
+		{
+			input:   `foo(bar)`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("foo(bar)"),
+				},
+				nil),
+		},
+		{
+			input:   `f(x) g(y)`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("f(x)"),
+					NewMatchQuery("g(y)"),
+				},
+				nil),
+		},
+		{
+			input:   `{x}`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("{x}"),
+				},
+				nil),
+		},
+		{
+			input:   `[x`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("[x"),
+				},
+				nil),
+		},
+		{
+			input:   `smile:)`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewMatchQuery(")")
+						q.SetField("smile")
+						return q
+					}(),
+				},
+				nil),
+		},
+		{
+			input:   `(a`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("(a"),
+				},
+				nil),
+		},
+		{
+			input:   `a)`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("a)"),
+				},
+				nil),
+		},
+		{
+			input:   `()`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					NewMatchQuery("()"),
+				},
+				nil),
+		},
+		{
+			input:   `field:[1 5]`,
+			mapping: mapping.NewIndexMapping(),
+			result: NewBooleanQueryForQueryString(
+				nil,
+				[]Query{
+					func() Query {
+						q := NewMatchQuery("[1")
+						q.SetField("field")
+						return q
+					}(),
+					NewMatchQuery("5]"),
+				},
+				nil),
+		},
 	}
 
 	// turn on lexer debugging
@@ -850,6 +1240,8 @@ func TestQuerySyntaxParserInvalid(t *testing.T) {
 		{`cat^3\0`},
 		{`cat~3\:`},
 		{`cat~3\0`},
+		{"field:[* TO *]"},
+		{`field:["yesterday" TO *]`},
 		{`99999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999`},
 		{`field:99999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999`},
 		{`field:>99999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999`},
@@ -105,6 +105,99 @@ func TestParseQuery(t *testing.T) {
 				return q
 			}(),
 		},
+		{
+			input: []byte(`{"match_phrase":"light beer","field":"desc","slop":2}`),
+			output: func() Query {
+				q := NewMatchPhraseQuery("light beer")
+				q.SetField("desc")
+				q.Slop = 2
+				return q
+			}(),
+		},
+		{
+			input: []byte(`{"terms":["light","beer"],"field":"desc","slop":1}`),
+			output: func() Query {
+				q := NewPhraseQuery([]string{"light", "beer"}, "desc")
+				q.Slop = 1
+				return q
+			}(),
+		},
+		{
+			input: []byte(`{"span_near":[{"span_term":"light","field":"desc"},{"span_or":[{"span_term":"beer","field":"desc"},{"span_term":"ale","field":"desc"}]}],"slop":2,"in_order":true}`),
+			output: NewSpanNearQuery([]SpanQuery{
+				func() SpanQuery {
+					q := NewSpanTermQuery("light")
+					q.SetField("desc")
+					return q
+				}(),
+				NewSpanOrQuery([]SpanQuery{
+					func() SpanQuery {
+						q := NewSpanTermQuery("beer")
+						q.SetField("desc")
+						return q
+					}(),
+					func() SpanQuery {
+						q := NewSpanTermQuery("ale")
+						q.SetField("desc")
+						return q
+					}(),
+				}),
+			}, 2, true),
+		},
+		{
+			input:  []byte(`{"span_not":{"span_term":"beer"},"exclude":{"span_term":"light"},"pre":1}`),
+			output: NewSpanNotQuery(NewSpanTermQuery("beer"), NewSpanTermQuery("light"), 1, 0),
+		},
+		{
+			input:  []byte(`{"span_first":{"span_term":"beer"},"end":3}`),
+			output: NewSpanFirstQuery(NewSpanTermQuery("beer"), 3),
+		},
+		{
+			input: []byte(`{"like":["a","b"],"fields":["desc"],"min_doc_freq":1,"max_query_terms":10}`),
+			output: func() Query {
+				q := NewMoreLikeThisQuery([]string{"a", "b"}, []string{"desc"})
+				q.MinDocFreq = 1
+				q.MaxQueryTerms = 10
+				return q
+			}(),
+		},
+		{
+			input: []byte(`{"like_text":"light beer","analyzer":"en","include":true}`),
+			output: func() Query {
+				q := NewMoreLikeThisTextQuery("light beer", nil)
+				q.Analyzer = "en"
+				q.Include = true
+				return q
+			}(),
+		},
+		{
+			input: []byte(`{"function_score":{"term":"beer","field":"desc"},"functions":[{"field_value_factor":{"field":"likes","modifier":"log1p"}},{"gauss":{"field":"date","origin":"2020-06-01T00:00:00Z","scale":"7d"},"weight":2}],"boost_mode":"sum"}`),
+			output: func() Query {
+				tq := NewTermQuery("beer")
+				tq.SetField("desc")
+				q := NewFunctionScoreQuery(tq,
+					&ScoreFunction{
+						FieldValueFactor: &FieldValueFactorFunction{
+							Field:    "likes",
+							Modifier: "log1p",
+						},
+					},
+					&ScoreFunction{
+						Gauss: &DecayFunction{
+							Field:  "date",
+							Origin: "2020-06-01T00:00:00Z",
+							Scale:  "7d",
+						},
+						Weight: 2,
+					})
+				q.BoostMode = "sum"
+				return q
+			}(),
+		},
+		{
+			input: []byte(`{"span_first":{"term":"beer"},"end":3}`),
+			err:   true,
+		},
 		{
 			input: []byte(`{"must":{"conjuncts": [{"match":"beer","field":"desc"}]},"should":{"disjuncts": [{"match":"water","field":"desc"}],"min":1.0},"must_not":{"disjuncts": [{"match":"devon","field":"desc"}]}}`),
 			output: func() Query {
@@ -0,0 +1,449 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/searcher"
+)
+
+// A SpanQuery matches spans of positions in a field, which other span
+// queries combine. The field must have been indexed with
+// IncludeTermVectors set to true. Result documents are scored by their
+// terms, decaying with the distance between them.
+type SpanQuery interface {
+	FieldableQuery
+	SpanClause() searcher.SpanClause
+}
+
+func spanSearcher(q SpanQuery, boost *Boost, i index.IndexReader,
+	m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	if vq, ok := q.(ValidatableQuery); ok {
+		err := vq.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	field := q.Field()
+	if field == "" {
+		field = m.DefaultSearchField()
+	}
+	return searcher.NewSpanSearcher(i, q.SpanClause(), field, boost.Value(), options)
+}
+
+// spanQueriesField returns the field of the span queries, which must be
+// the same, unless they don't say.
+func spanQueriesField(queries []SpanQuery) (string, error) {
+	var field string
+	for _, q := range queries {
+		if q == nil {
+			return "", fmt.Errorf("span query clauses must not be nil")
+		}
+		if vq, ok := q.(ValidatableQuery); ok {
+			err := vq.Validate()
+			if err != nil {
+				return "", err
+			}
+		}
+		f := q.Field()
+		if f == "" {
+			continue
+		}
+		if field != "" && f != field {
+			return "", fmt.Errorf("span query clauses must be of the same field, got %s and %s",
+				field, f)
+		}
+		field = f
+	}
+	return field, nil
+}
+
+func spanClauses(queries []SpanQuery) []searcher.SpanClause {
+	rv := make([]searcher.SpanClause, 0, len(queries))
+	for _, q := range queries {
+		rv = append(rv, q.SpanClause())
+	}
+	return rv
+}
+
+func parseSpanQuery(input []byte) (SpanQuery, error) {
+	q, err := ParseQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	sq, ok := q.(SpanQuery)
+	if !ok {
+		return nil, fmt.Errorf("span query clause must be a span query, got %T", q)
+	}
+	return sq, nil
+}
+
+func parseSpanQueries(inputs []json.RawMessage) ([]SpanQuery, error) {
+	rv := make([]SpanQuery, 0, len(inputs))
+	for _, input := range inputs {
+		q, err := parseSpanQuery(input)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, q)
+	}
+	return rv, nil
+}
+
+type SpanTermQuery struct {
+	SpanTerm string `json:"span_term"`
+	FieldVal string `json:"field,omitempty"`
+	BoostVal *Boost `json:"boost,omitempty"`
+}
+
+// NewSpanTermQuery creates a new Query for the spans
+// of an exact term, to be combined by other span
+// queries.
+func NewSpanTermQuery(term string) *SpanTermQuery {
+	return &SpanTermQuery{
+		SpanTerm: term,
+	}
+}
+
+func (q *SpanTermQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanTermQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+func (q *SpanTermQuery) SetField(f string) {
+	q.FieldVal = f
+}
+
+func (q *SpanTermQuery) Field() string {
+	return q.FieldVal
+}
+
+func (q *SpanTermQuery) SpanClause() searcher.SpanClause {
+	return searcher.SpanTerm(q.SpanTerm)
+}
+
+func (q *SpanTermQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	return spanSearcher(q, q.BoostVal, i, m, options)
+}
+
+type SpanNearQuery struct {
+	SpanNear []SpanQuery `json:"span_near"`
+	Slop     int         `json:"slop"`
+	InOrder  bool        `json:"in_order,omitempty"`
+	BoostVal *Boost      `json:"boost,omitempty"`
+}
+
+// NewSpanNearQuery creates a new Query for spans of
+// all the clauses, with at most slop positions between
+// them, in the order of the clauses if inOrder is true.
+func NewSpanNearQuery(clauses []SpanQuery, slop int, inOrder bool) *SpanNearQuery {
+	return &SpanNearQuery{
+		SpanNear: clauses,
+		Slop:     slop,
+		InOrder:  inOrder,
+	}
+}
+
+func (q *SpanNearQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanNearQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// SetField sets the field of all the clauses.
+func (q *SpanNearQuery) SetField(f string) {
+	for _, clause := range q.SpanNear {
+		clause.SetField(f)
+	}
+}
+
+func (q *SpanNearQuery) Field() string {
+	field, _ := spanQueriesField(q.SpanNear)
+	return field
+}
+
+func (q *SpanNearQuery) SpanClause() searcher.SpanClause {
+	return searcher.SpanNear(spanClauses(q.SpanNear), q.Slop, q.InOrder)
+}
+
+func (q *SpanNearQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	return spanSearcher(q, q.BoostVal, i, m, options)
+}
+
+func (q *SpanNearQuery) Validate() error {
+	if len(q.SpanNear) < 1 {
+		return fmt.Errorf("span near query must contain at least one clause")
+	}
+	if q.Slop < 0 {
+		return fmt.Errorf("span near query slop must not be negative")
+	}
+	_, err := spanQueriesField(q.SpanNear)
+	return err
+}
+
+func (q *SpanNearQuery) UnmarshalJSON(data []byte) error {
+	tmp := struct {
+		SpanNear []json.RawMessage `json:"span_near"`
+		Slop     int               `json:"slop"`
+		InOrder  bool              `json:"in_order"`
+		BoostVal *Boost            `json:"boost,omitempty"`
+	}{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	q.SpanNear, err = parseSpanQueries(tmp.SpanNear)
+	if err != nil {
+		return err
+	}
+	q.Slop = tmp.Slop
+	q.InOrder = tmp.InOrder
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+type SpanOrQuery struct {
+	SpanOr   []SpanQuery `json:"span_or"`
+	BoostVal *Boost      `json:"boost,omitempty"`
+}
+
+// NewSpanOrQuery creates a new Query for the spans
+// of any of the clauses.
+func NewSpanOrQuery(clauses []SpanQuery) *SpanOrQuery {
+	return &SpanOrQuery{
+		SpanOr: clauses,
+	}
+}
+
+func (q *SpanOrQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanOrQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// SetField sets the field of all the clauses.
+func (q *SpanOrQuery) SetField(f string) {
+	for _, clause := range q.SpanOr {
+		clause.SetField(f)
+	}
+}
+
+func (q *SpanOrQuery) Field() string {
+	field, _ := spanQueriesField(q.SpanOr)
+	return field
+}
+
+func (q *SpanOrQuery) SpanClause() searcher.SpanClause {
+	return searcher.SpanOr(spanClauses(q.SpanOr)...)
+}
+
+func (q *SpanOrQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	return spanSearcher(q, q.BoostVal, i, m, options)
+}
+
+func (q *SpanOrQuery) Validate() error {
+	if len(q.SpanOr) < 1 {
+		return fmt.Errorf("span or query must contain at least one clause")
+	}
+	_, err := spanQueriesField(q.SpanOr)
+	return err
+}
+
+func (q *SpanOrQuery) UnmarshalJSON(data []byte) error {
+	tmp := struct {
+		SpanOr   []json.RawMessage `json:"span_or"`
+		BoostVal *Boost            `json:"boost,omitempty"`
+	}{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	q.SpanOr, err = parseSpanQueries(tmp.SpanOr)
+	if err != nil {
+		return err
+	}
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+type SpanNotQuery struct {
+	SpanNot  SpanQuery `json:"span_not"`
+	Exclude  SpanQuery `json:"exclude"`
+	Pre      int       `json:"pre,omitempty"`
+	Post     int       `json:"post,omitempty"`
+	BoostVal *Boost    `json:"boost,omitempty"`
+}
+
+// NewSpanNotQuery creates a new Query for the spans
+// of include that don't overlap spans of exclude,
+// nor come within pre positions after them or post
+// positions before them.
+func NewSpanNotQuery(include, exclude SpanQuery, pre, post int) *SpanNotQuery {
+	return &SpanNotQuery{
+		SpanNot: include,
+		Exclude: exclude,
+		Pre:     pre,
+		Post:    post,
+	}
+}
+
+func (q *SpanNotQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanNotQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// SetField sets the field of both clauses.
+func (q *SpanNotQuery) SetField(f string) {
+	q.SpanNot.SetField(f)
+	q.Exclude.SetField(f)
+}
+
+func (q *SpanNotQuery) Field() string {
+	field, _ := spanQueriesField([]SpanQuery{q.SpanNot, q.Exclude})
+	return field
+}
+
+func (q *SpanNotQuery) SpanClause() searcher.SpanClause {
+	return searcher.SpanNot(q.SpanNot.SpanClause(), q.Exclude.SpanClause(), q.Pre, q.Post)
+}
+
+func (q *SpanNotQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	return spanSearcher(q, q.BoostVal, i, m, options)
+}
+
+func (q *SpanNotQuery) Validate() error {
+	if q.SpanNot == nil || q.Exclude == nil {
+		return fmt.Errorf("span not query must contain a clause and an exclude clause")
+	}
+	_, err := spanQueriesField([]SpanQuery{q.SpanNot, q.Exclude})
+	return err
+}
+
+func (q *SpanNotQuery) UnmarshalJSON(data []byte) error {
+	tmp := struct {
+		SpanNot  json.RawMessage `json:"span_not"`
+		Exclude  json.RawMessage `json:"exclude"`
+		Pre      int             `json:"pre"`
+		Post     int             `json:"post"`
+		BoostVal *Boost          `json:"boost,omitempty"`
+	}{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	q.SpanNot, err = parseSpanQuery(tmp.SpanNot)
+	if err != nil {
+		return err
+	}
+	q.Exclude, err = parseSpanQuery(tmp.Exclude)
+	if err != nil {
+		return err
+	}
+	q.Pre = tmp.Pre
+	q.Post = tmp.Post
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
+
+type SpanFirstQuery struct {
+	SpanFirst SpanQuery `json:"span_first"`
+	End       int       `json:"end"`
+	BoostVal  *Boost    `json:"boost,omitempty"`
+}
+
+// NewSpanFirstQuery creates a new Query for the spans
+// of the clause ending within the first end positions
+// of the field.
+func NewSpanFirstQuery(clause SpanQuery, end int) *SpanFirstQuery {
+	return &SpanFirstQuery{
+		SpanFirst: clause,
+		End:       end,
+	}
+}
+
+func (q *SpanFirstQuery) SetBoost(b float64) {
+	boost := Boost(b)
+	q.BoostVal = &boost
+}
+
+func (q *SpanFirstQuery) Boost() float64 {
+	return q.BoostVal.Value()
+}
+
+// SetField sets the field of the clause.
+func (q *SpanFirstQuery) SetField(f string) {
+	q.SpanFirst.SetField(f)
+}
+
+func (q *SpanFirstQuery) Field() string {
+	return q.SpanFirst.Field()
+}
+
+func (q *SpanFirstQuery) SpanClause() searcher.SpanClause {
+	return searcher.SpanFirst(q.SpanFirst.SpanClause(), q.End)
+}
+
+func (q *SpanFirstQuery) Searcher(i index.IndexReader, m mapping.IndexMapping, options search.SearcherOptions) (search.Searcher, error) {
+	return spanSearcher(q, q.BoostVal, i, m, options)
+}
+
+func (q *SpanFirstQuery) Validate() error {
+	if q.SpanFirst == nil {
+		return fmt.Errorf("span first query must contain a clause")
+	}
+	if q.End < 1 {
+		return fmt.Errorf("span first query end must be positive")
+	}
+	_, err := spanQueriesField([]SpanQuery{q.SpanFirst})
+	return err
+}
+
+func (q *SpanFirstQuery) UnmarshalJSON(data []byte) error {
+	tmp := struct {
+		SpanFirst json.RawMessage `json:"span_first"`
+		End       int             `json:"end"`
+		BoostVal  *Boost          `json:"boost,omitempty"`
+	}{}
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+	q.SpanFirst, err = parseSpanQuery(tmp.SpanFirst)
+	if err != nil {
+		return err
+	}
+	q.End = tmp.End
+	q.BoostVal = tmp.BoostVal
+	return nil
+}
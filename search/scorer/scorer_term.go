@@ -16,7 +16,6 @@ package scorer
 
 import (
 	"fmt"
-	"math"
 	"reflect"
 
 	"github.com/blevesearch/bleve/index"
@@ -44,6 +43,8 @@ type TermQueryScorer struct {
 	queryNorm              float64
 	queryWeight            float64
 	queryWeightExplanation *search.Explanation
+	similarity             search.Similarity
+	stats                  search.TermStats
 }
 
 func (s *TermQueryScorer) Size() int {
@@ -61,25 +62,35 @@ func (s *TermQueryScorer) Size() int {
 	return sizeInBytes
 }
 
+// NewTermQueryScorer returns a scorer using the classic TF-IDF similarity.
 func NewTermQueryScorer(queryTerm []byte, queryField string, queryBoost float64, docTotal, docTerm uint64, options search.SearcherOptions) *TermQueryScorer {
+	return NewTermQueryScorerWithSimilarity(queryTerm, queryField, queryBoost,
+		search.TermStats{DocCount: docTotal, DocFreq: docTerm}, nil, options)
+}
+
+// NewTermQueryScorerWithSimilarity returns a scorer using the given
+// similarity, or the classic one if it is nil. The Field and Term of the
+// stats are set by the scorer.
+func NewTermQueryScorerWithSimilarity(queryTerm []byte, queryField string, queryBoost float64,
+	stats search.TermStats, similarity search.Similarity, options search.SearcherOptions) *TermQueryScorer {
+	if similarity == nil {
+		similarity = defaultSimilarity
+	}
+	stats.Field = queryField
+	stats.Term = string(queryTerm)
 	rv := TermQueryScorer{
-		queryTerm:    string(queryTerm),
+		queryTerm:    stats.Term,
 		queryField:   queryField,
 		queryBoost:   queryBoost,
-		docTerm:      docTerm,
-		docTotal:     docTotal,
-		idf:          1.0 + math.Log(float64(docTotal)/float64(docTerm+1.0)),
+		docTerm:      stats.DocFreq,
+		docTotal:     stats.DocCount,
 		options:      options,
 		queryWeight:  1.0,
 		includeScore: options.Score != "none",
+		similarity:   similarity,
+		stats:        stats,
 	}
-
-	if options.Explain {
-		rv.idfExplanation = &search.Explanation{
-			Value:   rv.idf,
-			Message: fmt.Sprintf("idf(docFreq=%d, maxDocs=%d)", docTerm, docTotal),
-		}
-	}
+	rv.idf, rv.idfExplanation = similarity.IDF(&rv.stats, options.Explain)
 
 	return &rv
 }
@@ -93,19 +104,11 @@ func (s *TermQueryScorer) SetQueryNorm(qnorm float64) {
 	s.queryNorm = qnorm
 
 	// update the query weight
-	s.queryWeight = s.queryBoost * s.idf * s.queryNorm
+	var childrenExplanations []*search.Explanation
+	s.queryWeight, childrenExplanations = s.similarity.QueryWeight(s.queryBoost,
+		s.idf, s.queryNorm, s.idfExplanation, s.options.Explain)
 
 	if s.options.Explain {
-		childrenExplanations := make([]*search.Explanation, 3)
-		childrenExplanations[0] = &search.Explanation{
-			Value:   s.queryBoost,
-			Message: "boost",
-		}
-		childrenExplanations[1] = s.idfExplanation
-		childrenExplanations[2] = &search.Explanation{
-			Value:   s.queryNorm,
-			Message: "queryNorm",
-		}
 		s.queryWeightExplanation = &search.Explanation{
 			Value:    s.queryWeight,
 			Message:  fmt.Sprintf("queryWeight(%s:%s^%f), product of:", s.queryField, s.queryTerm, s.queryBoost),
@@ -119,25 +122,11 @@ func (s *TermQueryScorer) Score(ctx *search.SearchContext, termMatch *index.Term
 	// perform any score computations only when needed
 	if s.includeScore || s.options.Explain {
 		var scoreExplanation *search.Explanation
-		var tf float64
-		if termMatch.Freq < MaxSqrtCache {
-			tf = SqrtCache[int(termMatch.Freq)]
-		} else {
-			tf = math.Sqrt(float64(termMatch.Freq))
-		}
-		score := tf * termMatch.Norm * s.idf
+		tf, childrenExplanations := s.similarity.TF(&s.stats, termMatch, s.options.Explain)
+		score := tf * s.idf
 
 		if s.options.Explain {
-			childrenExplanations := make([]*search.Explanation, 3)
-			childrenExplanations[0] = &search.Explanation{
-				Value:   tf,
-				Message: fmt.Sprintf("tf(termFreq(%s:%s)=%d", s.queryField, s.queryTerm, termMatch.Freq),
-			}
-			childrenExplanations[1] = &search.Explanation{
-				Value:   termMatch.Norm,
-				Message: fmt.Sprintf("fieldNorm(field=%s, doc=%s)", s.queryField, termMatch.ID),
-			}
-			childrenExplanations[2] = s.idfExplanation
+			childrenExplanations = append(childrenExplanations, s.idfExplanation)
 			scoreExplanation = &search.Explanation{
 				Value:    score,
 				Message:  fmt.Sprintf("fieldWeight(%s:%s in %s), product of:", s.queryField, s.queryTerm, termMatch.ID),
@@ -0,0 +1,236 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/blevesearch/bleve/search"
+)
+
+const ClassicSimilarityName = "classic"
+const BM25SimilarityName = "bm25"
+
+// Default BM25 parameters, used when the configuration omits them.
+var BM25DefaultK1 = 1.2
+var BM25DefaultB = 0.75
+
+var defaultSimilarity search.Similarity = NewClassicSimilarity()
+
+// ClassicSimilarity is the TF-IDF scoring bleve has always used: the
+// square root of the term frequency, times the field norm, times the idf.
+// The query weight includes the idf once more and the query norm.
+type ClassicSimilarity struct{}
+
+func NewClassicSimilarity() *ClassicSimilarity {
+	return &ClassicSimilarity{}
+}
+
+func (s *ClassicSimilarity) UsesFieldStats() bool {
+	return false
+}
+
+func (s *ClassicSimilarity) IDF(stats *search.TermStats, explain bool) (float64, *search.Explanation) {
+	idf := 1.0 + math.Log(float64(stats.DocCount)/float64(stats.DocFreq+1.0))
+	if !explain {
+		return idf, nil
+	}
+	return idf, &search.Explanation{
+		Value:   idf,
+		Message: fmt.Sprintf("idf(docFreq=%d, maxDocs=%d)", stats.DocFreq, stats.DocCount),
+	}
+}
+
+func (s *ClassicSimilarity) QueryWeight(boost, idf, queryNorm float64,
+	idfExpl *search.Explanation, explain bool) (float64, []*search.Explanation) {
+	queryWeight := boost * idf * queryNorm
+	if !explain {
+		return queryWeight, nil
+	}
+	return queryWeight, []*search.Explanation{
+		{
+			Value:   boost,
+			Message: "boost",
+		},
+		idfExpl,
+		{
+			Value:   queryNorm,
+			Message: "queryNorm",
+		},
+	}
+}
+
+func (s *ClassicSimilarity) TF(stats *search.TermStats, match *index.TermFieldDoc,
+	explain bool) (float64, []*search.Explanation) {
+	var tf float64
+	if match.Freq < MaxSqrtCache {
+		tf = SqrtCache[int(match.Freq)]
+	} else {
+		tf = math.Sqrt(float64(match.Freq))
+	}
+	if !explain {
+		return tf * match.Norm, nil
+	}
+	return tf * match.Norm, []*search.Explanation{
+		{
+			Value:   tf,
+			Message: fmt.Sprintf("tf(termFreq(%s:%s)=%d", stats.Field, stats.Term, match.Freq),
+		},
+		{
+			Value:   match.Norm,
+			Message: fmt.Sprintf("fieldNorm(field=%s, doc=%s)", stats.Field, match.ID),
+		},
+	}
+}
+
+// BM25Similarity implements the Okapi BM25 ranking function. K1 controls
+// how quickly the term frequency saturates, B how much the field length
+// normalizes it, relatively to the average length of the field. The
+// query weight is only the boost, so BM25 scores are not normalized
+// across queries.
+type BM25Similarity struct {
+	K1 float64
+	B  float64
+}
+
+func NewBM25Similarity(k1, b float64) (*BM25Similarity, error) {
+	if k1 < 0 {
+		return nil, fmt.Errorf("bm25 k1 must not be negative, got %f", k1)
+	}
+	if b < 0 || b > 1 {
+		return nil, fmt.Errorf("bm25 b must be between 0 and 1, got %f", b)
+	}
+	return &BM25Similarity{
+		K1: k1,
+		B:  b,
+	}, nil
+}
+
+func (s *BM25Similarity) UsesFieldStats() bool {
+	return true
+}
+
+func (s *BM25Similarity) IDF(stats *search.TermStats, explain bool) (float64, *search.Explanation) {
+	docCount := float64(stats.DocCount)
+	docFreq := float64(stats.DocFreq)
+	idf := math.Log(1.0 + (docCount-docFreq+0.5)/(docFreq+0.5))
+	if !explain {
+		return idf, nil
+	}
+	return idf, &search.Explanation{
+		Value: idf,
+		Message: fmt.Sprintf("idf(docFreq=%d, docCount=%d), computed as "+
+			"log(1 + (docCount - docFreq + 0.5) / (docFreq + 0.5))",
+			stats.DocFreq, stats.DocCount),
+	}
+}
+
+func (s *BM25Similarity) QueryWeight(boost, idf, queryNorm float64,
+	idfExpl *search.Explanation, explain bool) (float64, []*search.Explanation) {
+	if !explain {
+		return boost, nil
+	}
+	return boost, []*search.Explanation{
+		{
+			Value:   boost,
+			Message: "boost",
+		},
+	}
+}
+
+func (s *BM25Similarity) TF(stats *search.TermStats, match *index.TermFieldDoc,
+	explain bool) (float64, []*search.Explanation) {
+	freq := float64(match.Freq)
+
+	// the norm is 1/sqrt(fieldLength), without field statistics the
+	// field is taken to be of average length
+	var fieldLength, avgFieldLength float64
+	if match.Norm > 0 {
+		fieldLength = math.Round(1.0 / (match.Norm * match.Norm))
+	}
+	if stats.FieldStats != nil {
+		avgFieldLength = stats.FieldStats.AvgFieldLength()
+	}
+	lengthNorm := 1.0
+	if fieldLength > 0 && avgFieldLength > 0 {
+		lengthNorm = 1.0 - s.B + s.B*fieldLength/avgFieldLength
+	}
+
+	tfNorm := freq * (s.K1 + 1.0) / (freq + s.K1*lengthNorm)
+	if !explain {
+		return tfNorm, nil
+	}
+	return tfNorm, []*search.Explanation{
+		{
+			Value: tfNorm,
+			Message: "tfNorm, computed as (freq * (k1 + 1)) / (freq + k1 * " +
+				"(1 - b + b * fieldLength / avgFieldLength)) from:",
+			Children: []*search.Explanation{
+				{
+					Value:   freq,
+					Message: fmt.Sprintf("termFreq(%s:%s)=%d", stats.Field, stats.Term, match.Freq),
+				},
+				{
+					Value:   s.K1,
+					Message: "k1",
+				},
+				{
+					Value:   s.B,
+					Message: "b",
+				},
+				{
+					Value:   fieldLength,
+					Message: fmt.Sprintf("fieldLength(field=%s, doc=%s)", stats.Field, match.ID),
+				},
+				{
+					Value:   avgFieldLength,
+					Message: fmt.Sprintf("avgFieldLength(field=%s)", stats.Field),
+				},
+			},
+		},
+	}
+}
+
+func ClassicSimilarityConstructor(config map[string]interface{}, cache *registry.Cache) (search.Similarity, error) {
+	return NewClassicSimilarity(), nil
+}
+
+func BM25SimilarityConstructor(config map[string]interface{}, cache *registry.Cache) (search.Similarity, error) {
+	k1 := BM25DefaultK1
+	if v, ok := config["k1"]; ok {
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("bm25 k1 must be a number, not %T", v)
+		}
+		k1 = f
+	}
+	b := BM25DefaultB
+	if v, ok := config["b"]; ok {
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("bm25 b must be a number, not %T", v)
+		}
+		b = f
+	}
+	return NewBM25Similarity(k1, b)
+}
+
+func init() {
+	registry.RegisterSimilarity(ClassicSimilarityName, ClassicSimilarityConstructor)
+	registry.RegisterSimilarity(BM25SimilarityName, BM25SimilarityConstructor)
+}
@@ -0,0 +1,189 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scorer
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/blevesearch/bleve/search"
+)
+
+func TestBM25TermScorer(t *testing.T) {
+	similarity, err := NewBM25Similarity(1.2, 0.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := search.TermStats{
+		DocCount: 100,
+		DocFreq:  9,
+		FieldStats: &index.FieldStats{
+			Docs:       80,
+			TotalTerms: 320,
+		},
+	}
+	scorer := NewTermQueryScorerWithSimilarity([]byte("beer"), "desc", 2.0,
+		stats, similarity, search.SearcherOptions{Explain: true})
+	// bm25 ignores the query norm, the query weight is the boost
+	scorer.SetQueryNorm(5.0)
+
+	docCount, docFreq := 100.0, 9.0
+	idf := math.Log(1.0 + (docCount-docFreq+0.5)/(docFreq+0.5))
+	// a field of 8 terms, twice the average length
+	norm := float64(float32(1.0 / math.Sqrt(8)))
+	freq, k1, b, fieldLength, avgFieldLength := 3.0, 1.2, 0.75, 8.0, 4.0
+	tfNorm := freq * (k1 + 1.0) / (freq + k1*(1.0-b+b*fieldLength/avgFieldLength))
+
+	ctx := &search.SearchContext{
+		DocumentMatchPool: search.NewDocumentMatchPool(1, 0),
+	}
+	actual := scorer.Score(ctx, &index.TermFieldDoc{
+		ID:   index.IndexInternalID("one"),
+		Freq: 3,
+		Norm: norm,
+	})
+
+	expected := &search.DocumentMatch{
+		IndexInternalID: index.IndexInternalID("one"),
+		Score:           tfNorm * idf * 2.0,
+		Sort:            []string{},
+		Expl: &search.Explanation{
+			Value:   tfNorm * idf * 2.0,
+			Message: "weight(desc:beer^2.000000 in one), product of:",
+			Children: []*search.Explanation{
+				{
+					Value:   2.0,
+					Message: "queryWeight(desc:beer^2.000000), product of:",
+					Children: []*search.Explanation{
+						{
+							Value:   2.0,
+							Message: "boost",
+						},
+					},
+				},
+				{
+					Value:   tfNorm * idf,
+					Message: "fieldWeight(desc:beer in one), product of:",
+					Children: []*search.Explanation{
+						{
+							Value: tfNorm,
+							Message: "tfNorm, computed as (freq * (k1 + 1)) / (freq + k1 * " +
+								"(1 - b + b * fieldLength / avgFieldLength)) from:",
+							Children: []*search.Explanation{
+								{
+									Value:   3,
+									Message: "termFreq(desc:beer)=3",
+								},
+								{
+									Value:   1.2,
+									Message: "k1",
+								},
+								{
+									Value:   0.75,
+									Message: "b",
+								},
+								{
+									Value:   8,
+									Message: "fieldLength(field=desc, doc=one)",
+								},
+								{
+									Value:   4,
+									Message: "avgFieldLength(field=desc)",
+								},
+							},
+						},
+						{
+							Value: idf,
+							Message: "idf(docFreq=9, docCount=100), computed as " +
+								"log(1 + (docCount - docFreq + 0.5) / (docFreq + 0.5))",
+						},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v got %#v", expected, actual)
+	}
+}
+
+func TestBM25WithoutFieldStats(t *testing.T) {
+	similarity, err := NewBM25Similarity(1.2, 0.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scorer := NewTermQueryScorerWithSimilarity([]byte("beer"), "desc", 1.0,
+		search.TermStats{DocCount: 100, DocFreq: 9}, similarity, search.SearcherOptions{})
+	scorer.SetQueryNorm(1.0)
+
+	// without field stats, the length normalization is neutral
+	ctx := &search.SearchContext{
+		DocumentMatchPool: search.NewDocumentMatchPool(1, 0),
+	}
+	actual := scorer.Score(ctx, &index.TermFieldDoc{
+		ID:   index.IndexInternalID("one"),
+		Freq: 1,
+		Norm: 0.5,
+	})
+	docCount, docFreq, k1 := 100.0, 9.0, 1.2
+	idf := math.Log(1.0 + (docCount-docFreq+0.5)/(docFreq+0.5))
+	expected := 1.0 * (k1 + 1.0) / (1.0 + k1) * idf
+	if actual.Score != expected {
+		t.Errorf("expected score %f, got %f", expected, actual.Score)
+	}
+}
+
+func TestSimilarityRegistry(t *testing.T) {
+	cache := registry.NewCache()
+
+	classic, err := cache.SimilarityNamed(ClassicSimilarityName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := classic.(*ClassicSimilarity); !ok {
+		t.Errorf("expected classic similarity, got %T", classic)
+	}
+
+	bm25, err := cache.SimilarityNamed(BM25SimilarityName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bm25, &BM25Similarity{K1: BM25DefaultK1, B: BM25DefaultB}) {
+		t.Errorf("expected default bm25 parameters, got %#v", bm25)
+	}
+
+	tuned, err := cache.DefineSimilarity("tuned", map[string]interface{}{
+		"type": BM25SimilarityName,
+		"k1":   2.0,
+		"b":    0.0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tuned, &BM25Similarity{K1: 2.0, B: 0.0}) {
+		t.Errorf("expected tuned bm25 parameters, got %#v", tuned)
+	}
+
+	_, err = cache.DefineSimilarity("invalid", map[string]interface{}{
+		"type": BM25SimilarityName,
+		"b":    1.5,
+	})
+	if err == nil {
+		t.Errorf("expected error for b out of range")
+	}
+}
@@ -353,6 +353,10 @@ type SearcherOptions struct {
 	Explain            bool
 	IncludeTermVectors bool
 	Score              string
+
+	// Similarity, when set, returns the similarity used to score the
+	// terms of a field, a nil Similarity meaning the default one.
+	Similarity func(field string) Similarity
 }
 
 // SearchContext represents the context around a single search
@@ -0,0 +1,668 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/blevesearch/bleve/geo"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/numeric"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/size"
+)
+
+var reflectStaticSizeFunctionScoreSearcher int
+
+func init() {
+	var fss FunctionScoreSearcher
+	reflectStaticSizeFunctionScoreSearcher = int(reflect.TypeOf(fss).Size())
+}
+
+// FunctionScoreMode is how a FunctionScoreSearcher combines the scores of
+// its functions, and their score with that of the documents.
+type FunctionScoreMode int
+
+const (
+	FunctionScoreMultiply FunctionScoreMode = iota
+	FunctionScoreSum
+	FunctionScoreMax
+	// FunctionScoreReplace replaces the score of the documents by that of
+	// the functions.
+	FunctionScoreReplace
+)
+
+func (m FunctionScoreMode) String() string {
+	switch m {
+	case FunctionScoreMultiply:
+		return "multiply"
+	case FunctionScoreSum:
+		return "sum"
+	case FunctionScoreMax:
+		return "max"
+	case FunctionScoreReplace:
+		return "replace"
+	}
+	return fmt.Sprintf("FunctionScoreMode(%d)", int(m))
+}
+
+func (m FunctionScoreMode) combine(a, b float64) float64 {
+	switch m {
+	case FunctionScoreSum:
+		return a + b
+	case FunctionScoreMax:
+		return math.Max(a, b)
+	case FunctionScoreReplace:
+		return b
+	}
+	return a * b
+}
+
+func (m FunctionScoreMode) explain() string {
+	switch m {
+	case FunctionScoreSum:
+		return "sum of:"
+	case FunctionScoreMax:
+		return "max of:"
+	case FunctionScoreReplace:
+		return "replaced by:"
+	}
+	return "product of:"
+}
+
+// A ScoreFunction scores the documents matched by a FunctionScoreSearcher.
+type ScoreFunction interface {
+	// Score returns the score of the document, or false if the function
+	// doesn't apply to it, such as when it has no value in the field the
+	// function reads.
+	Score(d *search.DocumentMatch) (float64, bool, error)
+
+	// String describes the function in explanations.
+	String() string
+}
+
+// FunctionScoreSearcher wraps any other searcher, combining the scores of
+// the documents it matches with those of the functions, which documents
+// none of them apply to don't change.
+type FunctionScoreSearcher struct {
+	child     search.Searcher
+	functions []ScoreFunction
+	scoreMode FunctionScoreMode
+	boostMode FunctionScoreMode
+	boost     float64
+	options   search.SearcherOptions
+}
+
+// NewFunctionScoreSearcher returns a searcher scoring the documents of
+// the child with the functions, whose scores are combined with each other
+// by scoreMode, and with the score of the child by boostMode.
+func NewFunctionScoreSearcher(child search.Searcher, functions []ScoreFunction,
+	scoreMode, boostMode FunctionScoreMode, boost float64,
+	options search.SearcherOptions) (*FunctionScoreSearcher, error) {
+	if scoreMode == FunctionScoreReplace {
+		return nil, fmt.Errorf("function score mode can't be replace")
+	}
+	return &FunctionScoreSearcher{
+		child:     child,
+		functions: functions,
+		scoreMode: scoreMode,
+		boostMode: boostMode,
+		boost:     boost,
+		options:   options,
+	}, nil
+}
+
+func (s *FunctionScoreSearcher) Size() int {
+	return reflectStaticSizeFunctionScoreSearcher + size.SizeOfPtr +
+		s.child.Size() + len(s.functions)*size.SizeOfPtr
+}
+
+func (s *FunctionScoreSearcher) score(dm *search.DocumentMatch) error {
+	if s.options.Score == "none" {
+		return nil
+	}
+
+	var score float64
+	var applied int
+	var expls []*search.Explanation
+	for _, f := range s.functions {
+		fscore, ok, err := f.Score(dm)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if applied == 0 {
+			score = fscore
+		} else {
+			score = s.scoreMode.combine(score, fscore)
+		}
+		applied++
+		if s.options.Explain {
+			expls = append(expls, &search.Explanation{
+				Value:   fscore,
+				Message: f.String(),
+			})
+		}
+	}
+
+	if applied > 0 {
+		if s.options.Explain {
+			expl := expls[0]
+			if len(expls) > 1 {
+				expl = &search.Explanation{
+					Value:    score,
+					Message:  "functions, " + s.scoreMode.explain(),
+					Children: expls,
+				}
+			}
+			children := []*search.Explanation{dm.Expl, expl}
+			if s.boostMode == FunctionScoreReplace {
+				children = children[1:]
+			}
+			dm.Expl = &search.Explanation{
+				Value:    s.boostMode.combine(dm.Score, score),
+				Message:  "function score, " + s.boostMode.explain(),
+				Children: children,
+			}
+		}
+		dm.Score = s.boostMode.combine(dm.Score, score)
+	}
+
+	if s.boost != 1 {
+		dm.Score *= s.boost
+		if s.options.Explain {
+			dm.Expl = &search.Explanation{
+				Value:   dm.Score,
+				Message: "product of:",
+				Children: []*search.Explanation{
+					dm.Expl,
+					{
+						Value:   s.boost,
+						Message: "boost",
+					},
+				},
+			}
+		}
+	}
+	return nil
+}
+
+func (s *FunctionScoreSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.child.Next(ctx)
+	if err != nil || dm == nil {
+		return nil, err
+	}
+	err = s.score(dm)
+	if err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+func (s *FunctionScoreSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.child.Advance(ctx, ID)
+	if err != nil || dm == nil {
+		return nil, err
+	}
+	err = s.score(dm)
+	if err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+func (s *FunctionScoreSearcher) Close() error {
+	return s.child.Close()
+}
+
+func (s *FunctionScoreSearcher) Weight() float64 {
+	return s.child.Weight()
+}
+
+func (s *FunctionScoreSearcher) SetQueryNorm(n float64) {
+	s.child.SetQueryNorm(n)
+}
+
+func (s *FunctionScoreSearcher) Count() uint64 {
+	return s.child.Count()
+}
+
+func (s *FunctionScoreSearcher) Min() int {
+	return s.child.Min()
+}
+
+func (s *FunctionScoreSearcher) DocumentMatchPoolSize() int {
+	return s.child.DocumentMatchPoolSize()
+}
+
+// docValueInt64s returns the unshifted numeric values of the document,
+// reusing rv.
+func docValueInt64s(dvReader index.DocValueReader, d *search.DocumentMatch,
+	rv []int64) ([]int64, error) {
+	rv = rv[:0]
+	err := dvReader.VisitDocValues(d.IndexInternalID, func(_ string, term []byte) {
+		prefixCoded := numeric.PrefixCoded(term)
+		shift, err := prefixCoded.Shift()
+		if err == nil && shift == 0 {
+			i64, err := prefixCoded.Int64()
+			if err == nil {
+				rv = append(rv, i64)
+			}
+		}
+	})
+	return rv, err
+}
+
+type weightedScoreFunction struct {
+	f      ScoreFunction
+	weight float64
+}
+
+// WeightedScoreFunction returns a ScoreFunction multiplying the scores of
+// f by weight, or always scoring weight if f is nil.
+func WeightedScoreFunction(f ScoreFunction, weight float64) ScoreFunction {
+	return &weightedScoreFunction{
+		f:      f,
+		weight: weight,
+	}
+}
+
+func (w *weightedScoreFunction) Score(d *search.DocumentMatch) (float64, bool, error) {
+	if w.f == nil {
+		return w.weight, true, nil
+	}
+	score, ok, err := w.f.Score(d)
+	return score * w.weight, ok, err
+}
+
+func (w *weightedScoreFunction) String() string {
+	if w.f == nil {
+		return fmt.Sprintf("weight %g", w.weight)
+	}
+	return fmt.Sprintf("weight %g times %s", w.weight, w.f)
+}
+
+var fieldValueModifiers = map[string]func(float64) float64{
+	"":           func(v float64) float64 { return v },
+	"none":       func(v float64) float64 { return v },
+	"log":        math.Log10,
+	"log1p":      func(v float64) float64 { return math.Log10(v + 1) },
+	"log2p":      func(v float64) float64 { return math.Log10(v + 2) },
+	"ln":         math.Log,
+	"ln1p":       math.Log1p,
+	"ln2p":       func(v float64) float64 { return math.Log(v + 2) },
+	"square":     func(v float64) float64 { return v * v },
+	"sqrt":       math.Sqrt,
+	"reciprocal": func(v float64) float64 { return 1 / v },
+}
+
+type fieldValueFactorFunction struct {
+	dvReader index.DocValueReader
+	field    string
+	factor   float64
+	modifier string
+	modify   func(float64) float64
+	missing  *float64
+	vals     []int64
+}
+
+// NewFieldValueFactorFunction returns a ScoreFunction scoring documents
+// by the first numeric value of the field, multiplied by the factor, and
+// modified by one of none, log, log1p, log2p, ln, ln1p, ln2p, square,
+// sqrt or reciprocal. Documents without a value have the missing value,
+// unless it's nil, when the function doesn't apply to them.
+func NewFieldValueFactorFunction(indexReader index.IndexReader, field string,
+	factor float64, modifier string, missing *float64) (ScoreFunction, error) {
+	modify, ok := fieldValueModifiers[modifier]
+	if !ok {
+		return nil, fmt.Errorf("unknown field value modifier: %s", modifier)
+	}
+	dvReader, err := indexReader.DocValueReader([]string{field})
+	if err != nil {
+		return nil, err
+	}
+	return &fieldValueFactorFunction{
+		dvReader: dvReader,
+		field:    field,
+		factor:   factor,
+		modifier: modifier,
+		modify:   modify,
+		missing:  missing,
+	}, nil
+}
+
+func (f *fieldValueFactorFunction) Score(d *search.DocumentMatch) (float64, bool, error) {
+	var err error
+	f.vals, err = docValueInt64s(f.dvReader, d, f.vals)
+	if err != nil {
+		return 0, false, err
+	}
+	var v float64
+	if len(f.vals) > 0 {
+		v = numeric.Int64ToFloat64(f.vals[0])
+	} else if f.missing != nil {
+		v = *f.missing
+	} else {
+		return 0, false, nil
+	}
+	rv := f.modify(v * f.factor)
+	if math.IsNaN(rv) || math.IsInf(rv, 0) {
+		return 0, false, fmt.Errorf("field value factor %s of %s %g gives %g",
+			f.modifier, f.field, v, rv)
+	}
+	return rv, true, nil
+}
+
+func (f *fieldValueFactorFunction) String() string {
+	modifier := f.modifier
+	if modifier == "" {
+		modifier = "none"
+	}
+	return fmt.Sprintf("field value factor, %s(%s * factor %g)", modifier, f.field, f.factor)
+}
+
+// DecayShape is the shape of the curve of a decay function.
+type DecayShape int
+
+const (
+	GaussDecay DecayShape = iota
+	ExpDecay
+	LinearDecay
+)
+
+func (s DecayShape) String() string {
+	switch s {
+	case GaussDecay:
+		return "gauss"
+	case ExpDecay:
+		return "exp"
+	case LinearDecay:
+		return "linear"
+	}
+	return fmt.Sprintf("DecayShape(%d)", int(s))
+}
+
+type decayFunction struct {
+	dvReader index.DocValueReader
+	field    string
+	shape    DecayShape
+	offset   float64
+	param    float64
+	distance func(int64) float64
+	desc     string
+	vals     []int64
+}
+
+// newDecayFunction returns a decay function scoring 1 for documents whose
+// nearest value of the field is within offset of the origin, and decay for
+// those scale further away, measuring the distance of the values with
+// distance.
+func newDecayFunction(indexReader index.IndexReader, field string, shape DecayShape,
+	scale, offset, decay float64, distance func(int64) float64,
+	desc string) (ScoreFunction, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("decay function scale must be positive")
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("decay function offset must not be negative")
+	}
+	if decay <= 0 || decay >= 1 {
+		return nil, fmt.Errorf("decay function decay must be between 0 and 1")
+	}
+	var param float64
+	switch shape {
+	case GaussDecay:
+		// the variance
+		param = -scale * scale / (2 * math.Log(decay))
+	case ExpDecay:
+		param = math.Log(decay) / scale
+	case LinearDecay:
+		param = scale / (1 - decay)
+	default:
+		return nil, fmt.Errorf("unknown decay shape: %v", shape)
+	}
+	dvReader, err := indexReader.DocValueReader([]string{field})
+	if err != nil {
+		return nil, err
+	}
+	return &decayFunction{
+		dvReader: dvReader,
+		field:    field,
+		shape:    shape,
+		offset:   offset,
+		param:    param,
+		distance: distance,
+		desc:     desc,
+	}, nil
+}
+
+// NewNumericDecayFunction returns a ScoreFunction whose scores decay from 1
+// for documents whose numeric field is within offset of the origin to
+// decay for those scale further away, in the shape of the curve. The
+// function doesn't apply to documents without a value.
+func NewNumericDecayFunction(indexReader index.IndexReader, field string,
+	shape DecayShape, origin, scale, offset, decay float64) (ScoreFunction, error) {
+	return newDecayFunction(indexReader, field, shape, scale, offset, decay,
+		func(i64 int64) float64 {
+			return math.Abs(numeric.Int64ToFloat64(i64) - origin)
+		}, fmt.Sprintf("%s decay, %s from %g, scale %g, offset %g, decay %g",
+			shape, field, origin, scale, offset, decay))
+}
+
+// NewDateTimeDecayFunction is NewNumericDecayFunction for a datetime field.
+func NewDateTimeDecayFunction(indexReader index.IndexReader, field string,
+	shape DecayShape, origin time.Time, scale, offset time.Duration,
+	decay float64) (ScoreFunction, error) {
+	originNanos := float64(origin.UnixNano())
+	return newDecayFunction(indexReader, field, shape, float64(scale), float64(offset), decay,
+		func(i64 int64) float64 {
+			return math.Abs(float64(i64) - originNanos)
+		}, fmt.Sprintf("%s decay, %s from %s, scale %s, offset %s, decay %g",
+			shape, field, origin.Format(time.RFC3339), scale, offset, decay))
+}
+
+// NewGeoDecayFunction is NewNumericDecayFunction for a geo point field,
+// with the scale and offset in meters.
+func NewGeoDecayFunction(indexReader index.IndexReader, field string,
+	shape DecayShape, originLon, originLat, scale, offset,
+	decay float64) (ScoreFunction, error) {
+	return newDecayFunction(indexReader, field, shape, scale, offset, decay,
+		func(i64 int64) float64 {
+			lon := geo.MortonUnhashLon(uint64(i64))
+			lat := geo.MortonUnhashLat(uint64(i64))
+			return geo.Haversin(lon, lat, originLon, originLat) * 1000
+		}, fmt.Sprintf("%s decay, %s from %g,%g, scale %gm, offset %gm, decay %g",
+			shape, field, originLon, originLat, scale, offset, decay))
+}
+
+func (f *decayFunction) Score(d *search.DocumentMatch) (float64, bool, error) {
+	var err error
+	f.vals, err = docValueInt64s(f.dvReader, d, f.vals)
+	if err != nil || len(f.vals) == 0 {
+		return 0, false, err
+	}
+	dist := math.Inf(1)
+	for _, v := range f.vals {
+		dist = math.Min(dist, f.distance(v))
+	}
+	dist = math.Max(0, dist-f.offset)
+	switch f.shape {
+	case GaussDecay:
+		return math.Exp(-dist * dist / (2 * f.param)), true, nil
+	case ExpDecay:
+		return math.Exp(f.param * dist), true, nil
+	}
+	return math.Max(0, (f.param-dist)/f.param), true, nil
+}
+
+func (f *decayFunction) String() string {
+	return f.desc
+}
+
+type randomScoreFunction struct {
+	indexReader index.IndexReader
+	seed        int64
+	buf         []byte
+}
+
+// NewRandomScoreFunction returns a ScoreFunction scoring documents
+// between 0 and 1, at random, but the same for the same seed and ID.
+func NewRandomScoreFunction(indexReader index.IndexReader, seed int64) ScoreFunction {
+	return &randomScoreFunction{
+		indexReader: indexReader,
+		seed:        seed,
+	}
+}
+
+func (f *randomScoreFunction) Score(d *search.DocumentMatch) (float64, bool, error) {
+	id, err := f.indexReader.ExternalID(d.IndexInternalID)
+	if err != nil {
+		return 0, false, err
+	}
+	f.buf = f.buf[:0]
+	f.buf = append(f.buf, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(f.buf, uint64(f.seed))
+	f.buf = append(f.buf, id...)
+	h := fnv.New64a()
+	_, _ = h.Write(f.buf)
+	return float64(h.Sum64()>>11) / (1 << 53), true, nil
+}
+
+func (f *randomScoreFunction) String() string {
+	return fmt.Sprintf("random score, seed %d", f.seed)
+}
+
+// A ScoreScript scores a document, given the parameters of the function.
+type ScoreScript func(doc *ScriptDoc, params map[string]interface{}) (float64, error)
+
+// ScriptDoc is the document a ScoreScript scores.
+type ScriptDoc struct {
+	indexReader index.IndexReader
+	dvReaders   map[string]index.DocValueReader
+	d           *search.DocumentMatch
+}
+
+// Score returns the score of the document before the script.
+func (d *ScriptDoc) Score() float64 {
+	return d.d.Score
+}
+
+// ID returns the ID of the document.
+func (d *ScriptDoc) ID() (string, error) {
+	return d.indexReader.ExternalID(d.d.IndexInternalID)
+}
+
+// Terms returns the terms of a field of the document, which must have
+// been indexed with doc values.
+func (d *ScriptDoc) Terms(field string) ([]string, error) {
+	dvReader, err := d.dvReader(field)
+	if err != nil {
+		return nil, err
+	}
+	var rv []string
+	err = dvReader.VisitDocValues(d.d.IndexInternalID, func(_ string, term []byte) {
+		rv = append(rv, string(term))
+	})
+	return rv, err
+}
+
+// Numbers returns the values of a numeric field of the document.
+func (d *ScriptDoc) Numbers(field string) ([]float64, error) {
+	vals, err := d.int64s(field)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		rv = append(rv, numeric.Int64ToFloat64(v))
+	}
+	return rv, nil
+}
+
+// DateTimes returns the values of a datetime field of the document.
+func (d *ScriptDoc) DateTimes(field string) ([]time.Time, error) {
+	vals, err := d.int64s(field)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]time.Time, 0, len(vals))
+	for _, v := range vals {
+		rv = append(rv, time.Unix(0, v))
+	}
+	return rv, nil
+}
+
+func (d *ScriptDoc) int64s(field string) ([]int64, error) {
+	dvReader, err := d.dvReader(field)
+	if err != nil {
+		return nil, err
+	}
+	return docValueInt64s(dvReader, d.d, nil)
+}
+
+func (d *ScriptDoc) dvReader(field string) (index.DocValueReader, error) {
+	if dvReader, ok := d.dvReaders[field]; ok {
+		return dvReader, nil
+	}
+	dvReader, err := d.indexReader.DocValueReader([]string{field})
+	if err != nil {
+		return nil, err
+	}
+	d.dvReaders[field] = dvReader
+	return dvReader, nil
+}
+
+type scriptScoreFunction struct {
+	name   string
+	script ScoreScript
+	params map[string]interface{}
+	doc    ScriptDoc
+}
+
+// NewScriptScoreFunction returns a ScoreFunction scoring documents with
+// the script, named name in explanations.
+func NewScriptScoreFunction(indexReader index.IndexReader, name string,
+	script ScoreScript, params map[string]interface{}) ScoreFunction {
+	return &scriptScoreFunction{
+		name:   name,
+		script: script,
+		params: params,
+		doc: ScriptDoc{
+			indexReader: indexReader,
+			dvReaders:   make(map[string]index.DocValueReader),
+		},
+	}
+}
+
+func (f *scriptScoreFunction) Score(d *search.DocumentMatch) (float64, bool, error) {
+	f.doc.d = d
+	score, err := f.script(&f.doc, f.params)
+	f.doc.d = nil
+	if err != nil {
+		return 0, false, fmt.Errorf("script %s: %v", f.name, err)
+	}
+	return score, true, nil
+}
+
+func (f *scriptScoreFunction) String() string {
+	return fmt.Sprintf("script %s", f.name)
+}
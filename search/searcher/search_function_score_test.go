@@ -0,0 +1,294 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/geo"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/index/store/gtreap"
+	"github.com/blevesearch/bleve/index/upsidedown"
+	"github.com/blevesearch/bleve/search"
+)
+
+var functionScoreOrigin = time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func setupFunctionScore(t *testing.T) index.Index {
+	analysisQueue := index.NewAnalysisQueue(1)
+	i, err := upsidedown.NewUpsideDownCouch(
+		gtreap.Name,
+		map[string]interface{}{
+			"path": "",
+		},
+		analysisQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = i.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(days int) document.Field {
+		f, err := document.NewDateTimeField("date", []uint64{},
+			functionScoreOrigin.Add(time.Duration(days)*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	for _, doc := range []*document.Document{
+		{
+			ID: "a",
+			Fields: []document.Field{
+				document.NewNumericField("likes", []uint64{}, 0),
+				date(0),
+				document.NewGeoPointField("loc", []uint64{}, 0, 0),
+			},
+		},
+		{
+			ID: "b",
+			Fields: []document.Field{
+				document.NewNumericField("likes", []uint64{}, 9),
+				date(-10),
+				document.NewGeoPointField("loc", []uint64{}, 0, 0.1),
+			},
+		},
+		{
+			ID:     "c",
+			Fields: []document.Field{},
+		},
+	} {
+		err = i.Update(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return i
+}
+
+func functionScores(t *testing.T, i index.IndexReader, functions []ScoreFunction,
+	scoreMode, boostMode FunctionScoreMode, options search.SearcherOptions) (
+	map[string]*search.DocumentMatch, error) {
+	child, err := NewMatchAllSearcher(i, 1.0, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFunctionScoreSearcher(child, functions, scoreMode, boostMode, 1.0, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+	ctx := &search.SearchContext{
+		DocumentMatchPool: search.NewDocumentMatchPool(s.DocumentMatchPoolSize(), 0),
+	}
+	rv := make(map[string]*search.DocumentMatch)
+	next, err := s.Next(ctx)
+	for err == nil && next != nil {
+		rv[string(next.IndexInternalID)] = next
+		next, err = s.Next(ctx)
+	}
+	return rv, err
+}
+
+func TestFunctionScoreSearcher(t *testing.T) {
+	i := setupFunctionScore(t)
+	indexReader, err := i.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = indexReader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = i.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	mustFunction := func(f ScoreFunction, err error) ScoreFunction {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	missing := 99.0
+	bDist := geo.Haversin(0, 0.1, 0, 0) * 1000
+
+	tests := []struct {
+		functions []ScoreFunction
+		scoreMode FunctionScoreMode
+		boostMode FunctionScoreMode
+		scores    map[string]float64
+	}{
+		{
+			functions: []ScoreFunction{
+				mustFunction(NewFieldValueFactorFunction(indexReader, "likes", 1, "log1p", nil)),
+			},
+			boostMode: FunctionScoreReplace,
+			// c has no likes, keeping its score
+			scores: map[string]float64{"a": 0, "b": 1, "c": 1},
+		},
+		{
+			functions: []ScoreFunction{
+				mustFunction(NewFieldValueFactorFunction(indexReader, "likes", 2, "", &missing)),
+			},
+			boostMode: FunctionScoreReplace,
+			scores:    map[string]float64{"a": 0, "b": 18, "c": 198},
+		},
+		{
+			functions: []ScoreFunction{
+				mustFunction(NewNumericDecayFunction(indexReader, "likes", GaussDecay, 0, 9, 0, 0.5)),
+			},
+			boostMode: FunctionScoreReplace,
+			scores:    map[string]float64{"a": 1, "b": 0.5, "c": 1},
+		},
+		{
+			functions: []ScoreFunction{
+				mustFunction(NewNumericDecayFunction(indexReader, "likes", LinearDecay, 0, 6, 3, 0.5)),
+			},
+			boostMode: FunctionScoreReplace,
+			scores:    map[string]float64{"a": 1, "b": 0.5, "c": 1},
+		},
+		{
+			functions: []ScoreFunction{
+				mustFunction(NewDateTimeDecayFunction(indexReader, "date", ExpDecay,
+					functionScoreOrigin, 5*24*time.Hour, 0, 0.5)),
+			},
+			boostMode: FunctionScoreReplace,
+			scores:    map[string]float64{"a": 1, "b": 0.25, "c": 1},
+		},
+		{
+			functions: []ScoreFunction{
+				mustFunction(NewGeoDecayFunction(indexReader, "loc", LinearDecay,
+					0, 0, bDist, 0, 0.5)),
+			},
+			boostMode: FunctionScoreReplace,
+			scores:    map[string]float64{"a": 1, "b": 0.5, "c": 1},
+		},
+		{
+			functions: []ScoreFunction{
+				WeightedScoreFunction(nil, 2),
+				WeightedScoreFunction(
+					mustFunction(NewFieldValueFactorFunction(indexReader, "likes", 1, "", nil)), 3),
+			},
+			scoreMode: FunctionScoreSum,
+			boostMode: FunctionScoreSum,
+			scores:    map[string]float64{"a": 3, "b": 30, "c": 3},
+		},
+		{
+			functions: []ScoreFunction{
+				WeightedScoreFunction(nil, 2),
+				mustFunction(NewFieldValueFactorFunction(indexReader, "likes", 1, "", nil)),
+			},
+			scoreMode: FunctionScoreMax,
+			boostMode: FunctionScoreMultiply,
+			scores:    map[string]float64{"a": 2, "b": 9, "c": 2},
+		},
+		{
+			functions: []ScoreFunction{
+				NewScriptScoreFunction(indexReader, "likes plus score",
+					func(doc *ScriptDoc, params map[string]interface{}) (float64, error) {
+						likes, err := doc.Numbers("likes")
+						if err != nil || len(likes) == 0 {
+							return params["default"].(float64), err
+						}
+						return doc.Score() + likes[0], nil
+					}, map[string]interface{}{"default": 5.0}),
+			},
+			boostMode: FunctionScoreReplace,
+			scores:    map[string]float64{"a": 1, "b": 10, "c": 5},
+		},
+	}
+
+	for testIndex, test := range tests {
+		// the match all score of every document is 1
+		dms, err := functionScores(t, indexReader, test.functions,
+			test.scoreMode, test.boostMode, search.SearcherOptions{Explain: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dms) != len(test.scores) {
+			t.Errorf("test %d: expected %d matches, got %d", testIndex, len(test.scores), len(dms))
+		}
+		for id, score := range test.scores {
+			dm := dms[id]
+			if dm == nil {
+				t.Errorf("test %d: expected %s to match", testIndex, id)
+				continue
+			}
+			if math.Abs(dm.Score-score) > 0.001 {
+				t.Errorf("test %d: expected %s to score %f, got %f", testIndex, id, score, dm.Score)
+			}
+			if dm.Expl == nil || math.Abs(dm.Expl.Value-dm.Score) > 1e-9 {
+				t.Errorf("test %d: expected %s explained, got %v", testIndex, id, dm.Expl)
+			}
+		}
+	}
+
+	// random scores are the same for the same seed
+	random := func(seed int64) map[string]float64 {
+		dms, err := functionScores(t, indexReader,
+			[]ScoreFunction{NewRandomScoreFunction(indexReader, seed)},
+			FunctionScoreMultiply, FunctionScoreReplace, search.SearcherOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv := make(map[string]float64)
+		for id, dm := range dms {
+			if dm.Score < 0 || dm.Score >= 1 {
+				t.Errorf("expected a random score between 0 and 1, got %f", dm.Score)
+			}
+			rv[id] = dm.Score
+		}
+		return rv
+	}
+	r1, r2, r3 := random(1), random(1), random(2)
+	for id := range r1 {
+		if r1[id] != r2[id] {
+			t.Errorf("expected the same random score for %s, got %f and %f", id, r1[id], r2[id])
+		}
+		if r1[id] == r3[id] {
+			t.Errorf("expected different random scores for %s with other seeds", id)
+		}
+	}
+
+	// a modifier undefined for a value fails the search
+	_, err = functionScores(t, indexReader, []ScoreFunction{
+		mustFunction(NewFieldValueFactorFunction(indexReader, "likes", 1, "log", nil)),
+	}, FunctionScoreMultiply, FunctionScoreMultiply, search.SearcherOptions{})
+	if err == nil {
+		t.Errorf("expected an error for the log of 0")
+	}
+
+	_, err = NewFieldValueFactorFunction(indexReader, "likes", 1, "cube", nil)
+	if err == nil {
+		t.Errorf("expected an error for an unknown modifier")
+	}
+	_, err = NewNumericDecayFunction(indexReader, "likes", GaussDecay, 0, 1, 0, 1)
+	if err == nil {
+		t.Errorf("expected an error for a decay of 1")
+	}
+}
@@ -36,9 +36,11 @@ type PhraseSearcher struct {
 	queryNorm    float64
 	currMust     *search.DocumentMatch
 	terms        [][]string
+	slop         int
 	path         phrasePath
 	paths        []phrasePath
 	locations    []search.Location
+	minDist      int
 	initialized  bool
 }
 
@@ -72,7 +74,24 @@ func NewPhraseSearcher(indexReader index.IndexReader, terms []string, field stri
 	return NewMultiPhraseSearcher(indexReader, mterms, field, options)
 }
 
+// NewSloppyPhraseSearcher returns a PhraseSearcher matching the terms
+// within slop positions of the exact phrase, summed over the terms, with
+// scores that decay the further the terms are from it.
+func NewSloppyPhraseSearcher(indexReader index.IndexReader, terms []string, field string, slop int, options search.SearcherOptions) (*PhraseSearcher, error) {
+	mterms := make([][]string, len(terms))
+	for i, term := range terms {
+		mterms[i] = []string{term}
+	}
+	return NewSloppyMultiPhraseSearcher(indexReader, mterms, field, slop, options)
+}
+
 func NewMultiPhraseSearcher(indexReader index.IndexReader, terms [][]string, field string, options search.SearcherOptions) (*PhraseSearcher, error) {
+	return NewSloppyMultiPhraseSearcher(indexReader, terms, field, 0, options)
+}
+
+// NewSloppyMultiPhraseSearcher is NewSloppyPhraseSearcher for a phrase
+// whose positions may be satisfied by any of several terms.
+func NewSloppyMultiPhraseSearcher(indexReader index.IndexReader, terms [][]string, field string, slop int, options search.SearcherOptions) (*PhraseSearcher, error) {
 	options.IncludeTermVectors = true
 	var termPositionSearchers []search.Searcher
 	for _, termPos := range terms {
@@ -129,6 +148,7 @@ func NewMultiPhraseSearcher(indexReader index.IndexReader, terms [][]string, fie
 	rv := PhraseSearcher{
 		mustSearcher: mustSearcher,
 		terms:        terms,
+		slop:         slop,
 	}
 	rv.computeQueryNorm()
 	return &rv, nil
@@ -221,6 +241,7 @@ func (s *PhraseSearcher) checkCurrMustMatch(ctx *search.SearchContext) *search.D
 	s.currMust.Locations = nil
 
 	ftls := s.currMust.FieldTermLocations
+	s.minDist = -1
 
 	// typically we would expect there to only actually be results in
 	// one field, but we allow for this to not be the case
@@ -235,6 +256,9 @@ func (s *PhraseSearcher) checkCurrMustMatch(ctx *search.SearchContext) *search.D
 		rv := s.currMust
 		s.currMust = nil
 		rv.FieldTermLocations = ftls
+		if s.minDist > 0 {
+			proximityDecay(rv, s.minDist)
+		}
 		return rv
 	}
 
@@ -252,8 +276,14 @@ func (s *PhraseSearcher) checkCurrMustMatchField(ctx *search.SearchContext,
 	if s.path == nil {
 		s.path = make(phrasePath, 0, len(s.terms))
 	}
-	s.paths = findPhrasePaths(0, nil, s.terms, tlm, s.path[:0], 0, s.paths[:0])
+	s.paths = findPhrasePaths(0, nil, s.terms, tlm, s.path[:0], s.slop, s.paths[:0])
 	for _, p := range s.paths {
+		if s.slop > 0 {
+			dist := phrasePathDistance(s.terms, p)
+			if s.minDist < 0 || dist < s.minDist {
+				s.minDist = dist
+			}
+		}
 		for _, pp := range p {
 			ftls = append(ftls, search.FieldTermLocation{
 				Field: field,
@@ -381,6 +411,51 @@ func findPhrasePaths(prevPos uint64, ap search.ArrayPositions, phraseTerms [][]s
 	return rv
 }
 
+// phrasePathDistance returns the slop used by a path found by
+// findPhrasePaths, the sum of the distances of its parts from where the
+// exact phrase has them.
+func phrasePathDistance(phraseTerms [][]string, p phrasePath) int {
+	var dist int
+	var prevPos uint64
+	for _, car := range phraseTerms {
+		if len(car) == 0 || (len(car) == 1 && car[0] == "") {
+			if prevPos != 0 {
+				prevPos++
+			}
+			continue
+		}
+		if len(p) == 0 {
+			break
+		}
+		if prevPos != 0 {
+			dist += editDistance(prevPos+1, p[0].loc.Pos)
+		}
+		prevPos = p[0].loc.Pos
+		p = p[1:]
+	}
+	return dist
+}
+
+// proximityDecay scales the score of a match whose terms are dist
+// positions from where they'd be matched exactly.
+func proximityDecay(dm *search.DocumentMatch, dist int) {
+	decay := 1.0 / float64(1+dist)
+	dm.Score *= decay
+	if dm.Expl != nil {
+		dm.Expl = &search.Explanation{
+			Value:   dm.Score,
+			Message: "product of:",
+			Children: []*search.Explanation{
+				dm.Expl,
+				{
+					Value:   decay,
+					Message: fmt.Sprintf("proximity decay, distance %d", dist),
+				},
+			},
+		}
+	}
+}
+
 func editDistance(p1, p2 uint64) int {
 	dist := int(p1 - p2)
 	if dist < 0 {
@@ -0,0 +1,689 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/size"
+)
+
+var reflectStaticSizeSpanSearcher int
+
+func init() {
+	var ss SpanSearcher
+	reflectStaticSizeSpanSearcher = int(reflect.TypeOf(ss).Size())
+}
+
+// A SpanClause matches spans of positions in a field, like those of a
+// term, or of other spans near each other. A SpanSearcher matches the
+// documents with spans of its clause, among the term vectors of the
+// field.
+type SpanClause interface {
+	// newSpanMatcher returns a matcher of the clause's spans, and a
+	// searcher of the documents with the term locations it needs, which
+	// are the only ones it can match.
+	newSpanMatcher(indexReader index.IndexReader, field string, boost float64,
+		options search.SearcherOptions) (spanMatcher, search.Searcher, error)
+}
+
+// span is the positions from start up to end, of the values of a field
+// with the array positions, and the term locations matched in them.
+// slop is the number of positions between the locations, beyond those
+// of an exact match.
+type span struct {
+	start, end uint64
+	ap         search.ArrayPositions
+	slop       int
+	parts      phrasePath
+}
+
+type spanMatcher interface {
+	// spans appends the spans matched among the term locations of the
+	// document to rv, in order.
+	spans(ctx *search.SearchContext, id index.IndexInternalID,
+		tlm search.TermLocationMap, rv []span) ([]span, error)
+	documentMatchPoolSize() int
+	close() error
+}
+
+func sortSpans(spans []span) {
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end < spans[j].end
+	})
+}
+
+// spansOverlap returns whether a and b overlap, once a is widened by pre
+// positions before it and post positions after.
+func spansOverlap(a, b span, pre, post int) bool {
+	return a.ap.Equals(b.ap) &&
+		int64(b.end)+int64(pre) > int64(a.start) &&
+		int64(b.start) < int64(a.end)+int64(post)
+}
+
+func closeSearchers(searchers []search.Searcher) {
+	for _, s := range searchers {
+		_ = s.Close()
+	}
+}
+
+// SpanTerm matches the locations of the term.
+func SpanTerm(term string) SpanClause {
+	return spanTerm(term)
+}
+
+type spanTerm string
+
+func (c spanTerm) newSpanMatcher(indexReader index.IndexReader, field string,
+	boost float64, options search.SearcherOptions) (spanMatcher, search.Searcher, error) {
+	ts, err := NewTermSearcher(indexReader, string(c), field, boost, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, ts, nil
+}
+
+func (c spanTerm) spans(ctx *search.SearchContext, id index.IndexInternalID,
+	tlm search.TermLocationMap, rv []span) ([]span, error) {
+	for _, loc := range tlm[string(c)] {
+		rv = append(rv, span{
+			start: loc.Pos,
+			end:   loc.Pos + 1,
+			ap:    loc.ArrayPositions,
+			parts: phrasePath{{term: string(c), loc: loc}},
+		})
+	}
+	sortSpans(rv)
+	return rv, nil
+}
+
+func (c spanTerm) documentMatchPoolSize() int {
+	return 0
+}
+
+func (c spanTerm) close() error {
+	return nil
+}
+
+// SpanOr matches the spans of any of the clauses.
+func SpanOr(clauses ...SpanClause) SpanClause {
+	return spanOr(clauses)
+}
+
+type spanOr []SpanClause
+
+type spanOrMatcher []spanMatcher
+
+func (c spanOr) newSpanMatcher(indexReader index.IndexReader, field string,
+	boost float64, options search.SearcherOptions) (spanMatcher, search.Searcher, error) {
+	matchers, searchers, err := newSpanMatchers(c, indexReader, field, boost, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	ds, err := NewDisjunctionSearcher(indexReader, searchers, 1, options)
+	if err != nil {
+		closeSearchers(searchers)
+		_ = spanOrMatcher(matchers).close()
+		return nil, nil, err
+	}
+	return spanOrMatcher(matchers), ds, nil
+}
+
+func newSpanMatchers(clauses []SpanClause, indexReader index.IndexReader,
+	field string, boost float64, options search.SearcherOptions) (
+	[]spanMatcher, []search.Searcher, error) {
+	if len(clauses) == 0 {
+		return nil, nil, fmt.Errorf("span clauses required")
+	}
+	matchers := make([]spanMatcher, 0, len(clauses))
+	searchers := make([]search.Searcher, 0, len(clauses))
+	for _, clause := range clauses {
+		m, s, err := clause.newSpanMatcher(indexReader, field, boost, options)
+		if err != nil {
+			closeSearchers(searchers)
+			_ = spanOrMatcher(matchers).close()
+			return nil, nil, err
+		}
+		matchers = append(matchers, m)
+		searchers = append(searchers, s)
+	}
+	return matchers, searchers, nil
+}
+
+func (m spanOrMatcher) spans(ctx *search.SearchContext, id index.IndexInternalID,
+	tlm search.TermLocationMap, rv []span) ([]span, error) {
+	n := len(rv)
+	var err error
+	for _, matcher := range m {
+		rv, err = matcher.spans(ctx, id, tlm, rv)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sortSpans(rv[n:])
+	return rv, nil
+}
+
+func (m spanOrMatcher) documentMatchPoolSize() int {
+	var rv int
+	for _, matcher := range m {
+		rv += matcher.documentMatchPoolSize()
+	}
+	return rv
+}
+
+func (m spanOrMatcher) close() error {
+	var err error
+	for _, matcher := range m {
+		if cerr := matcher.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// SpanNear matches spans of all the clauses, with at most slop positions
+// between them, in the order of the clauses if inOrder is true.
+func SpanNear(clauses []SpanClause, slop int, inOrder bool) SpanClause {
+	return &spanNear{clauses: clauses, slop: slop, inOrder: inOrder}
+}
+
+type spanNear struct {
+	clauses []SpanClause
+	slop    int
+	inOrder bool
+}
+
+type spanNearMatcher struct {
+	*spanNear
+	matchers spanOrMatcher
+	lists    [][]span
+	chosen   []span
+}
+
+func (c *spanNear) newSpanMatcher(indexReader index.IndexReader, field string,
+	boost float64, options search.SearcherOptions) (spanMatcher, search.Searcher, error) {
+	matchers, searchers, err := newSpanMatchers(c.clauses, indexReader, field, boost, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, err := NewConjunctionSearcher(indexReader, searchers, options)
+	if err != nil {
+		closeSearchers(searchers)
+		_ = spanOrMatcher(matchers).close()
+		return nil, nil, err
+	}
+	return &spanNearMatcher{
+		spanNear: c,
+		matchers: matchers,
+		lists:    make([][]span, len(matchers)),
+	}, cs, nil
+}
+
+func (m *spanNearMatcher) spans(ctx *search.SearchContext, id index.IndexInternalID,
+	tlm search.TermLocationMap, rv []span) ([]span, error) {
+	maxWidths := make([]int, len(m.lists))
+	for i, matcher := range m.matchers {
+		var err error
+		m.lists[i], err = matcher.spans(ctx, id, tlm, m.lists[i][:0])
+		if err != nil {
+			return nil, err
+		}
+		if len(m.lists[i]) == 0 {
+			return rv, nil
+		}
+		for _, s := range m.lists[i] {
+			if w := int(s.end - s.start); w > maxWidths[i] {
+				maxWidths[i] = w
+			}
+		}
+	}
+	// the widths of the spans yet to be chosen, for pruning
+	remainingWidths := make([]int, len(m.lists)+1)
+	for i := len(m.lists) - 1; i >= 0; i-- {
+		remainingWidths[i] = remainingWidths[i+1] + maxWidths[i]
+	}
+
+	n := len(rv)
+	if m.inOrder {
+		rv = m.inOrderSpans(0, 0, rv)
+	} else {
+		rv = m.unorderedSpans(0, remainingWidths, rv)
+	}
+	return dedupeSpans(rv, n), nil
+}
+
+// inOrderSpans appends the spans of the chosen spans followed by those of
+// the clauses from i on, in order, with used of the slop used between
+// them.
+func (m *spanNearMatcher) inOrderSpans(i int, used int, rv []span) []span {
+	if i == len(m.lists) {
+		return append(rv, m.combine(used))
+	}
+	for _, s := range m.lists[i] {
+		if i > 0 {
+			prev := m.chosen[i-1]
+			if !s.ap.Equals(prev.ap) || s.start < prev.end {
+				continue
+			}
+			gap := int(s.start - prev.end)
+			if used+gap > m.slop {
+				// the spans are in order, so the rest are further
+				break
+			}
+			m.chosen = append(m.chosen[:i], s)
+			rv = m.inOrderSpans(i+1, used+gap, rv)
+			continue
+		}
+		m.chosen = append(m.chosen[:0], s)
+		rv = m.inOrderSpans(i+1, used, rv)
+	}
+	return rv
+}
+
+// unorderedSpans appends the spans of the chosen spans with those of the
+// clauses from i on, in any order without overlapping.
+func (m *spanNearMatcher) unorderedSpans(i int, remainingWidths []int, rv []span) []span {
+	if i == len(m.lists) {
+		start, end, width := m.window()
+		slop := int(end-start) - width
+		if slop > m.slop {
+			return rv
+		}
+		sorted := append([]span(nil), m.chosen...)
+		sortSpans(sorted)
+		rv = append(rv, combineSpans(sorted, slop))
+		return rv
+	}
+OUTER:
+	for _, s := range m.lists[i] {
+		for _, c := range m.chosen[:i] {
+			if !s.ap.Equals(c.ap) || spansOverlap(s, c, 0, 0) {
+				continue OUTER
+			}
+		}
+		m.chosen = append(m.chosen[:i], s)
+		start, end, width := m.window()
+		if int(end-start)-width-remainingWidths[i+1] > m.slop {
+			continue
+		}
+		rv = m.unorderedSpans(i+1, remainingWidths, rv)
+	}
+	return rv
+}
+
+// window returns the extent of the chosen spans, and the sum of their
+// widths.
+func (m *spanNearMatcher) window() (start, end uint64, width int) {
+	for i, s := range m.chosen {
+		if i == 0 || s.start < start {
+			start = s.start
+		}
+		if s.end > end {
+			end = s.end
+		}
+		width += int(s.end - s.start)
+	}
+	return start, end, width
+}
+
+func (m *spanNearMatcher) combine(slop int) span {
+	return combineSpans(m.chosen, slop)
+}
+
+// combineSpans returns the span of the spans, which are in order, with
+// slop positions between them.
+func combineSpans(spans []span, slop int) span {
+	rv := span{
+		start: spans[0].start,
+		end:   spans[0].end,
+		ap:    spans[0].ap,
+		slop:  slop,
+	}
+	for _, s := range spans {
+		if s.end > rv.end {
+			rv.end = s.end
+		}
+		rv.slop += s.slop
+		rv.parts = append(rv.parts, s.parts...)
+	}
+	return rv
+}
+
+// dedupeSpans sorts the spans of rv from n on, keeping the span with
+// the least slop of those with the same positions.
+func dedupeSpans(rv []span, n int) []span {
+	spans := rv[n:]
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		if spans[i].end != spans[j].end {
+			return spans[i].end < spans[j].end
+		}
+		return spans[i].slop < spans[j].slop
+	})
+	out := rv[:n]
+	for i, s := range spans {
+		if i > 0 {
+			prev := out[len(out)-1]
+			if prev.start == s.start && prev.end == s.end && prev.ap.Equals(s.ap) {
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (m *spanNearMatcher) documentMatchPoolSize() int {
+	return m.matchers.documentMatchPoolSize()
+}
+
+func (m *spanNearMatcher) close() error {
+	return m.matchers.close()
+}
+
+// SpanNot matches the spans of include, but not those overlapping spans
+// of exclude, once they're widened by pre positions before them and
+// post positions after.
+func SpanNot(include, exclude SpanClause, pre, post int) SpanClause {
+	return &spanNot{include: include, exclude: exclude, pre: pre, post: post}
+}
+
+type spanNot struct {
+	include, exclude SpanClause
+	pre, post        int
+}
+
+type spanNotMatcher struct {
+	*spanNot
+	field           string
+	include         spanMatcher
+	exclude         spanMatcher
+	excludeSearcher search.Searcher
+	// the exclude searcher's current document, and whether it's done
+	curr      *search.DocumentMatch
+	done      bool
+	locations []search.Location
+	excluded  []span
+}
+
+func (c *spanNot) newSpanMatcher(indexReader index.IndexReader, field string,
+	boost float64, options search.SearcherOptions) (spanMatcher, search.Searcher, error) {
+	include, includeSearcher, err := c.include.newSpanMatcher(indexReader, field, boost, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude, excludeSearcher, err := c.exclude.newSpanMatcher(indexReader, field, boost, options)
+	if err != nil {
+		_ = includeSearcher.Close()
+		_ = include.close()
+		return nil, nil, err
+	}
+	return &spanNotMatcher{
+		spanNot:         c,
+		field:           field,
+		include:         include,
+		exclude:         exclude,
+		excludeSearcher: excludeSearcher,
+	}, includeSearcher, nil
+}
+
+func (m *spanNotMatcher) spans(ctx *search.SearchContext, id index.IndexInternalID,
+	tlm search.TermLocationMap, rv []span) ([]span, error) {
+	n := len(rv)
+	rv, err := m.include.spans(ctx, id, tlm, rv)
+	if err != nil || len(rv) == n {
+		return rv, err
+	}
+
+	// the excluded spans are found among the term locations of the
+	// exclude searcher's match of the document
+	if !m.done && (m.curr == nil || m.curr.IndexInternalID.Compare(id) < 0) {
+		if m.curr != nil {
+			ctx.DocumentMatchPool.Put(m.curr)
+		}
+		m.curr, err = m.excludeSearcher.Advance(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if m.curr == nil {
+			m.done = true
+		} else {
+			m.locations = m.curr.Complete(m.locations)
+		}
+	}
+	if m.curr == nil || !m.curr.IndexInternalID.Equals(id) {
+		return rv, nil
+	}
+	m.excluded, err = m.exclude.spans(ctx, id, m.curr.Locations[m.field], m.excluded[:0])
+	if err != nil {
+		return nil, err
+	}
+
+	out := rv[:n]
+OUTER:
+	for _, s := range rv[n:] {
+		for _, e := range m.excluded {
+			if spansOverlap(s, e, m.pre, m.post) {
+				continue OUTER
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func (m *spanNotMatcher) documentMatchPoolSize() int {
+	return m.include.documentMatchPoolSize() + m.exclude.documentMatchPoolSize() +
+		m.excludeSearcher.DocumentMatchPoolSize() + 1
+}
+
+func (m *spanNotMatcher) close() error {
+	err := m.excludeSearcher.Close()
+	if cerr := m.include.close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if cerr := m.exclude.close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SpanFirst matches the spans of the clause ending within the first end
+// positions of the field.
+func SpanFirst(clause SpanClause, end int) SpanClause {
+	return &spanFirst{clause: clause, end: end}
+}
+
+type spanFirst struct {
+	clause SpanClause
+	end    int
+}
+
+type spanFirstMatcher struct {
+	spanMatcher
+	end uint64
+}
+
+func (c *spanFirst) newSpanMatcher(indexReader index.IndexReader, field string,
+	boost float64, options search.SearcherOptions) (spanMatcher, search.Searcher, error) {
+	m, s, err := c.clause.newSpanMatcher(indexReader, field, boost, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	end := uint64(0)
+	if c.end > 0 {
+		end = uint64(c.end)
+	}
+	return &spanFirstMatcher{spanMatcher: m, end: end}, s, nil
+}
+
+func (m *spanFirstMatcher) spans(ctx *search.SearchContext, id index.IndexInternalID,
+	tlm search.TermLocationMap, rv []span) ([]span, error) {
+	n := len(rv)
+	rv, err := m.spanMatcher.spans(ctx, id, tlm, rv)
+	if err != nil {
+		return nil, err
+	}
+	out := rv[:n]
+	for _, s := range rv[n:] {
+		// positions start at 1
+		if s.end <= m.end+1 {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// SpanSearcher matches the documents with spans of a SpanClause in a
+// field, which must have been indexed with term vectors. The documents
+// are scored like a conjunction, or disjunction, of the clause's terms,
+// decaying with the slop of its closest span, and the term locations of
+// the spans are those of the match.
+type SpanSearcher struct {
+	field      string
+	matcher    spanMatcher
+	candidates search.Searcher
+	locations  []search.Location
+	spans      []span
+}
+
+func NewSpanSearcher(indexReader index.IndexReader, clause SpanClause, field string,
+	boost float64, options search.SearcherOptions) (*SpanSearcher, error) {
+	options.IncludeTermVectors = true
+	matcher, candidates, err := clause.newSpanMatcher(indexReader, field, boost, options)
+	if err != nil {
+		return nil, fmt.Errorf("span searcher error building searchers: %v", err)
+	}
+	return &SpanSearcher{
+		field:      field,
+		matcher:    matcher,
+		candidates: candidates,
+	}, nil
+}
+
+func (s *SpanSearcher) Size() int {
+	sizeInBytes := reflectStaticSizeSpanSearcher + size.SizeOfPtr +
+		len(s.field) + s.candidates.Size()
+	return sizeInBytes
+}
+
+func (s *SpanSearcher) Weight() float64 {
+	return s.candidates.Weight()
+}
+
+func (s *SpanSearcher) SetQueryNorm(qnorm float64) {
+	s.candidates.SetQueryNorm(qnorm)
+}
+
+func (s *SpanSearcher) Next(ctx *search.SearchContext) (*search.DocumentMatch, error) {
+	dm, err := s.candidates.Next(ctx)
+	for err == nil && dm != nil {
+		var ok bool
+		ok, err = s.checkMatch(ctx, dm)
+		if err != nil || ok {
+			break
+		}
+		ctx.DocumentMatchPool.Put(dm)
+		dm, err = s.candidates.Next(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+func (s *SpanSearcher) Advance(ctx *search.SearchContext, ID index.IndexInternalID) (*search.DocumentMatch, error) {
+	dm, err := s.candidates.Advance(ctx, ID)
+	if err != nil || dm == nil {
+		return nil, err
+	}
+	ok, err := s.checkMatch(ctx, dm)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return dm, nil
+	}
+	ctx.DocumentMatchPool.Put(dm)
+	return s.Next(ctx)
+}
+
+// checkMatch returns whether the candidate has spans of the clause, in
+// which case its term locations are replaced by theirs.
+func (s *SpanSearcher) checkMatch(ctx *search.SearchContext, dm *search.DocumentMatch) (bool, error) {
+	s.locations = dm.Complete(s.locations)
+	var err error
+	s.spans, err = s.matcher.spans(ctx, dm.IndexInternalID, dm.Locations[s.field], s.spans[:0])
+	if err != nil || len(s.spans) == 0 {
+		return false, err
+	}
+
+	ftls := dm.FieldTermLocations[:0]
+	minSlop := -1
+	for _, sp := range s.spans {
+		if minSlop < 0 || sp.slop < minSlop {
+			minSlop = sp.slop
+		}
+		for _, pp := range sp.parts {
+			ftls = append(ftls, search.FieldTermLocation{
+				Field: s.field,
+				Term:  pp.term,
+				Location: search.Location{
+					Pos:            pp.loc.Pos,
+					Start:          pp.loc.Start,
+					End:            pp.loc.End,
+					ArrayPositions: pp.loc.ArrayPositions,
+				},
+			})
+		}
+	}
+	dm.Locations = nil
+	dm.FieldTermLocations = ftls
+	if minSlop > 0 {
+		proximityDecay(dm, minSlop)
+	}
+	return true, nil
+}
+
+func (s *SpanSearcher) Count() uint64 {
+	// for now return a worst case
+	return s.candidates.Count()
+}
+
+func (s *SpanSearcher) Close() error {
+	err := s.candidates.Close()
+	if cerr := s.matcher.close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *SpanSearcher) Min() int {
+	return 0
+}
+
+func (s *SpanSearcher) DocumentMatchPoolSize() int {
+	return s.candidates.DocumentMatchPoolSize() + s.matcher.documentMatchPoolSize()
+}
@@ -0,0 +1,295 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/search"
+)
+
+// collectMatches returns the matches of the searcher, completed, with
+// their locations of the field.
+func collectMatches(t *testing.T, s search.Searcher) []*search.DocumentMatch {
+	ctx := &search.SearchContext{
+		DocumentMatchPool: search.NewDocumentMatchPool(s.DocumentMatchPoolSize(), 0),
+	}
+	var rv []*search.DocumentMatch
+	next, err := s.Next(ctx)
+	for err == nil && next != nil {
+		next.Complete(nil)
+		rv = append(rv, next)
+		next, err = s.Next(ctx)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+func matchIDs(matches []*search.DocumentMatch) []string {
+	rv := make([]string, 0, len(matches))
+	for _, dm := range matches {
+		rv = append(rv, string(dm.IndexInternalID))
+	}
+	return rv
+}
+
+func TestSpanSearcher(t *testing.T) {
+	reader, err := twoDocIndex.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	tests := []struct {
+		clause SpanClause
+		ids    []string
+	}{
+		{
+			clause: SpanNear([]SpanClause{SpanTerm("angst"), SpanTerm("couch")}, 1, true),
+			ids:    []string{"2"},
+		},
+		{
+			clause: SpanNear([]SpanClause{SpanTerm("angst"), SpanTerm("couch")}, 0, true),
+		},
+		{
+			clause: SpanNear([]SpanClause{SpanTerm("couch"), SpanTerm("angst")}, 1, true),
+		},
+		{
+			clause: SpanNear([]SpanClause{SpanTerm("couch"), SpanTerm("angst")}, 1, false),
+			ids:    []string{"2"},
+		},
+		{
+			clause: SpanNear([]SpanClause{SpanTerm("beer"), SpanTerm("beer")}, 0, true),
+			ids:    []string{"1", "4"},
+		},
+		{
+			clause: SpanNear([]SpanClause{
+				SpanNear([]SpanClause{SpanTerm("angst"), SpanTerm("beer")}, 0, true),
+				SpanTerm("database"),
+			}, 1, true),
+			ids: []string{"2"},
+		},
+		{
+			clause: SpanOr(SpanTerm("angst"), SpanTerm("apple")),
+			ids:    []string{"2", "3"},
+		},
+		{
+			clause: SpanFirst(SpanTerm("beer"), 1),
+			ids:    []string{"1", "4"},
+		},
+		{
+			clause: SpanFirst(SpanTerm("beer"), 2),
+			ids:    []string{"1", "2", "3", "4"},
+		},
+		{
+			clause: SpanNot(SpanTerm("beer"), SpanTerm("angst"), 1, 0),
+			ids:    []string{"1", "3", "4"},
+		},
+		{
+			clause: SpanNot(SpanTerm("beer"), SpanTerm("angst"), 0, 0),
+			ids:    []string{"1", "2", "3", "4"},
+		},
+		{
+			clause: SpanNot(SpanTerm("beer"), SpanOr(SpanTerm("apple"), SpanTerm("couch")), 1, 0),
+			ids:    []string{"1", "2", "4"},
+		},
+		{
+			clause: SpanNot(SpanTerm("beer"), SpanOr(SpanTerm("apple"), SpanTerm("couch")), 0, 1),
+			ids:    []string{"1", "3", "4"},
+		},
+	}
+
+	for i, test := range tests {
+		s, err := NewSpanSearcher(reader, test.clause, "desc", 1.0, search.SearcherOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := matchIDs(collectMatches(t, s))
+		if len(ids) != 0 || len(test.ids) != 0 {
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("test %d: expected %v, got %v", i, test.ids, ids)
+			}
+		}
+		err = s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSpanSearcherScoreAndLocations(t *testing.T) {
+	reader, err := twoDocIndex.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	options := search.SearcherOptions{Explain: true}
+	exact, err := NewSpanSearcher(reader,
+		SpanNear([]SpanClause{SpanTerm("angst"), SpanTerm("beer")}, 0, true),
+		"desc", 1.0, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near, err := NewSpanSearcher(reader,
+		SpanNear([]SpanClause{SpanTerm("angst"), SpanTerm("couch")}, 3, true),
+		"desc", 1.0, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []search.Searcher{exact, near} {
+		defer func(s search.Searcher) {
+			err := s.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}(s)
+	}
+	var conjunctionScore float64
+	for _, terms := range [][]string{{"angst", "beer"}, {"angst", "couch"}} {
+		var searchers []search.Searcher
+		for _, term := range terms {
+			ts, err := NewTermSearcher(reader, term, "desc", 1.0, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			searchers = append(searchers, ts)
+		}
+		cs, err := NewConjunctionSearcher(reader, searchers, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches := collectMatches(t, cs)
+		if len(matches) != 1 {
+			t.Fatalf("expected 1 match of %v, got %d", terms, len(matches))
+		}
+		if terms[1] == "couch" {
+			conjunctionScore = matches[0].Score
+		}
+		err = cs.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches := collectMatches(t, exact)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 exact match, got %d", len(matches))
+	}
+	matches = collectMatches(t, near)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 near match, got %d", len(matches))
+	}
+	// one position between the terms halves the score
+	if !scoresCloseEnough(matches[0].Score, conjunctionScore/2) {
+		t.Errorf("expected score %f, got %f", conjunctionScore/2, matches[0].Score)
+	}
+	if !scoresCloseEnough(matches[0].Expl.Value, matches[0].Score) {
+		t.Errorf("expected explanation of score %f, got %s", matches[0].Score, matches[0].Expl)
+	}
+	expected := search.FieldTermLocationMap{
+		"desc": search.TermLocationMap{
+			"angst": []*search.Location{{Pos: 1, Start: 0, End: 5}},
+			"couch": []*search.Location{{Pos: 3, Start: 11, End: 16}},
+		},
+	}
+	if !reflect.DeepEqual(matches[0].Locations, expected) {
+		t.Errorf("expected locations %v, got %v", expected, matches[0].Locations)
+	}
+}
+
+func TestSloppyPhraseSearcher(t *testing.T) {
+	reader, err := twoDocIndex.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	options := search.SearcherOptions{Explain: true}
+	tests := []struct {
+		terms []string
+		slop  int
+		ids   []string
+	}{
+		{terms: []string{"angst", "couch"}, slop: 0},
+		{terms: []string{"angst", "couch"}, slop: 1, ids: []string{"2"}},
+		{terms: []string{"couch", "angst"}, slop: 2},
+		{terms: []string{"couch", "angst"}, slop: 3, ids: []string{"2"}},
+		{terms: []string{"angst", "beer"}, slop: 2, ids: []string{"2"}},
+	}
+	for i, test := range tests {
+		s, err := NewSloppyPhraseSearcher(reader, test.terms, "desc", test.slop, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches := collectMatches(t, s)
+		ids := matchIDs(matches)
+		if len(ids) != 0 || len(test.ids) != 0 {
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("test %d: expected %v, got %v", i, test.ids, ids)
+			}
+		}
+		err = s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the score decays with the distance from the exact phrase
+	exact, err := NewSloppyPhraseSearcher(reader, []string{"angst", "beer"}, "desc", 2, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sloppy, err := NewSloppyPhraseSearcher(reader, []string{"beer", "angst"}, "desc", 2, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exactMatches := collectMatches(t, exact)
+	sloppyMatches := collectMatches(t, sloppy)
+	if len(exactMatches) != 1 || len(sloppyMatches) != 1 {
+		t.Fatalf("expected 1 match each, got %d and %d", len(exactMatches), len(sloppyMatches))
+	}
+	if !scoresCloseEnough(sloppyMatches[0].Score, exactMatches[0].Score/3) {
+		t.Errorf("expected score %f, got %f", exactMatches[0].Score/3, sloppyMatches[0].Score)
+	}
+	if !sloppyMatches[0].IndexInternalID.Equals(index.IndexInternalID("2")) {
+		t.Errorf("expected match of doc 2, got %s", sloppyMatches[0].IndexInternalID)
+	}
+	for _, s := range []search.Searcher{exact, sloppy} {
+		err = s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
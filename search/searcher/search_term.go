@@ -57,7 +57,25 @@ func newTermSearcherFromReader(indexReader index.IndexReader, reader index.TermF
 		_ = reader.Close()
 		return nil, err
 	}
-	scorer := scorer.NewTermQueryScorer(term, field, boost, count, reader.Count(), options)
+	stats := search.TermStats{
+		DocCount: count,
+		DocFreq:  reader.Count(),
+	}
+	var similarity search.Similarity
+	if options.Similarity != nil {
+		similarity = options.Similarity(field)
+	}
+	if similarity != nil && similarity.UsesFieldStats() && options.Score != "none" {
+		if fsr, ok := indexReader.(index.IndexReaderFieldStats); ok {
+			fieldStats, err := fsr.FieldStats(field)
+			if err != nil {
+				_ = reader.Close()
+				return nil, err
+			}
+			stats.FieldStats = &fieldStats
+		}
+	}
+	scorer := scorer.NewTermQueryScorerWithSimilarity(term, field, boost, stats, similarity, options)
 	return &TermSearcher{
 		indexReader: indexReader,
 		reader:      reader,
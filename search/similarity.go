@@ -0,0 +1,60 @@
+//  Copyright (c) 2020 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"github.com/blevesearch/bleve/index"
+)
+
+// TermStats are the statistics available to a Similarity when scoring
+// the matches of a term.
+type TermStats struct {
+	Field string
+	Term  string
+
+	// DocCount is the number of documents in the index
+	DocCount uint64
+	// DocFreq is the number of documents containing the term
+	DocFreq uint64
+
+	// FieldStats are only provided to the similarities which use them,
+	// and when the index supports them, see index.IndexReaderFieldStats
+	FieldStats *index.FieldStats
+}
+
+// A Similarity scores the matches of a term in a field. The score of a
+// match is the product of the query weight of the term, of its idf and
+// of the term frequency factors of the matching document.
+type Similarity interface {
+	// UsesFieldStats reports whether the similarity wants the field
+	// statistics to be provided in the TermStats.
+	UsesFieldStats() bool
+
+	// IDF returns the inverse document frequency of the term, and its
+	// explanation if explain is true.
+	IDF(stats *TermStats, explain bool) (float64, *Explanation)
+
+	// QueryWeight returns the weight of a term of the query, given its
+	// boost, its idf and the query normalization factor, along with the
+	// explanations of the factors if explain is true.
+	QueryWeight(boost, idf, queryNorm float64, idfExpl *Explanation,
+		explain bool) (float64, []*Explanation)
+
+	// TF returns the term frequency factor of a matching document, along
+	// with the explanations of what it is computed from if explain is
+	// true.
+	TF(stats *TermStats, match *index.TermFieldDoc,
+		explain bool) (float64, []*Explanation)
+}
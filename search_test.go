@@ -17,7 +17,9 @@ package bleve
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -41,6 +43,7 @@ import (
 	"github.com/blevesearch/bleve/search/highlight/highlighter/ansi"
 	"github.com/blevesearch/bleve/search/highlight/highlighter/html"
 	"github.com/blevesearch/bleve/search/query"
+	"github.com/blevesearch/bleve/search/searcher"
 )
 
 func TestSearchResultString(t *testing.T) {
@@ -1809,3 +1812,285 @@ func TestAnalyzerInheritance(t *testing.T) {
 		})
 	}
 }
+
+func TestSloppyPhraseAndSpanSearch(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idx, err := NewUsing(tmpIndexPath, NewIndexMapping(), scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	docs := map[string]string{
+		"a": "light beer from the tap",
+		"b": "light and hoppy beer",
+		"c": "beer light",
+	}
+	for id, desc := range docs {
+		if err = idx.Index(id, map[string]interface{}{"desc": desc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	light := NewSpanTermQuery("light")
+	light.SetField("desc")
+	beer := NewSpanTermQuery("beer")
+	beer.SetField("desc")
+
+	tests := []struct {
+		q   query.Query
+		ids []string
+	}{
+		{q: NewQueryStringQuery(`desc:"light beer"`), ids: []string{"a"}},
+		{q: NewQueryStringQuery(`desc:"light beer"~1`), ids: []string{"a"}},
+		// Swapping the terms takes a slop of 2.
+		{q: NewQueryStringQuery(`desc:"light beer"~2`), ids: []string{"a", "b", "c"}},
+		{q: NewSpanNearQuery([]query.SpanQuery{light, beer}, 2, true), ids: []string{"a", "b"}},
+		{q: NewSpanNearQuery([]query.SpanQuery{light, beer}, 0, false), ids: []string{"a", "c"}},
+		{q: NewSpanFirstQuery(beer, 1), ids: []string{"c"}},
+	}
+	for i, test := range tests {
+		res, err := idx.Search(NewSearchRequest(test.q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.ID)
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("test %d: expected hits %v, got %v", i, test.ids, ids)
+		}
+	}
+
+	// Nearer matches score higher.
+	res, err := idx.Search(NewSearchRequest(NewQueryStringQuery(`desc:"light beer"~2`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 3 || res.Hits[0].ID != "a" {
+		t.Errorf("expected the exact phrase to score highest, got %v", res.Hits)
+	}
+}
+
+func TestFunctionScoreSearch(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idxMapping := NewIndexMapping()
+	idxMapping.DefaultMapping.AddFieldMappingsAt("loc", NewGeoPointFieldMapping())
+
+	idx, err := NewUsing(tmpIndexPath, idxMapping, scorch.Name, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	docs := map[string]map[string]interface{}{
+		"a": {
+			"desc":  "beer",
+			"likes": 99,
+			"date":  "2020-06-01T00:00:00Z",
+			"loc":   map[string]interface{}{"lon": 0, "lat": 0},
+		},
+		"b": {
+			"desc":  "beer",
+			"likes": 9,
+			"date":  "2020-05-25T00:00:00Z",
+			"loc":   map[string]interface{}{"lon": 10, "lat": 10},
+		},
+		"c": {
+			"desc": "beer",
+		},
+	}
+	for id, doc := range docs {
+		if err = idx.Index(id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query.RegisterScoreScript("TestFunctionScoreSearch",
+		func(doc *searcher.ScriptDoc, params map[string]interface{}) (float64, error) {
+			id, err := doc.ID()
+			return params[id].(float64), err
+		})
+
+	tests := []struct {
+		q      string
+		scores map[string]float64
+	}{
+		{
+			q:      `{"function_score":{"match":"beer","field":"desc"},"functions":[{"field_value_factor":{"field":"likes","modifier":"log1p"}}],"boost_mode":"replace"}`,
+			scores: map[string]float64{"a": 2, "b": 1},
+		},
+		{
+			q:      `{"function_score":{"match":"beer","field":"desc"},"functions":[{"exp":{"field":"date","origin":"2020-06-01T00:00:00Z","scale":"7d","decay":0.25}}],"boost_mode":"replace"}`,
+			scores: map[string]float64{"a": 1, "b": 0.25},
+		},
+		{
+			q:      `{"function_score":{"match":"beer","field":"desc"},"functions":[{"linear":{"field":"loc","origin":{"lon":0,"lat":0},"scale":"3000km"}}],"boost_mode":"replace"}`,
+			scores: map[string]float64{"a": 1, "b": 0.74},
+		},
+		{
+			q:      `{"function_score":{"match":"beer","field":"desc"},"functions":[{"script":{"name":"TestFunctionScoreSearch","params":{"a":1,"b":2,"c":3}}},{"weight":2}],"score_mode":"sum","boost_mode":"replace"}`,
+			scores: map[string]float64{"a": 3, "b": 4, "c": 5},
+		},
+	}
+	for i, test := range tests {
+		q, err := query.ParseQuery([]byte(test.q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := NewSearchRequest(q)
+		req.Explain = true
+		res, err := idx.Search(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var scored int
+		for _, hit := range res.Hits {
+			score, ok := test.scores[hit.ID]
+			if !ok {
+				continue
+			}
+			scored++
+			if math.Abs(hit.Score-score) > 0.01 {
+				t.Errorf("test %d: expected %s to score %f, got %f", i, hit.ID, score, hit.Score)
+			}
+		}
+		if scored != len(test.scores) {
+			t.Errorf("test %d: expected hits %v, got %v", i, test.scores, res.Hits)
+		}
+	}
+}
+
+func TestBM25SimilarityUpsidedown(t *testing.T) {
+	testBM25Similarity(t, upsidedown.Name)
+}
+
+func TestBM25SimilarityScorch(t *testing.T) {
+	testBM25Similarity(t, scorch.Name)
+}
+
+func testBM25Similarity(t *testing.T, indexName string) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	idxMapping := NewIndexMapping()
+	bodyMapping := NewTextFieldMapping()
+	bodyMapping.Similarity = "bm25"
+	idxMapping.DefaultMapping.AddFieldMappingsAt("body", bodyMapping)
+
+	idx, err := NewUsing(tmpIndexPath, idxMapping, indexName, Config.DefaultKVStore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	docs := map[string]map[string]interface{}{
+		"a": {
+			"body":  "beer",
+			"title": "beer",
+		},
+		"b": {
+			"body":  "beer beer ale ale",
+			"title": "ale",
+		},
+		"c": {
+			"title": "wine",
+		},
+	}
+	for id, doc := range docs {
+		if err = idx.Index(id, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 3 docs, 2 with beer in the body, whose average length is 2.5
+	idf := math.Log(1.0 + (3.0-2.0+0.5)/(2.0+0.5))
+	k1, b, avgFieldLength := 1.2, 0.75, 2.5
+	bm25 := func(freq, fieldLength float64) float64 {
+		return freq * (k1 + 1) / (freq + k1*(1-b+b*fieldLength/avgFieldLength)) * idf
+	}
+	expectedScores := map[string]float64{
+		"a": bm25(1, 1),
+		"b": bm25(2, 4),
+	}
+
+	q := NewTermQuery("beer")
+	q.SetField("body")
+	req := NewSearchRequest(q)
+	req.Explain = true
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != len(expectedScores) {
+		t.Fatalf("expected %d hits, got %d", len(expectedScores), len(res.Hits))
+	}
+	for _, hit := range res.Hits {
+		if math.Abs(hit.Score-expectedScores[hit.ID]) > 1e-9 {
+			t.Errorf("expected bm25 score %f for %s, got %f", expectedScores[hit.ID], hit.ID, hit.Score)
+		}
+		if !strings.HasPrefix(hit.Expl.Children[0].Message, "tfNorm") {
+			t.Errorf("expected a bm25 explanation for %s, got %s", hit.ID, hit.Expl)
+		}
+	}
+
+	// the title is not mapped to bm25, it keeps the classic scoring
+	q = NewTermQuery("beer")
+	q.SetField("title")
+	req = NewSearchRequest(q)
+	req.Explain = true
+	res, err = idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(res.Hits))
+	}
+	if !strings.HasPrefix(res.Hits[0].Expl.Children[0].Message, "tf(") {
+		t.Errorf("expected a classic explanation, got %s", res.Hits[0].Expl)
+	}
+}
+
+// plainIndexMapping is an index mapping which doesn't choose similarities.
+type plainIndexMapping struct {
+	mapping.IndexMapping
+}
+
+func TestSimilarityForFieldWithoutSimilarityMapping(t *testing.T) {
+	idxMapping := NewIndexMapping()
+	bodyMapping := NewTextFieldMapping()
+	bodyMapping.Similarity = "bm25"
+	idxMapping.DefaultMapping.AddFieldMappingsAt("body", bodyMapping)
+
+	similarity := similarityForField(idxMapping)
+	if similarity == nil || similarity("body") == nil {
+		t.Errorf("expected the mapped similarity for body")
+	}
+
+	if similarity := similarityForField(plainIndexMapping{idxMapping}); similarity != nil {
+		t.Errorf("expected the default similarity")
+	}
+}